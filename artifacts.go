@@ -0,0 +1,189 @@
+package duct
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// collectArtifacts copies the CollectArtifacts of the containers out of them.
+// Failures are logged, as the artifacts may be missing when the launch
+// failed.
+func (c *Composer) collectArtifacts(ctx context.Context) {
+	for _, cont := range c.manifest {
+		if cont.External || cont.id == "" {
+			continue
+		}
+
+		for path, dir := range cont.CollectArtifacts {
+			if cont.replicaOf != "" {
+				dir = filepath.Join(dir, cont.Name)
+			}
+
+			c.logContainer(LogInfo, cont.Name, "Collecting artifacts from container: [%s] %s to %s", cont.Name, path, dir)
+			if err := c.collect(ctx, cont, path, dir); err != nil {
+				c.logContainer(LogWarn, cont.Name, "WARNING: Failed to collect artifacts from [%s] %s: %v", cont.Name, path, err)
+			}
+		}
+	}
+}
+
+// collect copies the file or directory at path in the container into dir.
+func (c *Composer) collect(ctx context.Context, cont *Container, path, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	pr, pw := io.Pipe()
+	errc := make(chan error, 1)
+	go func() {
+		err := c.ArchivePath(ctx, cont.Name, path, pw)
+		pw.CloseWithError(err)
+		errc <- err
+	}()
+
+	err := untar(pr, dir)
+	pr.CloseWithError(err)
+
+	if archiveErr := <-errc; archiveErr != nil {
+		return archiveErr
+	}
+
+	return err
+}
+
+// untar extracts the regular files, directories and symlinks of the archive
+// into dir. Entries which would land outside of it, directly or through a
+// symlink, and symlinks which point outside of it are an error.
+func untar(r io.Reader, dir string) error {
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(r)
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		target := filepath.Join(root, filepath.FromSlash(hdr.Name))
+		if !within(root, target) {
+			return fmt.Errorf("archive entry %q is outside of %s", hdr.Name, dir)
+		} else if target == root {
+			continue
+		}
+
+		// the symlinks extracted before the entry may lead anywhere, so it is
+		// created where they resolve to
+		parent, err := realPath(root, filepath.Dir(target))
+		if err != nil {
+			return fmt.Errorf("archive entry %q: %w", hdr.Name, err)
+		}
+		target = filepath.Join(parent, filepath.Base(target))
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			target, err = realPath(root, target)
+			if err != nil {
+				return fmt.Errorf("archive entry %q: %w", hdr.Name, err)
+			}
+
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(parent, 0755); err != nil {
+				return err
+			}
+
+			// a file replaces a symlink, instead of being written through it
+			if fi, err := os.Lstat(target); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+				os.Remove(target)
+			}
+
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(hdr.Mode).Perm()|0600)
+			if err != nil {
+				return err
+			}
+
+			_, err = io.Copy(f, tr)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.MkdirAll(parent, 0755); err != nil {
+				return err
+			}
+
+			link := filepath.FromSlash(hdr.Linkname)
+			if filepath.IsAbs(link) || !within(root, filepath.Join(parent, link)) {
+				return fmt.Errorf("archive entry %q links to %q, outside of %s", hdr.Name, hdr.Linkname, dir)
+			}
+
+			os.Remove(target)
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// within reports whether path is root or lies under it. Both are compared as
+// they are, without resolving symlinks.
+func within(root, path string) bool {
+	root = filepath.Clean(root)
+	path = filepath.Clean(path)
+
+	return path == root || strings.HasPrefix(path, root+string(filepath.Separator))
+}
+
+// realPath returns path, which is under root, with the symlinks extracted
+// before it resolved, as far as it exists. It is an error for it to resolve to
+// outside of root.
+func realPath(root, path string) (string, error) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return "", err
+	}
+
+	real := root
+	parts := strings.Split(rel, string(filepath.Separator))
+
+	for i, part := range parts {
+		if part == "." {
+			continue
+		}
+
+		next := filepath.Join(real, part)
+		if _, err := os.Lstat(next); errors.Is(err, os.ErrNotExist) {
+			// the rest is created by the extraction, without symlinks
+			return filepath.Join(append([]string{real}, parts[i:]...)...), nil
+		} else if err != nil {
+			return "", err
+		}
+
+		real, err = filepath.EvalSymlinks(next)
+		if err != nil {
+			return "", err
+		}
+
+		if !within(root, real) {
+			return "", fmt.Errorf("%s resolves to %s, outside of %s", next, real, root)
+		}
+	}
+
+	return real, nil
+}
@@ -0,0 +1,94 @@
+package duct
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUntar(t *testing.T) {
+	archive := func(names ...string) *bytes.Buffer {
+		buf := &bytes.Buffer{}
+		tw := tar.NewWriter(buf)
+		for _, name := range names {
+			tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Size: 5, Mode: 0644})
+			tw.Write([]byte("hello"))
+		}
+		tw.Close()
+		return buf
+	}
+
+	dir := t.TempDir()
+	if err := untar(archive("cover/unit.out", "cover/integration.out"), dir); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, "cover", "integration.out"))
+	if err != nil || string(content) != "hello" {
+		t.Fatalf("unexpected content %q: %v", content, err)
+	}
+
+	if err := untar(archive("../escape"), dir); err == nil {
+		t.Fatal("extracted an entry outside of the directory")
+	}
+
+	outside := t.TempDir()
+	malicious := []struct {
+		name    string
+		entries []tar.Header
+	}{
+		{"absolute link", []tar.Header{
+			{Typeflag: tar.TypeSymlink, Name: "out", Linkname: outside},
+		}},
+		{"relative link", []tar.Header{
+			{Typeflag: tar.TypeSymlink, Name: "cover/out", Linkname: "../../" + filepath.Base(outside)},
+		}},
+		{"link through a link", []tar.Header{
+			{Typeflag: tar.TypeSymlink, Name: "here", Linkname: "."},
+			{Typeflag: tar.TypeSymlink, Name: "here/out", Linkname: ".."},
+		}},
+		{"directory through a link", []tar.Header{
+			{Typeflag: tar.TypeSymlink, Name: "b", Linkname: "."},
+			{Typeflag: tar.TypeSymlink, Name: "a", Linkname: "b/.."},
+			{Typeflag: tar.TypeDir, Name: "a/" + filepath.Base(outside) + "/made", Mode: 0755},
+		}},
+		{"file through a link", []tar.Header{
+			{Typeflag: tar.TypeSymlink, Name: "b", Linkname: "."},
+			{Typeflag: tar.TypeSymlink, Name: "a", Linkname: "b/.."},
+			{Typeflag: tar.TypeReg, Name: "a/" + filepath.Base(outside) + "/escape", Mode: 0644},
+		}},
+	}
+
+	for _, test := range malicious {
+		buf := &bytes.Buffer{}
+		tw := tar.NewWriter(buf)
+		for _, hdr := range test.entries {
+			hdr := hdr
+			tw.WriteHeader(&hdr)
+		}
+		tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "out/escape", Size: 5, Mode: 0644})
+		tw.Write([]byte("hello"))
+		tw.Close()
+
+		if err := untar(buf, t.TempDir()); err == nil {
+			t.Fatalf("%s: extracted an archive with a symlink outside of the directory", test.name)
+		}
+
+		if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+			t.Fatalf("%s: wrote through a symlink outside of the directory", test.name)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	tw.WriteHeader(&tar.Header{Typeflag: tar.TypeSymlink, Name: "latest", Linkname: "cover"})
+	tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "latest/unit.out", Size: 5, Mode: 0644})
+	tw.Write([]byte("hello"))
+	tw.Close()
+
+	if err := untar(buf, dir); err != nil {
+		t.Fatalf("a symlink within the directory was rejected: %v", err)
+	}
+}
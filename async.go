@@ -0,0 +1,95 @@
+package duct
+
+import (
+	"context"
+	"fmt"
+)
+
+// LaunchHandle follows a launch started with LaunchAsync.
+type LaunchHandle struct {
+	done  chan struct{}
+	err   error
+	ready map[string]chan struct{}
+}
+
+// LaunchAsync launches the manifest like Launch, but in the background, so
+// that the test can do its own setup meanwhile. Use the handle to wait for
+// the launch, or for the containers it needs.
+func (c *Composer) LaunchAsync(ctx context.Context) *LaunchHandle {
+	h := &LaunchHandle{
+		done:  make(chan struct{}),
+		ready: map[string]chan struct{}{},
+	}
+
+	ready := map[*Container]chan struct{}{}
+	for _, cont := range c.manifest {
+		ready[cont] = make(chan struct{})
+		h.ready[cont.Name] = ready[cont]
+	}
+
+	go func() {
+		h.err = c.launch(ctx, ready)
+		close(h.done)
+	}()
+
+	return h
+}
+
+// Wait waits for the launch to finish and returns its error.
+func (h *LaunchHandle) Wait() error {
+	<-h.done
+	return h.err
+}
+
+// Done is closed when the launch is finished.
+func (h *LaunchHandle) Done() <-chan struct{} {
+	return h.done
+}
+
+// Err returns the error of the launch, or nil if it succeeded or has not
+// finished yet.
+func (h *LaunchHandle) Err() error {
+	select {
+	case <-h.done:
+		return h.err
+	default:
+		return nil
+	}
+}
+
+// Ready returns a channel which is closed when the named container is ready,
+// i.e. started and past its readiness checks and PostCommands. Replicas are
+// named as in Composer.Replicas. If the launch fails before then, it is never
+// closed, so select on Done as well. It returns nil for names not in the
+// manifest.
+func (h *LaunchHandle) Ready(name string) <-chan struct{} {
+	ch, ok := h.ready[name]
+	if !ok {
+		return nil
+	}
+
+	return ch
+}
+
+// WaitFor waits for the named containers to be ready, and returns the error
+// of the launch if it fails first.
+func (h *LaunchHandle) WaitFor(ctx context.Context, names ...string) error {
+	for _, name := range names {
+		ch := h.Ready(name)
+		if ch == nil {
+			return fmt.Errorf("container [%s] is not in the manifest", name)
+		}
+
+		select {
+		case <-ch:
+		case <-h.done:
+			if h.err != nil {
+				return h.err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+package duct_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/erikh/duct"
+	"github.com/erikh/duct/ductfake"
+)
+
+func TestLaunchAsync(t *testing.T) {
+	r := ductfake.Start(t)
+
+	c := r.Compose(t, duct.Manifest{
+		{Name: "db", Image: "postgres:latest"},
+		{Name: "web", Image: "nginx:latest", BootWait: 500 * time.Millisecond},
+	})
+
+	h := c.LaunchAsync(context.Background())
+
+	if err := h.WaitFor(context.Background(), "db"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-h.Ready("web"):
+		t.Fatal("[web] was ready before its boot wait")
+	case <-h.Done():
+		t.Fatal("launch finished before [web] was ready")
+	default:
+	}
+
+	if err := h.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-h.Ready("web"):
+	default:
+		t.Fatal("[web] is not ready after the launch")
+	}
+
+	if h.Ready("missing") != nil {
+		t.Fatal("ready channel for a missing container")
+	}
+}
@@ -0,0 +1,76 @@
+package duct
+
+import (
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+// dockerHubAuthKey is the key of Docker Hub in docker's configuration.
+const dockerHubAuthKey = "https://index.docker.io/v1/"
+
+// WithRegistryAuth sets the credentials to pull images with for each
+// registry, e.g. "docker.io", "ghcr.io" or "registry.corp:5000". Images
+// without a registry are from "docker.io". Credentials may carry an
+// IdentityToken or RegistryToken in place of a password. A container's Auth
+// overrides these.
+func WithRegistryAuth(auths map[string]dc.AuthConfiguration) Options {
+	return Options{optionRegistryAuth: auths}
+}
+
+// WithDockerConfigAuth pulls images from registries without credentials
+// given with WithRegistryAuth with those of the docker CLI's configuration,
+// in $DOCKER_CONFIG or ~/.docker: those of its credential helpers, and then
+// those stored in it, like `docker pull` would.
+func WithDockerConfigAuth() Options {
+	return Options{optionDockerConfigAuth: true}
+}
+
+// auth returns the credentials to pull the image of the container with. cont
+// may be nil for images duct uses itself.
+func (c *Composer) auth(cont *Container, image string) dc.AuthConfiguration {
+	if cont != nil && cont.Auth != nil {
+		return *cont.Auth
+	}
+
+	registry := imageRegistry(image)
+
+	auths, _ := c.options[optionRegistryAuth].(map[string]dc.AuthConfiguration)
+	if auth, ok := auths[registry]; ok {
+		return auth
+	}
+
+	if c.options[optionDockerConfigAuth] == nil {
+		return dc.AuthConfiguration{}
+	}
+
+	key := registry
+	if registry == "docker.io" {
+		key = dockerHubAuthKey
+	}
+
+	auth, err := dc.NewAuthConfigurationsFromCredsHelpers(key)
+	if err == nil {
+		// helpers return identity tokens with this user name
+		if auth.Username == "<token>" {
+			auth.Username = ""
+			auth.IdentityToken, auth.Password = auth.Password, ""
+		}
+
+		auth.ServerAddress = key
+		return *auth
+	}
+	c.logf(LogDebug, "No credential helper for registry %s: %v", registry, err)
+
+	configs, err := dc.NewAuthConfigurationsFromDockerCfg()
+	if err != nil {
+		c.logf(LogDebug, "No docker configuration for registry %s: %v", registry, err)
+		return dc.AuthConfiguration{}
+	}
+
+	for _, k := range []string{key, "https://" + key, "http://" + key} {
+		if auth, ok := configs.Configs[k]; ok {
+			return auth
+		}
+	}
+
+	return dc.AuthConfiguration{}
+}
@@ -0,0 +1,51 @@
+package duct
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+func TestAuth(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("DOCKER_CONFIG", dir)
+
+	config := `{"auths": {
+		"https://index.docker.io/v1/": {"auth": "` + base64.StdEncoding.EncodeToString([]byte("hub:secret")) + `"},
+		"registry.corp:5000": {"auth": "` + base64.StdEncoding.EncodeToString([]byte("corp:secret")) + `"}
+	}}`
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ghcr := dc.AuthConfiguration{Username: "gh", IdentityToken: "token"}
+	own := &dc.AuthConfiguration{Username: "own"}
+
+	c := New(Manifest{}, WithRegistryAuth(map[string]dc.AuthConfiguration{"ghcr.io": ghcr}))
+	if auth := c.auth(nil, "ghcr.io/org/app:1.0"); auth != ghcr {
+		t.Fatalf("unexpected auth for ghcr.io: %+v", auth)
+	}
+
+	if auth := c.auth(&Container{Auth: own}, "ghcr.io/org/app:1.0"); auth != *own {
+		t.Fatalf("auth of the container was not used: %+v", auth)
+	}
+
+	if auth := c.auth(nil, "postgres:15"); auth != (dc.AuthConfiguration{}) {
+		t.Fatalf("docker configuration was used without WithDockerConfigAuth: %+v", auth)
+	}
+
+	c = New(Manifest{}, WithRegistryAuth(map[string]dc.AuthConfiguration{"ghcr.io": ghcr}), WithDockerConfigAuth())
+	for image, user := range map[string]string{
+		"postgres:15":               "hub",
+		"registry.corp:5000/app:1":  "corp",
+		"ghcr.io/org/app:1.0":       "gh",
+		"quay.io/coreos/etcd:3.5.0": "",
+	} {
+		if auth := c.auth(nil, image); auth.Username != user {
+			t.Errorf("%s: expected user %q, got %+v", image, user, auth)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package duct
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+// Available returns an error describing why duct cannot talk to a docker
+// daemon, or nil if it can: the daemon must answer and support at least the
+// API version duct needs.
+func Available(ctx context.Context) error {
+	client, err := newClient("")
+	if err != nil {
+		return err
+	}
+
+	if err := pingClient(ctx, client); err != nil {
+		return fmt.Errorf("docker daemon at [%s] is not answering: %w", client.Endpoint(), err)
+	}
+
+	_, err = negotiateAPIVersion(ctx, client)
+	return err
+}
+
+// SkipIfUnavailable skips the test if docker is not Available, for test
+// suites that should pass on machines without it.
+func SkipIfUnavailable(t testing.TB) {
+	t.Helper()
+
+	if err := Available(context.Background()); err != nil {
+		t.Skipf("docker is not available: %v", err)
+	}
+}
@@ -0,0 +1,28 @@
+package duct
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAvailable(t *testing.T) {
+	t.Setenv("DOCKER_HOST", "unix://"+filepath.Join(fakeDaemon(t, "1.41"), "docker.sock"))
+
+	if err := Available(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("DOCKER_HOST", "unix://"+filepath.Join(fakeDaemon(t, "1.12"), "docker.sock"))
+
+	if err := Available(context.Background()); err == nil || !strings.Contains(err.Error(), minAPIVersion) {
+		t.Fatalf("old daemon was available: %v", err)
+	}
+
+	t.Setenv("DOCKER_HOST", "unix://"+filepath.Join(t.TempDir(), "missing.sock"))
+
+	if err := Available(context.Background()); err == nil {
+		t.Fatal("missing daemon was available")
+	}
+}
@@ -1,9 +1,11 @@
 package duct
 
 import (
+	"bytes"
 	"context"
-	"log"
+	"fmt"
 	"os"
+	"strings"
 
 	dc "github.com/fsouza/go-dockerclient"
 )
@@ -17,27 +19,35 @@ type Build struct {
 	Context string
 }
 
+// dir is the context directory of the build.
+func (b Build) dir() string {
+	if b.Context == "" {
+		return "."
+	}
+
+	return b.Context
+}
+
 // Builder is a named collection of builds.
 type Builder map[string]Build
 
 // Run runs the builds. It logs them to stderr similarly to `docker build`.
 func (bc Builder) Run(ctx context.Context) error {
-	client, err := dc.NewClientFromEnv()
+	client, err := newClient("")
 	if err != nil {
 		return err
 	}
 
-	for name, build := range bc {
-		dir := build.Context
-		if dir == "" {
-			dir = "."
-		}
+	if err := pingClient(ctx, client); err != nil {
+		return err
+	}
 
-		log.Printf("Building image: [%s]", name)
+	for name, build := range bc {
+		logPrintf("Building image: [%s]", name)
 		err := client.BuildImage(dc.BuildImageOptions{
 			Context:      ctx,
 			Name:         name,
-			ContextDir:   dir,
+			ContextDir:   build.dir(),
 			Dockerfile:   build.Dockerfile,
 			OutputStream: os.Stderr,
 		})
@@ -49,3 +59,63 @@ func (bc Builder) Run(ctx context.Context) error {
 
 	return nil
 }
+
+// imageBuild is a build of an image by the composition, which the containers
+// with the image share.
+type imageBuild struct {
+	done chan struct{}
+	err  error
+}
+
+// resetBuilds forgets the images built by the last launch.
+func (c *Composer) resetBuilds() {
+	c.mu.Lock()
+	c.builds = nil
+	c.mu.Unlock()
+}
+
+// buildImage builds the image from the build, once per launch unless force
+// is set; replicas share the build.
+func (c *Composer) buildImage(ctx context.Context, image string, build Build, force bool) error {
+	c.mu.Lock()
+	if c.builds == nil {
+		c.builds = map[string]*imageBuild{}
+	}
+
+	b, ok := c.builds[image]
+	if ok && !force {
+		c.mu.Unlock()
+
+		select {
+		case <-b.done:
+			return b.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	b = &imageBuild{done: make(chan struct{})}
+	c.builds[image] = b
+	c.mu.Unlock()
+
+	defer close(b.done)
+
+	c.logf(LogInfo, "Building image: [%s] from %s", image, build.dir())
+
+	output := &bytes.Buffer{}
+	b.err = c.client.BuildImage(dc.BuildImageOptions{
+		Context:      ctx,
+		Name:         image,
+		ContextDir:   build.dir(),
+		Dockerfile:   build.Dockerfile,
+		OutputStream: output,
+	})
+
+	c.logf(LogDebug, "Build output of image [%s]:\n%s", image, output)
+
+	if b.err != nil {
+		b.err = fmt.Errorf("building image [%s]: %w\n%s", image, b.err, strings.TrimSpace(output.String()))
+	}
+
+	return b.err
+}
@@ -0,0 +1,149 @@
+// Package chaos degrades the network of the containers of a duct composition,
+// to test how the services in it handle timeouts and retries. Rules are
+// applied with tc and netem, from a helper container which joins the network
+// namespace of the target (see duct.Composer.NetAdmin); the target image does
+// not need any tools. Single routes between containers are degraded through a
+// proxy container instead; see ProxyContainer.
+package chaos
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/erikh/duct"
+)
+
+// HelperImage is the image of the helper container which runs tc; see
+// duct.Composer.NetAdmin.
+const HelperImage = duct.NetAdminImage
+
+// Device is the network interface of the containers the rules apply to. It
+// is the interface of the composition's network when that is the only one.
+const Device = "eth0"
+
+// Chaos applies network rules to the containers of a launched composition.
+// The rules of a container combine, e.g. Delay and Loss together; they last
+// until Clear, or until the container is removed at Teardown.
+type Chaos struct {
+	c *duct.Composer
+
+	mu    sync.Mutex
+	rules map[string]*netem
+}
+
+// netem is the netem settings of a container.
+type netem struct {
+	delay  time.Duration
+	jitter time.Duration
+	loss   float64
+	rate   int
+}
+
+// New returns a Chaos for the launched composition.
+func New(c *duct.Composer) *Chaos {
+	return &Chaos{c: c, rules: map[string]*netem{}}
+}
+
+// Delay delays the packets the named container sends by d.
+func (ch *Chaos) Delay(ctx context.Context, name string, d time.Duration) error {
+	return ch.apply(ctx, name, func(n *netem) { n.delay, n.jitter = d, 0 })
+}
+
+// Jitter delays the packets the named container sends by d, give or take
+// jitter, at random.
+func (ch *Chaos) Jitter(ctx context.Context, name string, d, jitter time.Duration) error {
+	return ch.apply(ctx, name, func(n *netem) { n.delay, n.jitter = d, jitter })
+}
+
+// Loss drops percent of the packets the named container sends, at random.
+func (ch *Chaos) Loss(ctx context.Context, name string, percent float64) error {
+	if percent < 0 || percent > 100 {
+		return fmt.Errorf("loss of %v%% is not a percentage", percent)
+	}
+
+	return ch.apply(ctx, name, func(n *netem) { n.loss = percent })
+}
+
+// Bandwidth limits the rate the named container sends at, in bits per
+// second.
+func (ch *Chaos) Bandwidth(ctx context.Context, name string, bitsPerSecond int) error {
+	if bitsPerSecond <= 0 {
+		return fmt.Errorf("bandwidth of %d bits per second is not positive", bitsPerSecond)
+	}
+
+	return ch.apply(ctx, name, func(n *netem) { n.rate = bitsPerSecond })
+}
+
+// Clear removes the rules of the named container.
+func (ch *Chaos) Clear(ctx context.Context, name string) error {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	for _, replica := range ch.c.Replicas(name) {
+		if _, ok := ch.rules[replica]; !ok {
+			continue
+		}
+
+		if err := ch.tc(ctx, replica, "qdisc", "del", "dev", Device, "root"); err != nil {
+			return err
+		}
+
+		delete(ch.rules, replica)
+	}
+
+	return nil
+}
+
+// apply changes the rules of the named container, or of each of its
+// replicas.
+func (ch *Chaos) apply(ctx context.Context, name string, change func(*netem)) error {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	for _, replica := range ch.c.Replicas(name) {
+		n := netem{}
+		if rules, ok := ch.rules[replica]; ok {
+			n = *rules
+		}
+		change(&n)
+
+		args := append([]string{"qdisc", "replace", "dev", Device, "root"}, n.args()...)
+		if err := ch.tc(ctx, replica, args...); err != nil {
+			return err
+		}
+
+		ch.rules[replica] = &n
+	}
+
+	return nil
+}
+
+// args returns the arguments of tc for the settings.
+func (n netem) args() []string {
+	args := []string{"netem"}
+
+	if n.delay != 0 {
+		args = append(args, "delay", fmt.Sprintf("%dus", n.delay.Microseconds()))
+		if n.jitter != 0 {
+			args = append(args, fmt.Sprintf("%dus", n.jitter.Microseconds()))
+		}
+	}
+
+	if n.loss != 0 {
+		args = append(args, "loss", fmt.Sprintf("%g%%", n.loss))
+	}
+
+	if n.rate != 0 {
+		args = append(args, "rate", fmt.Sprintf("%dbit", n.rate))
+	}
+
+	return args
+}
+
+// tc runs tc with the arguments in the network namespace of the named
+// container.
+func (ch *Chaos) tc(ctx context.Context, name string, args ...string) error {
+	return ch.c.NetAdmin(ctx, name, append([]string{"tc"}, args...)...)
+}
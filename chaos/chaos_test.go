@@ -0,0 +1,24 @@
+package chaos
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNetemArgs(t *testing.T) {
+	table := []struct {
+		netem    netem
+		expected []string
+	}{
+		{netem{delay: 200 * time.Millisecond}, []string{"netem", "delay", "200000us"}},
+		{netem{delay: time.Second, jitter: 100 * time.Millisecond, loss: 12.5}, []string{"netem", "delay", "1000000us", "100000us", "loss", "12.5%"}},
+		{netem{rate: 1000000}, []string{"netem", "rate", "1000000bit"}},
+	}
+
+	for _, test := range table {
+		if args := test.netem.args(); !reflect.DeepEqual(args, test.expected) {
+			t.Fatalf("unexpected args for %+v: %v", test.netem, args)
+		}
+	}
+}
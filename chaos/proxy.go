@@ -0,0 +1,316 @@
+package chaos
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/erikh/duct"
+)
+
+// ProxyImage is the image of the proxy container, which runs toxiproxy.
+const ProxyImage = "ghcr.io/shopify/toxiproxy:2.9.0"
+
+const proxyAPIPort = 8474
+
+// Route is a TCP route through the proxy: connections to Listen on the proxy
+// are forwarded to Upstream, the host:port address of another container on
+// the network, e.g. "db:5432".
+type Route struct {
+	Name     string
+	Listen   int
+	Upstream string
+}
+
+// ProxyContainer returns a container named name which proxies the routes.
+// Containers go through a route by connecting to the proxy, e.g. to
+// "proxy:15432" instead of "db:5432"; the Listen ports are forwarded too, so
+// the test can go through them with Proxy.Endpoint. Use NewProxy to degrade
+// the routes once it is launched.
+func ProxyContainer(name string, routes ...Route) *duct.Container {
+	ports := []duct.PortForward{{ContainerPort: proxyAPIPort}}
+	for _, route := range routes {
+		ports = append(ports, duct.PortForward{ContainerPort: route.Listen})
+	}
+
+	return &duct.Container{
+		Name:    name,
+		Image:   ProxyImage,
+		Command: []string{"-host=0.0.0.0", "-config=/etc/toxiproxy.json"},
+		Files: map[string]duct.FileContent{
+			"/etc/toxiproxy.json": {Content: proxyConfig(routes)},
+		},
+		Ports: ports,
+		ReadyFunc: func(ctx context.Context, info *duct.ContainerInfo) error {
+			addr, err := info.Endpoint(proxyAPIPort)
+			if err != nil {
+				return err
+			}
+
+			p := &Proxy{base: "http://" + addr, client: http.DefaultClient}
+			return duct.Retry(ctx, 100*time.Millisecond, 0, func() error {
+				return p.api(ctx, http.MethodGet, "/version", nil)
+			})
+		},
+	}
+}
+
+// proxyConfig returns the configuration of toxiproxy for the routes.
+func proxyConfig(routes []Route) []byte {
+	type proxy struct {
+		Name     string `json:"name"`
+		Listen   string `json:"listen"`
+		Upstream string `json:"upstream"`
+		Enabled  bool   `json:"enabled"`
+	}
+
+	proxies := []proxy{}
+	for _, route := range routes {
+		proxies = append(proxies, proxy{
+			Name:     route.Name,
+			Listen:   fmt.Sprintf("0.0.0.0:%d", route.Listen),
+			Upstream: route.Upstream,
+			Enabled:  true,
+		})
+	}
+
+	content, _ := json.Marshal(proxies)
+	return content
+}
+
+// Proxy degrades the routes of a launched proxy container. Unlike the rules
+// of Chaos, its toxics apply to single routes rather than all the traffic of
+// a container, and they are applied by the proxy rather than the kernel.
+// They last until Clear or Reset.
+type Proxy struct {
+	c      *duct.Composer
+	name   string
+	base   string
+	client *http.Client
+	routes map[string]Route
+}
+
+// NewProxy returns the Proxy of the named proxy container, which was created
+// by ProxyContainer.
+func NewProxy(c *duct.Composer, name string) (*Proxy, error) {
+	base, err := c.BaseURL(name, proxyAPIPort)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Proxy{c: c, name: name, base: base, client: &http.Client{Timeout: 10 * time.Second}, routes: map[string]Route{}}
+
+	var proxies map[string]struct {
+		Name     string
+		Listen   string
+		Upstream string
+	}
+
+	if err := p.api(context.Background(), http.MethodGet, "/proxies", &proxies); err != nil {
+		return nil, err
+	}
+
+	for _, proxy := range proxies {
+		_, port, err := net.SplitHostPort(proxy.Listen)
+		if err != nil {
+			return nil, err
+		}
+
+		listen, err := strconv.Atoi(port)
+		if err != nil {
+			return nil, err
+		}
+
+		p.routes[proxy.Name] = Route{Name: proxy.Name, Listen: listen, Upstream: proxy.Upstream}
+	}
+
+	return p, nil
+}
+
+// Endpoint returns the host:port address the test reaches the upstream of
+// the route at: through the proxy if proxied is set, or directly, at the
+// forwarded port of the upstream container, otherwise.
+func (p *Proxy) Endpoint(route string, proxied bool) (string, error) {
+	r, err := p.route(route)
+	if err != nil {
+		return "", err
+	}
+
+	if proxied {
+		return p.c.Endpoint(p.name, r.Listen)
+	}
+
+	host, port, err := net.SplitHostPort(r.Upstream)
+	if err != nil {
+		return "", err
+	}
+
+	containerPort, err := strconv.Atoi(port)
+	if err != nil {
+		return "", err
+	}
+
+	return p.c.Endpoint(host, containerPort)
+}
+
+// Latency delays the data the upstream of the route sends by d, give or
+// take jitter, at random.
+func (p *Proxy) Latency(ctx context.Context, route string, d, jitter time.Duration) error {
+	return p.toxic(ctx, route, "latency", map[string]int64{"latency": d.Milliseconds(), "jitter": jitter.Milliseconds()})
+}
+
+// Bandwidth limits the rate the upstream of the route sends at, in bits per
+// second, like Chaos.Bandwidth. The proxy limits it in kilobytes per
+// second, rounded up.
+func (p *Proxy) Bandwidth(ctx context.Context, route string, bitsPerSecond int) error {
+	if bitsPerSecond <= 0 {
+		return fmt.Errorf("bandwidth of %d bits per second is not positive", bitsPerSecond)
+	}
+
+	return p.toxic(ctx, route, "bandwidth", map[string]int64{"rate": (int64(bitsPerSecond) + 7999) / 8000})
+}
+
+// Stall stops forwarding the data of the route without closing the
+// connections, and closes them after d if it is not zero, like a peer that
+// stopped answering.
+func (p *Proxy) Stall(ctx context.Context, route string, d time.Duration) error {
+	return p.toxic(ctx, route, "timeout", map[string]int64{"timeout": d.Milliseconds()})
+}
+
+// Cut closes the connections of the route and refuses new ones, until
+// Restore.
+func (p *Proxy) Cut(ctx context.Context, route string) error {
+	return p.setEnabled(ctx, route, false)
+}
+
+// Restore accepts connections on the route again after Cut.
+func (p *Proxy) Restore(ctx context.Context, route string) error {
+	return p.setEnabled(ctx, route, true)
+}
+
+// Clear removes the toxics of the route.
+func (p *Proxy) Clear(ctx context.Context, route string) error {
+	if _, err := p.route(route); err != nil {
+		return err
+	}
+
+	var toxics []struct{ Name string }
+	if err := p.api(ctx, http.MethodGet, "/proxies/"+url.PathEscape(route)+"/toxics", &toxics); err != nil {
+		return err
+	}
+
+	for _, toxic := range toxics {
+		if err := p.api(ctx, http.MethodDelete, "/proxies/"+url.PathEscape(route)+"/toxics/"+url.PathEscape(toxic.Name), nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Reset removes the toxics of all routes, and restores those which were
+// cut.
+func (p *Proxy) Reset(ctx context.Context) error {
+	return p.api(ctx, http.MethodPost, "/reset", nil)
+}
+
+func (p *Proxy) route(name string) (Route, error) {
+	r, ok := p.routes[name]
+	if !ok {
+		return Route{}, fmt.Errorf("[%s] has no route %q", p.name, name)
+	}
+
+	return r, nil
+}
+
+func (p *Proxy) setEnabled(ctx context.Context, route string, enabled bool) error {
+	if _, err := p.route(route); err != nil {
+		return err
+	}
+
+	return p.call(ctx, http.MethodPost, "/proxies/"+url.PathEscape(route), map[string]bool{"enabled": enabled}, nil)
+}
+
+// toxic replaces the toxic of the type on the route, which is named after
+// the type.
+func (p *Proxy) toxic(ctx context.Context, route, typ string, attributes map[string]int64) error {
+	if _, err := p.route(route); err != nil {
+		return err
+	}
+
+	path := "/proxies/" + url.PathEscape(route) + "/toxics"
+
+	if err := p.api(ctx, http.MethodDelete, path+"/"+typ, nil); err != nil && !isNotFound(err) {
+		return err
+	}
+
+	return p.call(ctx, http.MethodPost, path, map[string]interface{}{
+		"name":       typ,
+		"type":       typ,
+		"stream":     "downstream",
+		"toxicity":   1,
+		"attributes": attributes,
+	}, nil)
+}
+
+// apiError is an error answered by the API of toxiproxy.
+type apiError struct {
+	method, path string
+	status       int
+	msg          string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("toxiproxy: %s %s: %d %s", e.method, e.path, e.status, e.msg)
+}
+
+func isNotFound(err error) bool {
+	e, ok := err.(*apiError)
+	return ok && e.status == http.StatusNotFound
+}
+
+func (p *Proxy) api(ctx context.Context, method, path string, res interface{}) error {
+	return p.call(ctx, method, path, nil, res)
+}
+
+// call calls the API of toxiproxy with the JSON of body, if it is not nil,
+// decoding the response into res if it is not nil.
+func (p *Proxy) call(ctx context.Context, method, path string, body, res interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(content)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, p.base+path, reader)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &apiError{method: method, path: path, status: resp.StatusCode, msg: string(bytes.TrimSpace(msg))}
+	}
+
+	if res == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(res)
+}
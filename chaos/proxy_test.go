@@ -0,0 +1,173 @@
+package chaos
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/erikh/duct"
+	"github.com/erikh/duct/ductfake"
+)
+
+func TestProxyConfig(t *testing.T) {
+	var config []map[string]interface{}
+	if err := json.Unmarshal(proxyConfig([]Route{{Name: "db", Listen: 15432, Upstream: "db:5432"}}), &config); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []map[string]interface{}{{"name": "db", "listen": "0.0.0.0:15432", "upstream": "db:5432", "enabled": true}}
+	if !reflect.DeepEqual(config, expected) {
+		t.Fatalf("unexpected config: %v", config)
+	}
+}
+
+// fakeToxiproxy records the calls made to the API of toxiproxy.
+type fakeToxiproxy struct {
+	mu     sync.Mutex
+	calls  []string
+	toxics map[string]bool
+}
+
+func (f *fakeToxiproxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	body := map[string]interface{}{}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	call := r.Method + " " + r.URL.Path
+	if attributes, ok := body["attributes"]; ok {
+		content, _ := json.Marshal(attributes)
+		call += " " + string(content)
+	} else if enabled, ok := body["enabled"]; ok {
+		content, _ := json.Marshal(enabled)
+		call += " " + string(content)
+	}
+	f.calls = append(f.calls, call)
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/proxies/db/toxics":
+		toxics := []map[string]string{}
+		for name := range f.toxics {
+			toxics = append(toxics, map[string]string{"name": name})
+		}
+		json.NewEncoder(w).Encode(toxics)
+	case r.Method == http.MethodPost && r.URL.Path == "/proxies/db/toxics":
+		f.toxics[body["name"].(string)] = true
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/proxies/db/toxics/"):
+		name := strings.TrimPrefix(r.URL.Path, "/proxies/db/toxics/")
+		if !f.toxics[name] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(f.toxics, name)
+	}
+}
+
+func TestProxyToxics(t *testing.T) {
+	fake := &fakeToxiproxy{toxics: map[string]bool{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	p := &Proxy{name: "proxy", base: server.URL, client: http.DefaultClient, routes: map[string]Route{"db": {Name: "db", Listen: 15432, Upstream: "db:5432"}}}
+	ctx := context.Background()
+
+	if err := p.Latency(ctx, "db", 200*time.Millisecond, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Latency(ctx, "db", 300*time.Millisecond, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Bandwidth(ctx, "db", 1000000); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Cut(ctx, "db"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Restore(ctx, "db"); err != nil {
+		t.Fatal(err)
+	}
+
+	fake.calls = nil
+	if err := p.Clear(ctx, "db"); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.toxics) != 0 || len(fake.calls) != 3 {
+		t.Fatalf("toxics were not cleared: %v %v", fake.toxics, fake.calls)
+	}
+
+	if err := p.Stall(ctx, "cache", 0); err == nil || !strings.Contains(err.Error(), `no route "cache"`) {
+		t.Fatalf("unexpected error for an unknown route: %v", err)
+	}
+}
+
+func TestProxyToxicCalls(t *testing.T) {
+	fake := &fakeToxiproxy{toxics: map[string]bool{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	p := &Proxy{name: "proxy", base: server.URL, client: http.DefaultClient, routes: map[string]Route{"db": {Name: "db", Listen: 15432, Upstream: "db:5432"}}}
+	ctx := context.Background()
+
+	if err := p.Latency(ctx, "db", 200*time.Millisecond, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Bandwidth(ctx, "db", 1000000); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Cut(ctx, "db"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"DELETE /proxies/db/toxics/latency",
+		`POST /proxies/db/toxics {"jitter":50,"latency":200}`,
+		"DELETE /proxies/db/toxics/bandwidth",
+		`POST /proxies/db/toxics {"rate":125}`,
+		"POST /proxies/db false",
+	}
+
+	if !reflect.DeepEqual(fake.calls, expected) {
+		t.Fatalf("unexpected calls: %v", fake.calls)
+	}
+}
+
+func TestProxyEndpoint(t *testing.T) {
+	r, err := ductfake.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	proxy := ProxyContainer("proxy", Route{Name: "db", Listen: 15432, Upstream: "db:5432"})
+	// the fake daemon does not allocate host ports, nor run toxiproxy
+	proxy.Ports[0].HostPort = 40000
+	proxy.Ports[1].HostPort = 40001
+	proxy.ReadyFunc = nil
+
+	db := &duct.Container{Name: "db", Image: "postgres:16", Ports: []duct.PortForward{{ContainerPort: 5432, HostPort: 40002}}}
+
+	c := duct.New(duct.Manifest{db, proxy}, duct.WithNewNetwork("duct-test-network"), r.Options())
+	if err := c.Launch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Teardown(context.Background())
+
+	p := &Proxy{c: c, name: "proxy", routes: map[string]Route{"db": {Name: "db", Listen: 15432, Upstream: "db:5432"}}}
+
+	for proxied, expected := range map[bool]string{true: "127.0.0.1:40001", false: "127.0.0.1:40002"} {
+		addr, err := p.Endpoint("db", proxied)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if addr != expected {
+			t.Fatalf("unexpected endpoint with proxied %v: %s", proxied, addr)
+		}
+	}
+}
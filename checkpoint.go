@@ -0,0 +1,161 @@
+package duct
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+// Checkpoint saves the state of the processes of the named container with
+// CRIU, as the checkpoint id, and leaves it running. RestoreFrom returns the
+// container to that state, e.g. a JVM service after its warmup, which is much
+// quicker than starting it again.
+//
+// Checkpoints require a daemon with experimental features enabled and CRIU
+// installed, on Linux.
+func (c *Composer) Checkpoint(ctx context.Context, name, id string) error {
+	cont, err := c.find(name)
+	if err != nil {
+		return err
+	}
+
+	c.logContainer(LogInfo, name, "Checkpointing container: [%s] as %s", name, id)
+
+	return c.apiPost(ctx, "/containers/"+cont.id+"/checkpoints", nil, map[string]interface{}{
+		"CheckpointID": id,
+		"Exit":         false,
+	})
+}
+
+// RestoreFrom stops the named container, and starts it again from the
+// checkpoint id made with Checkpoint. It then waits for the container to be
+// ready like Launch does. The exit is not reported by the crash monitor.
+func (c *Composer) RestoreFrom(ctx context.Context, name, id string) error {
+	cont, err := c.find(name)
+	if err != nil {
+		return err
+	}
+
+	c.logContainer(LogInfo, name, "Restoring container: [%s] from %s", name, id)
+
+	c.expectExit(cont.id, true)
+
+	err = c.client.KillContainer(dc.KillContainerOptions{
+		ID:      cont.id,
+		Signal:  dc.SIGKILL,
+		Context: ctx,
+	})
+	if err != nil {
+		// there is no exit to ignore
+		c.expectExit(cont.id, false)
+
+		var notRunning *dc.ContainerNotRunning
+		if !errors.As(err, &notRunning) {
+			return err
+		}
+	}
+
+	if _, err := c.client.WaitContainerWithContext(cont.id, ctx); err != nil {
+		return err
+	}
+
+	// the old follower's output ended with the exit
+	c.unfollow(cont)
+
+	// the output from before the checkpoint is not replayed
+	c.mu.Lock()
+	cont.started = time.Now()
+	c.mu.Unlock()
+
+	if err := c.apiPost(ctx, "/containers/"+cont.id+"/start", url.Values{"checkpoint": {id}}, nil); err != nil {
+		return err
+	}
+
+	if c.options[optionLogStream] != nil {
+		c.follow(cont)
+	}
+
+	return c.waitReady(ctx, cont)
+}
+
+// apiPost makes a request to the docker API which the client has no method
+// for, with the body encoded as JSON if it is not nil.
+func (c *Composer) apiPost(ctx context.Context, path string, query url.Values, body interface{}) error {
+	content := []byte{}
+	if body != nil {
+		var err error
+		content, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+
+	u, err := apiURL(c.client, path)
+	if err != nil {
+		return err
+	}
+
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(resp.Body)
+
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(msg, &apiErr) == nil && apiErr.Message != "" {
+			msg = []byte(apiErr.Message)
+		}
+
+		return fmt.Errorf("docker API: POST %s: %s: %s", path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	return nil
+}
+
+// apiURL returns the URL of the API path on the daemon of the client.
+func apiURL(client *dc.Client, path string) (string, error) {
+	u, err := url.Parse(client.Endpoint())
+	if err != nil {
+		return "", err
+	}
+
+	switch u.Scheme {
+	case "unix", "npipe":
+		// the client's transport dials the socket; the host is not used.
+		return "http://unix.sock" + path, nil
+	case "tcp":
+		u.Scheme = "http"
+		if client.TLSConfig != nil {
+			u.Scheme = "https"
+		}
+	}
+
+	return strings.TrimRight(u.String(), "/") + path, nil
+}
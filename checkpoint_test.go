@@ -0,0 +1,113 @@
+package duct
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+func TestAPIURL(t *testing.T) {
+	table := map[string]string{
+		"unix:///var/run/docker.sock":  "http://unix.sock/containers/x/checkpoints",
+		"tcp://10.0.0.1:2375":          "http://10.0.0.1:2375/containers/x/checkpoints",
+		"http://docker.example.com:80": "http://docker.example.com:80/containers/x/checkpoints",
+	}
+
+	for endpoint, expected := range table {
+		client, err := dc.NewClient(endpoint)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		u, err := apiURL(client, "/containers/x/checkpoints")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if u != expected {
+			t.Fatalf("unexpected URL for %s: %s", endpoint, u)
+		}
+	}
+}
+
+func TestExpectExit(t *testing.T) {
+	c := New(Manifest{})
+	if c.expectedExit("id") {
+		t.Fatal("exit was expected without expectExit")
+	}
+
+	c.expectExit("id", true)
+	c.expectExit("id", true)
+	c.expectExit("id", false)
+	if !c.expectedExit("id") || c.expectedExit("id") {
+		t.Fatal("expected exits were not counted")
+	}
+}
+
+func TestRestoreFromSince(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		since []int64
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/wait"):
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"StatusCode":0}`))
+		case strings.HasSuffix(r.URL.Path, "/logs"):
+			n, _ := strconv.ParseInt(r.URL.Query().Get("since"), 10, 64)
+			mu.Lock()
+			since = append(since, n)
+			mu.Unlock()
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	client, err := dc.NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cont := &Container{Name: "jvm", Image: "openjdk", id: "jvm-id", started: time.Now().Add(-time.Hour)}
+	c := New(Manifest{cont}, WithClient(client), WithLogStream(io.Discard))
+	c.client = client
+
+	restored := time.Now().Unix()
+	if err := c.RestoreFrom(context.Background(), "jvm", "warm"); err != nil {
+		t.Fatal(err)
+	}
+	defer c.stopFollowers()
+
+	err = Retry(context.Background(), 10*time.Millisecond, time.Second, func() error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if len(since) == 0 {
+			return errors.New("the restored container was not followed")
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if since[0] < restored {
+		t.Fatalf("output from before the checkpoint is replayed: since %d, restored at %d", since[0], restored)
+	}
+}
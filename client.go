@@ -0,0 +1,524 @@
+package duct
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+// WithDockerContext talks to the daemon of the named docker context (see
+// `docker context ls`) instead of the one selected by DOCKER_HOST,
+// DOCKER_CONTEXT or `docker context use`.
+func WithDockerContext(name string) Options {
+	return Options{optionDockerContext: name}
+}
+
+// WithClient talks to the daemon with the client, instead of one selected
+// from the environment. See the ductfake package for a fake daemon to use
+// with it.
+func WithClient(client *dc.Client) Options {
+	return Options{optionClient: client}
+}
+
+// newClient returns a client for the daemon selected by the options, which
+// makes its requests with the API version negotiated by Launch.
+func (c *Composer) newClient() (*dc.Client, error) {
+	client, err := c.baseClient()
+	if err != nil {
+		return nil, err
+	}
+
+	if c.apiVersion != nil {
+		return versionedClient(client, c.apiVersion)
+	}
+
+	return client, nil
+}
+
+// baseClient returns a client for the daemon selected by the options, which
+// makes its requests with the version of its environment, if any.
+func (c *Composer) baseClient() (*dc.Client, error) {
+	client, ok := c.options[optionClient].(*dc.Client)
+	if !ok {
+		name, _ := c.options[optionDockerContext].(string)
+
+		var err error
+		client, err = newClient(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if timeouts, ok := c.options[optionClientTimeouts].(clientTimeouts); ok {
+		client = timedClient(client, timeouts)
+	}
+
+	return client, nil
+}
+
+// clientPool holds the clients made by newClient, so that the Composers in a
+// process share their connections instead of probing for the daemon each.
+// Clients are safe for concurrent use.
+var clientPool = struct {
+	sync.Mutex
+	clients   map[string]*dc.Client
+	pinged    map[*dc.Client]*clientPing
+	timed     map[timedClientKey]*dc.Client
+	versioned map[versionedClientKey]*dc.Client
+}{
+	clients:   map[string]*dc.Client{},
+	pinged:    map[*dc.Client]*clientPing{},
+	timed:     map[timedClientKey]*dc.Client{},
+	versioned: map[versionedClientKey]*dc.Client{},
+}
+
+// clientEnv is the environment which selects the daemon.
+var clientEnv = []string{
+	"DOCKER_HOST",
+	"DOCKER_CONTEXT",
+	"DOCKER_CONFIG",
+	"DOCKER_CERT_PATH",
+	"DOCKER_TLS_VERIFY",
+	"XDG_RUNTIME_DIR",
+}
+
+// newClient returns a client for the daemon of the named docker context. If
+// the name is empty, the daemon is selected like the docker CLI does:
+// DOCKER_HOST, then the context named by DOCKER_CONTEXT, then the current
+// context in the docker config. Clients are pooled, so calls with the same
+// name and environment return the same client.
+func newClient(contextName string) (*dc.Client, error) {
+	parts := []string{contextName}
+	for _, name := range clientEnv {
+		parts = append(parts, os.Getenv(name))
+	}
+	key := strings.Join(parts, "\x00")
+
+	clientPool.Lock()
+	defer clientPool.Unlock()
+
+	if client, ok := clientPool.clients[key]; ok {
+		return client, nil
+	}
+
+	client, err := dialClient(contextName)
+	if err != nil {
+		return nil, err
+	}
+
+	// the client would otherwise learn the daemon's API version before its
+	// first request, without synchronization. StartContainer and a few others
+	// still do regardless, so pingClient has it learn the version first.
+	client.SkipServerVersionCheck = true
+
+	clientPool.clients[key] = client
+
+	return client, nil
+}
+
+// pingClient pings the daemon the first time it is called for the client,
+// and has the client learn the daemon's API version. Concurrent calls for the
+// same client wait for the same ping; calls for other clients do not.
+func pingClient(ctx context.Context, client *dc.Client) error {
+	ping := clientPingOf(client)
+
+	ping.mu.Lock()
+	defer ping.mu.Unlock()
+
+	if ping.done {
+		return nil
+	}
+
+	if err := client.PingWithContext(ctx); err != nil {
+		return err
+	}
+
+	ping.learnAPIVersion(client)
+	ping.done = true
+
+	return nil
+}
+
+// learnAPIVersion has the client learn the daemon's API version the first time
+// it is called for it; see clientPing.
+func learnAPIVersion(client *dc.Client) {
+	ping := clientPingOf(client)
+
+	ping.mu.Lock()
+	defer ping.mu.Unlock()
+
+	ping.learnAPIVersion(client)
+}
+
+// clientPingOf returns whether the client has pinged its daemon.
+func clientPingOf(client *dc.Client) *clientPing {
+	clientPool.Lock()
+	defer clientPool.Unlock()
+
+	ping, ok := clientPool.pinged[client]
+	if !ok {
+		ping = &clientPing{}
+		clientPool.pinged[client] = ping
+	}
+
+	return ping
+}
+
+// clientPing is whether a client has pinged its daemon, and learned its API
+// version. go-dockerclient learns the version lazily in StartContainer,
+// CreateExec, BuildImage and CopyFromContainer, and writes it without
+// synchronization, so clients which are shared must learn it before they are
+// used. Both happen under mu.
+type clientPing struct {
+	mu      sync.Mutex
+	done    bool
+	learned bool
+}
+
+// learnAPIVersion has the client learn the daemon's API version, if it has
+// not yet. The caller holds mu.
+func (ping *clientPing) learnAPIVersion(client *dc.Client) {
+	if ping.learned {
+		return
+	}
+
+	// this fails without a request past the version on any daemon duct
+	// supports.
+	client.CopyFromContainer(dc.CopyFromContainerOptions{Container: "duct", OutputStream: io.Discard})
+
+	ping.learned = true
+}
+
+// dialClient returns a new client for the daemon of the named docker context;
+// see newClient.
+func dialClient(contextName string) (*dc.Client, error) {
+	if contextName == "" {
+		if os.Getenv("DOCKER_HOST") != "" {
+			return dc.NewClientFromEnv()
+		}
+
+		var err error
+		contextName, err = currentContext()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if contextName == "" || contextName == "default" {
+		client, err := dc.NewClientFromEnv()
+		if err != nil {
+			return nil, err
+		}
+
+		return probeSockets(append([]string{client.Endpoint()}, socketCandidates()...))
+	}
+
+	endpoint, err := loadContext(contextName)
+	if err != nil {
+		return nil, err
+	}
+
+	return endpoint.client()
+}
+
+// probeTimeout is how long probeSockets waits for each daemon to answer.
+const probeTimeout = 2 * time.Second
+
+// socketCandidates returns the sockets of the daemons of rootless docker,
+// colima and podman, for when the default socket does not work. On Windows,
+// they are the named pipes of Docker Desktop's engines and podman.
+func socketCandidates() []string {
+	if runtime.GOOS == "windows" {
+		return []string{
+			"npipe:////./pipe/docker_engine",
+			"npipe:////./pipe/dockerDesktopLinuxEngine",
+			"npipe:////./pipe/dockerDesktopWindowsEngine",
+			"npipe:////./pipe/podman-machine-default",
+		}
+	}
+
+	paths := []string{}
+
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		paths = append(paths,
+			filepath.Join(dir, "docker.sock"),
+			filepath.Join(dir, "podman", "podman.sock"),
+		)
+	}
+
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths,
+			filepath.Join(home, ".colima", "docker.sock"),
+			filepath.Join(home, ".colima", "default", "docker.sock"),
+			filepath.Join(home, ".docker", "run", "docker.sock"),
+		)
+	}
+
+	candidates := []string{}
+	for _, path := range paths {
+		candidates = append(candidates, "unix://"+path)
+	}
+
+	return candidates
+}
+
+// probeSockets returns a client for the first of the endpoints with a daemon
+// that answers, or an error listing why each did not.
+func probeSockets(endpoints []string) (*dc.Client, error) {
+	tried := []string{}
+
+	for _, endpoint := range endpoints {
+		if path := strings.TrimPrefix(endpoint, "unix://"); path != endpoint {
+			if _, err := os.Stat(path); err != nil {
+				tried = append(tried, fmt.Sprintf("%s: %v", endpoint, err))
+				continue
+			}
+		}
+
+		version := os.Getenv("DOCKER_API_VERSION")
+		client, err := dc.NewVersionedClient(endpoint, version)
+		if err != nil {
+			tried = append(tried, fmt.Sprintf("%s: %v", endpoint, err))
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+		err = client.PingWithContext(ctx)
+		cancel()
+
+		if err != nil {
+			tried = append(tried, fmt.Sprintf("%s: %v", endpoint, err))
+			continue
+		}
+
+		if endpoint != endpoints[0] {
+			logPrintf("Using docker daemon at [%s]", endpoint)
+		}
+
+		return client, nil
+	}
+
+	return nil, fmt.Errorf("no docker daemon found; set DOCKER_HOST or select a docker context. Tried:\n\t%s", strings.Join(tried, "\n\t"))
+}
+
+// dockerConfigDir returns the directory of the docker CLI configuration.
+func dockerConfigDir() (string, error) {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return dir, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".docker"), nil
+}
+
+// currentContext returns the name of the selected docker context, or "" if
+// there is none.
+func currentContext() (string, error) {
+	if name := os.Getenv("DOCKER_CONTEXT"); name != "" {
+		return name, nil
+	}
+
+	dir, err := dockerConfigDir()
+	if err != nil {
+		return "", nil
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, "config.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	var config struct {
+		CurrentContext string `json:"currentContext"`
+	}
+
+	if err := json.Unmarshal(content, &config); err != nil {
+		return "", fmt.Errorf("reading docker config: %w", err)
+	}
+
+	return config.CurrentContext, nil
+}
+
+// contextEndpoint is the docker endpoint of a docker context.
+type contextEndpoint struct {
+	Host          string
+	SkipTLSVerify bool
+
+	tlsDir string
+}
+
+// loadContext reads the docker endpoint of the named docker context from the
+// context store of the docker CLI.
+func loadContext(name string) (*contextEndpoint, error) {
+	dir, err := dockerConfigDir()
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256([]byte(name))
+	id := hex.EncodeToString(sum[:])
+
+	content, err := os.ReadFile(filepath.Join(dir, "contexts", "meta", id, "meta.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("docker context %q does not exist", name)
+	} else if err != nil {
+		return nil, err
+	}
+
+	var meta struct {
+		Endpoints map[string]*contextEndpoint
+	}
+
+	if err := json.Unmarshal(content, &meta); err != nil {
+		return nil, fmt.Errorf("reading docker context %q: %w", name, err)
+	}
+
+	endpoint, ok := meta.Endpoints["docker"]
+	if !ok || endpoint.Host == "" {
+		return nil, fmt.Errorf("docker context %q has no docker endpoint", name)
+	}
+
+	endpoint.tlsDir = filepath.Join(dir, "contexts", "tls", id, "docker")
+
+	return endpoint, nil
+}
+
+// client returns a client for the endpoint.
+func (ep *contextEndpoint) client() (*dc.Client, error) {
+	u, err := url.Parse(ep.Host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid docker host %q: %w", ep.Host, err)
+	}
+
+	if u.Scheme == "ssh" {
+		return sshClient(u)
+	}
+
+	if _, err := os.Stat(ep.tlsDir); err != nil {
+		return dc.NewClient(ep.Host)
+	}
+
+	client, err := dc.NewTLSClient(
+		ep.Host,
+		filepath.Join(ep.tlsDir, "cert.pem"),
+		filepath.Join(ep.tlsDir, "key.pem"),
+		filepath.Join(ep.tlsDir, "ca.pem"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if ep.SkipTLSVerify {
+		client.TLSConfig.InsecureSkipVerify = true
+	}
+
+	return client, nil
+}
+
+// sshClient returns a client for a daemon reached with `docker system
+// dial-stdio` over ssh, like the docker CLI does for ssh:// hosts.
+func sshClient(u *url.URL) (*dc.Client, error) {
+	args := []string{}
+	if u.User != nil {
+		args = append(args, "-l", u.User.Username())
+	}
+	if u.Port() != "" {
+		args = append(args, "-p", u.Port())
+	}
+	args = append(args, "--", u.Hostname(), "docker", "system", "dial-stdio")
+
+	// the endpoint is only used for its host, which is where forwarded ports
+	// are published.
+	client, err := dc.NewClient("tcp://" + net.JoinHostPort(u.Hostname(), "2375"))
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := sshDialer(args)
+	client.Dialer = dialer
+	client.HTTPClient.Transport = &http.Transport{
+		DialContext: func(context.Context, string, string) (net.Conn, error) {
+			return dialer.Dial("", "")
+		},
+	}
+
+	return client, nil
+}
+
+// sshDialer connects to a docker daemon through ssh with the arguments.
+type sshDialer []string
+
+func (d sshDialer) Dial(string, string) (net.Conn, error) {
+	cmd := exec.Command("ssh", d...)
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	return &cmdConn{cmd: cmd, stdin: stdin, stdout: stdout}, nil
+}
+
+// cmdConn is a connection over the standard input and output of a command.
+type cmdConn struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+}
+
+func (cc *cmdConn) Read(p []byte) (int, error)  { return cc.stdout.Read(p) }
+func (cc *cmdConn) Write(p []byte) (int, error) { return cc.stdin.Write(p) }
+
+// CloseWrite closes the command's input; it is needed by hijacked
+// connections.
+func (cc *cmdConn) CloseWrite() error { return cc.stdin.Close() }
+
+func (cc *cmdConn) Close() error {
+	cc.stdin.Close()
+	cc.cmd.Process.Kill()
+	cc.cmd.Wait()
+	return nil
+}
+
+func (cc *cmdConn) LocalAddr() net.Addr              { return cmdAddr{} }
+func (cc *cmdConn) RemoteAddr() net.Addr             { return cmdAddr{} }
+func (cc *cmdConn) SetDeadline(time.Time) error      { return nil }
+func (cc *cmdConn) SetReadDeadline(time.Time) error  { return nil }
+func (cc *cmdConn) SetWriteDeadline(time.Time) error { return nil }
+
+type cmdAddr struct{}
+
+func (cmdAddr) Network() string { return "cmd" }
+func (cmdAddr) String() string  { return "ssh" }
@@ -0,0 +1,329 @@
+package duct
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+func writeDockerContext(t *testing.T, dir, name, host string) {
+	sum := sha256.Sum256([]byte(name))
+	metaDir := filepath.Join(dir, "contexts", "meta", hex.EncodeToString(sum[:]))
+
+	if err := os.MkdirAll(metaDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	meta := `{"Name":"` + name + `","Metadata":{},"Endpoints":{"docker":{"Host":"` + host + `","SkipTLSVerify":false}}}`
+	if err := os.WriteFile(filepath.Join(metaDir, "meta.json"), []byte(meta), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fakeDaemon serves pings and the API version on docker.sock in a new
+// directory, which it returns. It is not a t.TempDir, as the length of socket
+// paths is limited.
+func fakeDaemon(t *testing.T, apiVersion string) string {
+	dir, err := os.MkdirTemp("", "duct-daemon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	l, err := net.Listen("unix", filepath.Join(dir, "docker.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/version") {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"ApiVersion":%q}`, apiVersion)
+			return
+		}
+		w.Write([]byte("OK"))
+	})}
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+
+	return dir
+}
+
+func TestProbeSockets(t *testing.T) {
+	dir := fakeDaemon(t, "1.41")
+	missing := "unix://" + filepath.Join(dir, "missing.sock")
+	found := "unix://" + filepath.Join(dir, "docker.sock")
+
+	client, err := probeSockets([]string{missing, found})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if client.Endpoint() != found {
+		t.Fatalf("unexpected endpoint: %s", client.Endpoint())
+	}
+
+	_, err = probeSockets([]string{missing})
+	if err == nil || !strings.Contains(err.Error(), missing) {
+		t.Fatalf("error does not list what was tried: %v", err)
+	}
+}
+
+func TestDockerContext(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Setenv("DOCKER_CONFIG", dir)
+	t.Setenv("DOCKER_HOST", "")
+	t.Setenv("DOCKER_CONTEXT", "")
+
+	writeDockerContext(t, dir, "remote", "tcp://docker.example.org:2375")
+	writeDockerContext(t, dir, "tunnel", "ssh://user@docker.example.org")
+
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(`{"currentContext":"remote"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := newClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if client.Endpoint() != "tcp://docker.example.org:2375" {
+		t.Fatalf("current context was not used: %s", client.Endpoint())
+	}
+
+	client, err = New(Manifest{}, WithDockerContext("tunnel")).newClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if endpointHost(client.Endpoint()) != "docker.example.org" {
+		t.Fatalf("ssh context was not used: %s", client.Endpoint())
+	}
+
+	if _, ok := client.Dialer.(sshDialer); !ok {
+		t.Fatalf("ssh context does not dial with ssh: %T", client.Dialer)
+	}
+
+	t.Setenv("DOCKER_CONTEXT", "default")
+	t.Setenv("XDG_RUNTIME_DIR", fakeDaemon(t, "1.41"))
+	client, err = newClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if endpointHost(client.Endpoint()) != "localhost" {
+		t.Fatalf("default context was not used: %s", client.Endpoint())
+	}
+
+	t.Setenv("DOCKER_HOST", "tcp://127.0.0.1:2375")
+	client, err = newClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if client.Endpoint() != "tcp://127.0.0.1:2375" {
+		t.Fatalf("DOCKER_HOST was not used: %s", client.Endpoint())
+	}
+
+	if pooled, err := newClient(""); err != nil || pooled != client {
+		t.Fatalf("client was not pooled: %v", err)
+	}
+
+	if _, err := newClient("missing"); err == nil {
+		t.Fatal("no error for a missing context")
+	}
+}
+
+// wedgedDaemon answers pings and version requests only with headers, streams
+// slowly for the "slow" image and logs, and sends nothing for other images.
+func wedgedDaemon(wedged chan struct{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/_ping"):
+		case strings.HasSuffix(r.URL.Path, "/images/create") && r.URL.Query().Get("fromImage") != "slow":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+		case strings.HasSuffix(r.URL.Path, "/images/create") || strings.HasSuffix(r.URL.Path, "/logs"):
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			for i := 0; i < 12; i++ {
+				fmt.Fprintf(w, "{\"status\":\"%d\"}\n", i)
+				w.(http.Flusher).Flush()
+				time.Sleep(50 * time.Millisecond)
+			}
+			return
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+		}
+
+		select {
+		case <-wedged:
+		case <-r.Context().Done():
+		}
+	})
+}
+
+func TestClientTimeouts(t *testing.T) {
+	wedged := make(chan struct{})
+	defer close(wedged)
+
+	srv := httptest.NewServer(wedgedDaemon(wedged))
+	defer srv.Close()
+
+	dir, err := os.MkdirTemp("", "duct-daemon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l, err := net.Listen("unix", filepath.Join(dir, "docker.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unixSrv := &http.Server{Handler: wedgedDaemon(wedged)}
+	go unixSrv.Serve(l)
+	defer unixSrv.Close()
+
+	for _, endpoint := range []string{srv.URL, "unix://" + filepath.Join(dir, "docker.sock")} {
+		base, err := dc.NewClient(endpoint)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := New(Manifest{}, WithClient(base), WithClientTimeouts(time.Second, 200*time.Millisecond, 300*time.Millisecond))
+		client, err := c.newClient()
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.client = client
+
+		if client == base || base.HTTPClient.Transport == client.HTTPClient.Transport {
+			t.Fatalf("%s: the timeouts were applied to the given client", endpoint)
+		}
+
+		if pooled, err := c.newClient(); err != nil || pooled != client {
+			t.Fatalf("%s: client was not pooled: %v", endpoint, err)
+		}
+
+		started := time.Now()
+		err = client.PingWithContext(context.Background())
+		if err == nil || !strings.Contains(err.Error(), "did not answer GET /_ping within 200ms") {
+			t.Fatalf("%s: unexpected error from a wedged ping: %v", endpoint, err)
+		}
+
+		if time.Since(started) > time.Second {
+			t.Fatalf("%s: response timeout was not applied: %v", endpoint, time.Since(started))
+		}
+
+		started = time.Now()
+		if _, err := client.VersionWithContext(context.Background()); err == nil {
+			t.Fatalf("%s: no error from a wedged response body", endpoint)
+		}
+
+		if elapsed := time.Since(started); elapsed < 300*time.Millisecond || elapsed > time.Second {
+			t.Fatalf("%s: overall timeout was not applied: %v", endpoint, elapsed)
+		}
+
+		started = time.Now()
+		if err := c.pullImage(context.Background(), "wedged"); err == nil || !strings.Contains(err.Error(), "sent nothing for 200ms") {
+			t.Fatalf("%s: unexpected error from a wedged pull: %v", endpoint, err)
+		}
+
+		if time.Since(started) > time.Second {
+			t.Fatalf("%s: the wedged pull was not bounded: %v", endpoint, time.Since(started))
+		}
+
+		if err := c.pullImage(context.Background(), "slow"); err != nil {
+			t.Fatalf("%s: a pull longer than overall failed: %v", endpoint, err)
+		}
+
+		err = client.Logs(dc.LogsOptions{
+			Container:    "app",
+			OutputStream: io.Discard,
+			Follow:       true,
+			Stdout:       true,
+			RawTerminal:  true,
+		})
+		if err != nil {
+			t.Fatalf("%s: a followed log stream longer than overall failed: %v", endpoint, err)
+		}
+	}
+}
+
+func TestPingClient(t *testing.T) {
+	var pings int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/_ping" {
+			atomic.AddInt32(&pings, 1)
+		}
+		w.Write([]byte("OK"))
+	}))
+	defer srv.Close()
+
+	wedged := make(chan struct{})
+	defer close(wedged)
+
+	wedgedSrv := httptest.NewServer(wedgedDaemon(wedged))
+	defer wedgedSrv.Close()
+
+	client, err := dc.NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wedgedClient, err := dc.NewClient(wedgedSrv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go pingClient(ctx, wedgedClient)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := pingClient(context.Background(), client); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a wedged daemon blocks pinging another")
+	}
+
+	if n := atomic.LoadInt32(&pings); n != 1 {
+		t.Fatalf("the daemon was pinged %d times", n)
+	}
+}
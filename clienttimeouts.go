@@ -0,0 +1,365 @@
+package duct
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"sync/atomic"
+	"time"
+
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+// WithClientTimeouts bounds the requests made to the daemon, so a wedged
+// daemon fails the launch instead of hanging it. A zero duration leaves that
+// bound unset.
+//
+// dial bounds connecting to the daemon. response bounds waiting for the
+// daemon to answer a request, and for the streams of image pulls, file
+// downloads and log reads, how long the daemon may send nothing. overall
+// bounds requests which are not streams as a whole, including reading their
+// response.
+//
+// Streams which last as long as the containers do, like followed logs,
+// events, waits for an exit and attached post-commands, are only bounded by
+// dial. So are image builds, whose steps may run silently for long.
+func WithClientTimeouts(dial, response, overall time.Duration) Options {
+	return Options{optionClientTimeouts: clientTimeouts{dial: dial, response: response, overall: overall}}
+}
+
+// clientTimeouts are the bounds of WithClientTimeouts.
+type clientTimeouts struct {
+	dial     time.Duration
+	response time.Duration
+	overall  time.Duration
+}
+
+// timedClientKey identifies a client made by timedClient.
+type timedClientKey struct {
+	client   *dc.Client
+	timeouts clientTimeouts
+}
+
+// timedClient returns a copy of the client whose requests are bounded by the
+// timeouts. The copy shares everything else with the client, which may be
+// pooled, and is pooled itself.
+func timedClient(client *dc.Client, timeouts clientTimeouts) *dc.Client {
+	key := timedClientKey{client: client, timeouts: timeouts}
+
+	clientPool.Lock()
+	pooled, ok := clientPool.timed[key]
+	clientPool.Unlock()
+
+	if ok {
+		return pooled
+	}
+
+	// the copy includes the API version the client learned, which pingClient
+	// writes under the client's ping lock
+	ping := clientPingOf(client)
+	ping.mu.Lock()
+	timed := *client
+	ping.mu.Unlock()
+
+	// streams and hijacked connections dial with the Dialer
+	if timeouts.dial > 0 {
+		switch dialer := client.Dialer.(type) {
+		case nil:
+		case *net.Dialer:
+			bounded := *dialer
+			bounded.Timeout = timeouts.dial
+			timed.Dialer = &bounded
+		default:
+			timed.Dialer = &boundedDialer{dialer: dialer, timeout: timeouts.dial}
+		}
+	}
+
+	httpClient := http.Client{}
+	if client.HTTPClient != nil {
+		httpClient = *client.HTTPClient
+	}
+
+	transport := httpClient.Transport
+	if tr, ok := transport.(*http.Transport); ok && timeouts.dial > 0 {
+		tr = tr.Clone()
+		tr.TLSHandshakeTimeout = timeouts.dial
+		if tr.DialContext != nil {
+			// the transport of unix sockets dials with the Dialer of the
+			// original client, ignoring the context
+			tr.DialContext = boundDial(tr.DialContext, timeouts.dial)
+		}
+		transport = tr
+	}
+
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	httpClient.Transport = &timeoutTransport{base: transport, timeouts: timeouts}
+	timed.HTTPClient = &httpClient
+
+	clientPool.Lock()
+	defer clientPool.Unlock()
+
+	if pooled, ok := clientPool.timed[key]; ok {
+		return pooled
+	}
+
+	clientPool.timed[key] = &timed
+
+	return &timed
+}
+
+// dialFunc is the DialContext of an http.Transport.
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// boundDial returns a dial which gives up after the timeout, even if dial
+// ignores its context. A connection made after that is closed.
+func boundDial(dial dialFunc, timeout time.Duration) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		type dialed struct {
+			conn net.Conn
+			err  error
+		}
+
+		result := make(chan dialed, 1)
+		go func() {
+			conn, err := dial(ctx, network, addr)
+			result <- dialed{conn: conn, err: err}
+		}()
+
+		select {
+		case r := <-result:
+			return r.conn, r.err
+		case <-ctx.Done():
+			go func() {
+				if r := <-result; r.conn != nil {
+					r.conn.Close()
+				}
+			}()
+
+			return nil, fmt.Errorf("connecting to the docker daemon: no connection within %v: %w", timeout, ctx.Err())
+		}
+	}
+}
+
+// boundedDialer is a Dialer which gives up after the timeout.
+type boundedDialer struct {
+	dialer  dc.Dialer
+	timeout time.Duration
+}
+
+func (d *boundedDialer) Dial(network, addr string) (net.Conn, error) {
+	dial := func(_ context.Context, network, addr string) (net.Conn, error) {
+		return d.dialer.Dial(network, addr)
+	}
+
+	return boundDial(dial, d.timeout)(context.Background(), network, addr)
+}
+
+// streamRequest matches the requests whose responses are streams, which
+// overall does not bound.
+var streamRequest = regexp.MustCompile(`/(images/create|images/load|images/.+/get|build|containers/[^/]+/(archive|export|logs|stats|attach|wait)|exec/[^/]+/start|events)$`)
+
+// waitRequest matches the requests which the daemon may not answer until a
+// container exits, which response does not bound either.
+var waitRequest = regexp.MustCompile(`/(containers/[^/]+/(attach|wait)|exec/[^/]+/start|events)$`)
+
+// timeoutTransport bounds the requests to the daemon, and explains the ones
+// which time out.
+type timeoutTransport struct {
+	base     http.RoundTripper
+	timeouts clientTimeouts
+}
+
+func (t *timeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+
+	var overall time.Duration
+	if t.timeouts.overall > 0 && !streamRequest.MatchString(req.URL.Path) {
+		overall = t.timeouts.overall
+		cancel()
+		ctx, cancel = context.WithTimeout(req.Context(), overall)
+	}
+
+	var stalled int32
+	var timer *time.Timer
+	if t.timeouts.response > 0 && !waitRequest.MatchString(req.URL.Path) {
+		timer = time.AfterFunc(t.timeouts.response, func() {
+			atomic.StoreInt32(&stalled, 1)
+			cancel()
+		})
+	}
+
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if timer != nil {
+		timer.Stop()
+	}
+
+	if err != nil {
+		cancel()
+
+		switch {
+		case atomic.LoadInt32(&stalled) != 0:
+			return nil, fmt.Errorf("docker daemon did not answer %s %s within %v: %w", req.Method, req.URL.Path, t.timeouts.response, err)
+		case overall > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded):
+			return nil, fmt.Errorf("docker daemon did not finish %s %s within %v: %w", req.Method, req.URL.Path, overall, err)
+		}
+
+		return nil, err
+	}
+
+	resp.Body = &timedBody{ReadCloser: resp.Body, ctx: ctx, cancel: cancel, req: req, overall: overall}
+
+	return resp, nil
+}
+
+// timedBody is the body of a response to a request bounded by
+// timeoutTransport, which ends the request when it is closed.
+type timedBody struct {
+	io.ReadCloser
+	ctx     context.Context
+	cancel  context.CancelFunc
+	req     *http.Request
+	overall time.Duration
+}
+
+func (b *timedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF && b.overall > 0 && errors.Is(b.ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("docker daemon did not finish %s %s within %v: %w", b.req.Method, b.req.URL.Path, b.overall, err)
+	}
+
+	return n, err
+}
+
+func (b *timedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+
+	return err
+}
+
+// pullImage pulls the image of a helper container, bounded like the pulls of
+// the containers.
+func (c *Composer) pullImage(ctx context.Context, image string) error {
+	ctx, watch := c.watchStream(ctx)
+
+	return watch.Done(c.client.PullImage(dc.PullImageOptions{
+		Repository:    image,
+		OutputStream:  watch.Writer(nil),
+		RawJSONStream: true,
+		Context:       ctx,
+	}, c.auth(nil, image)))
+}
+
+// watchStream bounds a streaming call to the daemon, like an image pull, by
+// the response timeout of WithClientTimeouts: the returned context is
+// canceled when nothing is written to the writers of the watch for that long.
+// Without the timeout, the watch does nothing.
+func (c *Composer) watchStream(ctx context.Context) (context.Context, *streamWatch) {
+	timeouts, _ := c.options[optionClientTimeouts].(clientTimeouts)
+	if timeouts.response <= 0 {
+		return ctx, nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	sw := &streamWatch{
+		timeout: timeouts.response,
+		cancel:  cancel,
+		active:  make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		stalled: make(chan struct{}),
+	}
+
+	go func() {
+		timer := time.NewTimer(sw.timeout)
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-sw.active:
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(sw.timeout)
+			case <-timer.C:
+				close(sw.stalled)
+				cancel()
+				return
+			case <-sw.stop:
+				return
+			}
+		}
+	}()
+
+	return ctx, sw
+}
+
+// streamWatch is the watch of a stream started by watchStream.
+type streamWatch struct {
+	timeout time.Duration
+	cancel  context.CancelFunc
+	active  chan struct{}
+	stop    chan struct{}
+	stalled chan struct{}
+}
+
+// Writer returns a writer which passes the stream on to w, and notes that it
+// is active.
+func (sw *streamWatch) Writer(w io.Writer) io.Writer {
+	if w == nil {
+		w = io.Discard
+	}
+
+	if sw == nil {
+		return w
+	}
+
+	return &watchedWriter{sw: sw, w: w}
+}
+
+// Done stops the watch, and explains err if the watch caused it.
+func (sw *streamWatch) Done(err error) error {
+	if sw == nil {
+		return err
+	}
+
+	close(sw.stop)
+	sw.cancel()
+
+	select {
+	case <-sw.stalled:
+		if err != nil {
+			return fmt.Errorf("docker daemon sent nothing for %v: %w", sw.timeout, err)
+		}
+	default:
+	}
+
+	return err
+}
+
+// watchedWriter is a writer of a streamWatch.
+type watchedWriter struct {
+	sw *streamWatch
+	w  io.Writer
+}
+
+func (ww *watchedWriter) Write(p []byte) (int, error) {
+	select {
+	case ww.sw.active <- struct{}{}:
+	default:
+	}
+
+	return ww.w.Write(p)
+}
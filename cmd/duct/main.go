@@ -0,0 +1,116 @@
+// Command duct launches duct compositions from manifest files, for local
+// development with them outside of tests.
+//
+// Usage:
+//
+//	duct watch [-network name] [-interval duration] [-set key=value ...] manifest.yaml
+//
+// Manifests are in YAML, JSON or TOML, and are rendered as templates with
+// the values given with -set; see duct.LoadManifestTemplate. Keys with dots,
+// like postgres.tag, set nested values.
+//
+// watch launches the composition, and then rebuilds the images of containers
+// with a Build and recreates them whenever the files of their build context
+// change, until it is interrupted; then it tears the composition down.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/erikh/duct"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "watch":
+		err = watch(os.Args[2:])
+	default:
+		usage()
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "duct: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: duct watch [-network name] [-interval duration] [-set key=value ...] manifest.yaml")
+	os.Exit(2)
+}
+
+// watch runs the watch verb.
+func watch(args []string) error {
+	flags := flag.NewFlagSet("watch", flag.ExitOnError)
+	network := flags.String("network", "duct", "name of the network to create")
+	interval := flags.Duration("interval", time.Second, "how often to check build contexts for changes")
+	values := setFlag{}
+	flags.Var(values, "set", "key=value to render the manifest with; may be repeated")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		usage()
+	}
+
+	manifest, err := duct.LoadManifestTemplate(flags.Arg(0), values)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	c := duct.New(manifest, duct.WithNewNetwork(*network))
+	if err := c.Launch(ctx); err != nil {
+		return err
+	}
+
+	err = c.Watch(ctx, *interval)
+
+	if teardownErr := c.Teardown(context.Background()); err == nil {
+		err = teardownErr
+	}
+
+	return err
+}
+
+// setFlag collects the values of -set flags. Dots in keys separate the keys
+// of nested values.
+type setFlag map[string]interface{}
+
+func (s setFlag) String() string {
+	return fmt.Sprint(map[string]interface{}(s))
+}
+
+func (s setFlag) Set(arg string) error {
+	key, value, ok := strings.Cut(arg, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("%q is not key=value", arg)
+	}
+
+	values := map[string]interface{}(s)
+	keys := strings.Split(key, ".")
+	for _, k := range keys[:len(keys)-1] {
+		nested, ok := values[k].(map[string]interface{})
+		if !ok {
+			nested = map[string]interface{}{}
+			values[k] = nested
+		}
+		values = nested
+	}
+	values[keys[len(keys)-1]] = value
+
+	return nil
+}
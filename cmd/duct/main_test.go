@@ -0,0 +1,29 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSetFlag(t *testing.T) {
+	values := setFlag{}
+	for _, arg := range []string{"replicas=3", "postgres.tag=15", "postgres.port=5432", "url=http://a/?b=c"} {
+		if err := values.Set(arg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := setFlag{
+		"replicas": "3",
+		"postgres": map[string]interface{}{"tag": "15", "port": "5432"},
+		"url":      "http://a/?b=c",
+	}
+
+	if !reflect.DeepEqual(values, expected) {
+		t.Fatalf("unexpected values: %v", values)
+	}
+
+	if err := values.Set("replicas"); err == nil {
+		t.Fatal("no error without a value")
+	}
+}
@@ -0,0 +1,233 @@
+package duct
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	traceScript = "/usr/local/lib/duct/trace.sh"
+	traceLog    = "/tmp/duct-trace.log"
+)
+
+// traceWrapper runs its arguments, recording when they started and exited
+// with which code. The start is recorded first, as the main process is
+// killed at Teardown. Signals are passed on, since the wrapper of the main
+// process is PID 1, and stdin is kept, which sh would otherwise replace for
+// a background command.
+const traceWrapper = `#!/bin/sh
+log=` + traceLog + `
+read up _ < /proc/uptime
+printf 'start\t%s\t%s\t%s\t%s\n' "$$" "$(date -u +%s)" "$up" "$(printf '%s' "$*" | tr '\t\n' '  ')" >> "$log" 2>/dev/null
+chmod 666 "$log" 2>/dev/null
+exec 3<&0
+"$@" 0<&3 3<&- &
+pid=$!
+trap 'kill -TERM $pid 2>/dev/null' TERM
+trap 'kill -INT $pid 2>/dev/null' INT
+trap 'kill -HUP $pid 2>/dev/null' HUP
+wait $pid
+code=$?
+while kill -0 $pid 2>/dev/null; do
+	wait $pid
+	code=$?
+done
+read up _ < /proc/uptime
+printf 'exit\t%s\t%s\t%s\n' "$$" "$up" "$code" >> "$log" 2>/dev/null
+exit $code
+`
+
+// TraceEntry is a command run by a container with TraceDir.
+type TraceEntry struct {
+	Command  string
+	Started  time.Time
+	Duration time.Duration
+	// Exited is false if the command had not exited, e.g. the main process
+	// of the container.
+	Exited   bool
+	ExitCode int
+}
+
+// addTrace wraps the entrypoint of the resolved container spec in the trace
+// wrapper. Without an Entrypoint, the command the image runs is wrapped.
+func (c *Composer) addTrace(ctx context.Context, spec *Container) error {
+	command := append(append([]string{}, spec.Entrypoint...), spec.Command...)
+
+	if len(spec.Entrypoint) == 0 {
+		image, err := c.client.InspectImage(spec.Image)
+		if err != nil {
+			return fmt.Errorf("[%s] could not inspect the image to trace its command: %w", spec.Name, err)
+		}
+
+		if image.Config != nil {
+			command = append([]string{}, image.Config.Entrypoint...)
+			if len(spec.Command) != 0 {
+				command = append(command, spec.Command...)
+			} else {
+				command = append(command, image.Config.Cmd...)
+			}
+		}
+	}
+
+	if len(command) == 0 {
+		return fmt.Errorf("[%s] has no command to trace", spec.Name)
+	}
+
+	files := copyMap(spec.Files)
+	if files == nil {
+		files = map[string]FileContent{}
+	}
+	files[traceScript] = FileContent{Content: []byte(traceWrapper), Mode: 0755}
+	spec.Files = files
+
+	spec.Entrypoint = []string{"/bin/sh", traceScript}
+	spec.Command = command
+
+	return nil
+}
+
+// traced returns the command wrapped in the trace wrapper if the container
+// is traced.
+func (cont *Container) traced(command []string) []string {
+	if cont.TraceDir == "" {
+		return command
+	}
+
+	return append([]string{"/bin/sh", traceScript}, command...)
+}
+
+// Trace returns the commands the named container, which must have a
+// TraceDir, has run so far, in the order they started.
+func (c *Composer) Trace(ctx context.Context, name string) ([]TraceEntry, error) {
+	cont, err := c.find(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if cont.TraceDir == "" {
+		return nil, fmt.Errorf("[%s] is not traced", name)
+	}
+
+	archive := &bytes.Buffer{}
+	if err := c.ArchivePath(ctx, name, traceLog, archive); err != nil {
+		return nil, err
+	}
+
+	log, err := untarFile(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseTrace(bytes.NewReader(log))
+}
+
+// parseTrace reads the log of the trace wrapper.
+func parseTrace(r io.Reader) ([]TraceEntry, error) {
+	type started struct {
+		index  int
+		uptime float64
+	}
+
+	entries := []TraceEntry{}
+	running := map[string]started{}
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		fields := strings.SplitN(s.Text(), "\t", 5)
+
+		switch {
+		case fields[0] == "start" && len(fields) == 5:
+			epoch, err := strconv.ParseInt(fields[2], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trace record %q", s.Text())
+			}
+
+			uptime, err := strconv.ParseFloat(fields[3], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trace record %q", s.Text())
+			}
+
+			running[fields[1]] = started{index: len(entries), uptime: uptime}
+			entries = append(entries, TraceEntry{Command: fields[4], Started: time.Unix(epoch, 0).UTC()})
+		case fields[0] == "exit" && len(fields) == 4:
+			start, ok := running[fields[1]]
+			if !ok {
+				continue
+			}
+			delete(running, fields[1])
+
+			uptime, err := strconv.ParseFloat(fields[2], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trace record %q", s.Text())
+			}
+
+			code, err := strconv.Atoi(fields[3])
+			if err != nil {
+				return nil, fmt.Errorf("invalid trace record %q", s.Text())
+			}
+
+			entry := &entries[start.index]
+			entry.Exited = true
+			entry.ExitCode = code
+			entry.Duration = time.Duration((uptime - start.uptime) * float64(time.Second)).Round(10 * time.Millisecond)
+		default:
+			return nil, fmt.Errorf("invalid trace record %q", s.Text())
+		}
+	}
+
+	return entries, s.Err()
+}
+
+// String formats the entry as a line of a trace file.
+func (e TraceEntry) String() string {
+	status := "running"
+	if e.Exited {
+		status = fmt.Sprintf("exit %d after %v", e.ExitCode, e.Duration)
+	}
+
+	return fmt.Sprintf("%s %s: %s", e.Started.Format(time.RFC3339), status, e.Command)
+}
+
+// collectTraces writes the traces of the traced containers to their
+// TraceDirs. Failures are logged, as the trace may be missing when the
+// launch failed.
+func (c *Composer) collectTraces(ctx context.Context) {
+	for _, cont := range c.manifest {
+		if cont.TraceDir == "" || cont.External || cont.id == "" {
+			continue
+		}
+
+		if err := c.collectTrace(ctx, cont); err != nil {
+			c.logContainer(LogWarn, cont.Name, "WARNING: Failed to collect the command trace of [%s]: %v", cont.Name, err)
+		}
+	}
+}
+
+func (c *Composer) collectTrace(ctx context.Context, cont *Container) error {
+	entries, err := c.Trace(ctx, cont.Name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(cont.TraceDir, 0755); err != nil {
+		return err
+	}
+
+	buf := &bytes.Buffer{}
+	for _, entry := range entries {
+		fmt.Fprintln(buf, entry)
+	}
+
+	path := filepath.Join(cont.TraceDir, cont.Name+".trace")
+	c.logContainer(LogInfo, cont.Name, "Writing command trace of container: [%s] to %s", cont.Name, path)
+
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
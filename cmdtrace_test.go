@@ -0,0 +1,99 @@
+package duct
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTrace(t *testing.T) {
+	log := "start\t7\t1700000000\t100.50\tpsql -c select 1\n" +
+		"start\t1\t1700000000\t100.00\tpostgres\n" +
+		"exit\t7\t101.75\t2\n" +
+		"exit\t9\t102.00\t0\n"
+
+	entries, err := parseTrace(strings.NewReader(log))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []TraceEntry{
+		{Command: "psql -c select 1", Started: time.Unix(1700000000, 0).UTC(), Exited: true, ExitCode: 2, Duration: 1250 * time.Millisecond},
+		{Command: "postgres", Started: time.Unix(1700000000, 0).UTC()},
+	}
+
+	if !reflect.DeepEqual(entries, expected) {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+
+	if entries[0].String() != "2023-11-14T22:13:20Z exit 2 after 1.25s: psql -c select 1" {
+		t.Fatalf("unexpected line: %s", entries[0])
+	}
+
+	if _, err := parseTrace(strings.NewReader("garbage\n")); err == nil {
+		t.Fatal("a garbage record was parsed")
+	}
+}
+
+func TestTraceWrapper(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the wrapper reads /proc/uptime")
+	}
+
+	dir := t.TempDir()
+	log := filepath.Join(dir, "trace.log")
+	script := filepath.Join(dir, "trace.sh")
+	if err := os.WriteFile(script, []byte(strings.Replace(traceWrapper, traceLog, log, 1)), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("/bin/sh", script, "sh", "-c", "read line; test \"$line\" = hello && exit 3")
+	cmd.Stdin = strings.NewReader("hello\n")
+	err := cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 3 {
+		t.Fatalf("the exit code was not passed on: %v", err)
+	}
+
+	f, err := os.Open(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	entries, err := parseTrace(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 || entries[0].Command != `sh -c read line; test "$line" = hello && exit 3` || !entries[0].Exited || entries[0].ExitCode != 3 {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+}
+
+func TestAddTrace(t *testing.T) {
+	cont := &Container{Name: "app", Image: "debian", Entrypoint: []string{"/entrypoint.sh"}, Command: []string{"serve"}, TraceDir: "traces"}
+
+	c := New(Manifest{cont})
+	spec := cont.clone()
+	if err := c.addTrace(context.Background(), spec); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(spec.Entrypoint, []string{"/bin/sh", traceScript}) || !reflect.DeepEqual(spec.Command, []string{"/entrypoint.sh", "serve"}) {
+		t.Fatalf("the entrypoint was not wrapped: %v %v", spec.Entrypoint, spec.Command)
+	}
+
+	if spec.Files[traceScript].Mode != 0755 {
+		t.Fatalf("the wrapper was not added: %v", spec.Files)
+	}
+
+	if command := cont.traced([]string{"migrate"}); !reflect.DeepEqual(command, []string{"/bin/sh", traceScript, "migrate"}) {
+		t.Fatalf("the post command was not wrapped: %v", command)
+	}
+}
@@ -0,0 +1,104 @@
+package duct
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"syscall"
+
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+// Signal sends the signal to the main process of the named container, e.g.
+// SIGHUP to reload its configuration, or SIGUSR1 to dump its state. If the
+// signal makes the container exit, that is reported by the crash monitor
+// like any other exit.
+func (c *Composer) Signal(ctx context.Context, name string, sig syscall.Signal) error {
+	cont, err := c.find(name)
+	if err != nil {
+		return err
+	}
+
+	c.logContainer(LogInfo, name, "Signaling container: [%s] with %v", name, sig)
+
+	return c.client.KillContainer(dc.KillContainerOptions{
+		ID:      cont.id,
+		Signal:  dc.Signal(sig),
+		Context: ctx,
+	})
+}
+
+// Recreate removes the named container and creates and launches it again
+// with the changes mutate makes to its description, e.g. a new image tag or
+// environment, while the rest of the composition keeps running; the core of
+// upgrade and downgrade tests. Its Volumes and TempMounts keep their
+// contents. The container's name cannot be changed, and its removal is not
+// reported by the crash monitor.
+func (c *Composer) Recreate(ctx context.Context, name string, mutate func(*Container)) error {
+	cont, err := c.find(name)
+	if err != nil {
+		return err
+	}
+
+	if cont.External {
+		return fmt.Errorf("container [%s] is external and cannot be recreated", name)
+	}
+
+	updated := cont.clone()
+	mutate(updated)
+	if updated.Name != cont.Name {
+		return fmt.Errorf("container [%s] cannot be renamed to [%s] by Recreate", name, updated.Name)
+	}
+
+	c.logContainer(LogInfo, name, "Recreating container: [%s]", name)
+
+	c.expectExit(cont.id, true)
+	c.unfollow(cont)
+
+	if !c.removeContainer(ctx, c.client, cont) {
+		return fmt.Errorf("container [%s] could not be removed", name)
+	}
+
+	if cont.hostsFile != "" {
+		os.Remove(cont.hostsFile)
+	}
+
+	c.mu.Lock()
+	tempDirs := cont.tempDirs
+	*cont = *updated
+	cont.tempDirs = tempDirs
+	c.mu.Unlock()
+
+	if err := c.createContainer(ctx, cont); err != nil {
+		return err
+	}
+
+	return c.startContainer(ctx, cont)
+}
+
+// RollingUpgrade recreates the replicas of the named container one at a
+// time with the image, like a rolling deployment, calling probe after each
+// one is ready, e.g. to assert that the service stayed available. It stops
+// at the first error, of a recreate or the probe, leaving the rest of the
+// replicas on their old image.
+func (c *Composer) RollingUpgrade(ctx context.Context, name, image string, probe func(ctx context.Context, replica string) error) error {
+	replicas := c.Replicas(name)
+	if len(replicas) == 0 {
+		return fmt.Errorf("container [%s] is not in the manifest", name)
+	}
+
+	for _, replica := range replicas {
+		c.logContainer(LogInfo, replica, "Upgrading container: [%s] to image [%s]", replica, image)
+		if err := c.Recreate(ctx, replica, func(cont *Container) { cont.Image = image }); err != nil {
+			return err
+		}
+
+		if probe != nil {
+			if err := probe(ctx, replica); err != nil {
+				return fmt.Errorf("probe after upgrading [%s] failed: %w", replica, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package duct_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/erikh/duct"
+	"github.com/erikh/duct/ductfake"
+)
+
+func TestSignal(t *testing.T) {
+	r := ductfake.Start(t)
+
+	c := r.Launch(t, duct.Manifest{
+		{Name: "web", Image: "nginx:latest"},
+	})
+
+	if err := c.Signal(context.Background(), "web", syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Signal(context.Background(), "missing", syscall.SIGHUP); err == nil {
+		t.Fatal("no error for a missing container")
+	}
+}
+
+func TestRecreate(t *testing.T) {
+	r := ductfake.Start(t)
+
+	c := r.Launch(t, duct.Manifest{
+		{Name: "db", Image: "postgres:latest"},
+		{Name: "web", Image: "nginx:1.24", Env: []string{"MODE=old"}},
+	}, duct.WithCrashMonitor())
+
+	db, err := r.Container("db")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old, err := r.Container("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Recreate(context.Background(), "web", func(cont *duct.Container) {
+		cont.Image = "nginx:1.25"
+		cont.Env = []string{"MODE=new"}
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	web, err := r.Container("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if web.ID == old.ID || web.Config.Image != "nginx:1.25" || !reflect.DeepEqual(web.Config.Env, []string{"MODE=new"}) || !web.State.Running {
+		t.Fatalf("container was not recreated: %+v", web.Config)
+	}
+
+	if ctr, err := r.Container("db"); err != nil || ctr.ID != db.ID {
+		t.Fatalf("other container was recreated: %v", err)
+	}
+
+	if err := c.Check(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Recreate(context.Background(), "web", func(cont *duct.Container) { cont.Name = "web2" }); err == nil {
+		t.Fatal("container was renamed")
+	}
+}
+
+func TestRollingUpgrade(t *testing.T) {
+	r := ductfake.Start(t)
+
+	c := r.Launch(t, duct.Manifest{
+		{Name: "web", Image: "nginx:1.24", Replicas: 3},
+	})
+
+	images := func() []string {
+		res := []string{}
+		for _, name := range c.Replicas("web") {
+			ctr, err := r.Container(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res = append(res, ctr.Config.Image)
+		}
+		return res
+	}
+
+	probed := []string{}
+	err := c.RollingUpgrade(context.Background(), "web", "nginx:1.25", func(ctx context.Context, replica string) error {
+		probed = append(probed, strings.Join(images(), ","))
+		if replica == "web-2" {
+			return fmt.Errorf("unavailable")
+		}
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "unavailable") {
+		t.Fatalf("probe failure was not returned: %v", err)
+	}
+
+	expected := []string{"nginx:1.25,nginx:1.24,nginx:1.24", "nginx:1.25,nginx:1.25,nginx:1.24"}
+	if !reflect.DeepEqual(probed, expected) {
+		t.Fatalf("replicas were not upgraded one at a time: %v", probed)
+	}
+}
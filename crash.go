@@ -0,0 +1,155 @@
+package duct
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// WithCrashMonitor watches the containers in the manifest from the time they
+// are started, and records any that exit while the composition is running.
+// Containers with WaitForExit set are exempt. Crashes are reported by Check
+// and by Teardown.
+func WithCrashMonitor() Options {
+	return Options{optionCrashMonitor: true}
+}
+
+// monitorCrashes starts recording unexpected exits.
+func (c *Composer) monitorCrashes() error {
+	c.mu.Lock()
+	c.crashes = nil
+	for _, cont := range c.manifest {
+		cont.restarts = 0
+	}
+	c.mu.Unlock()
+
+	return c.Events(context.Background(), func(ev ContainerEvent) {
+		if ev.Action != "die" {
+			return
+		}
+
+		cont, err := c.find(ev.Name)
+		if err != nil || cont.WaitForExit || c.expectedExit(ev.ID) {
+			return
+		}
+
+		c.mu.Lock()
+		restart := cont.restarts < cont.MaxRestarts
+		if restart {
+			cont.restarts++
+		}
+		restarts := cont.restarts
+		c.mu.Unlock()
+
+		if restart {
+			c.logContainer(LogInfo, ev.Name, "Container exited: [%s] (exit code %s); restarting (%d of %d)", ev.Name, ev.Attributes["exitCode"], restarts, cont.MaxRestarts)
+			c.background(context.Background(), func(ctx context.Context) {
+				c.restart(ctx, cont, restarts)
+			})
+			return
+		}
+
+		crash := c.exitError(context.Background(), cont, nil, 0, nil)
+		c.logf(LogError, "Container exited unexpectedly: %v", crash)
+
+		c.mu.Lock()
+		c.crashes = append(c.crashes, crash)
+		c.mu.Unlock()
+	})
+}
+
+// expectExit makes the crash monitor ignore the next exit of the container
+// with the id, which duct is about to cause; or, if expect is false, undoes
+// that.
+func (c *Composer) expectExit(id string, expect bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.expectedExits == nil {
+		c.expectedExits = map[string]int{}
+	}
+
+	if expect {
+		c.expectedExits[id]++
+	} else if c.expectedExits[id] > 0 {
+		c.expectedExits[id]--
+	}
+}
+
+// expectedExit is true if an exit of the container with the id was expected
+// with expectExit, and uses up the expectation.
+func (c *Composer) expectedExit(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.expectedExits[id] == 0 {
+		return false
+	}
+
+	c.expectedExits[id]--
+
+	return true
+}
+
+// restart starts an exited container again and waits for it to become ready.
+func (c *Composer) restart(ctx context.Context, cont *Container, restart int) {
+	// the old follower's output ended with the exit
+	c.unfollow(cont)
+
+	c.mu.Lock()
+	cont.started = time.Now()
+	id := cont.id
+	c.mu.Unlock()
+	err := c.client.StartContainerWithContext(id, nil, ctx)
+	if err == nil {
+		if c.options[optionLogStream] != nil {
+			c.follow(cont)
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(cont.BootWait):
+		}
+
+		err = c.waitReady(ctx, cont)
+	}
+
+	if err != nil {
+		c.logContainer(LogError, cont.Name, "Restarting container [%s] failed: %v", cont.Name, err)
+	}
+
+	if cont.OnRestart != nil {
+		cont.OnRestart(cont.Name, restart, err)
+	}
+}
+
+// restartable is true if any container is restarted by duct.
+func (m Manifest) restartable() bool {
+	for _, cont := range m {
+		if cont.MaxRestarts > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Check returns an error describing every container that exited unexpectedly
+// since Launch. It requires WithCrashMonitor; without it, Check always
+// returns nil.
+func (c *Composer) Check() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.crashes) == 0 {
+		return nil
+	}
+
+	msgs := []string{}
+	for _, crash := range c.crashes {
+		msgs = append(msgs, crash.Error())
+	}
+
+	return fmt.Errorf("containers exited unexpectedly: %s", strings.Join(msgs, "\n"))
+}
@@ -1,21 +1,19 @@
 package duct
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
-	"os/signal"
-	"path/filepath"
 	"strings"
-	"syscall"
+	"sync"
 	"time"
 
 	dc "github.com/fsouza/go-dockerclient"
 	"github.com/sirupsen/logrus"
-	"golang.org/x/sys/unix"
 )
 
 // Container is the description of a single container. Usually several of these
@@ -30,10 +28,24 @@ type Container struct {
 	// Env is the array of key=value string pairs in `man 7 environ` fashion.
 	Env []string
 
+	// EnvFile is a list of dotenv files to load into the container's
+	// environment. Env takes precedence over them, and later files over
+	// earlier ones.
+	//
+	// ${VAR} references in Image, Env, EnvFile contents, Command and BindMounts
+	// are expanded with docker compose semantics from the variables given
+	// with WithVariables, or the environment.
+	EnvFile []string
+
 	// PostCommands is a series of argvs for running commands after the container
 	// is booted, and after the bootwait is consumed.
 	PostCommands [][]string
 
+	// PostRun are post-commands with more control than PostCommands, e.g.
+	// over their standard input and output. They run after PostCommands.
+	// See PostCommand for more.
+	PostRun []PostCommand
+
 	// Command is the command to run as the booted container.
 	Command []string
 
@@ -44,26 +56,100 @@ type Container struct {
 	// pull it unless LocalImage is set true.
 	Image string
 
+	// Build builds Image from the build, instead of pulling it, when the
+	// container is created; see also Composer.Watch.
+	Build *Build
+
 	// BindMounts is a map of absolute path -> absolute path for host ->
-	// container bind mounting.
+	// container bind mounting. On Windows, host paths may have a drive
+	// letter, or be written like /c/src/app as in Git Bash.
 	BindMounts map[string]string
 
+	// Files is a map of absolute path -> file, which are written into the
+	// container before it is started. Unlike BindMounts, this also works with
+	// remote docker daemons.
+	Files map[string]FileContent
+
+	// TempMounts are container paths to mount temporary host directories on.
+	// duct creates the directories, and removes them at Teardown. Their host
+	// paths are available from Composer.MountPath.
+	TempMounts []string
+
+	// Volumes is a map of volume name -> container path to mount named
+	// volumes on. Volumes declared with WithVolumes are managed by duct and
+	// can be shared by several containers; others must already exist.
+	Volumes map[string]string
+
+	// VolumesFrom mounts all volumes of the named containers, in docker's
+	// `name[:ro|rw]` format. The containers must come earlier in the manifest.
+	VolumesFrom []string
+
+	// PidMode, IpcMode and UTSMode set the PID, IPC and UTS namespaces of
+	// the container, e.g. for a debugging sidecar which sees the processes
+	// of the container it debugs. "host" shares the namespace of the host,
+	// and "container:<name>" that of the named container, which must come
+	// earlier in the manifest. IpcMode "shareable" lets other containers
+	// share the container's IPC namespace; UTSMode only supports "host".
+	PidMode string
+	IpcMode string
+	UTSMode string
+
+	// Secrets are written into the container before it is started, readable
+	// only by their owner. See Secret for more.
+	Secrets []Secret
+
 	// LocalImage indicates this image is not to be pulled.
 	LocalImage bool
 
 	// BootWait is how long to wait after booting the container before moving
-	// forward with PostCommands and other orchestration.
+	// forward with PostCommands and other orchestration. Later containers are
+	// pulled and created meanwhile.
 	BootWait time.Duration
 
 	// AliveFunc is a locally run golang function for testing the availability of
 	// the container. The client is passed in as well as the container ID to
-	// assist with this process.
+	// assist with this process. The context is canceled after AliveTimeout;
+	// see Retry for polling until then.
 	AliveFunc func(context.Context, *dc.Client, string) error
 
+	// ReadyFunc is a readiness check like AliveFunc, run after it, which is
+	// given the container's addresses and forwarded ports along with its
+	// inspect data.
+	ReadyFunc func(context.Context, *ContainerInfo) error
+
+	// AliveTimeout is how long AliveFunc and ReadyFunc may take. The default
+	// is five minutes.
+	AliveTimeout time.Duration
+
+	// WaitFor is a readiness check run after ReadyFunc. See WaitStrategy for
+	// more.
+	WaitFor WaitStrategy
+
+	// MaxRestarts is the number of times duct itself will start the container
+	// again if it exits while the composition is running. BootWait and the
+	// readiness checks are run again after each restart, and log history (see
+	// ExpectLog) begins anew. Restarted exits are not reported as crashes; see
+	// WithCrashMonitor.
+	MaxRestarts int
+
+	// OnRestart is called after each restart made for MaxRestarts, with the
+	// number of the restart and the error restarting or waiting for the
+	// container, if any.
+	OnRestart func(name string, restart int, err error)
+
 	// PortForwards are a simple mapping of host -> container port mappings that
-	// forward the port on 0.0.0.0 automatically.
+	// forward the port on 0.0.0.0 (or the address given with WithHostIP)
+	// automatically.
 	PortForwards map[int]int
 
+	// Ports are port forwards with more control than PortForwards, e.g. over
+	// the host address they bind to. See PortForward for more.
+	Ports []PortForward
+
+	// PublishAllPorts forwards every port the image exposes to a free host
+	// port. Use HostPort to find out which.
+	PublishAllPorts bool
+
 	// WaitForExit runs this container until it exits. Helpful for scenarios where a container operates
 	// on another (example: initialize database data), but does not expose a service.
 	WaitForExit bool
@@ -74,12 +160,165 @@ type Container struct {
 	// IPv6 attempts to set IPv6 addresses for the container.
 	IPv6 string
 
+	// MacAddress is the MAC address of the container on the network.
+	MacAddress string
+
+	// Aliases are more names the container is reachable by on the network,
+	// besides its Name.
+	Aliases []string
+
 	// ExtraHosts is a map of IP -> names in /etc/hosts. It does this by
 	// constructing an /etc/hosts file and bind mounting it in.
 	ExtraHosts map[string][]string
 
-	id       string // the container id
-	exitCode *int   // container exit code
+	// HostGateway makes the host reachable as host.docker.internal from the
+	// container. See also WithHostGateway.
+	HostGateway bool
+
+	// Replicas launches this many copies of the container, named after it with
+	// an index suffix, e.g. "web-1", "web-2". All replicas are also reachable
+	// by the container's name on the network. Host ports in PortForwards and
+	// Ports are incremented by one (or the size of the port range) for each
+	// replica after the first.
+	Replicas int
+
+	// External adopts a running container which duct did not create, e.g. a
+	// service of the CI environment, by its Name or ExternalLabel. Its
+	// readiness checks and PostCommands are run, and it can be reached with
+	// Endpoint and the like, but it is not started, stopped or removed, and
+	// settings for creating it, like Image, are ignored.
+	External bool
+
+	// ExternalLabel adopts the External container with this label, as
+	// "key=value" or just "key", instead of by name.
+	ExternalLabel string
+
+	// DependsOn are the names of containers which must be started, and be
+	// ready, before this one. They must come earlier in the manifest; see
+	// Manifest.Validate. Containers are launched one at a time in the order
+	// of the manifest, unless WithParallelism is given: then they only wait
+	// for their DependsOn, and those they take VolumesFrom or namespaces
+	// from.
+	DependsOn []string
+
+	// Platform is the platform of the image to pull, e.g. "linux/arm64", if
+	// not the daemon's. It requires docker API version 1.32.
+	Platform string
+
+	// Auth is the credentials to pull Image with, instead of those given
+	// with WithRegistryAuth or WithDockerConfigAuth for its registry.
+	Auth *dc.AuthConfiguration
+
+	// CollectArtifacts are files or directories in the container, e.g. of
+	// coverage profiles, to copy into host directories at Teardown, before
+	// the container is removed, even when the launch failed. Like `docker cp`,
+	// each is copied into the directory under its own name; replicas get a
+	// directory of their own in it.
+	CollectArtifacts map[string]string
+
+	// TraceDir wraps the entrypoint and PostCommands of the container in a
+	// shell script which records the commands, their exit codes and
+	// timing. The record is written to <TraceDir>/<name>.trace at Teardown,
+	// and is read during the test with Composer.Trace. The image must have
+	// /bin/sh.
+	TraceDir string
+
+	// Privileged gives the container all capabilities and access to the
+	// devices of the host, e.g. to run docker in docker.
+	Privileged bool
+
+	// Runtime is the OCI runtime to run the container with instead of the
+	// daemon's default, e.g. "runsc" for gVisor or "kata-runtime". It must
+	// be configured on the daemon.
+	Runtime string
+
+	// CgroupParent is the cgroup the container's cgroup is created under,
+	// instead of the one given with WithCgroupParent, or the daemon's
+	// default.
+	CgroupParent string
+
+	// CgroupnsMode is the cgroup namespace of the container: "private", or
+	// "host" to share the host's. It requires docker API version 1.41.
+	CgroupnsMode string
+
+	// DeviceReadBps, DeviceWriteBps, DeviceReadIOps and DeviceWriteIOps are
+	// maps of block device path on the host -> limit of the bytes, or
+	// operations, per second the container reads from or writes to it, e.g.
+	// to test a service on a slow disk. The device is the one backing the
+	// container's filesystem or volumes, e.g. "/dev/sda".
+	DeviceReadBps   map[string]int64
+	DeviceWriteBps  map[string]int64
+	DeviceReadIOps  map[string]int64
+	DeviceWriteIOps map[string]int64
+
+	// Memory limits the memory of the container, in bytes. MemorySwap limits
+	// its memory and swap together; -1 is unlimited swap.
+	Memory     int64
+	MemorySwap int64
+
+	// MemorySwappiness is how readily the kernel swaps out the container's
+	// anonymous pages, from 0 to 100, instead of the host's setting.
+	MemorySwappiness *int64
+
+	// OomScoreAdj adjusts how likely the kernel's OOM killer picks the
+	// container's processes when the host runs out of memory, from -1000,
+	// never, to 1000, first. OomKillDisable keeps it from killing them when
+	// the container runs out of its Memory.
+	OomScoreAdj    int
+	OomKillDisable bool
+
+	// StorageOpt are options of the storage driver for the container's
+	// filesystem, e.g. "size" = "2G" to bound it on drivers which support
+	// that, like overlay2 on xfs with project quotas.
+	StorageOpt map[string]string
+
+	// ShmSize is the size of /dev/shm in bytes; docker's default is 64MB,
+	// which is too small for browsers, among others.
+	ShmSize int64
+
+	// Tmpfs is a map of container path -> mount options, e.g. "size=512m",
+	// to mount tmpfs filesystems on.
+	Tmpfs map[string]string
+
+	// LogConfig configures the log driver of the container, instead of the
+	// one given with WithLogConfig, or the daemon's default.
+	LogConfig *LogConfig
+
+	// Isolation is the isolation technology of Windows containers:
+	// "process", "hyperv" or "default".
+	Isolation string
+
+	// FakeTime runs the container with libfaketime preloaded, starting its
+	// clock at the libfaketime specification, e.g. "-2d", "+1h" or
+	// "@2030-01-01 00:00:00". Use "+0" to start at the real time. The
+	// clock is changed with Composer.SetFakeTime and Composer.ShiftClock.
+	// See WithFakeTimeImage for where libfaketime comes from.
+	FakeTime string
+
+	// Profiles are the profiles the container belongs to. A container with
+	// profiles is only launched if one of them is selected with WithProfiles;
+	// containers without any are always launched.
+	Profiles []string
+
+	// Only and Except launch the container depending on the environment of
+	// this process, e.g. only in CI. Each is "VAR", which holds if the
+	// variable is set and not empty, or "VAR=value". The container is only
+	// launched if any of Only holds, and none of Except.
+	Only   []string
+	Except []string
+
+	// Condition is called by New to decide whether to launch the container,
+	// after Profiles, Only and Except.
+	Condition func() bool
+
+	id        string            // the container id
+	replicaOf string            // the name of the container this is a replica of
+	exitCode  *int              // container exit code
+	started   time.Time         // when the container was last started
+	restarts  int               // restarts made for MaxRestarts
+	tempDirs  map[string]string // container path -> host dir for TempMounts
+	hostsFile string            // the hosts file made for ExtraHosts
+	fakeTime  string            // the current FakeTime specification
 
 }
 
@@ -92,7 +331,32 @@ type Composer struct {
 	manifest  Manifest
 	options   Options
 	netID     string
-	sigCancel context.CancelFunc
+	sigCancel []context.CancelFunc
+	client    *dc.Client
+
+	mu             sync.Mutex
+	streamMu       sync.Mutex
+	teardownMu     sync.Mutex
+	partitionMu    sync.Mutex
+	followers      map[string]*logFollower
+	sampler        *statsSampler
+	bgCancel       []context.CancelFunc
+	bgWait         sync.WaitGroup
+	crashes        []*ExitError
+	volumes        []string
+	secrets        []string
+	tunnelID       string
+	tunnels        map[string]string // name:port -> local address
+	apiVersion     dc.APIVersion
+	timings        map[string]*Timing
+	partitions     map[[2]string]bool // container ids -> blocked by Partition
+	builds         map[string]*imageBuild
+	expectedExits  map[string]int // container id -> exits caused by duct
+	fakeTimeMu     sync.Mutex
+	fakeTimeLib    []byte // libfaketime, read from the fake time image
+	daemonPlatform string // os/arch of the docker daemon
+	emulated       []PlatformMismatch
+	hooksDue       bool // PostTeardown hooks are to run; guarded by teardownMu
 }
 
 // New constructs a new Composer from a Manifest. A network name must also be
@@ -111,17 +375,67 @@ func New(manifest Manifest, options ...Options) *Composer {
 		}
 	}
 
-	return &Composer{manifest: manifest, options: opts}
+	profiles, _ := opts[optionProfiles].([]string)
+	manifest = manifest.selectProfiles(profiles)
+
+	c := &Composer{options: opts}
+
+	selected := Manifest{}
+	for _, cont := range manifest {
+		if cont.enabled() {
+			selected = append(selected, cont)
+		} else {
+			c.logContainer(LogInfo, cont.Name, "Skipping container: [%s]", cont.Name)
+		}
+	}
+
+	c.manifest = selected.expand()
+
+	return c
 }
 
 // Options is a generic type for options.
 type Options map[string]interface{}
 
 const (
-	optionCreateNetwork       = "create_network"
-	optionCreateNetworkSubnet = "create_network_subnet"
-	optionExistingNetwork     = "existing_network"
-	optionLogWriter           = "log_writer"
+	optionCreateNetwork     = "create_network"
+	optionCreateNetworkIPAM = "create_network_ipam"
+	optionExistingNetwork   = "existing_network"
+	optionLogWriter         = "log_writer"
+	optionLogStream         = "log_stream"
+	optionStatsSampler      = "stats_sampler"
+	optionCrashMonitor      = "crash_monitor"
+	optionProfiles          = "profiles"
+	optionVariables         = "variables"
+	optionGlobalEnv         = "global_env"
+	optionRemoveVolumes     = "remove_volumes"
+	optionVolumes           = "volumes"
+	optionHostGateway       = "host_gateway"
+	optionHostIP            = "host_ip"
+	optionTunnel            = "tunnel"
+	optionDockerContext     = "docker_context"
+	optionClient            = "client"
+	optionTeardownTimeout   = "teardown_timeout"
+	optionOnSignal          = "on_signal"
+	optionParallelism       = "parallelism"
+	optionJSONLogs          = "json_logs"
+	optionLogPrefix         = "log_prefix"
+	optionLogTimestamps     = "log_timestamps"
+	optionLogLevel          = "log_level"
+	optionTracerProvider    = "tracer_provider"
+	optionTimingSummary     = "timing_summary"
+	optionNetworkOptions    = "network_options"
+	optionCgroupParent      = "cgroup_parent"
+	optionLogConfig         = "log_config"
+	optionPullProgress      = "pull_progress"
+	optionRegistryMirror    = "registry_mirror"
+	optionPolicies          = "policies"
+	optionRegistryAuth      = "registry_auth"
+	optionDockerConfigAuth  = "docker_config_auth"
+	optionHooks             = "hooks"
+	optionFakeTimeImage     = "fake_time_image"
+	optionStrictPlatform    = "strict_platform"
+	optionClientTimeouts    = "client_timeouts"
 )
 
 // WithNewNetwork creates a network for use with the manifest.
@@ -129,9 +443,10 @@ func WithNewNetwork(name string) Options {
 	return Options{optionCreateNetwork: name}
 }
 
-// WithNewNetwork creates a network for use with the manifest.
+// WithNewNetworkAndSubnet creates a network with the subnet for use with the
+// manifest. See WithNewNetworkIPAM for more control over its addresses.
 func WithNewNetworkAndSubnet(name, subnet string) Options {
-	return Options{optionCreateNetwork: name, optionCreateNetworkSubnet: subnet}
+	return WithNewNetworkIPAM(name, IPAMPool{Subnet: subnet})
 }
 
 // WithExistingNetwork uses an existing network by ID (*not* name, since
@@ -141,37 +456,45 @@ func WithExistingNetwork(id string) Options {
 }
 
 // WithLogWriter routes all logging output to the specified writer, or to none
-// if nil is pecified
+// if nil is pecified. Logging output is shared by every Composer in the
+// process, so the last one launched with this option sets it for all of them.
 func WithLogWriter(writer io.Writer) Options {
 	return Options{optionLogWriter: writer}
 }
 
-// HandleSignals handles SIGINT and SIGTERM to ensure that containers get
-// cleaned up. It is expected that no other signal handler will be installed
-// afterwards. If the forward argument is true, it will forward the signal back
-// to its own process after deregistering itself as the signal handler,
-// allowing your test suite to exit gracefully. Set it to false to stay out of
-// your way.
-func (c *Composer) HandleSignals(forward bool) {
-	ctx, cancel := context.WithCancel(context.Background())
-	c.sigCancel = cancel
-	sigChan := make(chan os.Signal, 2)
-
-	go func() {
-		select {
-		case sig := <-sigChan:
-			log.Println("Signalled; will terminate containers now")
-			c.Teardown(context.Background())
-			signal.Stop(sigChan) // stop letting us get notified
-			if forward {
-				unix.Kill(os.Getpid(), sig.(syscall.Signal))
-			}
-		case <-ctx.Done():
-			signal.Stop(sigChan)
-		}
-	}()
+// WithLogStream copies the output of every container in the manifest to the
+// specified writer, line by line, for as long as the containers run.
+func WithLogStream(writer io.Writer) Options {
+	return Options{optionLogStream: writer}
+}
+
+// WithRemoveVolumes removes the anonymous volumes of the containers along with
+// them at Teardown, e.g. those images declare for their data directories.
+func WithRemoveVolumes() Options {
+	return Options{optionRemoveVolumes: true}
+}
+
+// WithCgroupParent creates the cgroups of the containers under parent, e.g.
+// one per CI pipeline to account their resource usage, unless they have a
+// CgroupParent of their own.
+func WithCgroupParent(parent string) Options {
+	return Options{optionCgroupParent: parent}
+}
+
+// cgroupParent returns the parent cgroup of the container.
+func (c *Composer) cgroupParent(cont *Container) string {
+	if cont.CgroupParent != "" {
+		return cont.CgroupParent
+	}
+
+	parent, _ := c.options[optionCgroupParent].(string)
+	return parent
+}
 
-	signal.Notify(sigChan, unix.SIGINT, unix.SIGTERM)
+// WithProfiles selects the profiles of containers to launch; see
+// Container.Profiles.
+func WithProfiles(profiles ...string) Options {
+	return Options{optionProfiles: profiles}
 }
 
 // GetNetworkID returns the network identifier of the created network from
@@ -181,244 +504,537 @@ func (c *Composer) GetNetworkID() string {
 	return c.netID
 }
 
+// Client returns the client the composition talks to the docker daemon with.
+// It is nil until the composition is launched.
+func (c *Composer) Client() *dc.Client {
+	return c.client
+}
+
+// find returns the launched container with the name.
+func (c *Composer) find(name string) (*Container, error) {
+	for _, cont := range c.manifest {
+		if cont.Name == name {
+			if cont.id == "" {
+				return nil, fmt.Errorf("container [%s] has not been launched", name)
+			}
+			return cont, nil
+		}
+	}
+
+	return nil, fmt.Errorf("container [%s] is not in the manifest", name)
+}
+
 // internal variable for testing and capturing log dumping from containers
 var containerLogsTarget io.Writer = os.Stdout
 
+// outputMu serializes the process-wide output of the Composers in a process:
+// setting the log writer, and dumping container logs.
+var outputMu sync.Mutex
+
+// networkMu serializes the creation of networks, so Composers launched
+// concurrently with the same network name fail instead of creating two
+// networks with the name.
+var networkMu sync.Mutex
+
 // Launch launches the manifest. On error containers are automatically cleaned
 // up.
 func (c *Composer) Launch(ctx context.Context) error {
-	client, err := dc.NewClientFromEnv()
+	return c.launch(ctx, nil)
+}
+
+// launch launches the manifest, closing the channel in ready for each
+// container once it is ready.
+func (c *Composer) launch(ctx context.Context, ready map[*Container]chan struct{}) (err error) {
+	ctx, end := c.trace(ctx, "duct.Launch", nil)
+	defer func() { end(err) }()
+
+	c.resetTimings()
+	c.resetBuilds()
+	c.resetPlatforms()
+
+	if err := c.manifest.Validate(c.options); err != nil {
+		return err
+	}
+
+	if err := c.preLaunch(ctx); err != nil {
+		return err
+	}
+
+	client, err := c.baseClient()
+	if err != nil {
+		return err
+	}
+
+	if err := pingClient(ctx, client); err != nil {
+		return err
+	}
+
+	c.apiVersion, err = negotiateAPIVersion(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	client, err = versionedClient(client, c.apiVersion)
 	if err != nil {
 		return err
 	}
 
+	if c.logLevel() == LogDebug {
+		client = c.traceClient(client)
+	}
+
+	c.client = client
+
+	if err := c.checkFeatures(); err != nil {
+		return err
+	}
+
+	if c.options[optionCrashMonitor] != nil || c.manifest.restartable() {
+		if err := c.monitorCrashes(); err != nil {
+			return err
+		}
+	}
+
 	if w, ok := c.options[optionLogWriter]; ok {
 		var writer io.Writer = w.(io.Writer)
 		if writer == nil {
 			writer = io.Discard
 		}
+		outputMu.Lock()
 		log.SetOutput(writer)
+		outputMu.Unlock()
 	}
 
 	if c.options[optionCreateNetwork] != nil {
-		var ipam *dc.IPAMOptions
-
-		if subnet, ok := c.options[optionCreateNetworkSubnet]; ok {
-			ipam = &dc.IPAMOptions{
-				Config: []dc.IPAMConfig{
-					{
-						Subnet: subnet.(string),
-					},
-				},
-			}
-		}
-
-		net, err := client.CreateNetwork(dc.CreateNetworkOptions{
-			Name:    c.options[optionCreateNetwork].(string),
-			Driver:  "bridge",
-			Context: ctx,
-			IPAM:    ipam,
-		})
-
-		if err != nil {
+		if err := c.createNetwork(ctx, client); err != nil {
 			return err
 		}
-		c.netID = net.ID
 	} else if c.options[optionExistingNetwork] != nil {
 		c.netID = c.options[optionExistingNetwork].(string)
 	} else {
 		return errors.New("compositions must have a network specified")
 	}
 
-	for _, cont := range c.manifest {
-		if !cont.LocalImage {
-			log.Printf("Pulling docker image: [%s]", cont.Image)
+	if err := c.createVolumes(ctx); err != nil {
+		c.Teardown(ctx)
+		return err
+	}
 
-			if err := client.PullImage(dc.PullImageOptions{Repository: cont.Image}, dc.AuthConfiguration{}); err != nil {
-				c.Teardown(ctx)
-				return err
-			}
+	if c.options[optionTunnel] != nil {
+		if err := c.startTunnel(ctx); err != nil {
+			c.Teardown(ctx)
+			return err
+		}
+	}
+
+	if err := c.launchContainers(ctx, ready); err != nil {
+		c.Teardown(ctx)
+		return err
+	}
+
+	if interval, ok := c.options[optionStatsSampler]; ok {
+		c.startSampler(interval.(time.Duration))
+	}
+
+	if c.options[optionTimingSummary] != nil {
+		c.logTimings()
+	}
+
+	return nil
+}
+
+// createContainer pulls the image of the container and creates it, or adopts
+// it if it is External.
+func (c *Composer) createContainer(ctx context.Context, cont *Container) error {
+	if cont.External {
+		return c.adopt(ctx, cont)
+	}
+
+	spec, err := c.resolve(cont)
+	if err != nil {
+		return err
+	}
+
+	if strings.Contains(cont.Image, "$") {
+		if violations := policyViolations(c.options, spec); len(violations) != 0 {
+			return fmt.Errorf("policy violated: %s", strings.Join(violations, "; "))
+		}
+	}
+
+	if cont.Build != nil {
+		done := c.phase(ctx, "build", cont, "")
+		err := c.buildImage(ctx, spec.Image, *cont.Build, false)
+		done(err)
+		if err != nil {
+			return err
+		}
+	} else if !cont.LocalImage {
+		done := c.phase(ctx, "pull", cont, "Pulling docker image: [%s]", spec.Image)
+		pullCtx, watch := c.watchStream(ctx)
+		err := c.client.PullImage(dc.PullImageOptions{
+			Repository:    spec.Image,
+			Platform:      spec.Platform,
+			OutputStream:  watch.Writer(c.newPullProgress(cont, spec.Image)),
+			RawJSONStream: true,
+			Context:       pullCtx,
+		}, c.auth(cont, spec.Image))
+		err = watch.Done(err)
+		done(err)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := c.checkPlatform(ctx, cont, spec); err != nil {
+		return err
+	}
+
+	if cont.FakeTime != "" {
+		if err := c.addFakeTime(ctx, cont, spec); err != nil {
+			return err
+		}
+	}
+
+	if cont.TraceDir != "" {
+		if err := c.addTrace(ctx, spec); err != nil {
+			return err
+		}
+	}
+
+	if len(cont.ExtraHosts) != 0 {
+		// the file must outlive the container's starts; it is removed with
+		// the temporary mounts
+		f, err := os.CreateTemp("", "duct-hosts-XXXXXX")
+		if err != nil {
+			return err
 		}
+		defer f.Close()
 
-		var hostsfile string
+		cont.hostsFile = f.Name()
 
-		if len(cont.ExtraHosts) != 0 {
-			f, err := os.CreateTemp("", "duct-hosts-XXXXXX")
+		for ip, hostnames := range cont.ExtraHosts {
+			_, err := fmt.Fprintf(f, "%s %s\n", ip, strings.Join(hostnames, " "))
 			if err != nil {
 				return err
 			}
+		}
 
-			defer func(f *os.File) {
-				f.Close()
-				os.Remove(f.Name())
-			}(f)
-
-			for ip, hostnames := range cont.ExtraHosts {
-				_, err := fmt.Fprintf(f, "%s %s\n", ip, strings.Join(hostnames, " "))
-				if err != nil {
-					return err
-				}
+		if c.hostGateway(cont) {
+			ip, err := c.gatewayIP(ctx)
+			if err != nil {
+				return err
 			}
 
-			f.Close()
-			hostsfile = f.Name()
-		}
-
-		mounts := []dc.HostMount{}
-		for host, target := range cont.BindMounts {
-			if !filepath.IsAbs(host) {
-				host, err = filepath.Abs(host)
-				if err != nil {
-					c.Teardown(ctx)
+			if ip != "" {
+				if _, err := fmt.Fprintf(f, "%s %s\n", ip, hostGatewayName); err != nil {
 					return err
 				}
 			}
+		}
 
-			mounts = append(mounts, dc.HostMount{
-				Source: host,
-				Type:   "bind",
-				Target: target,
-			})
+		if err := f.Close(); err != nil {
+			return err
 		}
+	}
 
-		if hostsfile != "" {
-			mounts = append(mounts, dc.HostMount{
-				Source: hostsfile,
-				Type:   "bind",
-				Target: "/etc/hosts",
-			})
+	mounts := []dc.HostMount{}
+	for host, target := range spec.BindMounts {
+		host, err = hostPath(host)
+		if err != nil {
+			return err
 		}
 
-		exposed := map[dc.Port]struct{}{}
-		bindings := map[dc.Port][]dc.PortBinding{}
+		mounts = append(mounts, dc.HostMount{
+			Source: host,
+			Type:   "bind",
+			Target: target,
+		})
+	}
 
-		for from, to := range cont.PortForwards {
-			port := dc.Port(fmt.Sprintf("%d/tcp", to))
-			exposed[port] = struct{}{}
-			bindings[port] = []dc.PortBinding{{
-				HostIP:   "0.0.0.0",
-				HostPort: fmt.Sprintf("%d", from),
-			}}
-		}
+	mounts = append(mounts, spec.volumeMounts()...)
 
-		log.Printf("Creating container: [%s]", cont.Name)
-		ctr, err := client.CreateContainer(dc.CreateContainerOptions{
-			Name: cont.Name,
-			Config: &dc.Config{
-				Hostname:     cont.Name,
-				Image:        cont.Image,
-				Env:          cont.Env,
-				Cmd:          cont.Command,
-				Entrypoint:   cont.Entrypoint,
-				ExposedPorts: exposed,
-			},
-			HostConfig: &dc.HostConfig{
-				Mounts:       mounts,
-				PortBindings: bindings,
-			},
-			NetworkingConfig: &dc.NetworkingConfig{
-				EndpointsConfig: map[string]*dc.EndpointConfig{
-					cont.Name: {
-						NetworkID:         c.netID,
-						Aliases:           []string{cont.Name},
-						IPAddress:         cont.IPv4,
-						GlobalIPv6Address: cont.IPv6,
-					},
+	tempMounts, err := cont.makeTempMounts()
+	if err != nil {
+		return err
+	}
+	mounts = append(mounts, tempMounts...)
+
+	if cont.hostsFile != "" {
+		mounts = append(mounts, dc.HostMount{
+			Source: cont.hostsFile,
+			Type:   "bind",
+			Target: "/etc/hosts",
+		})
+	}
+
+	exposed, bindings := c.portBindings(spec)
+
+	done := c.phase(ctx, "create", cont, "Creating container: [%s]", cont.Name)
+	ctr, err := c.client.CreateContainer(dc.CreateContainerOptions{
+		Name: cont.Name,
+		Config: &dc.Config{
+			Hostname:     cont.Name,
+			Image:        spec.Image,
+			Env:          spec.Env,
+			Cmd:          spec.Command,
+			Entrypoint:   spec.Entrypoint,
+			ExposedPorts: exposed,
+			MacAddress:   cont.MacAddress,
+		},
+		HostConfig: &dc.HostConfig{
+			Mounts:          mounts,
+			VolumesFrom:     spec.VolumesFrom,
+			PortBindings:    bindings,
+			PublishAllPorts: spec.PublishAllPorts,
+			ExtraHosts:      c.extraHosts(cont),
+			Privileged:      cont.Privileged,
+			PidMode:         cont.PidMode,
+			IpcMode:         cont.IpcMode,
+			UTSMode:         cont.UTSMode,
+			Isolation:       cont.Isolation,
+			Runtime:         cont.Runtime,
+			CgroupParent:    c.cgroupParent(cont),
+			CgroupnsMode:    cont.CgroupnsMode,
+
+			BlkioDeviceReadBps:   blockLimits(cont.DeviceReadBps),
+			BlkioDeviceWriteBps:  blockLimits(cont.DeviceWriteBps),
+			BlkioDeviceReadIOps:  blockLimits(cont.DeviceReadIOps),
+			BlkioDeviceWriteIOps: blockLimits(cont.DeviceWriteIOps),
+			LogConfig:            c.logConfig(cont),
+			StorageOpt:           cont.StorageOpt,
+			ShmSize:              cont.ShmSize,
+			Tmpfs:                cont.Tmpfs,
+			Memory:               cont.Memory,
+			MemorySwap:           cont.MemorySwap,
+			MemorySwappiness:     cont.MemorySwappiness,
+			OomScoreAdj:          cont.OomScoreAdj,
+			OOMKillDisable:       oomKillDisable(cont),
+		},
+		NetworkingConfig: &dc.NetworkingConfig{
+			EndpointsConfig: map[string]*dc.EndpointConfig{
+				cont.Name: {
+					NetworkID:         c.netID,
+					Aliases:           cont.aliases(),
+					IPAddress:         cont.IPv4,
+					GlobalIPv6Address: cont.IPv6,
+					MacAddress:        cont.MacAddress,
 				},
 			},
-			Context: ctx,
-		})
+		},
+		Context: ctx,
+	})
+	if err != nil {
+		done(err)
+		return err
+	}
+
+	c.setID(cont, ctr.ID)
+
+	if len(spec.Files) != 0 {
+		c.logf(LogInfo, "Writing %d files into container: [%s]", len(spec.Files), cont.Name)
+		err = c.uploadFiles(ctx, cont, spec.Files)
+	}
+
+	done(err)
+
+	return err
+}
+
+// startContainer starts the container and waits for it to become ready, or
+// to exit if WaitForExit is set, and then runs its PostCommands.
+func (c *Composer) startContainer(ctx context.Context, cont *Container) error {
+	c.mu.Lock()
+	cont.started = time.Now()
+	c.mu.Unlock()
+	if !cont.External {
+		done := c.phase(ctx, "start", cont, "Starting container: [%s]", cont.Name)
+		err := c.client.StartContainerWithContext(cont.id, nil, ctx)
+		done(err)
 		if err != nil {
-			c.Teardown(ctx)
 			return err
 		}
+	}
 
-		cont.id = ctr.ID
+	if c.options[optionLogStream] != nil {
+		c.follow(cont)
 	}
 
-	for _, cont := range c.manifest {
-		log.Printf("Starting container: [%s]", cont.Name)
-		if err := client.StartContainerWithContext(cont.id, nil, ctx); err != nil {
-			c.Teardown(ctx)
+	done := c.phase(ctx, "ready", cont, "")
+	err := c.becomeReady(ctx, cont)
+	done(err)
+	if err != nil {
+		return err
+	}
+
+	for _, command := range cont.postCommands() {
+		done := c.phase(ctx, "post-command", cont, "Running post-command [%s] in container: [%s]", command.argv(), cont.Name)
+		err := c.runPostCommand(ctx, cont, command)
+		done(err)
+		if err != nil {
 			return err
 		}
+	}
 
-		if cont.BootWait != 0 {
-			log.Printf("Sleeping for %v (requested by %q bootWait parameter)", cont.BootWait, cont.Name)
-			time.Sleep(cont.BootWait)
+	return nil
+}
+
+// becomeReady consumes the BootWait of the started container, and then waits
+// for it to exit if WaitForExit is set, or to pass its readiness checks.
+func (c *Composer) becomeReady(ctx context.Context, cont *Container) error {
+	if cont.BootWait != 0 {
+		c.logContainer(LogInfo, cont.Name, "Sleeping for %v (requested by %q bootWait parameter)", cont.BootWait, cont.Name)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(cont.BootWait):
 		}
+	}
 
-		if cont.WaitForExit {
+	if !cont.WaitForExit {
+		return c.waitReady(ctx, cont)
+	}
 
-			code, err := client.WaitContainer(cont.id)
+	code, err := c.client.WaitContainerWithContext(cont.id, ctx)
+	if err != nil {
+		return err
+	}
 
-			if err != nil {
-				c.Teardown(ctx)
-				return err
-			}
+	cont.exitCode = &code
+
+	if code != 0 {
+		// if we have a non-zero code, dump the logs to stdout, in one
+		// piece so they do not interleave with other compositions'
+		buf := &bytes.Buffer{}
+		logsCtx, watch := c.watchStream(ctx)
+		err := c.client.Logs(dc.LogsOptions{
+			Context:      logsCtx,
+			Container:    cont.Name,
+			OutputStream: watch.Writer(buf),
+			ErrorStream:  watch.Writer(buf),
+			Stdout:       true,
+			Stderr:       true,
+		})
+		if err := watch.Done(err); err != nil {
+			c.logContainer(LogWarn, cont.Name, "WARNING: Failed to get logs for [%s]: %v", cont.Name, err)
+		}
 
-			cont.exitCode = &code
+		outputMu.Lock()
+		c.logf(LogError, "Logs from failing container:")
+		(&scrubWriter{c: c, w: containerLogsTarget}).Write(buf.Bytes())
+		outputMu.Unlock()
 
-			if code != 0 {
+		return c.exitError(ctx, cont, nil, code, nil)
+	}
 
-				log.Println("Logs from failing container:")
-				// if we have a non-zero code, dump the logs to stdout
-				if err := client.Logs(dc.LogsOptions{
-					Container:    cont.Name,
-					OutputStream: containerLogsTarget,
-					ErrorStream:  containerLogsTarget,
-					Stdout:       true,
-					Stderr:       true,
-				}); err != nil {
-					log.Printf("WARNING: Failed to get logs for [%s]: %v", cont.Name, err)
-				}
+	return nil
+}
 
-				c.Teardown(ctx)
-				return fmt.Errorf("Container %s had non-zero exit code %d", cont.Name, *cont.exitCode)
-			}
-		} else if cont.AliveFunc != nil {
-			log.Printf("Running aliveFunc for %v", cont.Name)
-			if err := cont.AliveFunc(ctx, client, cont.id); err != nil {
-				c.Teardown(ctx)
-				return err
-			}
-			log.Printf("AliveFunc for %v completed", cont.Name)
+// removeContainer kills and removes the container. It returns false if that
+// failed; a container which is already gone is not a failure.
+func (c *Composer) removeContainer(ctx context.Context, client *dc.Client, cont *Container) bool {
+	done := c.phase(ctx, "remove", cont, "")
+	ok := true
+
+	var notFound *dc.NoSuchContainer
+	var notRunning *dc.ContainerNotRunning
+
+	if cont.WaitForExit {
+		// ensure the container actually exited cleanly
+		if cont.exitCode == nil {
+			c.logContainer(LogError, cont.Name, "Container expected to exit but did not: [%s]", cont.Name)
+			ok = false
 		}
+	} else {
+		c.logContainer(LogInfo, cont.Name, "Killing container: [%s]", cont.Name)
+		err := client.KillContainer(dc.KillContainerOptions{
+			ID:      cont.id,
+			Signal:  dc.SIGKILL,
+			Context: ctx,
+		})
+		if errors.As(err, &notFound) {
+			c.setID(cont, "")
+			done(nil)
+			return true
+		} else if err != nil && !errors.As(err, &notRunning) {
+			c.logf(LogError, "%v", err)
+			ok = false
+		}
+	}
 
-		for _, command := range cont.PostCommands {
-			log.Printf("Running post-command [%s] in container: [%s]", strings.Join(command, " "), cont.Name)
-			exec, err := client.CreateExec(dc.CreateExecOptions{
-				Context:      ctx,
-				Container:    cont.id,
-				Cmd:          command,
-				AttachStderr: true,
-				AttachStdout: true,
-			})
-			if err != nil {
-				c.Teardown(ctx)
-				return err
-			}
+	c.logContainer(LogInfo, cont.Name, "Removing container: [%s]", cont.Name)
+	if err := client.RemoveContainer(dc.RemoveContainerOptions{
+		ID:            cont.id,
+		Force:         true,
+		RemoveVolumes: c.options[optionRemoveVolumes] != nil,
+		Context:       ctx,
+	}); err != nil && !errors.As(err, &notFound) {
+		c.logContainer(LogError, cont.Name, "Error shutting down container: [%s] %v", cont.Name, err)
+		done(err)
+		return false
+	}
 
-			err = client.StartExec(exec.ID, dc.StartExecOptions{
-				OutputStream: os.Stdout,
-				ErrorStream:  os.Stderr,
-				Context:      ctx,
-			})
-			if err != nil {
-				c.Teardown(ctx)
-				return err
-			}
-			ins, err := client.InspectExec(exec.ID)
-			if err != nil {
-				c.Teardown(ctx)
-				return err
-			}
+	if err := waitRemoved(ctx, func(ctx context.Context) error {
+		_, err := client.InspectContainerWithOptions(dc.InspectContainerOptions{ID: cont.id, Context: ctx})
+		return err
+	}); err != nil {
+		c.logContainer(LogError, cont.Name, "Error waiting for removal of container: [%s] %v", cont.Name, err)
+		done(err)
+		return false
+	}
 
-			if ins.ExitCode != 0 {
-				c.Teardown(ctx)
-				return fmt.Errorf("[%s] invalid exit code from postcommand: [%s]", cont.Name, strings.Join(command, " "))
-			}
+	c.setID(cont, "")
+
+	if ok {
+		done(nil)
+	} else {
+		done(fmt.Errorf("[%s] could not be removed", cont.Name))
+	}
+
+	return ok
+}
+
+// defaultAliveTimeout is how long AliveFunc and ReadyFunc may take if
+// AliveTimeout is not set.
+const defaultAliveTimeout = 5 * time.Minute
+
+// waitReady runs the AliveFunc, ReadyFunc and WaitFor readiness checks of the
+// container.
+func (c *Composer) waitReady(ctx context.Context, cont *Container) error {
+	timeout := cont.AliveTimeout
+	if timeout == 0 {
+		timeout = defaultAliveTimeout
+	}
+
+	aliveCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if cont.AliveFunc != nil {
+		c.logContainer(LogInfo, cont.Name, "Running aliveFunc for %v", cont.Name)
+		if err := cont.AliveFunc(aliveCtx, c.client, cont.id); err != nil {
+			return err
 		}
+		c.logContainer(LogInfo, cont.Name, "AliveFunc for %v completed", cont.Name)
+	}
+
+	if cont.ReadyFunc != nil {
+		c.logContainer(LogInfo, cont.Name, "Running readyFunc for %v", cont.Name)
+		info, err := c.containerInfo(aliveCtx, cont)
+		if err != nil {
+			return err
+		}
+
+		if err := cont.ReadyFunc(aliveCtx, info); err != nil {
+			return err
+		}
+		c.logContainer(LogInfo, cont.Name, "ReadyFunc for %v completed", cont.Name)
+	}
+
+	if cont.WaitFor != nil {
+		c.logContainer(LogInfo, cont.Name, "Waiting for %v to become ready", cont.Name)
+		if err := cont.WaitFor(ctx, c, cont); err != nil {
+			return fmt.Errorf("[%s] did not become ready: %w", cont.Name, err)
+		}
+		c.logContainer(LogInfo, cont.Name, "%v is ready", cont.Name)
 	}
 
 	return nil
@@ -427,60 +1043,91 @@ func (c *Composer) Launch(ctx context.Context) error {
 // Teardown kills the container processes in the manifest and removes their
 // containers. In the event of errors, this will continue to attempt to stop
 // and remove everything before returning. It will log the error to stderr.
-func (c *Composer) Teardown(ctx context.Context) error {
-	if c.sigCancel != nil {
-		c.sigCancel()
+//
+// Teardown may be called more than once, and concurrently, e.g. from
+// t.Cleanup and a signal handler: resources which are already gone are
+// skipped, and only those which could not be removed are tried again. It
+// returns once the containers and network are gone, so they can be created
+// again right away, or when the timeout set with WithTeardownTimeout is up.
+func (c *Composer) Teardown(ctx context.Context) (err error) {
+	c.teardownMu.Lock()
+	defer c.teardownMu.Unlock()
+
+	ctx, end := c.trace(ctx, "duct.Teardown", nil)
+	defer func() { end(err) }()
+
+	timeout, ok := c.options[optionTeardownTimeout].(time.Duration)
+	if !ok {
+		timeout = defaultTeardownTimeout
 	}
-	client, err := dc.NewClientFromEnv()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	c.stopSignals()
+
+	c.stopSampler()
+	c.stopBackground()
+	c.stopFollowers()
+
+	c.collectArtifacts(ctx)
+	c.collectTraces(ctx)
+
+	client, err := c.newClient()
 	if err != nil {
+		// the containers cannot be removed without the daemon, but what duct
+		// made on this host can
+		c.closeTunnels()
+		for _, cont := range c.manifest {
+			c.removeTempMounts(cont)
+		}
+		c.postTeardown(ctx)
+
 		return err
 	}
 
 	var errs bool
 
 	for _, cont := range c.manifest {
-		if cont.id != "" {
-
-			if cont.WaitForExit {
-				// ensure the container actually exited cleanly
-				if cont.exitCode == nil {
-					log.Printf("Container expected to exit but did not: [%s]", cont.Name)
-					errs = true
-				}
-			} else {
-				log.Printf("Killing container: [%s]", cont.Name)
-				err := client.KillContainer(dc.KillContainerOptions{
-					ID:      cont.id,
-					Signal:  dc.SIGKILL,
-					Context: ctx,
-				})
-				if err != nil {
-					log.Println(err)
-					errs = true
-				}
+		if cont.External {
+			if cont.id != "" {
+				c.logContainer(LogInfo, cont.Name, "Leaving external container: [%s]", cont.Name)
+				c.setID(cont, "")
 			}
-
-			log.Printf("Removing container: [%s]", cont.Name)
-			if err := client.RemoveContainer(dc.RemoveContainerOptions{ID: cont.id, Force: true, Context: ctx}); err != nil {
-				log.Printf("Error shutting down container: [%s] %v", cont.Name, err)
+		} else if cont.id != "" {
+			if !c.removeContainer(ctx, client, cont) {
 				errs = true
 			}
-
 		} else {
-			log.Printf("Skipping unstarted container: [%s]", cont.Name)
+			c.logContainer(LogInfo, cont.Name, "Skipping unstarted container: [%s]", cont.Name)
 		}
 	}
 
-	if c.options[optionCreateNetwork] != nil {
-		if err := client.RemoveNetwork(c.netID); err != nil {
-			log.Println(err)
+	for _, cont := range c.manifest {
+		if err := c.removeTempMounts(cont); err != nil {
 			errs = true
 		}
 	}
 
+	if !c.removeTunnel(ctx, client) {
+		errs = true
+	}
+
+	if !c.removeVolumes(ctx, client) {
+		errs = true
+	}
+
+	if !c.removeNetwork(ctx, client) {
+		errs = true
+	}
+
+	if !c.postTeardown(ctx) {
+		errs = true
+	}
+
 	if errs {
 		return errors.New("there were errors (see log)")
 	}
 
-	return nil
+	return c.Check()
 }
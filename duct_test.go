@@ -1,11 +1,16 @@
 package duct
 
 import (
+	"archive/tar"
 	"bytes"
 	"context"
+	"fmt"
+	"io"
 	"log"
 	"net"
+	"net/http"
 	"os"
+	"path/filepath"
 	"runtime"
 	"testing"
 	"time"
@@ -54,8 +59,9 @@ func TestBasic(t *testing.T) {
 		t.Fatal("launch succeeded; should not have")
 	}
 
-	if err := c.Teardown(context.Background()); err == nil {
-		t.Fatal("teardown did not fail with an error")
+	// launch tore it down already; doing so again is harmless
+	if err := c.Teardown(context.Background()); err != nil {
+		t.Fatal(err)
 	}
 
 	// start it a second time to make sure it was cleaned up, this time it will
@@ -220,10 +226,19 @@ func TestSignals(t *testing.T) {
 
 	time.Sleep(time.Second)
 
-	if err := c.Teardown(context.Background()); err == nil {
+	client, err := dc.NewClientFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.InspectContainer("target"); err == nil {
 		t.Fatal("signal handling didn't work")
 	}
 
+	if err := c.Teardown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
 	if runtime.NumGoroutine() > count+1 {
 		t.Log("goroutine count increased: ", runtime.NumGoroutine(), count+1)
 		buf := make([]byte, 1024*1024)
@@ -278,7 +293,11 @@ func TestTeardown(t *testing.T) {
 		t.Fatal("Was able to start a duplicate container")
 	}
 
-	if err := c2.Teardown(context.Background()); err == nil {
+	if err := c2.Teardown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c2.find("target"); err == nil {
 		t.Fatal("auto-teardown on failure did not trigger")
 	}
 
@@ -470,3 +489,601 @@ func TestExtraHosts(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestExpectLog(t *testing.T) {
+	c := New(Manifest{
+		{
+			Name:    "logger",
+			Command: []string{"sh", "-c", "echo starting; sleep 1; echo connection accepted from 10.0.0.1; sleep infinity"},
+			Image:   "debian:latest",
+			WaitFor: WaitForLog("^starting$", 1, 10*time.Second),
+		},
+	}, WithNewNetwork("duct-test-network"))
+
+	t.Cleanup(func() {
+		if err := c.Teardown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if err := c.Launch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.ExpectLog(context.Background(), "logger", "connection accepted from", 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.ExpectLog(context.Background(), "logger", "connection refused", time.Second); err == nil {
+		t.Fatal("expected log line that was never emitted")
+	}
+}
+
+func TestEvents(t *testing.T) {
+	c := New(Manifest{
+		{
+			Name:    "short-lived",
+			Command: []string{"sleep", "2"},
+			Image:   "debian:latest",
+		},
+	}, WithNewNetwork("duct-test-network"))
+
+	t.Cleanup(func() {
+		c.Teardown(context.Background())
+	})
+
+	died := make(chan ContainerEvent, 1)
+
+	if err := c.Events(context.Background(), func(ev ContainerEvent) {
+		if ev.Action == "die" {
+			died <- ev
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Launch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case ev := <-died:
+		if ev.Name != "short-lived" || ev.Attributes["exitCode"] != "0" {
+			t.Fatalf("unexpected event: %+v", ev)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("did not receive die event")
+	}
+}
+
+func TestCrashMonitor(t *testing.T) {
+	c := New(Manifest{
+		{
+			Name:    "crasher",
+			Command: []string{"sh", "-c", "sleep 1; exit 3"},
+			Image:   "debian:latest",
+		},
+	}, WithNewNetwork("duct-test-network"), WithCrashMonitor())
+
+	if err := c.Launch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Check(); err != nil {
+		t.Fatalf("crash reported before the container exited: %v", err)
+	}
+
+	time.Sleep(3 * time.Second)
+
+	if err := c.Check(); err == nil {
+		t.Fatal("crash was not detected")
+	}
+
+	if err := c.Teardown(context.Background()); err == nil {
+		t.Fatal("teardown did not report the crash")
+	}
+}
+
+func TestMaxRestarts(t *testing.T) {
+	restarts := make(chan int, 2)
+
+	c := New(Manifest{
+		{
+			Name:        "flapper",
+			Command:     []string{"sh", "-c", "sleep 1; exit 1"},
+			Image:       "debian:latest",
+			MaxRestarts: 2,
+			OnRestart: func(name string, restart int, err error) {
+				if err != nil {
+					t.Errorf("restart %d of %s failed: %v", restart, name, err)
+				}
+				restarts <- restart
+			},
+		},
+	}, WithNewNetwork("duct-test-network"))
+
+	t.Cleanup(func() {
+		c.Teardown(context.Background())
+	})
+
+	if err := c.Launch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 2; i++ {
+		select {
+		case restart := <-restarts:
+			if restart != i {
+				t.Fatalf("expected restart %d, got %d", i, restart)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("container was not restarted a %d time", i)
+		}
+	}
+
+	time.Sleep(3 * time.Second)
+
+	if err := c.Check(); err == nil {
+		t.Fatal("exit after restarts were exhausted was not reported")
+	}
+}
+
+func TestFiles(t *testing.T) {
+	c := New(Manifest{
+		{
+			Name:    "files",
+			Command: []string{"sleep", "infinity"},
+			Image:   "debian:latest",
+			Files: map[string]FileContent{
+				"/etc/duct/config": {Content: []byte("hello\n")},
+			},
+			PostCommands: [][]string{{"grep", "-q", "hello", "/etc/duct/config"}},
+		},
+	}, WithNewNetwork("duct-test-network"))
+
+	t.Cleanup(func() {
+		if err := c.Teardown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if err := c.Launch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTempMounts(t *testing.T) {
+	c := New(Manifest{
+		{
+			Name:        "writer",
+			Command:     []string{"sh", "-c", "echo hello > /out/greeting"},
+			Image:       "debian:latest",
+			TempMounts:  []string{"/out"},
+			WaitForExit: true,
+		},
+	}, WithNewNetwork("duct-test-network"))
+
+	if err := c.Launch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := c.MountPath("writer", "/out")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(dir + "/greeting")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(content) != "hello\n" {
+		t.Fatalf("unexpected content: %q", content)
+	}
+
+	if err := c.Teardown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatal("temporary mount was not removed")
+	}
+}
+
+func TestRemoveVolumes(t *testing.T) {
+	c := New(Manifest{
+		{
+			Name:    "volume",
+			Command: []string{"sleep", "infinity"},
+			Image:   "postgres:latest",
+		},
+	}, WithNewNetwork("duct-test-network"), WithRemoveVolumes())
+
+	if err := c.Launch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := dc.NewClientFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctr, err := client.InspectContainerWithOptions(dc.InspectContainerOptions{ID: c.manifest[0].id})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	volumes := []string{}
+	for _, mount := range ctr.Mounts {
+		if mount.Name != "" {
+			volumes = append(volumes, mount.Name)
+		}
+	}
+
+	if len(volumes) == 0 {
+		t.Fatal("image did not create an anonymous volume")
+	}
+
+	if err := c.Teardown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, volume := range volumes {
+		if _, err := client.InspectVolume(volume); err != dc.ErrNoSuchVolume {
+			t.Fatalf("volume %s was not removed: %v", volume, err)
+		}
+	}
+}
+
+func TestSharedVolumes(t *testing.T) {
+	c := New(Manifest{
+		{
+			Name:        "builder",
+			Command:     []string{"sh", "-c", "echo built > /assets/index.html"},
+			Image:       "debian:latest",
+			Volumes:     map[string]string{"duct-test-assets": "/assets"},
+			WaitForExit: true,
+		},
+		{
+			Name:         "server",
+			Command:      []string{"sleep", "infinity"},
+			Image:        "debian:latest",
+			Volumes:      map[string]string{"duct-test-assets": "/srv"},
+			PostCommands: [][]string{{"grep", "-q", "built", "/srv/index.html"}},
+		},
+		{
+			Name:         "sidecar",
+			Command:      []string{"sleep", "infinity"},
+			Image:        "debian:latest",
+			VolumesFrom:  []string{"server:ro"},
+			PostCommands: [][]string{{"grep", "-q", "built", "/srv/index.html"}},
+		},
+	}, WithNewNetwork("duct-test-network"), WithVolumes("duct-test-assets"))
+
+	t.Cleanup(func() {
+		if err := c.Teardown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if err := c.Launch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHostGateway(t *testing.T) {
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	b := Builder{
+		"nc": {
+			Dockerfile: "testdata/Dockerfile.nc",
+			Context:    ".",
+		},
+	}
+
+	if err := b.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	port := l.Addr().(*net.TCPAddr).Port
+
+	c := New(Manifest{
+		{
+			Name:        "caller",
+			Command:     []string{"nc", "-z", "host.docker.internal", fmt.Sprint(port)},
+			Image:       "nc",
+			LocalImage:  true,
+			WaitForExit: true,
+		},
+		{
+			Name:        "caller-with-hosts",
+			Command:     []string{"nc", "-z", "host.docker.internal", fmt.Sprint(port)},
+			Image:       "nc",
+			LocalImage:  true,
+			WaitForExit: true,
+			ExtraHosts:  map[string][]string{"10.0.0.2": {"example.org"}},
+		},
+	}, WithNewNetwork("duct-test-network"), WithHostGateway())
+
+	t.Cleanup(func() {
+		c.Teardown(context.Background())
+	})
+
+	if err := c.Launch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPublishAllPorts(t *testing.T) {
+	c := New(Manifest{
+		{
+			Name:            "nginx",
+			Image:           "nginx:latest",
+			PublishAllPorts: true,
+			Ports:           []PortForward{{HostIP: "127.0.0.1", ContainerPort: 8000, Count: 3}},
+		},
+	}, WithNewNetwork("duct-test-network"))
+
+	t.Cleanup(func() {
+		c.Teardown(context.Background())
+	})
+
+	if err := c.Launch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	port, err := c.HostPort(context.Background(), "nginx", 80, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Get(fmt.Sprintf("http://localhost:%d", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	for i := 8000; i < 8003; i++ {
+		if _, err := c.HostPort(context.Background(), "nginx", i, "tcp"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestEndpoint(t *testing.T) {
+	c := New(Manifest{
+		{
+			Name:         "nginx",
+			Image:        "nginx:latest",
+			PortForwards: map[int]int{8000: 80},
+		},
+	}, WithNewNetwork("duct-test-network"))
+
+	t.Cleanup(func() {
+		c.Teardown(context.Background())
+	})
+
+	if err := c.Launch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	addr, err := c.Endpoint("nginx", 80)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Get("http://" + addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	ip, err := c.ContainerIP("nginx")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if net.ParseIP(ip) == nil {
+		t.Fatalf("invalid container ip %q", ip)
+	}
+
+	if _, err := c.Endpoint("nginx", 443); err == nil {
+		t.Fatal("got an endpoint for a port that is not forwarded")
+	}
+}
+
+func TestTunnel(t *testing.T) {
+	c := New(Manifest{
+		{
+			Name:  "nginx",
+			Image: "nginx:latest",
+		},
+	}, WithNewNetwork("duct-test-network"), WithTunnel())
+
+	t.Cleanup(func() {
+		c.Teardown(context.Background())
+	})
+
+	if err := c.Launch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	addr, err := c.Endpoint("nginx", 80)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if host, _, _ := net.SplitHostPort(addr); host != "127.0.0.1" {
+		t.Fatalf("endpoint is not a local tunnel: %s", addr)
+	}
+
+	if err := waitUntil(context.Background(), 10*time.Second, func(ctx context.Context) error {
+		resp, err := http.Get("http://" + addr)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if again, _ := c.Endpoint("nginx", 80); again != addr {
+		t.Fatalf("tunnel was not reused: %s != %s", again, addr)
+	}
+}
+
+func TestArchivePath(t *testing.T) {
+	c := New(Manifest{
+		{
+			Name:        "writer",
+			Command:     []string{"sh", "-c", "mkdir /out && echo hello > /out/greeting"},
+			Image:       "debian:latest",
+			WaitForExit: true,
+		},
+	}, WithNewNetwork("duct-test-network"))
+
+	t.Cleanup(func() {
+		if err := c.Teardown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if err := c.Launch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := c.ArchivePath(context.Background(), "writer", "/out", buf); err != nil {
+		t.Fatal(err)
+	}
+
+	tr := tar.NewReader(buf)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			t.Fatalf("greeting is not in the archive: %v", err)
+		}
+
+		if hdr.Name == "out/greeting" {
+			content, err := io.ReadAll(tr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(content) != "hello\n" {
+				t.Fatalf("unexpected content: %q", content)
+			}
+			break
+		}
+	}
+
+	buf.Reset()
+	if err := c.Export(context.Background(), "writer", buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.Len() == 0 {
+		t.Fatal("export is empty")
+	}
+}
+
+func TestCollectArtifacts(t *testing.T) {
+	dir := t.TempDir()
+
+	c := New(Manifest{
+		{
+			Name:             "writer",
+			Command:          []string{"sh", "-c", "mkdir /cover && echo mode: set > /cover/cover.out"},
+			Image:            "debian:latest",
+			WaitForExit:      true,
+			CollectArtifacts: map[string]string{"/cover": dir},
+		},
+		// images are pulled while earlier containers run, so this fails when
+		// it is started, once the writer has exited
+		{
+			Name:        "failing",
+			Command:     []string{"false"},
+			Image:       "debian:latest",
+			DependsOn:   []string{"writer"},
+			WaitForExit: true,
+		},
+	}, WithNewNetwork("duct-test-network"))
+
+	if err := c.Launch(context.Background()); err == nil {
+		t.Fatal("launch of a failing container succeeded")
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, "cover", "cover.out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(content) != "mode: set\n" {
+		t.Fatalf("unexpected content: %q", content)
+	}
+}
+
+func TestPartition(t *testing.T) {
+	c := New(Manifest{
+		{Name: "a", Image: "alpine:latest", Command: []string{"sleep", "infinity"}},
+		{Name: "b", Image: "alpine:latest", Command: []string{"sleep", "infinity"}},
+	}, WithNewNetwork("duct-test-network"))
+
+	t.Cleanup(func() {
+		if err := c.Teardown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if err := c.Launch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ping := func() int {
+		a, err := c.Container("a")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		code, err := a.Exec(context.Background(), []string{"ping", "-c", "1", "-W", "1", "b"}, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return code
+	}
+
+	if code := ping(); code != 0 {
+		t.Fatalf("ping failed before the partition: %d", code)
+	}
+
+	if err := c.Partition(context.Background(), "a", "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := ping(); code == 0 {
+		t.Fatal("ping succeeded across the partition")
+	}
+
+	if err := c.Heal(context.Background(), "b", "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := ping(); code != 0 {
+		t.Fatalf("ping failed after healing: %d", code)
+	}
+}
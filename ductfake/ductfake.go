@@ -0,0 +1,340 @@
+// Package ductfake provides a fake, in-memory docker daemon to launch duct
+// manifests against, so code built on duct can be unit tested on machines
+// without docker. Containers in it have state, ports, files and logs, but run
+// nothing: post-commands succeed unless told to fail with FailExecs, and
+// containers only exit when told to with Exit.
+package ductfake
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/erikh/duct"
+	dc "github.com/fsouza/go-dockerclient"
+	dtesting "github.com/fsouza/go-dockerclient/testing"
+)
+
+// APIVersion is the docker API version the fake daemon reports.
+const APIVersion = "1.41"
+
+// Runtime is a fake docker daemon.
+type Runtime struct {
+	server *dtesting.DockerServer
+	client *dc.Client
+
+	mu        sync.Mutex
+	failCode  int
+	failCount int
+	execCodes map[string]int // exec id -> exit code
+	execs     []dc.CreateExecOptions
+	platforms map[string]string // image -> os/arch
+	watchers  map[chan *dc.APIEvents]struct{}
+
+	stopOnce sync.Once
+	stopped  chan struct{}
+}
+
+// New starts a fake daemon on a local port. Stop it with Stop.
+func New() (*Runtime, error) {
+	server, err := dtesting.NewServer("127.0.0.1:0", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	server.CustomHandler("/version", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"Version":    "20.10.0",
+			"ApiVersion": APIVersion,
+			"Os":         "linux",
+			"Arch":       "amd64",
+		})
+	}))
+
+	client, err := dc.NewClient(server.URL())
+	if err != nil {
+		server.Stop()
+		return nil, err
+	}
+
+	r := &Runtime{
+		server:    server,
+		client:    client,
+		execCodes: map[string]int{},
+		platforms: map[string]string{},
+		watchers:  map[chan *dc.APIEvents]struct{}{},
+		stopped:   make(chan struct{}),
+	}
+	server.CustomHandler(`^(/v[0-9.]+)?/exec/[^/]+/json$`, http.HandlerFunc(r.inspectExec))
+	server.CustomHandler(`^(/v[0-9.]+)?/containers/[^/]+/exec$`, http.HandlerFunc(r.createExec))
+	server.CustomHandler(`^(/v[0-9.]+)?/images/.+/json$`, http.HandlerFunc(r.inspectImage))
+	server.CustomHandler(`^(/v[0-9.]+)?/events$`, http.HandlerFunc(r.events))
+
+	return r, nil
+}
+
+// versionPrefix is the API version a request path may begin with.
+var versionPrefix = regexp.MustCompile(`^/v[0-9.]+/`)
+
+// apiPath returns the path of the request without its API version.
+func apiPath(req *http.Request) string {
+	return versionPrefix.ReplaceAllString(req.URL.Path, "/")
+}
+
+// FailExecs makes the next count commands executed in containers, e.g.
+// post-commands, exit with the code.
+func (r *Runtime) FailExecs(code, count int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.failCode, r.failCount = code, count
+}
+
+// Execs returns the options of the commands executed in containers so far,
+// e.g. post-commands, in order. Container is the id of the container.
+func (r *Runtime) Execs() []dc.CreateExecOptions {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]dc.CreateExecOptions(nil), r.execs...)
+}
+
+// createExec records the options of an exec before creating it.
+func (r *Runtime) createExec(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var opts dc.CreateExecOptions
+	if err := json.Unmarshal(body, &opts); err == nil {
+		opts.Container = strings.Split(strings.TrimPrefix(apiPath(req), "/containers/"), "/")[0]
+
+		r.mu.Lock()
+		r.execs = append(r.execs, opts)
+		r.mu.Unlock()
+	}
+
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	r.server.DefaultHandler().ServeHTTP(w, req)
+}
+
+// inspectExec answers the inspection of an exec with the exit code given to
+// FailExecs, if it is to fail.
+func (r *Runtime) inspectExec(w http.ResponseWriter, req *http.Request) {
+	rec := httptest.NewRecorder()
+	r.server.DefaultHandler().ServeHTTP(rec, req)
+
+	var exec dc.ExecInspect
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &exec) != nil {
+		w.WriteHeader(rec.Code)
+		w.Write(rec.Body.Bytes())
+		return
+	}
+
+	r.mu.Lock()
+	code, ok := r.execCodes[exec.ID]
+	if !ok && r.failCount > 0 {
+		code = r.failCode
+		r.failCount--
+	}
+	r.execCodes[exec.ID] = code
+	r.mu.Unlock()
+
+	exec.ExitCode = code
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(exec)
+}
+
+// SetImagePlatform makes the named image report the platform, e.g.
+// "linux/arm64", as if it had been built for it. Images otherwise report no
+// platform.
+func (r *Runtime) SetImagePlatform(name, platform string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.platforms[name] = platform
+}
+
+// inspectImage answers the inspection of an image with the platform given to
+// SetImagePlatform, if any.
+func (r *Runtime) inspectImage(w http.ResponseWriter, req *http.Request) {
+	rec := httptest.NewRecorder()
+	r.server.DefaultHandler().ServeHTTP(rec, req)
+
+	name := strings.TrimSuffix(strings.TrimPrefix(apiPath(req), "/images/"), "/json")
+
+	r.mu.Lock()
+	platform, ok := r.platforms[name]
+	r.mu.Unlock()
+
+	var image map[string]interface{}
+	if !ok || rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &image) != nil {
+		w.WriteHeader(rec.Code)
+		w.Write(rec.Body.Bytes())
+		return
+	}
+
+	parts := strings.SplitN(platform, "/", 2)
+	image["Os"] = parts[0]
+	if len(parts) == 2 {
+		image["Architecture"] = parts[1]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(image)
+}
+
+// Stop stops the daemon.
+func (r *Runtime) Stop() {
+	r.stopOnce.Do(func() {
+		close(r.stopped)
+		r.server.Stop()
+	})
+}
+
+// Options returns the option that makes a duct.Composer use the daemon.
+func (r *Runtime) Options() duct.Options {
+	return duct.WithClient(r.client)
+}
+
+// Client returns a client of the daemon.
+func (r *Runtime) Client() *dc.Client {
+	return r.client
+}
+
+// AddImage makes the image exist, as containers with LocalImage set need.
+func (r *Runtime) AddImage(name string) error {
+	return r.client.PullImage(dc.PullImageOptions{Repository: name}, dc.AuthConfiguration{})
+}
+
+// Container returns the named container.
+func (r *Runtime) Container(name string) (*dc.Container, error) {
+	return r.client.InspectContainerWithOptions(dc.InspectContainerOptions{ID: name})
+}
+
+// Containers returns the names of all containers, running or not.
+func (r *Runtime) Containers() ([]string, error) {
+	list, err := r.client.ListContainers(dc.ListContainersOptions{All: true})
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, ctr := range list {
+		for _, name := range ctr.Names {
+			names = append(names, strings.TrimPrefix(name, "/"))
+		}
+	}
+
+	return names, nil
+}
+
+// Networks returns the names of all networks.
+func (r *Runtime) Networks() ([]string, error) {
+	list, err := r.client.ListNetworks()
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, network := range list {
+		names = append(names, network.Name)
+	}
+
+	return names, nil
+}
+
+// Exit makes the named container exit with the code, as if its process had.
+func (r *Runtime) Exit(name string, code int) error {
+	ctr, err := r.Container(name)
+	if err != nil {
+		return err
+	}
+
+	state := ctr.State
+	state.Running = false
+	state.ExitCode = code
+
+	if err := r.server.MutateContainer(ctr.ID, state); err != nil {
+		return fmt.Errorf("[%s] %w", name, err)
+	}
+
+	now := time.Now()
+	r.publish(&dc.APIEvents{
+		Type:   "container",
+		Action: "die",
+		Actor: dc.APIActor{
+			ID:         ctr.ID,
+			Attributes: map[string]string{"name": name, "exitCode": fmt.Sprint(code)},
+		},
+		Time:     now.Unix(),
+		TimeNano: now.UnixNano(),
+	})
+
+	return nil
+}
+
+// events streams the events of the daemon, which are the exits made with
+// Exit, until the client goes away or the daemon is stopped.
+func (r *Runtime) events(w http.ResponseWriter, req *http.Request) {
+	events := make(chan *dc.APIEvents, 16)
+
+	r.mu.Lock()
+	r.watchers[events] = struct{}{}
+	r.mu.Unlock()
+
+	defer func() {
+		r.mu.Lock()
+		delete(r.watchers, events)
+		r.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-r.stopped:
+			return
+		case ev := <-events:
+			if err := enc.Encode(ev); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// publish sends the event to the clients streaming events.
+func (r *Runtime) publish(ev *dc.APIEvents) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for events := range r.watchers {
+		select {
+		case events <- ev:
+		default:
+		}
+	}
+}
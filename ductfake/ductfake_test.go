@@ -0,0 +1,371 @@
+package ductfake
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/erikh/duct"
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+func TestLaunch(t *testing.T) {
+	r, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	if err := r.AddImage("local"); err != nil {
+		t.Fatal(err)
+	}
+
+	c := duct.New(duct.Manifest{
+		{
+			Name:         "nginx",
+			Image:        "nginx:latest",
+			PortForwards: map[int]int{8000: 80},
+			PostCommands: [][]string{{"nginx", "-t"}},
+			Files:        map[string]duct.FileContent{"/etc/motd": {Content: []byte("hi")}},
+		},
+		{
+			Name:       "local",
+			Image:      "local",
+			LocalImage: true,
+		},
+	}, duct.WithNewNetwork("duct-test-network"), r.Options())
+
+	if err := c.Launch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := r.Containers()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(names)
+	if !reflect.DeepEqual(names, []string{"local", "nginx"}) {
+		t.Fatalf("unexpected containers: %v", names)
+	}
+
+	ctr, err := r.Container("nginx")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ctr.State.Running {
+		t.Fatal("container is not running")
+	}
+
+	if port, err := c.HostPort(context.Background(), "nginx", 80, ""); err != nil || port != 8000 {
+		t.Fatalf("unexpected host port %d: %v", port, err)
+	}
+
+	if err := c.Teardown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if names, err := r.Containers(); err != nil || len(names) != 0 {
+		t.Fatalf("containers were not removed: %v %v", names, err)
+	}
+
+	if networks, err := r.Networks(); err != nil || len(networks) != 0 {
+		t.Fatalf("network was not removed: %v %v", networks, err)
+	}
+}
+
+func TestExit(t *testing.T) {
+	r, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	c := duct.New(duct.Manifest{
+		{
+			Name:        "migrate",
+			Image:       "debian:latest",
+			WaitForExit: true,
+		},
+	}, duct.WithNewNetwork("duct-test-network"), r.Options())
+
+	errs := make(chan error, 1)
+	go func() { errs <- c.Launch(context.Background()) }()
+
+	for {
+		if ctr, err := r.Container("migrate"); err == nil && ctr.State.Running {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := r.Exit("migrate", 3); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := <-errs; err == nil {
+		t.Fatal("launch succeeded with a failed container")
+	}
+}
+
+func TestExternal(t *testing.T) {
+	r, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	client := r.Client()
+	if err := r.AddImage("redis"); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, labels := range map[string]map[string]string{
+		"ci-redis":    nil,
+		"ci-postgres": {"ci.service": "postgres"},
+	} {
+		ctr, err := client.CreateContainer(dc.CreateContainerOptions{
+			Name:   name,
+			Config: &dc.Config{Image: "redis", Labels: labels},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := client.StartContainer(ctr.ID, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var checked []string
+	alive := func(ctx context.Context, client *dc.Client, id string) error {
+		ctr, err := client.InspectContainerWithOptions(dc.InspectContainerOptions{ID: id})
+		if err != nil {
+			return err
+		}
+		checked = append(checked, ctr.Name)
+		return nil
+	}
+
+	c := duct.New(duct.Manifest{
+		{Name: "ci-redis", External: true, AliveFunc: alive},
+		{Name: "db", External: true, ExternalLabel: "ci.service=postgres", AliveFunc: alive},
+	}, duct.WithNewNetwork("duct-test-network"), r.Options())
+
+	if err := c.Launch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(checked, []string{"ci-redis", "ci-postgres"}) {
+		t.Fatalf("unexpected containers were checked: %v", checked)
+	}
+
+	if err := c.Teardown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := r.Containers()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(names) != 2 {
+		t.Fatalf("external containers were removed: %v", names)
+	}
+
+	c = duct.New(duct.Manifest{{Name: "missing", External: true}}, duct.WithNewNetwork("duct-test-network"), r.Options())
+	if err := c.Launch(context.Background()); err == nil {
+		t.Fatal("adopted a container that does not exist")
+	}
+}
+
+func TestTeardownTwice(t *testing.T) {
+	r, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	c := duct.New(duct.Manifest{
+		{Name: "nginx", Image: "nginx:latest"},
+	}, duct.WithNewNetwork("duct-test-network"), duct.WithVolumes("data"), r.Options())
+
+	if err := c.Launch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() { errs <- c.Teardown(context.Background()) }()
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := c.Teardown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if names, err := r.Containers(); err != nil || len(names) != 0 {
+		t.Fatalf("containers were not removed: %v %v", names, err)
+	}
+}
+
+func TestHandleContext(t *testing.T) {
+	r, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	signalled := make(chan os.Signal, 1)
+
+	c := duct.New(duct.Manifest{
+		{
+			Name:  "nginx",
+			Image: "nginx:latest",
+		},
+	}, duct.WithNewNetwork("duct-test-network"), duct.WithOnSignal(func(sig os.Signal) { signalled <- sig }), r.Options())
+
+	if err := c.Launch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// a stopped handler does nothing when its context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	c.HandleContext(ctx)()
+	cancel()
+
+	select {
+	case <-signalled:
+		t.Fatal("stopped handler tore down the composition")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer c.HandleContext(ctx)()
+	cancel()
+
+	select {
+	case sig := <-signalled:
+		if sig != nil {
+			t.Fatalf("unexpected signal: %v", sig)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler was not called")
+	}
+
+	for i := 0; i < 50; i++ {
+		if names, err := r.Containers(); err == nil && len(names) == 0 {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	t.Fatal("containers were not removed")
+}
+
+func TestCleanupOnPanic(t *testing.T) {
+	r, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	c := duct.New(duct.Manifest{
+		{
+			Name:  "nginx",
+			Image: "nginx:latest",
+		},
+	}, duct.WithNewNetwork("duct-test-network"), r.Options())
+
+	func() {
+		defer func() {
+			if recover() != "boom" {
+				t.Fatal("panic was not propagated")
+			}
+		}()
+		defer c.CleanupOnPanic()
+
+		if err := c.Launch(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		panic("boom")
+	}()
+
+	if names, err := r.Containers(); err != nil || len(names) != 0 {
+		t.Fatalf("containers were not removed: %v %v", names, err)
+	}
+}
+
+func TestGuard(t *testing.T) {
+	r, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	t.Run("launch", func(t *testing.T) {
+		c := duct.New(duct.Manifest{
+			{
+				Name:  "nginx",
+				Image: "nginx:latest",
+			},
+		}, duct.WithNewNetwork("duct-test-network"), r.Options())
+		c.Guard(t)
+
+		if err := c.Launch(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if names, err := r.Containers(); err != nil || len(names) != 0 {
+		t.Fatalf("containers were not removed: %v %v", names, err)
+	}
+}
+
+func TestConcurrentLaunch(t *testing.T) {
+	r, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		go func(i int) {
+			c := duct.New(duct.Manifest{
+				{
+					Name:  fmt.Sprintf("nginx-%d", i),
+					Image: "nginx:latest",
+				},
+			}, duct.WithNewNetwork(fmt.Sprintf("duct-test-network-%d", i)), r.Options())
+
+			if err := c.Launch(context.Background()); err != nil {
+				errs <- err
+				return
+			}
+
+			errs <- c.Teardown(context.Background())
+		}(i)
+	}
+
+	for i := 0; i < 4; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if networks, err := r.Networks(); err != nil || len(networks) != 0 {
+		t.Fatalf("networks were not removed: %v %v", networks, err)
+	}
+}
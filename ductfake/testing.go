@@ -0,0 +1,48 @@
+package ductfake
+
+import (
+	"context"
+	"testing"
+
+	"github.com/erikh/duct"
+)
+
+// Network is the network Compose and Launch create compositions in.
+const Network = "duct-test-network"
+
+// Start starts a fake daemon for the test, which is stopped when it ends.
+func Start(t testing.TB) *Runtime {
+	t.Helper()
+
+	r, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(r.Stop)
+
+	return r
+}
+
+// Compose returns a Composer for the manifest in a new Network of the daemon,
+// with the options. It is torn down when the test ends.
+func (r *Runtime) Compose(t testing.TB, manifest duct.Manifest, options ...duct.Options) *duct.Composer {
+	t.Helper()
+
+	c := duct.New(manifest, append([]duct.Options{duct.WithNewNetwork(Network), r.Options()}, options...)...)
+	t.Cleanup(func() { c.Teardown(context.Background()) })
+
+	return c
+}
+
+// Launch composes the manifest like Compose and launches it, failing the test
+// if the launch fails.
+func (r *Runtime) Launch(t testing.TB, manifest duct.Manifest, options ...duct.Options) *duct.Composer {
+	t.Helper()
+
+	c := r.Compose(t, manifest, options...)
+	if err := c.Launch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
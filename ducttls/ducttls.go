@@ -0,0 +1,211 @@
+// Package ducttls generates throwaway TLS certificates for duct compositions:
+// a certificate authority, and server certificates for containers which are
+// valid for the names they are reachable by. The authority is available to
+// the host test to verify the containers with.
+package ducttls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"path"
+	"time"
+
+	"github.com/erikh/duct"
+)
+
+// Dir is the directory certificates are written to in containers: ca.pem is
+// the authority's certificate, cert.pem the container's certificate and
+// key.pem its key.
+const Dir = "/etc/duct/tls"
+
+// validity is how long certificates are valid for.
+const validity = 24 * time.Hour
+
+// CA is a certificate authority for a single test run.
+type CA struct {
+	// KeyUID and KeyGID own the key files written into containers, which are
+	// only readable by their owner. Set these to the user the containers run
+	// as if it is not root.
+	KeyUID int
+	KeyGID int
+
+	cert    *x509.Certificate
+	certPEM []byte
+	key     *ecdsa.PrivateKey
+}
+
+// NewCA generates a new certificate authority.
+func NewCA() (*CA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "duct test CA"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(validity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CA{
+		cert:    cert,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		key:     key,
+	}, nil
+}
+
+func serialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// CertPEM returns the authority's certificate in PEM format.
+func (ca *CA) CertPEM() []byte {
+	return ca.certPEM
+}
+
+// Pool returns a pool containing only the authority.
+func (ca *CA) Pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+// ClientConfig returns a TLS client configuration trusting only the
+// authority.
+func (ca *CA) ClientConfig() *tls.Config {
+	return &tls.Config{RootCAs: ca.Pool(), MinVersion: tls.VersionTLS12}
+}
+
+// Issue returns a server certificate and key in PEM format, valid for the
+// hosts, which may be names or IP addresses.
+func (ca *CA) Issue(hosts ...string) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	if len(hosts) != 0 {
+		template.Subject.CommonName = hosts[0]
+	}
+
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+		nil
+}
+
+// Apply issues a certificate for each named container in the manifest, or all
+// of them if no names are given, and adds it, its key and the authority's
+// certificate to the container's files in Dir. Certificates are valid for the
+// names the container is reachable by on the network, and for localhost so
+// forwarded ports can be verified from the host.
+func (ca *CA) Apply(manifest duct.Manifest, names ...string) error {
+	selected := map[string]bool{}
+	for _, name := range names {
+		selected[name] = false
+	}
+
+	for _, cont := range manifest {
+		if _, ok := selected[cont.Name]; len(names) != 0 && !ok {
+			continue
+		}
+		selected[cont.Name] = true
+
+		cert, key, err := ca.Issue(hostnames(cont)...)
+		if err != nil {
+			return fmt.Errorf("[%s] %w", cont.Name, err)
+		}
+
+		if cont.Files == nil {
+			cont.Files = map[string]duct.FileContent{}
+		}
+
+		cont.Files[path.Join(Dir, "ca.pem")] = duct.FileContent{Content: ca.certPEM}
+		cont.Files[path.Join(Dir, "cert.pem")] = duct.FileContent{Content: cert}
+		cont.Secrets = append(cont.Secrets, duct.Secret{
+			Name:    "duct-tls-key",
+			Content: key,
+			Target:  path.Join(Dir, "key.pem"),
+			UID:     ca.KeyUID,
+			GID:     ca.KeyGID,
+		})
+	}
+
+	for name, found := range selected {
+		if !found {
+			return fmt.Errorf("container [%s] is not in the manifest", name)
+		}
+	}
+
+	return nil
+}
+
+// hostnames returns the names the container is reachable by.
+func hostnames(cont *duct.Container) []string {
+	hosts := []string{cont.Name}
+
+	for i := 1; i <= cont.Replicas; i++ {
+		hosts = append(hosts, fmt.Sprintf("%s-%d", cont.Name, i))
+	}
+
+	hosts = append(hosts, cont.Aliases...)
+
+	return append(hosts, "localhost", "127.0.0.1", "::1")
+}
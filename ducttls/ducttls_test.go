@@ -0,0 +1,60 @@
+package ducttls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"path"
+	"testing"
+
+	"github.com/erikh/duct"
+)
+
+func TestApply(t *testing.T) {
+	ca, err := NewCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifest := duct.Manifest{
+		{Name: "web", Replicas: 2},
+		{Name: "db"},
+	}
+
+	if err := ca.Apply(manifest, "web"); err != nil {
+		t.Fatal(err)
+	}
+
+	if manifest[1].Files != nil {
+		t.Fatal("certificate was added to a container that was not named")
+	}
+
+	web := manifest[0]
+	if string(web.Files[path.Join(Dir, "ca.pem")].Content) != string(ca.CertPEM()) {
+		t.Fatal("authority was not added")
+	}
+
+	if len(web.Secrets) != 1 || web.Secrets[0].Target != path.Join(Dir, "key.pem") {
+		t.Fatalf("key was not added as a secret: %+v", web.Secrets)
+	}
+
+	if _, err := tls.X509KeyPair(web.Files[path.Join(Dir, "cert.pem")].Content, web.Secrets[0].Content); err != nil {
+		t.Fatal(err)
+	}
+
+	block, _ := pem.Decode(web.Files[path.Join(Dir, "cert.pem")].Content)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, host := range []string{"web", "web-2", "localhost", "127.0.0.1"} {
+		if _, err := cert.Verify(x509.VerifyOptions{DNSName: host, Roots: ca.Pool()}); err != nil {
+			t.Fatalf("certificate is not valid for %s: %v", host, err)
+		}
+	}
+
+	if err := ca.Apply(manifest, "missing"); err == nil {
+		t.Fatal("applied to a container that is not in the manifest")
+	}
+}
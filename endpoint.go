@@ -0,0 +1,94 @@
+package duct
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+// Endpoint returns the host:port address the tcp port of the named container
+// is reachable at from this process: the forwarded port on localhost for a
+// local daemon or Docker Desktop, or on the daemon's host if DOCKER_HOST
+// points at a remote one. With WithTunnel, it is a local tunnel to the port
+// instead, which need not be forwarded.
+func (c *Composer) Endpoint(name string, containerPort int) (string, error) {
+	cont, err := c.find(name)
+	if err != nil {
+		return "", err
+	}
+
+	return c.hostAddr(context.Background(), cont, containerPort)
+}
+
+// ContainerIP returns the address of the named container on the network of
+// the composition. It is generally only reachable from other containers.
+func (c *Composer) ContainerIP(name string) (string, error) {
+	cont, err := c.find(name)
+	if err != nil {
+		return "", err
+	}
+
+	return c.containerIP(context.Background(), cont)
+}
+
+func (c *Composer) containerIP(ctx context.Context, cont *Container) (string, error) {
+	ctr, err := c.client.InspectContainerWithOptions(dc.InspectContainerOptions{ID: cont.id, Context: ctx})
+	if err != nil {
+		return "", err
+	}
+
+	for _, network := range ctr.NetworkSettings.Networks {
+		if network.NetworkID == c.netID && network.IPAddress != "" {
+			return network.IPAddress, nil
+		}
+	}
+
+	if ctr.NetworkSettings.IPAddress != "" {
+		return ctr.NetworkSettings.IPAddress, nil
+	}
+
+	return "", fmt.Errorf("[%s] has no ip address", cont.Name)
+}
+
+// hostAddr returns the address on the host which is forwarded to the
+// container's tcp port, or a tunnel to it.
+func (c *Composer) hostAddr(ctx context.Context, cont *Container, port int) (string, error) {
+	if c.tunnelID != "" {
+		return c.tunnel(cont, port)
+	}
+
+	binding, err := c.hostBinding(ctx, cont, port, "tcp")
+	if err != nil {
+		return "", err
+	}
+
+	host := binding.HostIP
+	switch host {
+	case "", "0.0.0.0", "::":
+		host = endpointHost(c.client.Endpoint())
+	}
+
+	return net.JoinHostPort(host, binding.HostPort), nil
+}
+
+// endpointHost returns the host forwarded ports of the daemon at the endpoint
+// are published on. Daemons reached over a socket are local, or in a VM which
+// forwards them to localhost.
+func endpointHost(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "localhost"
+	}
+
+	switch u.Scheme {
+	case "tcp", "http", "https":
+		if host := u.Hostname(); host != "" {
+			return host
+		}
+	}
+
+	return "localhost"
+}
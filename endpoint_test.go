@@ -0,0 +1,20 @@
+package duct
+
+import "testing"
+
+func TestEndpointHost(t *testing.T) {
+	table := map[string]string{
+		"unix:///var/run/docker.sock":    "localhost",
+		"npipe:////./pipe/docker_engine": "localhost",
+		"tcp://127.0.0.1:2375":           "127.0.0.1",
+		"tcp://docker.example.org:2376":  "docker.example.org",
+		"https://[2001:db8::1]:2376":     "2001:db8::1",
+		"tcp://:2375":                    "localhost",
+	}
+
+	for endpoint, host := range table {
+		if res := endpointHost(endpoint); res != host {
+			t.Fatalf("unexpected host for %q: %q", endpoint, res)
+		}
+	}
+}
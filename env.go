@@ -0,0 +1,286 @@
+package duct
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// WithVariables provides variables for ${VAR} interpolation in the manifest.
+// They take precedence over the environment of the process.
+func WithVariables(vars map[string]string) Options {
+	return Options{optionVariables: vars}
+}
+
+// WithGlobalEnv adds the key=value pairs to the environment of every
+// container. Variables set by a container's Env or EnvFile take precedence.
+func WithGlobalEnv(env []string) Options {
+	return Options{optionGlobalEnv: env}
+}
+
+// lookup returns a variable for interpolation.
+func (c *Composer) lookup(name string) (string, bool) {
+	if vars, ok := c.options[optionVariables].(map[string]string); ok {
+		if val, ok := vars[name]; ok {
+			return val, true
+		}
+	}
+
+	return os.LookupEnv(name)
+}
+
+// interpolate expands variables in s like docker compose does: $VAR and
+// ${VAR} are replaced by the value of VAR, ${VAR:-default} and
+// ${VAR-default} use the default if VAR is empty or unset respectively,
+// ${VAR:?message} and ${VAR?message} fail if VAR is empty or unset, and $$ is
+// a literal $.
+func interpolate(s string, lookup func(string) (string, bool)) (string, error) {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		i++
+
+		switch {
+		case s[i] == '$':
+			b.WriteByte('$')
+		case s[i] == '{':
+			end := closingBrace(s[i:])
+			if end < 0 {
+				return "", fmt.Errorf("unterminated variable in %q", s)
+			}
+
+			val, err := expandBraced(s[i+1:i+end], lookup)
+			if err != nil {
+				return "", err
+			}
+
+			b.WriteString(val)
+			i += end
+		case isVarChar(s[i], true):
+			end := i
+			for end < len(s) && isVarChar(s[end], end == i) {
+				end++
+			}
+
+			val, _ := lookup(s[i:end])
+			b.WriteString(val)
+			i = end - 1
+		default:
+			b.WriteByte('$')
+			b.WriteByte(s[i])
+		}
+	}
+
+	return b.String(), nil
+}
+
+// expandBraced expands the inside of ${...}.
+func expandBraced(expr string, lookup func(string) (string, bool)) (string, error) {
+	end := 0
+	for end < len(expr) && isVarChar(expr[end], end == 0) {
+		end++
+	}
+
+	name, op := expr[:end], expr[end:]
+	if name == "" {
+		return "", fmt.Errorf("invalid variable ${%s}", expr)
+	}
+
+	val, set := lookup(name)
+
+	for _, mod := range []string{":-", "-", ":?", "?"} {
+		if !strings.HasPrefix(op, mod) {
+			continue
+		}
+
+		arg, err := interpolate(op[len(mod):], lookup)
+		if err != nil {
+			return "", err
+		}
+
+		missing := !set || (mod[0] == ':' && val == "")
+		if !missing {
+			return val, nil
+		}
+
+		if strings.HasSuffix(mod, "?") {
+			if arg == "" {
+				arg = "not set"
+			}
+			return "", fmt.Errorf("variable %s: %s", name, arg)
+		}
+
+		return arg, nil
+	}
+
+	if op != "" {
+		return "", fmt.Errorf("invalid variable ${%s}", expr)
+	}
+
+	return val, nil
+}
+
+// closingBrace returns the index of the brace closing the one s starts with,
+// or -1.
+func closingBrace(s string) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+func isVarChar(c byte, first bool) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (!first && c >= '0' && c <= '9')
+}
+
+// readEnvFile reads a dotenv file: KEY=VALUE lines, optionally prefixed with
+// "export", where values may be quoted. Blank lines and lines starting with #
+// are skipped.
+func readEnvFile(filename string) ([]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	env := []string{}
+	scanner := bufio.NewScanner(f)
+
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+
+		key, val, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", filename, lineno)
+		}
+
+		key, val = strings.TrimSpace(key), strings.TrimSpace(val)
+		if len(val) >= 2 && (val[0] == '"' || val[0] == '\'') && val[len(val)-1] == val[0] {
+			val = val[1 : len(val)-1]
+		} else if i := strings.Index(val, " #"); i >= 0 {
+			val = strings.TrimSpace(val[:i])
+		}
+
+		env = append(env, key+"="+val)
+	}
+
+	return env, scanner.Err()
+}
+
+// mergeEnv returns base with the variables in override added, replacing those
+// with the same name.
+func mergeEnv(base, override []string) []string {
+	res := []string{}
+	index := map[string]int{}
+
+	for _, list := range [][]string{base, override} {
+		for _, kv := range list {
+			key, _, _ := strings.Cut(kv, "=")
+			if i, ok := index[key]; ok {
+				res[i] = kv
+				continue
+			}
+
+			index[key] = len(res)
+			res = append(res, kv)
+		}
+	}
+
+	return res
+}
+
+// resolve returns a copy of the container with the global environment and its
+// EnvFiles loaded, variables interpolated, and Secrets added to its Files,
+// ready to be created.
+func (c *Composer) resolve(cont *Container) (*Container, error) {
+	n := cont.clone()
+	n.id = cont.id
+
+	env, _ := c.options[optionGlobalEnv].([]string)
+	for _, filename := range cont.EnvFile {
+		vars, err := readEnvFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("[%s] reading env file: %w", cont.Name, err)
+		}
+		env = mergeEnv(env, vars)
+	}
+	n.Env = mergeEnv(env, n.Env)
+
+	var err error
+	expand := func(s string) string {
+		if err != nil {
+			return s
+		}
+
+		var res string
+		res, err = interpolate(s, c.lookup)
+		return res
+	}
+
+	n.Image = expand(n.Image)
+	if n.Build == nil && !n.LocalImage && !n.External {
+		n.Image = c.mirror(n.Image)
+	}
+
+	for i := range n.Env {
+		n.Env[i] = expand(n.Env[i])
+	}
+
+	for i := range n.Command {
+		n.Command[i] = expand(n.Command[i])
+	}
+
+	if n.BindMounts != nil {
+		n.BindMounts = map[string]string{}
+		for host, target := range cont.BindMounts {
+			n.BindMounts[expand(host)] = expand(target)
+		}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("[%s] %w", cont.Name, err)
+	}
+
+	secrets, secretEnv, err := n.secretFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	c.addSecrets(secrets)
+	n.Env = mergeEnv(n.Env, secretEnv)
+
+	if len(secrets) != 0 {
+		files := copyMap(n.Files)
+		if files == nil {
+			files = map[string]FileContent{}
+		}
+
+		for target, file := range secrets {
+			files[target] = file
+		}
+		n.Files = files
+	}
+
+	return n, nil
+}
@@ -0,0 +1,109 @@
+package duct
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestInterpolate(t *testing.T) {
+	vars := map[string]string{"TAG": "15", "EMPTY": ""}
+	lookup := func(name string) (string, bool) {
+		val, ok := vars[name]
+		return val, ok
+	}
+
+	table := map[string]string{
+		"postgres:${TAG}":         "postgres:15",
+		"postgres:$TAG":           "postgres:15",
+		"${MISSING:-latest}":      "latest",
+		"${EMPTY:-default}":       "default",
+		"${EMPTY-default}":        "",
+		"${MISSING-${TAG}}":       "15",
+		"cost: $$5":               "cost: $5",
+		"$TAG-suffix":             "15-suffix",
+		"trailing $":              "trailing $",
+		"$1 is not a variable":    "$1 is not a variable",
+		"${TAG:?must be set}/end": "15/end",
+	}
+
+	for in, out := range table {
+		res, err := interpolate(in, lookup)
+		if err != nil {
+			t.Fatalf("%q: %v", in, err)
+		}
+
+		if res != out {
+			t.Fatalf("%q: expected %q, got %q", in, out, res)
+		}
+	}
+
+	for _, in := range []string{"${MISSING:?must be set}", "${EMPTY:?}", "${unterminated", "${}"} {
+		if _, err := interpolate(in, lookup); err == nil {
+			t.Fatalf("%q: expected error", in)
+		}
+	}
+}
+
+func TestEnvFile(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "test.env")
+
+	if err := os.WriteFile(filename, []byte(`
+# comment
+export LEVEL=debug
+QUOTED="a # b"
+URL=http://${HOST:-localhost}:8080 # trailing comment
+OVERRIDDEN=file
+`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c := New(Manifest{
+		{
+			Name:       "test",
+			Image:      "debian:${DEBIAN_TAG}",
+			EnvFile:    []string{filename},
+			Env:        []string{"OVERRIDDEN=env"},
+			Command:    []string{"echo", "$LEVEL"},
+			BindMounts: map[string]string{"${DIR}": "/data"},
+		},
+	}, WithVariables(map[string]string{"DEBIAN_TAG": "bookworm", "DIR": dir, "LEVEL": "from-vars"}))
+
+	spec, err := c.resolve(c.manifest[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if spec.Image != "debian:bookworm" {
+		t.Fatalf("unexpected image: %s", spec.Image)
+	}
+
+	expected := []string{"LEVEL=debug", "QUOTED=a # b", "URL=http://localhost:8080", "OVERRIDDEN=env"}
+	if !reflect.DeepEqual(spec.Env, expected) {
+		t.Fatalf("unexpected env: %v", spec.Env)
+	}
+
+	if spec.Command[1] != "from-vars" || spec.BindMounts[dir] != "/data" {
+		t.Fatalf("unexpected interpolation: %v %v", spec.Command, spec.BindMounts)
+	}
+}
+
+func TestGlobalEnv(t *testing.T) {
+	c := New(Manifest{
+		{
+			Name: "test",
+			Env:  []string{"LOG_LEVEL=debug"},
+		},
+	}, WithGlobalEnv([]string{"HTTP_PROXY=http://proxy:3128", "LOG_LEVEL=info"}))
+
+	spec, err := c.resolve(c.manifest[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(spec.Env, []string{"HTTP_PROXY=http://proxy:3128", "LOG_LEVEL=debug"}) {
+		t.Fatalf("unexpected env: %v", spec.Env)
+	}
+}
@@ -0,0 +1,138 @@
+package duct
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+// ContainerEvent is an event docker emitted for a container in the manifest.
+type ContainerEvent struct {
+	// Name is the name of the container in the manifest.
+	Name string
+	// ID is the docker container id.
+	ID string
+	// Action is the docker event action: "die", "oom", or
+	// "health_status: <status>".
+	Action string
+	// Time is the time of the event.
+	Time time.Time
+	// Attributes are the attributes docker attached to the event, e.g. the
+	// exitCode of a die event.
+	Attributes map[string]string
+}
+
+// Events calls fn for every die, oom and health_status event of the containers
+// in the manifest. Events are delivered in order from a separate goroutine
+// until ctx is canceled or the composition is torn down. fn must not call
+// Teardown.
+func (c *Composer) Events(ctx context.Context, fn func(ContainerEvent)) error {
+	client := c.client
+	if client == nil {
+		var err error
+		client, err = c.newClient()
+		if err != nil {
+			return err
+		}
+	}
+
+	events := make(chan *dc.APIEvents, 64)
+	if err := client.AddEventListenerWithOptions(dc.EventsOptions{
+		Filters: map[string][]string{"type": {"container"}},
+	}, events); err != nil {
+		return err
+	}
+
+	c.background(ctx, func(ctx context.Context) {
+		defer client.RemoveEventListener(events)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev, ok := <-events:
+				if !ok {
+					return
+				}
+
+				if ev.Action != "die" && ev.Action != "oom" && !strings.HasPrefix(ev.Action, "health_status") {
+					continue
+				}
+
+				// Recreate changes containers under the lock
+				var match *ContainerEvent
+				c.mu.Lock()
+				for _, cont := range c.manifest {
+					if cont.id != "" && cont.id == ev.Actor.ID {
+						match = &ContainerEvent{
+							Name:       cont.Name,
+							ID:         cont.id,
+							Action:     ev.Action,
+							Time:       time.Unix(0, ev.TimeNano),
+							Attributes: ev.Actor.Attributes,
+						}
+						break
+					}
+				}
+				c.mu.Unlock()
+
+				if match != nil {
+					fn(*match)
+				}
+			}
+		}
+	})
+
+	return nil
+}
+
+// setID records the docker id of the container. The Events goroutine reads it
+// under the lock, while the container is launched and torn down.
+func (c *Composer) setID(cont *Container, id string) {
+	c.mu.Lock()
+	cont.id = id
+	c.mu.Unlock()
+}
+
+// idOf returns the docker id of the container, for code which may run in
+// another goroutine than the one launching or tearing it down.
+func (c *Composer) idOf(cont *Container) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return cont.id
+}
+
+// background runs fn in a goroutine with a context that is also canceled by
+// Teardown, which waits for fn to return.
+func (c *Composer) background(ctx context.Context, fn func(context.Context)) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	c.mu.Lock()
+	c.bgCancel = append(c.bgCancel, cancel)
+	c.mu.Unlock()
+
+	c.bgWait.Add(1)
+	go func() {
+		defer c.bgWait.Done()
+		defer cancel()
+		fn(ctx)
+	}()
+}
+
+// stopBackground cancels all goroutines started with background and waits
+// for them.
+func (c *Composer) stopBackground() {
+	c.mu.Lock()
+	cancels := c.bgCancel
+	c.bgCancel = nil
+	c.mu.Unlock()
+
+	for _, cancel := range cancels {
+		cancel()
+	}
+
+	c.bgWait.Wait()
+}
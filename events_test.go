@@ -0,0 +1,60 @@
+package duct_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/erikh/duct"
+	"github.com/erikh/duct/ductfake"
+)
+
+func TestEventsDuringRecreate(t *testing.T) {
+	r := ductfake.Start(t)
+
+	c := r.Launch(t, duct.Manifest{
+		{Name: "db", Image: "postgres:latest"},
+		{Name: "web", Image: "nginx:latest"},
+	})
+
+	events := make(chan duct.ContainerEvent, 64)
+	if err := c.Events(context.Background(), func(ev duct.ContainerEvent) { events <- ev }); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := c.ContainerID("db")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// events of [db] are matched against the ids of all containers while
+	// [web] gets new ones
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			if err := c.Recreate(context.Background(), "web", func(*duct.Container) {}); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 10; i++ {
+		if err := r.Exit("db", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+
+	for i := 0; i < 10; i++ {
+		select {
+		case ev := <-events:
+			if ev.Name != "db" || ev.ID != id || ev.Action != "die" {
+				t.Fatalf("unexpected event: %+v", ev)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event for the exited container")
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package duct
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+// exitLogLines is the number of lines of output included in an ExitError.
+const exitLogLines = 20
+
+// ExitError is returned when a container exits unexpectedly, or with a
+// non-zero code when WaitForExit is set, or when a post-command fails. It
+// carries what duct could find out about why.
+type ExitError struct {
+	// Container is the name of the container.
+	Container string
+	// Command is the failed post-command, if it was one.
+	Command []string
+	// ExitCode is the exit code of the container or post-command.
+	ExitCode int
+	// OOMKilled is true if the kernel killed the container for running out of
+	// memory.
+	OOMKilled bool
+	// Logs are the last lines of output of the container or post-command.
+	Logs []string
+}
+
+func (e *ExitError) Error() string {
+	var msg string
+	if e.Command != nil {
+		msg = fmt.Sprintf("[%s] invalid exit code %d from postcommand: [%s]", e.Container, e.ExitCode, strings.Join(e.Command, " "))
+	} else {
+		msg = fmt.Sprintf("[%s] exited with code %d", e.Container, e.ExitCode)
+	}
+
+	if e.OOMKilled {
+		msg += " (OOM killed)"
+	}
+
+	if len(e.Logs) != 0 {
+		msg += "; last output:\n" + strings.Join(e.Logs, "\n")
+	}
+
+	return msg
+}
+
+// exitError inspects the container to describe how it or the post-command
+// exited. logs are the post-command's output; the container's are fetched if
+// it is nil.
+func (c *Composer) exitError(ctx context.Context, cont *Container, command []string, code int, logs []string) *ExitError {
+	e := &ExitError{Container: cont.Name, Command: command, ExitCode: code, Logs: logs}
+	id := c.idOf(cont)
+
+	ctr, err := c.client.InspectContainerWithOptions(dc.InspectContainerOptions{ID: id, Context: ctx})
+	if err != nil {
+		c.logContainer(LogWarn, cont.Name, "WARNING: Failed to inspect [%s]: %v", cont.Name, err)
+	} else {
+		e.OOMKilled = ctr.State.OOMKilled
+		if command == nil {
+			e.ExitCode = ctr.State.ExitCode
+		}
+	}
+
+	if logs == nil {
+		tail := &tailWriter{max: exitLogLines}
+		logsCtx, watch := c.watchStream(ctx)
+		err := c.client.Logs(dc.LogsOptions{
+			Context:      logsCtx,
+			Container:    id,
+			OutputStream: watch.Writer(tail),
+			ErrorStream:  watch.Writer(tail),
+			Stdout:       true,
+			Stderr:       true,
+			Tail:         fmt.Sprint(exitLogLines),
+		})
+		if err := watch.Done(err); err != nil {
+			c.logContainer(LogWarn, cont.Name, "WARNING: Failed to get logs for [%s]: %v", cont.Name, err)
+		}
+		e.Logs = tail.Lines()
+	}
+
+	e.Logs = c.scrubLines(e.Logs)
+
+	return e
+}
+
+// tailWriter retains the last max lines written to it.
+type tailWriter struct {
+	max     int
+	lines   []string
+	partial []byte
+}
+
+func (tw *tailWriter) Write(p []byte) (int, error) {
+	tw.partial = append(tw.partial, p...)
+
+	for {
+		i := bytes.IndexByte(tw.partial, '\n')
+		if i < 0 {
+			break
+		}
+
+		tw.lines = append(tw.lines, string(tw.partial[:i]))
+		tw.partial = tw.partial[i+1:]
+
+		if len(tw.lines) > tw.max {
+			tw.lines = tw.lines[len(tw.lines)-tw.max:]
+		}
+	}
+
+	return len(p), nil
+}
+
+// Lines returns the retained lines, including an unterminated last line.
+func (tw *tailWriter) Lines() []string {
+	lines := append([]string{}, tw.lines...)
+	if len(tw.partial) != 0 {
+		lines = append(lines, string(tw.partial))
+	}
+
+	if len(lines) > tw.max {
+		lines = lines[len(lines)-tw.max:]
+	}
+
+	return lines
+}
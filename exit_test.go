@@ -0,0 +1,27 @@
+package duct
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExitError(t *testing.T) {
+	tail := &tailWriter{max: 2}
+	tail.Write([]byte("one\ntwo\nthr"))
+	tail.Write([]byte("ee\nfour"))
+
+	lines := tail.Lines()
+	if strings.Join(lines, ",") != "three,four" {
+		t.Fatalf("unexpected tail: %v", lines)
+	}
+
+	e := &ExitError{Container: "db", ExitCode: 137, OOMKilled: true, Logs: lines}
+	if e.Error() != "[db] exited with code 137 (OOM killed); last output:\nthree\nfour" {
+		t.Fatalf("unexpected message: %q", e.Error())
+	}
+
+	e = &ExitError{Container: "db", Command: []string{"false"}, ExitCode: 1}
+	if e.Error() != "[db] invalid exit code 1 from postcommand: [false]" {
+		t.Fatalf("unexpected message: %q", e.Error())
+	}
+}
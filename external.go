@@ -0,0 +1,47 @@
+package duct
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+// adopt finds the running container described by an External container.
+func (c *Composer) adopt(ctx context.Context, cont *Container) error {
+	filters := map[string][]string{"name": {"^/?" + regexp.QuoteMeta(cont.Name) + "$"}}
+	if cont.ExternalLabel != "" {
+		filters = map[string][]string{"label": {cont.ExternalLabel}}
+	}
+
+	list, err := c.client.ListContainers(dc.ListContainersOptions{Filters: filters, Context: ctx})
+	if err != nil {
+		return err
+	}
+
+	ids := []string{}
+	for _, ctr := range list {
+		if cont.ExternalLabel != "" {
+			ids = append(ids, ctr.ID)
+			continue
+		}
+
+		for _, name := range ctr.Names {
+			if name == "/"+cont.Name {
+				ids = append(ids, ctr.ID)
+			}
+		}
+	}
+
+	switch len(ids) {
+	case 0:
+		return fmt.Errorf("[%s] no running container to adopt", cont.Name)
+	case 1:
+		c.logContainer(LogInfo, cont.Name, "Adopting external container: [%s]", cont.Name)
+		c.setID(cont, ids[0])
+		return nil
+	default:
+		return fmt.Errorf("[%s] %d running containers have the label %q", cont.Name, len(ids), cont.ExternalLabel)
+	}
+}
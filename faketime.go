@@ -0,0 +1,275 @@
+package duct
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+const (
+	// DefaultFakeTimeImage is the image libfaketime is read from by
+	// default. duct builds it from Debian's package when it is missing.
+	DefaultFakeTimeImage = "duct-libfaketime:bookworm"
+
+	// fakeTimeBase is the image DefaultFakeTimeImage is built from.
+	fakeTimeBase = "debian:bookworm-slim"
+
+	// fakeTimeImageLibrary is where libfaketime is in the fake time image.
+	fakeTimeImageLibrary = "/libfaketime.so.1"
+
+	fakeTimeLibrary = "/usr/local/lib/duct/libfaketime.so.1"
+	fakeTimeRC      = "/etc/duct-faketime.rc"
+)
+
+// fakeTimeSpec matches the libfaketime specifications duct accepts:
+// absolute times and relative offsets.
+var fakeTimeSpec = regexp.MustCompile(`^(@\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}|[+-]?\d+(\.\d+)?[smhdy]?)$`)
+
+// WithFakeTimeImage reads libfaketime for containers with FakeTime from
+// image, at /libfaketime.so.1, instead of DefaultFakeTimeImage. It must be
+// built for the C library of the containers; Debian's works with glibc
+// images, but not Alpine's. Statically linked programs, like most Go
+// programs, ignore it.
+func WithFakeTimeImage(image string) Options {
+	return Options{optionFakeTimeImage: image}
+}
+
+// addFakeTime adds libfaketime, preloaded, and the clock of the container to
+// the resolved container spec.
+func (c *Composer) addFakeTime(ctx context.Context, cont, spec *Container) error {
+	lib, err := c.fakeTimeLibrary(ctx)
+	if err != nil {
+		return fmt.Errorf("[%s] could not get libfaketime: %w", cont.Name, err)
+	}
+
+	files := copyMap(spec.Files)
+	if files == nil {
+		files = map[string]FileContent{}
+	}
+	files[fakeTimeLibrary] = FileContent{Content: lib, Mode: 0755}
+	files[fakeTimeRC] = FileContent{Content: []byte(cont.FakeTime + "\n")}
+	spec.Files = files
+
+	preload := fakeTimeLibrary
+	for _, kv := range spec.Env {
+		if strings.HasPrefix(kv, "LD_PRELOAD=") && kv != "LD_PRELOAD=" {
+			preload += ":" + strings.TrimPrefix(kv, "LD_PRELOAD=")
+		}
+	}
+
+	spec.Env = mergeEnv(spec.Env, []string{
+		"LD_PRELOAD=" + preload,
+		"FAKETIME_TIMESTAMP_FILE=" + fakeTimeRC,
+		// read the clock on every call, so changes apply at once
+		"FAKETIME_NO_CACHE=1",
+		"FAKETIME_DONT_RESET=1",
+	})
+
+	cont.fakeTime = cont.FakeTime
+
+	return nil
+}
+
+// fakeTimeLibrary returns libfaketime from the fake time image, building
+// DefaultFakeTimeImage if it is used and missing, or pulling the image given
+// with WithFakeTimeImage. It is read once per composition.
+func (c *Composer) fakeTimeLibrary(ctx context.Context) ([]byte, error) {
+	c.fakeTimeMu.Lock()
+	defer c.fakeTimeMu.Unlock()
+
+	if c.fakeTimeLib != nil {
+		return c.fakeTimeLib, nil
+	}
+
+	image, _ := c.options[optionFakeTimeImage].(string)
+	if image == "" {
+		image = DefaultFakeTimeImage
+	}
+
+	if _, err := c.client.InspectImage(image); err == dc.ErrNoSuchImage {
+		if image == DefaultFakeTimeImage {
+			err = c.buildFakeTimeImage(ctx)
+		} else {
+			image = c.mirror(image)
+			c.logf(LogInfo, "Pulling docker image: [%s]", image)
+			err = c.pullImage(ctx, image)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	// the container is never started, so the image needs no command
+	ctr, err := c.client.CreateContainer(dc.CreateContainerOptions{
+		Config:  &dc.Config{Image: image, Entrypoint: []string{fakeTimeImageLibrary}},
+		Context: ctx,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer c.client.RemoveContainer(dc.RemoveContainerOptions{ID: ctr.ID, Force: true, Context: context.Background()})
+
+	archive := &bytes.Buffer{}
+	downloadCtx, watch := c.watchStream(ctx)
+	err = c.client.DownloadFromContainer(ctr.ID, dc.DownloadFromContainerOptions{
+		Path:         fakeTimeImageLibrary,
+		OutputStream: watch.Writer(archive),
+		Context:      downloadCtx,
+	})
+	if err := watch.Done(err); err != nil {
+		return nil, err
+	}
+
+	lib, err := untarFile(archive)
+	if err != nil {
+		return nil, fmt.Errorf("%s in %s: %w", fakeTimeImageLibrary, image, err)
+	}
+
+	c.fakeTimeLib = lib
+
+	return lib, nil
+}
+
+// buildFakeTimeImage builds DefaultFakeTimeImage.
+func (c *Composer) buildFakeTimeImage(ctx context.Context) error {
+	dockerfile := fmt.Sprintf(`FROM %s
+RUN apt-get update && apt-get install -y --no-install-recommends libfaketime && cp /usr/lib/*/faketime/libfaketime.so.1 %s && rm -rf /var/lib/apt/lists/*
+`, c.mirror(fakeTimeBase), fakeTimeImageLibrary)
+
+	buildContext, err := tarFiles(map[string]FileContent{"/Dockerfile": {Content: []byte(dockerfile)}})
+	if err != nil {
+		return err
+	}
+
+	c.logf(LogInfo, "Building image: [%s]", DefaultFakeTimeImage)
+
+	output := &tailWriter{max: exitLogLines}
+	if err := c.client.BuildImage(dc.BuildImageOptions{
+		Name:         DefaultFakeTimeImage,
+		InputStream:  buildContext,
+		OutputStream: output,
+		Context:      ctx,
+	}); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.Join(output.Lines(), "\n"))
+	}
+
+	return nil
+}
+
+// untarFile returns the contents of the first regular file in the archive.
+func untarFile(r io.Reader) ([]byte, error) {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no file in the archive")
+		} else if err != nil {
+			return nil, err
+		}
+
+		if header.Typeflag == tar.TypeReg {
+			return io.ReadAll(tr)
+		}
+	}
+}
+
+// SetFakeTime sets the clock of the named container, which must have been
+// launched with FakeTime, to the libfaketime specification, e.g. "+30d" to
+// move it thirty days ahead of the real time. Processes see the change on
+// their next clock read.
+func (c *Composer) SetFakeTime(ctx context.Context, name, spec string) error {
+	cont, err := c.find(name)
+	if err != nil {
+		return err
+	}
+
+	if cont.fakeTime == "" {
+		return fmt.Errorf("[%s] was not launched with FakeTime", name)
+	}
+
+	if !fakeTimeSpec.MatchString(spec) {
+		return fmt.Errorf("[%s] invalid fake time %q", name, spec)
+	}
+
+	c.logContainer(LogInfo, name, "Setting fake time of container: [%s] %s", name, spec)
+
+	if err := c.uploadFiles(ctx, cont, map[string]FileContent{fakeTimeRC: {Content: []byte(spec + "\n")}}); err != nil {
+		return err
+	}
+
+	cont.fakeTime = spec
+
+	return nil
+}
+
+// ShiftClock moves the clock of the named container, which must have been
+// launched with FakeTime, by d from where it is, e.g. past the expiry of a
+// certificate or the next run of a scheduled job. Its fake time must be
+// relative to the real time, not an absolute "@" time.
+func (c *Composer) ShiftClock(ctx context.Context, name string, d time.Duration) error {
+	cont, err := c.find(name)
+	if err != nil {
+		return err
+	}
+
+	offset, err := fakeTimeOffset(cont.fakeTime)
+	if err != nil {
+		return fmt.Errorf("[%s] cannot shift the clock: %w", name, err)
+	}
+
+	return c.SetFakeTime(ctx, name, formatFakeTimeOffset(offset+d))
+}
+
+// fakeTimeUnits are the durations of the units of libfaketime offsets.
+var fakeTimeUnits = map[string]time.Duration{
+	"":  time.Second,
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+	"d": 24 * time.Hour,
+	"y": 365 * 24 * time.Hour,
+}
+
+// fakeTimeOffset returns the offset from the real time of a relative
+// libfaketime specification.
+func fakeTimeOffset(spec string) (time.Duration, error) {
+	if spec == "" {
+		return 0, fmt.Errorf("no fake time")
+	}
+
+	if !fakeTimeSpec.MatchString(spec) || strings.HasPrefix(spec, "@") {
+		return 0, fmt.Errorf("fake time %q is not an offset", spec)
+	}
+
+	number := strings.TrimRight(spec, "smhdy")
+	unit := fakeTimeUnits[spec[len(number):]]
+
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(value * float64(unit)), nil
+}
+
+// formatFakeTimeOffset returns the libfaketime specification of the offset,
+// in seconds.
+func formatFakeTimeOffset(d time.Duration) string {
+	seconds := strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+	if d >= 0 {
+		seconds = "+" + seconds
+	}
+
+	return seconds + "s"
+}
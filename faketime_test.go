@@ -0,0 +1,87 @@
+package duct
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFakeTimeOffset(t *testing.T) {
+	table := map[string]time.Duration{
+		"+0":    0,
+		"+90":   90 * time.Second,
+		"-2d":   -48 * time.Hour,
+		"+1.5h": 90 * time.Minute,
+		"+1y":   365 * 24 * time.Hour,
+	}
+
+	for spec, expected := range table {
+		offset, err := fakeTimeOffset(spec)
+		if err != nil {
+			t.Fatalf("%s: %v", spec, err)
+		}
+		if offset != expected {
+			t.Fatalf("unexpected offset for %s: %v", spec, offset)
+		}
+	}
+
+	for _, spec := range []string{"", "@2030-01-01 00:00:00", "tomorrow"} {
+		if _, err := fakeTimeOffset(spec); err == nil {
+			t.Fatalf("%q is not an offset", spec)
+		}
+	}
+
+	for d, expected := range map[time.Duration]string{0: "+0s", 36 * time.Hour: "+129600s", -1500 * time.Millisecond: "-1.5s"} {
+		if spec := formatFakeTimeOffset(d); spec != expected {
+			t.Fatalf("unexpected specification for %v: %s", d, spec)
+		}
+	}
+}
+
+func TestAddFakeTime(t *testing.T) {
+	c := New(Manifest{{Name: "app", Image: "debian", FakeTime: "-2d", Env: []string{"LD_PRELOAD=/lib/other.so"}}})
+	c.fakeTimeLib = []byte("lib")
+
+	cont := c.manifest[0]
+	spec := cont.clone()
+	if err := c.addFakeTime(context.Background(), cont, spec); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(spec.Files[fakeTimeRC].Content) != "-2d\n" || string(spec.Files[fakeTimeLibrary].Content) != "lib" {
+		t.Fatalf("unexpected files: %v", spec.Files)
+	}
+
+	env := strings.Join(spec.Env, " ")
+	if !strings.Contains(env, "LD_PRELOAD="+fakeTimeLibrary+":/lib/other.so ") || !strings.Contains(env, "FAKETIME_TIMESTAMP_FILE="+fakeTimeRC) {
+		t.Fatalf("unexpected environment: %v", spec.Env)
+	}
+
+	if cont.Files != nil {
+		t.Fatalf("the container was modified: %v", cont.Files)
+	}
+
+	// as if launched; neither call reaches docker
+	cont.id = "app-id"
+
+	if err := c.SetFakeTime(context.Background(), "app", "next week"); err == nil || !strings.Contains(err.Error(), "invalid fake time") {
+		t.Fatalf("unexpected error for an invalid fake time: %v", err)
+	}
+
+	cont.fakeTime = "@2030-01-01 00:00:00"
+	if err := c.ShiftClock(context.Background(), "app", time.Hour); err == nil || !strings.Contains(err.Error(), "not an offset") {
+		t.Fatalf("unexpected error shifting an absolute fake time: %v", err)
+	}
+}
+
+func TestValidateFakeTime(t *testing.T) {
+	err := Manifest{{Name: "app", Image: "debian", FakeTime: "yesterday"}}.Validate()
+	if err == nil || !strings.Contains(err.Error(), `[app] has an invalid fake time "yesterday"`) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := (Manifest{{Name: "app", Image: "debian", FakeTime: "@2030-01-01 00:00:00"}}).Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
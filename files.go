@@ -0,0 +1,123 @@
+package duct
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+// FileContent is a file duct writes into a container before starting it.
+type FileContent struct {
+	// Content is the contents of the file.
+	Content []byte
+	// Mode is the permissions of the file; the default is 0644.
+	Mode os.FileMode
+	// UID and GID own the file; the default is root.
+	UID int
+	GID int
+}
+
+// tarFiles archives the files, keyed by absolute path, for uploading to the
+// root of a container.
+func tarFiles(files map[string]FileContent) (*bytes.Buffer, error) {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+
+	paths := []string{}
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	now := time.Now()
+
+	for _, p := range paths {
+		if !path.IsAbs(p) {
+			return nil, fmt.Errorf("file path %q is not absolute", p)
+		}
+
+		file := files[p]
+		mode := file.Mode
+		if mode == 0 {
+			mode = 0644
+		}
+
+		if err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     path.Clean(p)[1:],
+			Size:     int64(len(file.Content)),
+			Mode:     int64(mode.Perm()),
+			Uid:      file.UID,
+			Gid:      file.GID,
+			ModTime:  now,
+		}); err != nil {
+			return nil, err
+		}
+
+		if _, err := tw.Write(file.Content); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+// uploadFiles writes the files into the container.
+func (c *Composer) uploadFiles(ctx context.Context, cont *Container, files map[string]FileContent) error {
+	buf, err := tarFiles(files)
+	if err != nil {
+		return fmt.Errorf("[%s] %w", cont.Name, err)
+	}
+
+	return c.client.UploadToContainer(cont.id, dc.UploadToContainerOptions{
+		Context:     ctx,
+		InputStream: buf,
+		Path:        "/",
+	})
+}
+
+// Export writes the filesystem of the named container to w as a tar archive.
+func (c *Composer) Export(ctx context.Context, name string, w io.Writer) error {
+	cont, err := c.find(name)
+	if err != nil {
+		return err
+	}
+
+	ctx, watch := c.watchStream(ctx)
+
+	return watch.Done(c.client.ExportContainer(dc.ExportContainerOptions{
+		ID:           cont.id,
+		OutputStream: watch.Writer(w),
+		Context:      ctx,
+	}))
+}
+
+// ArchivePath writes the file or directory at path in the named container to
+// w as a tar archive, e.g. to keep reports or coverage profiles written by
+// the container. The container need not be running.
+func (c *Composer) ArchivePath(ctx context.Context, name, path string, w io.Writer) error {
+	cont, err := c.find(name)
+	if err != nil {
+		return err
+	}
+
+	ctx, watch := c.watchStream(ctx)
+
+	return watch.Done(c.client.DownloadFromContainer(cont.id, dc.DownloadFromContainerOptions{
+		Path:         path,
+		OutputStream: watch.Writer(w),
+		Context:      ctx,
+	}))
+}
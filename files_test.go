@@ -0,0 +1,42 @@
+package duct
+
+import (
+	"archive/tar"
+	"io"
+	"testing"
+)
+
+func TestTarFiles(t *testing.T) {
+	buf, err := tarFiles(map[string]FileContent{
+		"/etc/app/config.yml": {Content: []byte("level: debug\n")},
+		"/run/token":          {Content: []byte("secret"), Mode: 0400, UID: 999},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr := tar.NewReader(buf)
+
+	hdr, err := tr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, _ := io.ReadAll(tr)
+	if hdr.Name != "etc/app/config.yml" || hdr.Mode != 0644 || string(content) != "level: debug\n" {
+		t.Fatalf("unexpected entry: %+v %q", hdr, content)
+	}
+
+	hdr, err = tr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hdr.Name != "run/token" || hdr.Mode != 0400 || hdr.Uid != 999 {
+		t.Fatalf("unexpected entry: %+v", hdr)
+	}
+
+	if _, err := tarFiles(map[string]FileContent{"relative": {}}); err == nil {
+		t.Fatal("relative path was accepted")
+	}
+}
@@ -0,0 +1,177 @@
+// Package fixtures launches database containers from snapshots of their
+// setup. A Fixture's container is booted, migrated and seeded once, and the
+// result committed to an image; tests then launch that image, which takes
+// about as long as starting the database, instead of repeating the setup.
+package fixtures
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/erikh/duct"
+)
+
+// Fixture is a database container and the setup to snapshot it after.
+//
+// Volumes are not part of the snapshot, and many database images declare one
+// for their data directory; point the data elsewhere with their environment
+// (e.g. PGDATA for postgres) for the setup to be kept. See Composer.Commit.
+type Fixture struct {
+	// Container is the database container. Its readiness checks are run
+	// before the Setup, and whenever it is launched from the snapshot; its
+	// PostCommands are only run for the snapshot, like the Setup.
+	Container *duct.Container
+
+	// Setup are the commands, e.g. migrations and seed scripts, run in the
+	// container before it is snapshotted, after its own PostCommands.
+	Setup [][]string
+
+	// Tag is the image to commit the snapshot to. By default, it is derived
+	// from the container's image, environment, command and Setup, so that a
+	// change to any of them makes a new snapshot.
+	Tag string
+
+	// Options are the options of the composition the snapshot is made in,
+	// which must select a network, e.g. duct.WithNewNetwork.
+	Options []duct.Options
+
+	mu  sync.Mutex
+	tag string
+}
+
+// Snapshot makes the snapshot if the daemon does not have it already, and
+// returns its image. It is safe to call concurrently; the snapshot is only
+// made once.
+func (f *Fixture) Snapshot(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.tag != "" {
+		return f.tag, nil
+	}
+
+	tag := f.Tag
+	if tag == "" {
+		var err error
+		if tag, err = f.defaultTag(); err != nil {
+			return "", err
+		}
+	}
+
+	// the setup container is named apart from compositions using the
+	// fixture, which may be running
+	setup := f.Container.Derive(f.Container.Name+"-snapshot", func(cont *duct.Container) {
+		cont.PostCommands = append(cont.PostCommands, f.Setup...)
+	})
+
+	c := duct.New(duct.Manifest{setup}, f.Options...)
+
+	exists, err := c.HasImage(ctx, tag)
+	if err != nil {
+		return "", err
+	}
+
+	if !exists {
+		if err := f.snapshot(ctx, c, setup.Name, tag); err != nil {
+			return "", fmt.Errorf("snapshotting fixture [%s]: %w", f.Container.Name, err)
+		}
+	}
+
+	f.tag = tag
+
+	return tag, nil
+}
+
+// snapshot launches the setup composition and commits its container.
+func (f *Fixture) snapshot(ctx context.Context, c *duct.Composer, name, tag string) (err error) {
+	defer func() {
+		if teardownErr := c.Teardown(context.Background()); err == nil {
+			err = teardownErr
+		}
+	}()
+
+	if err := c.Launch(ctx); err != nil {
+		return err
+	}
+
+	return c.Commit(ctx, name, tag)
+}
+
+// defaultTag derives the tag of the snapshot from what goes into it.
+func (f *Fixture) defaultTag() (string, error) {
+	content, err := json.Marshal(struct {
+		Image      string
+		Env        []string
+		Command    []string
+		Entrypoint []string
+		Files      map[string]duct.FileContent
+		Post       [][]string
+		PostRun    []duct.PostCommand
+		Setup      [][]string
+	}{
+		f.Container.Image,
+		f.Container.Env,
+		f.Container.Command,
+		f.Container.Entrypoint,
+		f.Container.Files,
+		f.Container.PostCommands,
+		f.Container.PostRun,
+		f.Setup,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(content)
+
+	return fmt.Sprintf("duct-fixture-%s:%s", f.Container.Name, hex.EncodeToString(sum[:])[:12]), nil
+}
+
+// FromSnapshot returns a copy of the fixture's container which launches the
+// snapshot, making it if necessary, for a manifest of the test's own.
+func (f *Fixture) FromSnapshot(ctx context.Context) (*duct.Container, error) {
+	tag, err := f.Snapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return f.Container.Derive(f.Container.Name, func(cont *duct.Container) {
+		cont.Image = tag
+		cont.LocalImage = true
+		cont.Build = nil
+		// the setup is in the snapshot
+		cont.PostCommands = nil
+		cont.PostRun = nil
+	}), nil
+}
+
+// Use launches a composition of the fixture's container from the snapshot,
+// making the snapshot if necessary, and tears it down when the test finishes.
+// The options are those of the composition; by default, those of the
+// fixture. Setup failures fail the test.
+func Use(t testing.TB, f *Fixture, options ...duct.Options) *duct.Composer {
+	t.Helper()
+
+	cont, err := f.FromSnapshot(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(options) == 0 {
+		options = f.Options
+	}
+
+	c := duct.New(duct.Manifest{cont}, options...)
+	c.Guard(t)
+
+	if err := c.Launch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
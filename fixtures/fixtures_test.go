@@ -0,0 +1,94 @@
+package fixtures
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/erikh/duct"
+	"github.com/erikh/duct/ductfake"
+)
+
+func TestUse(t *testing.T) {
+	// the daemon must outlive the teardown of Use
+	r := ductfake.Start(t)
+
+	// count the launches of the setup composition
+	launches := filepath.Join(t.TempDir(), "launches")
+	options := []duct.Options{
+		duct.WithNewNetwork("duct-fixture-network"),
+		r.Options(),
+		duct.WithHooks(duct.Hooks{PreLaunch: [][]string{{"sh", "-c", "echo >> " + launches}}}),
+	}
+
+	fixture := func() *Fixture {
+		return &Fixture{
+			Container: &duct.Container{Name: "db", Image: "postgres:15", Env: []string{"PGDATA=/pgdata"}},
+			Setup:     [][]string{{"psql", "-f", "/migrations/1.sql"}},
+			Options:   options,
+		}
+	}
+
+	f := fixture()
+	c := Use(t, f, duct.WithNewNetwork("duct-test-network"), r.Options())
+
+	tag, err := f.Snapshot(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(tag, "duct-fixture-db:") {
+		t.Fatalf("unexpected tag: %s", tag)
+	}
+
+	if _, err := r.Client().InspectImage(tag); err != nil {
+		t.Fatalf("snapshot was not committed: %v", err)
+	}
+
+	info, err := c.Info(context.Background(), "db")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Inspect.Config.Image != tag {
+		t.Fatalf("container was not launched from the snapshot: %s", info.Inspect.Config.Image)
+	}
+
+	// another fixture with the same setup reuses the snapshot
+	if again, err := fixture().Snapshot(context.Background()); err != nil || again != tag {
+		t.Fatalf("unexpected snapshot: %s, %v", again, err)
+	}
+
+	changed := fixture()
+	changed.Setup = append(changed.Setup, []string{"psql", "-f", "/migrations/2.sql"})
+	if other, err := changed.Snapshot(context.Background()); err != nil || other == tag {
+		t.Fatalf("changed setup did not make a new snapshot: %s, %v", other, err)
+	}
+
+	seeded := fixture()
+	seeded.Container.PostRun = []duct.PostCommand{{Shell: "psql < /seed.sql"}}
+	other, err := seeded.Snapshot(context.Background())
+	if err != nil || other == tag {
+		t.Fatalf("post-run commands did not make a new snapshot: %s, %v", other, err)
+	}
+
+	cont, err := seeded.FromSnapshot(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cont.PostRun) != 0 || len(cont.PostCommands) != 0 {
+		t.Fatalf("the setup is run again on the snapshot: %+v", cont)
+	}
+
+	content, err := os.ReadFile(launches)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := strings.Count(string(content), "\n"); n != 3 {
+		t.Fatalf("setup was launched %d times", n)
+	}
+}
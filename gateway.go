@@ -0,0 +1,61 @@
+package duct
+
+import (
+	"context"
+	"fmt"
+)
+
+// hostGatewayName is the name containers reach the host by.
+const hostGatewayName = "host.docker.internal"
+
+// dockerDesktop is the operating system Docker Desktop reports for its daemon.
+const dockerDesktop = "Docker Desktop"
+
+// WithHostGateway makes the host reachable as host.docker.internal from every
+// container, so they can call services run by the test itself. See also
+// Container.HostGateway.
+func WithHostGateway() Options {
+	return Options{optionHostGateway: true}
+}
+
+// hostGateway is true if the container should be able to reach the host.
+func (c *Composer) hostGateway(cont *Container) bool {
+	return cont.HostGateway || c.options[optionHostGateway] != nil
+}
+
+// gatewayIP returns the address of the host on the composition's network,
+// for containers with their own hosts file, where docker cannot add the
+// host-gateway entry. On Docker Desktop, where the gateway is the VM's and not
+// the host's, it returns "": its DNS resolves host.docker.internal instead.
+func (c *Composer) gatewayIP(ctx context.Context) (string, error) {
+	info, err := c.client.Info()
+	if err != nil {
+		return "", fmt.Errorf("getting docker info: %w", err)
+	}
+
+	if info.OperatingSystem == dockerDesktop {
+		return "", nil
+	}
+
+	network, err := c.client.NetworkInfo(c.netID)
+	if err != nil {
+		return "", err
+	}
+
+	for _, config := range network.IPAM.Config {
+		if config.Gateway != "" {
+			return config.Gateway, nil
+		}
+	}
+
+	return "", fmt.Errorf("network %s has no gateway", network.Name)
+}
+
+// extraHosts returns the host entries docker adds for the container.
+func (c *Composer) extraHosts(cont *Container) []string {
+	if c.hostGateway(cont) && len(cont.ExtraHosts) == 0 {
+		return []string{hostGatewayName + ":host-gateway"}
+	}
+
+	return nil
+}
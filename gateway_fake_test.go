@@ -0,0 +1,32 @@
+package duct_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/erikh/duct"
+	"github.com/erikh/duct/ductfake"
+)
+
+func TestHostGatewayTeardown(t *testing.T) {
+	r := ductfake.Start(t)
+
+	// the networks of the fake daemon have no gateway to write into the
+	// hosts file
+	c := r.Compose(t, duct.Manifest{
+		{Name: "db", Image: "postgres:latest"},
+		{Name: "web", Image: "nginx:latest", HostGateway: true, ExtraHosts: map[string][]string{"10.0.0.2": {"example.org"}}},
+	})
+
+	if err := c.Launch(context.Background()); err == nil {
+		t.Fatal("launched without the address of the host")
+	}
+
+	if names, err := r.Containers(); err != nil || len(names) != 0 {
+		t.Fatalf("containers were not removed: %v %v", names, err)
+	}
+
+	if networks, err := r.Networks(); err != nil || len(networks) != 0 {
+		t.Fatalf("network was not removed: %v %v", networks, err)
+	}
+}
@@ -0,0 +1,61 @@
+package duct
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+func TestGatewayIP(t *testing.T) {
+	var (
+		system   string
+		networks int
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/info":
+			json.NewEncoder(w).Encode(dc.DockerInfo{OperatingSystem: system})
+		case "/networks/duct-test-network":
+			networks++
+			json.NewEncoder(w).Encode(dc.Network{
+				Name: "duct-test-network",
+				IPAM: dc.IPAMOptions{Config: []dc.IPAMConfig{{Subnet: "10.0.0.0/24", Gateway: "10.0.0.1"}}},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	client, err := dc.NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SkipServerVersionCheck = true
+
+	c := New(Manifest{}, WithNewNetwork("duct-test-network"))
+	c.client = client
+	c.netID = "duct-test-network"
+
+	system = "Ubuntu 22.04.3 LTS"
+	if ip, err := c.gatewayIP(context.Background()); err != nil || ip != "10.0.0.1" {
+		t.Fatalf("unexpected gateway %q: %v", ip, err)
+	}
+
+	system = dockerDesktop
+	networks = 0
+	if ip, err := c.gatewayIP(context.Background()); err != nil || ip != "" {
+		t.Fatalf("unexpected gateway on Docker Desktop %q: %v", ip, err)
+	}
+
+	if networks != 0 {
+		t.Fatal("the gateway of the network was looked up on Docker Desktop")
+	}
+}
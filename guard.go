@@ -0,0 +1,35 @@
+package duct
+
+import (
+	"context"
+	"testing"
+)
+
+// Guard tears down the composition when the test and its subtests finish,
+// including when they fail or panic; the testing package runs cleanups before
+// reporting a panic. Errors tearing down fail the test.
+func (c *Composer) Guard(t testing.TB) {
+	t.Helper()
+
+	t.Cleanup(func() {
+		if err := c.Teardown(context.Background()); err != nil {
+			t.Errorf("error tearing down: %v", err)
+		}
+	})
+}
+
+// CleanupOnPanic tears down the composition if the calling goroutine panics,
+// then panics again with the same value. Defer it right after New, in
+// goroutines or programs where Guard does not apply:
+//
+//	c := duct.New(manifest)
+//	defer c.CleanupOnPanic()
+func (c *Composer) CleanupOnPanic() {
+	if r := recover(); r != nil {
+		c.logf(LogError, "Panicked; will terminate containers now: %v", r)
+		if err := c.Teardown(context.Background()); err != nil {
+			c.logf(LogError, "Error tearing down after panic: %v", err)
+		}
+		panic(r)
+	}
+}
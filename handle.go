@@ -0,0 +1,172 @@
+package duct
+
+import (
+	"context"
+	"io"
+	"time"
+
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+// ContainerHandle is a launched container, for inspecting and operating on it
+// without its docker id. It is a snapshot of the container at the time it was
+// returned by Composer.Container; its methods act on the live container.
+type ContainerHandle struct {
+	*ContainerInfo
+
+	// Image is the image the container was created from.
+	Image string
+}
+
+// ContainerID returns the docker id of the named container.
+func (c *Composer) ContainerID(name string) (string, error) {
+	cont, err := c.find(name)
+	if err != nil {
+		return "", err
+	}
+
+	return c.idOf(cont), nil
+}
+
+// Container returns a handle on the named container.
+func (c *Composer) Container(name string) (*ContainerHandle, error) {
+	cont, err := c.find(name)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := c.containerInfo(context.Background(), cont)
+	if err != nil {
+		return nil, err
+	}
+
+	handle := &ContainerHandle{ContainerInfo: info}
+	if info.Inspect.Config != nil {
+		handle.Image = info.Inspect.Config.Image
+	}
+
+	return handle, nil
+}
+
+// ExecOption configures the commands run by ContainerHandle.Exec.
+type ExecOption func(*execConfig)
+
+type execConfig struct {
+	user       string
+	workingDir string
+	env        []string
+	privileged bool
+}
+
+// WithExecUser runs the command as the user, and optionally the group, e.g.
+// "postgres" or "1000:1000", instead of the container's user.
+func WithExecUser(user string) ExecOption {
+	return func(config *execConfig) {
+		config.user = user
+	}
+}
+
+// WithExecWorkingDir runs the command in the directory.
+func WithExecWorkingDir(dir string) ExecOption {
+	return func(config *execConfig) {
+		config.workingDir = dir
+	}
+}
+
+// WithExecEnv adds the key=value pairs to the environment of the command.
+func WithExecEnv(env ...string) ExecOption {
+	return func(config *execConfig) {
+		config.env = append(config.env, env...)
+	}
+}
+
+// WithExecPrivileged runs the command with extended privileges.
+func WithExecPrivileged() ExecOption {
+	return func(config *execConfig) {
+		config.privileged = true
+	}
+}
+
+// Exec runs the command in the container, copying its output to stdout and
+// stderr, which may be nil to discard it, and returns its exit code.
+func (h *ContainerHandle) Exec(ctx context.Context, command []string, stdout, stderr io.Writer, opts ...ExecOption) (int, error) {
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	if stderr == nil {
+		stderr = io.Discard
+	}
+
+	config := &execConfig{}
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	exec, err := h.c.client.CreateExec(dc.CreateExecOptions{
+		Context:      ctx,
+		Container:    h.ID,
+		Cmd:          command,
+		Env:          config.env,
+		User:         config.user,
+		WorkingDir:   config.workingDir,
+		Privileged:   config.privileged,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if err := h.c.client.StartExec(exec.ID, dc.StartExecOptions{
+		OutputStream: stdout,
+		ErrorStream:  stderr,
+		Context:      ctx,
+	}); err != nil {
+		return 0, err
+	}
+
+	ins, err := h.c.client.InspectExec(exec.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	return ins.ExitCode, nil
+}
+
+// Logs copies the output of the container so far to stdout and stderr, which
+// may be nil to discard it.
+func (h *ContainerHandle) Logs(ctx context.Context, stdout, stderr io.Writer) error {
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	if stderr == nil {
+		stderr = io.Discard
+	}
+
+	ctx, watch := h.c.watchStream(ctx)
+
+	return watch.Done(h.c.client.Logs(dc.LogsOptions{
+		Context:      ctx,
+		Container:    h.ID,
+		OutputStream: watch.Writer(stdout),
+		ErrorStream:  watch.Writer(stderr),
+		Stdout:       true,
+		Stderr:       true,
+	}))
+}
+
+// Stop stops the container, killing it if it has not exited after the
+// timeout. The exit is not reported by the crash monitor, and the container
+// is not restarted; it is still removed at Teardown.
+func (h *ContainerHandle) Stop(ctx context.Context, timeout time.Duration) error {
+	h.c.logContainer(LogInfo, h.Name, "Stopping container: [%s]", h.Name)
+
+	h.c.expectExit(h.ID, true)
+
+	err := h.c.client.StopContainerWithContext(h.ID, uint(timeout.Seconds()), ctx)
+	if err != nil {
+		h.c.expectExit(h.ID, false)
+	}
+
+	return err
+}
@@ -0,0 +1,73 @@
+package duct_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/erikh/duct"
+	"github.com/erikh/duct/ductfake"
+)
+
+func TestContainerHandle(t *testing.T) {
+	r := ductfake.Start(t)
+
+	c := r.Launch(t, duct.Manifest{
+		{Name: "web", Image: "nginx:1.24", PortForwards: map[int]int{8080: 80}},
+	}, duct.WithCrashMonitor())
+
+	if _, err := c.Container("missing"); err == nil {
+		t.Fatal("no error for a missing container")
+	}
+
+	web, err := c.Container("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := c.ContainerID("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if web.ID != id || web.Name != "web" || web.Image != "nginx:1.24" {
+		t.Fatalf("unexpected handle: %+v", web)
+	}
+
+	code, err := web.Exec(context.Background(), []string{"true"}, nil, nil)
+	if err != nil || code != 0 {
+		t.Fatalf("unexpected exec result: %d, %v", code, err)
+	}
+
+	if _, err := web.Exec(context.Background(), []string{"nginx", "-s", "reload"}, nil, nil,
+		duct.WithExecUser("nginx"), duct.WithExecWorkingDir("/etc/nginx"), duct.WithExecEnv("A=1", "B=2"), duct.WithExecPrivileged()); err != nil {
+		t.Fatal(err)
+	}
+
+	execs := r.Execs()
+	exec := execs[len(execs)-1]
+	if exec.Container != id || exec.User != "nginx" || exec.WorkingDir != "/etc/nginx" || !reflect.DeepEqual(exec.Env, []string{"A=1", "B=2"}) || !exec.Privileged {
+		t.Fatalf("exec options were not passed on: %+v", exec)
+	}
+
+	if err := web.Stop(context.Background(), time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	ctr, err := r.Container("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ctr.State.Running {
+		t.Fatal("container is still running")
+	}
+
+	// give the crash monitor time to see the exit
+	time.Sleep(200 * time.Millisecond)
+
+	if err := c.Check(); err != nil {
+		t.Fatalf("stop was reported as a crash: %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package duct
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Hooks are commands run on the host around a composition, like a Makefile
+// would, e.g. to generate fixtures with a local binary before the containers
+// are started. Each command is a program and its arguments.
+type Hooks struct {
+	// PreLaunch are run in order by Launch, after the manifest is validated
+	// and before anything is created; if one fails, the launch fails.
+	PreLaunch [][]string
+	// PostTeardown are run in order by Teardown after everything is
+	// removed, even if that failed; each is run even if one before failed.
+	// They are run once per launch whose PreLaunch hooks succeeded, by the
+	// first Teardown after it.
+	PostTeardown [][]string
+
+	// Env is added to the environment of this process for the commands.
+	Env []string
+	// Dir is the directory to run the commands in; by default, the working
+	// directory.
+	Dir string
+	// Output captures the combined output of the commands. By default, it
+	// goes to stdout and stderr.
+	Output io.Writer
+}
+
+// WithHooks runs the hooks around the launch and teardown of the
+// composition.
+func WithHooks(hooks Hooks) Options {
+	return Options{optionHooks: hooks}
+}
+
+// HookError is returned when a hook fails.
+type HookError struct {
+	// Command is the failed command.
+	Command []string
+	// Err is why it failed, e.g. an *exec.ExitError.
+	Err error
+	// Logs are the last lines of its output.
+	Logs []string
+}
+
+func (e *HookError) Error() string {
+	msg := fmt.Sprintf("hook [%s] failed: %v", strings.Join(e.Command, " "), e.Err)
+	if len(e.Logs) != 0 {
+		msg += "; last output:\n" + strings.Join(e.Logs, "\n")
+	}
+
+	return msg
+}
+
+func (e *HookError) Unwrap() error {
+	return e.Err
+}
+
+// hooks returns the hooks given with WithHooks.
+func (c *Composer) hooks() Hooks {
+	hooks, _ := c.options[optionHooks].(Hooks)
+	return hooks
+}
+
+// runHook runs the command of a hook.
+func (c *Composer) runHook(ctx context.Context, hooks Hooks, command []string) error {
+	if len(command) == 0 {
+		return &HookError{Command: command, Err: fmt.Errorf("empty command")}
+	}
+
+	c.logf(LogInfo, "Running hook: [%s]", strings.Join(command, " "))
+
+	tail := &tailWriter{max: exitLogLines}
+
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Dir = hooks.Dir
+	cmd.Env = append(os.Environ(), hooks.Env...)
+
+	if hooks.Output != nil {
+		out := io.MultiWriter(hooks.Output, tail)
+		cmd.Stdout, cmd.Stderr = out, out
+	} else {
+		cmd.Stdout = io.MultiWriter(&scrubWriter{c: c, w: os.Stdout}, tail)
+		cmd.Stderr = io.MultiWriter(&scrubWriter{c: c, w: os.Stderr}, tail)
+	}
+
+	if err := cmd.Run(); err != nil {
+		return &HookError{Command: command, Err: err, Logs: c.scrubLines(tail.Lines())}
+	}
+
+	return nil
+}
+
+// preLaunch runs the PreLaunch hooks until one fails. If all succeed, the
+// PostTeardown hooks are due.
+func (c *Composer) preLaunch(ctx context.Context) error {
+	hooks := c.hooks()
+	for _, command := range hooks.PreLaunch {
+		if err := c.runHook(ctx, hooks, command); err != nil {
+			return err
+		}
+	}
+
+	c.teardownMu.Lock()
+	c.hooksDue = true
+	c.teardownMu.Unlock()
+
+	return nil
+}
+
+// postTeardown runs all PostTeardown hooks, if they are due, and returns
+// false if any failed. It must be called with teardownMu held.
+func (c *Composer) postTeardown(ctx context.Context) bool {
+	if !c.hooksDue {
+		return true
+	}
+	c.hooksDue = false
+
+	ok := true
+
+	hooks := c.hooks()
+	for _, command := range hooks.PostTeardown {
+		if err := c.runHook(ctx, hooks, command); err != nil {
+			c.logf(LogError, "%v", err)
+			ok = false
+		}
+	}
+
+	return ok
+}
@@ -0,0 +1,68 @@
+package duct_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/erikh/duct"
+	"github.com/erikh/duct/ductfake"
+)
+
+func TestHooks(t *testing.T) {
+	r := ductfake.Start(t)
+
+	dir := t.TempDir()
+	out := &strings.Builder{}
+	manifest := duct.Manifest{
+		{Name: "web", Image: "nginx:latest"},
+	}
+
+	c := r.Launch(t, manifest, duct.WithHooks(duct.Hooks{
+		PreLaunch:    [][]string{{"sh", "-c", "echo $FIXTURE > fixture && echo generated"}},
+		PostTeardown: [][]string{{"rm", "fixture"}},
+		Env:          []string{"FIXTURE=rows"},
+		Dir:          dir,
+		Output:       out,
+	}))
+
+	content, err := os.ReadFile(filepath.Join(dir, "fixture"))
+	if err != nil || string(content) != "rows\n" || out.String() != "generated\n" {
+		t.Fatalf("pre-launch hook did not run: %q, %q, %v", content, out, err)
+	}
+
+	if err := c.Teardown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "fixture")); !os.IsNotExist(err) {
+		t.Fatalf("post-teardown hook did not run: %v", err)
+	}
+
+	if err := c.Teardown(context.Background()); err != nil {
+		t.Fatalf("post-teardown hooks ran again: %v", err)
+	}
+
+	c = r.Compose(t, manifest, duct.WithHooks(duct.Hooks{
+		PreLaunch:    [][]string{{"sh", "-c", "echo broken; exit 3"}},
+		PostTeardown: [][]string{{"false"}},
+		Output:       io.Discard,
+	}))
+
+	var hookErr *duct.HookError
+	if err := c.Launch(context.Background()); !errors.As(err, &hookErr) || hookErr.Logs[0] != "broken" {
+		t.Fatalf("unexpected error for a failing hook: %v", err)
+	}
+
+	if names, err := r.Containers(); err != nil || len(names) != 0 {
+		t.Fatalf("containers were created despite the failing hook: %v, %v", names, err)
+	}
+
+	if err := c.Teardown(context.Background()); err != nil {
+		t.Fatalf("post-teardown hooks ran without the pre-launch hooks: %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package duct
+
+import (
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+// blockLimits returns the limits of the map of device path -> rate, in the
+// order of the paths.
+func blockLimits(limits map[string]int64) []dc.BlockLimit {
+	res := []dc.BlockLimit{}
+	for _, path := range sortedKeys(limits) {
+		res = append(res, dc.BlockLimit{Path: path, Rate: limits[path]})
+	}
+
+	return res
+}
+
+// LogConfig configures the log driver of containers.
+type LogConfig struct {
+	// Driver is the log driver, e.g. "json-file", "local", "journald",
+	// "syslog" or "none".
+	Driver string
+	// Options are the options of the driver, e.g. "max-size" and "max-file"
+	// to cap the logs json-file keeps.
+	Options map[string]string
+}
+
+// WithLogConfig configures the log driver of the containers which do not
+// have a LogConfig of their own, e.g. to cap the logs of long soak tests.
+// duct reads the logs of containers, e.g. for ExpectLog and WithLogStream,
+// which some drivers do not support on daemons before docker 20.10.
+func WithLogConfig(config LogConfig) Options {
+	return Options{optionLogConfig: config}
+}
+
+// logConfig returns the log configuration of the container.
+func (c *Composer) logConfig(cont *Container) dc.LogConfig {
+	config, _ := c.options[optionLogConfig].(LogConfig)
+	if cont.LogConfig != nil {
+		config = *cont.LogConfig
+	}
+
+	return dc.LogConfig{Type: config.Driver, Config: config.Options}
+}
+
+// oomKillDisable returns the OOMKillDisable setting of the container; unset,
+// the daemon keeps the OOM killer enabled.
+func oomKillDisable(cont *Container) *bool {
+	if !cont.OomKillDisable {
+		return nil
+	}
+
+	disable := true
+	return &disable
+}
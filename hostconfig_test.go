@@ -0,0 +1,32 @@
+package duct
+
+import (
+	"reflect"
+	"testing"
+
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+func TestBlockLimits(t *testing.T) {
+	limits := blockLimits(map[string]int64{"/dev/sdb": 2048, "/dev/sda": 1024})
+	expected := []dc.BlockLimit{{Path: "/dev/sda", Rate: 1024}, {Path: "/dev/sdb", Rate: 2048}}
+
+	if !reflect.DeepEqual(limits, expected) {
+		t.Fatalf("unexpected limits: %v", limits)
+	}
+}
+
+func TestLogConfig(t *testing.T) {
+	c := New(Manifest{
+		{Name: "soak", Image: "debian"},
+		{Name: "quiet", Image: "debian", LogConfig: &LogConfig{Driver: "none"}},
+	}, WithLogConfig(LogConfig{Driver: "json-file", Options: map[string]string{"max-size": "10m"}}))
+
+	if config := c.logConfig(c.manifest[0]); config.Type != "json-file" || config.Config["max-size"] != "10m" {
+		t.Fatalf("unexpected default log config: %+v", config)
+	}
+
+	if config := c.logConfig(c.manifest[1]); config.Type != "none" || config.Config != nil {
+		t.Fatalf("unexpected log config: %+v", config)
+	}
+}
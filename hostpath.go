@@ -0,0 +1,40 @@
+package duct
+
+import (
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// hostPath returns the absolute path of the bind mount source on the host.
+// On Windows, paths in the style of Git Bash and MSYS, like /c/src/app, are
+// taken to be drive paths, like C:\src\app.
+func hostPath(path string) (string, error) {
+	if runtime.GOOS == "windows" {
+		path = windowsPath(path)
+	}
+
+	if filepath.IsAbs(path) {
+		return path, nil
+	}
+
+	return filepath.Abs(path)
+}
+
+// windowsPath converts a path with a leading /<drive letter>/ to one with the
+// drive letter, and forward slashes to backslashes. Other paths are only
+// converted to backslashes.
+func windowsPath(path string) string {
+	if len(path) >= 2 && path[0] == '/' && isDriveLetter(path[1]) && (len(path) == 2 || path[2] == '/') {
+		path = strings.ToUpper(path[1:2]) + ":" + path[2:]
+		if len(path) == 2 {
+			path += "/"
+		}
+	}
+
+	return strings.ReplaceAll(path, "/", `\`)
+}
+
+func isDriveLetter(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
@@ -0,0 +1,20 @@
+package duct
+
+import "testing"
+
+func TestWindowsPath(t *testing.T) {
+	table := map[string]string{
+		"/c/src/app":      `C:\src\app`,
+		"/D":              `D:\`,
+		`C:\src\app`:      `C:\src\app`,
+		"C:/src/app":      `C:\src\app`,
+		"/cache/app":      `\cache\app`,
+		"testdata/config": `testdata\config`,
+	}
+
+	for path, expected := range table {
+		if res := windowsPath(path); res != expected {
+			t.Fatalf("unexpected path for %s: %s", path, res)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package duct
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// HTTPOption configures the clients made by Composer.HTTPClient.
+type HTTPOption func(*httpConfig)
+
+type httpConfig struct {
+	https   bool
+	roots   *x509.CertPool
+	timeout time.Duration
+}
+
+// WithHTTPS makes the client use https. The server's certificate is verified
+// for the container's name, against the system's roots unless WithHTTPCA is
+// given.
+func WithHTTPS() HTTPOption {
+	return func(config *httpConfig) {
+		config.https = true
+	}
+}
+
+// WithHTTPCA makes the client use https, trusting only the certificate
+// authority in PEM format, e.g. one of ducttls.
+func WithHTTPCA(certPEM []byte) HTTPOption {
+	return func(config *httpConfig) {
+		config.https = true
+		if config.roots == nil {
+			config.roots = x509.NewCertPool()
+		}
+		config.roots.AppendCertsFromPEM(certPEM)
+	}
+}
+
+// WithHTTPTimeout sets the timeout of the client's requests.
+func WithHTTPTimeout(timeout time.Duration) HTTPOption {
+	return func(config *httpConfig) {
+		config.timeout = timeout
+	}
+}
+
+// BaseURL returns the URL of the http server on the tcp port of the named
+// container from this process, e.g. "http://127.0.0.1:49153"; see Endpoint.
+func (c *Composer) BaseURL(name string, containerPort int, opts ...HTTPOption) (string, error) {
+	config := &httpConfig{}
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	addr, err := c.Endpoint(name, containerPort)
+	if err != nil {
+		return "", err
+	}
+
+	scheme := "http"
+	if config.https {
+		scheme = "https"
+	}
+
+	return (&url.URL{Scheme: scheme, Host: addr}).String(), nil
+}
+
+// HTTPClient returns a client of the http server on the tcp port of the named
+// container. Requests with relative URLs, like client.Get("/health"), are
+// sent to the server; see BaseURL. Others are sent as usual.
+func (c *Composer) HTTPClient(name string, containerPort int, opts ...HTTPOption) (*http.Client, error) {
+	config := &httpConfig{}
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	base, err := c.BaseURL(name, containerPort, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+
+	transport, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return nil, errors.New("the default http transport is not an *http.Transport")
+	}
+	transport = transport.Clone()
+
+	if config.https {
+		transport.TLSClientConfig = &tls.Config{
+			RootCAs:    config.roots,
+			ServerName: name,
+		}
+	}
+
+	return &http.Client{
+		Transport: &baseTransport{base: baseURL, rt: transport},
+		Timeout:   config.timeout,
+	}, nil
+}
+
+// baseTransport sends requests with relative URLs to the base URL.
+type baseTransport struct {
+	base *url.URL
+	rt   http.RoundTripper
+}
+
+func (bt *baseTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host == "" {
+		req = req.Clone(req.Context())
+		req.URL.Scheme = bt.base.Scheme
+		req.URL.Host = bt.base.Host
+		req.Host = ""
+	}
+
+	return bt.rt.RoundTrip(req)
+}
@@ -0,0 +1,80 @@
+package duct_test
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/erikh/duct"
+	"github.com/erikh/duct/ductfake"
+	"github.com/erikh/duct/ducttls"
+)
+
+func TestHTTPClient(t *testing.T) {
+	r := ductfake.Start(t)
+
+	ca, err := ducttls.NewCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM, keyPEM, err := ca.Issue("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// stand in for the forwarded port of the container
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.URL.Path)
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	server.StartTLS()
+	defer server.Close()
+
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+
+	c := r.Launch(t, duct.Manifest{
+		{Name: "web", Image: "nginx:latest", PortForwards: map[int]int{port: 443}},
+	})
+
+	base, err := c.BaseURL("web", 443, duct.WithHTTPS())
+	if err != nil || base != fmt.Sprintf("https://127.0.0.1:%d", port) {
+		t.Fatalf("unexpected base url: %s, %v", base, err)
+	}
+
+	client, err := c.HTTPClient("web", 443, duct.WithHTTPCA(ca.CertPEM()), duct.WithHTTPTimeout(5*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := client.Get("/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil || string(body) != "/health" {
+		t.Fatalf("unexpected response: %q, %v", body, err)
+	}
+
+	// without the authority, the certificate is not trusted
+	client, err = c.HTTPClient("web", 443, duct.WithHTTPS())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Get("/health"); err == nil {
+		t.Fatal("certificate of an unknown authority was trusted")
+	}
+}
@@ -0,0 +1,86 @@
+package duct
+
+import (
+	"context"
+	"strconv"
+
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+// ContainerInfo describes a launched container; it is passed to ReadyFunc.
+type ContainerInfo struct {
+	// ID is the id of the container.
+	ID string
+	// Name is its name in the manifest.
+	Name string
+	// IPv4 and IPv6 are its addresses on the network of the composition.
+	IPv4 string
+	IPv6 string
+	// HostPorts maps its ports, e.g. "80/tcp", to the host ports forwarded
+	// to them.
+	HostPorts map[string]int
+	// Inspect is what docker reports about the container.
+	Inspect *dc.Container
+
+	c    *Composer
+	cont *Container
+}
+
+// Endpoint returns the host:port address the tcp port of the container is
+// reachable at from this process; see Composer.Endpoint.
+func (info *ContainerInfo) Endpoint(port int) (string, error) {
+	return info.c.hostAddr(context.Background(), info.cont, port)
+}
+
+// Info describes the named container.
+func (c *Composer) Info(ctx context.Context, name string) (*ContainerInfo, error) {
+	cont, err := c.find(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.containerInfo(ctx, cont)
+}
+
+func (c *Composer) containerInfo(ctx context.Context, cont *Container) (*ContainerInfo, error) {
+	ctr, err := c.client.InspectContainerWithOptions(dc.InspectContainerOptions{ID: cont.id, Context: ctx})
+	if err != nil {
+		return nil, err
+	}
+
+	info := &ContainerInfo{
+		ID:        ctr.ID,
+		Name:      cont.Name,
+		HostPorts: map[string]int{},
+		Inspect:   ctr,
+		c:         c,
+		cont:      cont,
+	}
+
+	if ctr.NetworkSettings == nil {
+		return info, nil
+	}
+
+	for _, network := range ctr.NetworkSettings.Networks {
+		if network.NetworkID == c.netID {
+			info.IPv4 = network.IPAddress
+			info.IPv6 = network.GlobalIPv6Address
+		}
+	}
+
+	if info.IPv4 == "" {
+		info.IPv4 = ctr.NetworkSettings.IPAddress
+	}
+
+	for port, bindings := range ctr.NetworkSettings.Ports {
+		if len(bindings) == 0 {
+			continue
+		}
+
+		if hostPort, err := strconv.Atoi(bindings[0].HostPort); err == nil {
+			info.HostPorts[string(port)] = hostPort
+		}
+	}
+
+	return info, nil
+}
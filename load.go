@@ -0,0 +1,363 @@
+package duct
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// manifestFile is the schema of manifest files: the containers, with the
+// fields of Container.
+type manifestFile struct {
+	Containers []containerFile
+}
+
+// containerFile is a container in a manifest file. Durations are given as
+// strings, and the readiness check as a Wait; functions cannot be given.
+type containerFile struct {
+	Container
+
+	BootWait     fileDuration
+	AliveTimeout fileDuration
+	Wait         *WaitSpec
+	PostRun      []postCommandFile
+}
+
+// postCommandFile is a post-command in a manifest file. Durations are given
+// as strings, and Stdin as text.
+type postCommandFile struct {
+	PostCommand
+
+	Stdin         string
+	RetryFor      fileDuration
+	RetryInterval fileDuration
+	Timeout       fileDuration
+}
+
+// postCommand returns the PostCommand described by the file.
+func (pf postCommandFile) postCommand() PostCommand {
+	pc := pf.PostCommand
+	if pf.Stdin != "" {
+		pc.Stdin = []byte(pf.Stdin)
+	}
+	pc.RetryFor = time.Duration(pf.RetryFor)
+	pc.RetryInterval = time.Duration(pf.RetryInterval)
+	pc.Timeout = time.Duration(pf.Timeout)
+
+	return pc
+}
+
+// WaitSpec is the readiness check of a container in a manifest file, which
+// sets its WaitFor. Exactly one of Log, Kafka, AMQP, MQTT, TCP and WebSocket
+// must be given.
+type WaitSpec struct {
+	// Log waits for lines matching the regular expression, Occurrences
+	// times; see WaitForLog.
+	Log         string
+	Occurrences int
+	// Kafka, AMQP and MQTT wait for the protocol on the container port; see
+	// WaitForKafka and the like.
+	Kafka int
+	AMQP  int
+	MQTT  int
+	// TCP waits for the reply to Send on the container port to contain
+	// Expect; see WaitForTCP.
+	TCP    int
+	Send   string
+	Expect string
+	// WebSocket waits for a handshake on the container port and
+	// WebSocketPath; see WaitForWebSocket.
+	WebSocket     int
+	WebSocketPath string
+	// Timeout is how long to wait, e.g. "30s"; by default, until the launch
+	// is canceled.
+	Timeout fileDuration
+}
+
+// Strategy returns the WaitStrategy described by the spec.
+func (w WaitSpec) Strategy() (WaitStrategy, error) {
+	var strategies []WaitStrategy
+	timeout := time.Duration(w.Timeout)
+
+	if w.Log != "" {
+		strategies = append(strategies, WaitForLog(w.Log, w.Occurrences, timeout))
+	}
+	if w.Kafka != 0 {
+		strategies = append(strategies, WaitForKafka(w.Kafka, timeout))
+	}
+	if w.AMQP != 0 {
+		strategies = append(strategies, WaitForAMQP(w.AMQP, timeout))
+	}
+	if w.MQTT != 0 {
+		strategies = append(strategies, WaitForMQTT(w.MQTT, timeout))
+	}
+	if w.TCP != 0 {
+		if w.Expect == "" {
+			return nil, errors.New("a tcp wait must have an expect")
+		}
+		strategies = append(strategies, WaitForTCP(w.TCP, []byte(w.Send), []byte(w.Expect), timeout))
+	}
+	if w.WebSocket != 0 {
+		path := w.WebSocketPath
+		if path == "" {
+			path = "/"
+		}
+		strategies = append(strategies, WaitForWebSocket(w.WebSocket, path, timeout))
+	}
+
+	if len(strategies) != 1 {
+		return nil, errors.New("a wait must have exactly one of log, kafka, amqp, mqtt, tcp and websocket")
+	}
+
+	return strategies[0], nil
+}
+
+// fileDuration is a duration in a manifest file: a string like "1m30s", or a
+// number of seconds.
+type fileDuration time.Duration
+
+func (d *fileDuration) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	switch v := v.(type) {
+	case string:
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*d = fileDuration(parsed)
+	case float64:
+		*d = fileDuration(v * float64(time.Second))
+	default:
+		return fmt.Errorf("invalid duration %s", b)
+	}
+
+	return nil
+}
+
+// LoadManifest reads a manifest file in YAML, JSON or TOML, by the extension
+// of the path. It holds a list of containers under "containers", or just the
+// list in YAML and JSON, with the fields of Container, whose names are not
+// case sensitive: e.g.
+//
+//	containers:
+//	  - name: db
+//	    image: postgres:15
+//	    env: [POSTGRES_PASSWORD=secret]
+//	    portForwards: {5432: 5432}
+//	    bootWait: 2s
+//	    wait: {log: "ready to accept connections", occurrences: 2, timeout: 30s}
+//	    postRun:
+//	      - {command: [psql, -U, postgres], stdin: "CREATE TABLE t (id int);", retryFor: 30s}
+//
+// Durations are strings like "30s", the Stdin of a post-command is text, and
+// the WaitFor of a container is given as a WaitSpec under "wait"; fields that
+// are functions cannot be given. Unknown fields are an error.
+func LoadManifest(path string) (Manifest, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := parseManifest(content, filepath.Ext(path))
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest %s: %w", path, err)
+	}
+
+	return m, nil
+}
+
+// LoadManifestTemplate reads a manifest file like LoadManifest, after
+// rendering it as a text/template with the values, so the same file can vary
+// e.g. image tags, ports and replica counts:
+//
+//	image: postgres:{{ .postgres.tag }}
+//	replicas: {{ index . "replicas" | default 1 }}
+//
+// Referring to a value that is not given is an error, except with index.
+// Besides the template builtins, there are "default", which returns its
+// first argument if the second is empty, "required", which fails with its
+// first argument as message if the second is empty, and "quote".
+func LoadManifestTemplate(path string, values map[string]interface{}) (Manifest, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	rendered, err := renderManifest(filepath.Base(path), content, values)
+	if err != nil {
+		return nil, fmt.Errorf("rendering manifest %s: %w", path, err)
+	}
+
+	m, err := parseManifest(rendered, filepath.Ext(path))
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest %s: %w", path, err)
+	}
+
+	return m, nil
+}
+
+// templateFuncs are the functions of manifest templates besides the
+// builtins.
+var templateFuncs = template.FuncMap{
+	"default": func(def, v interface{}) interface{} {
+		if isEmpty(v) {
+			return def
+		}
+		return v
+	},
+	"required": func(msg string, v interface{}) (interface{}, error) {
+		if isEmpty(v) {
+			return nil, errors.New(msg)
+		}
+		return v, nil
+	},
+	"quote": func(v interface{}) string {
+		return strconv.Quote(fmt.Sprint(v))
+	},
+}
+
+func isEmpty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	}
+
+	return rv.IsZero()
+}
+
+// renderManifest renders the manifest file as a template with the values.
+func renderManifest(name string, content []byte, values map[string]interface{}) ([]byte, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Funcs(templateFuncs).Parse(string(content))
+	if err != nil {
+		return nil, err
+	}
+
+	if values == nil {
+		values = map[string]interface{}{}
+	}
+
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, values); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// parseManifest parses a manifest file in the format of the extension.
+func parseManifest(content []byte, ext string) (Manifest, error) {
+	var doc interface{}
+
+	switch strings.ToLower(ext) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(content, &doc); err != nil {
+			return nil, err
+		}
+	case ".json":
+		if err := json.Unmarshal(content, &doc); err != nil {
+			return nil, err
+		}
+	case ".toml":
+		if _, err := toml.Decode(string(content), &doc); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown manifest format %q; use .yaml, .json or .toml", ext)
+	}
+
+	if list, ok := doc.([]interface{}); ok {
+		doc = map[string]interface{}{"containers": list}
+	}
+
+	// the formats are decoded generically, and then into the schema as JSON,
+	// so they share its rules
+	normalized, err := json.Marshal(jsonValue(doc))
+	if err != nil {
+		return nil, err
+	}
+
+	var file manifestFile
+	dec := json.NewDecoder(bytes.NewReader(normalized))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&file); err != nil {
+		return nil, err
+	}
+
+	m := Manifest{}
+	for i := range file.Containers {
+		cf := &file.Containers[i]
+
+		cont := cf.Container
+		cont.BootWait = time.Duration(cf.BootWait)
+		cont.AliveTimeout = time.Duration(cf.AliveTimeout)
+
+		for _, pf := range cf.PostRun {
+			cont.PostRun = append(cont.PostRun, pf.postCommand())
+		}
+
+		if cf.Wait != nil {
+			strategy, err := cf.Wait.Strategy()
+			if err != nil {
+				return nil, fmt.Errorf("[%s] %w", cont.Name, err)
+			}
+			cont.WaitFor = strategy
+		}
+
+		m = append(m, &cont)
+	}
+
+	return m, nil
+}
+
+// jsonValue converts a generically decoded document to one that can be
+// encoded as JSON: YAML maps may have keys that are not strings, like ports.
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		res := map[string]interface{}{}
+		for k, value := range v {
+			res[k] = jsonValue(value)
+		}
+		return res
+	case map[interface{}]interface{}:
+		res := map[string]interface{}{}
+		for k, value := range v {
+			res[fmt.Sprint(k)] = jsonValue(value)
+		}
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i, value := range v {
+			res[i] = jsonValue(value)
+		}
+		return res
+	case []map[string]interface{}:
+		res := make([]interface{}, len(v))
+		for i, value := range v {
+			res[i] = jsonValue(value)
+		}
+		return res
+	default:
+		return v
+	}
+}
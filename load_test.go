@@ -0,0 +1,152 @@
+package duct
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadManifest(t *testing.T) {
+	files := map[string]string{
+		"manifest.yaml": `
+containers:
+  - name: db
+    image: postgres:15
+    env: [POSTGRES_PASSWORD=secret]
+    portForwards: {5432: 5432}
+    bootWait: 2s
+    wait: {log: "ready to accept connections", occurrences: 2, timeout: 30s}
+    postRun:
+      - {command: [psql, -U, postgres], stdin: "CREATE TABLE t (id int);", retryFor: 30s, retryInterval: 1s, timeout: 5s}
+  - name: app
+    image: app:dev
+    build: {context: .}
+    dependsOn: [db]
+`,
+		"manifest.json": `[
+	{"Name": "db", "Image": "postgres:15", "Env": ["POSTGRES_PASSWORD=secret"], "PortForwards": {"5432": 5432}, "BootWait": "2s",
+	 "Wait": {"Log": "ready to accept connections", "Occurrences": 2, "Timeout": 30},
+	 "PostRun": [{"Command": ["psql", "-U", "postgres"], "Stdin": "CREATE TABLE t (id int);", "RetryFor": "30s", "RetryInterval": 1, "Timeout": "5s"}]},
+	{"Name": "app", "Image": "app:dev", "Build": {"Context": "."}, "DependsOn": ["db"]}
+]`,
+		"manifest.toml": `
+[[containers]]
+name = "db"
+image = "postgres:15"
+env = ["POSTGRES_PASSWORD=secret"]
+portForwards = { "5432" = 5432 }
+bootWait = "2s"
+wait = { log = "ready to accept connections", occurrences = 2, timeout = "30s" }
+postRun = [{ command = ["psql", "-U", "postgres"], stdin = "CREATE TABLE t (id int);", retryFor = "30s", retryInterval = "1s", timeout = "5s" }]
+
+[[containers]]
+name = "app"
+image = "app:dev"
+build = { context = "." }
+dependsOn = ["db"]
+`,
+	}
+
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		m, err := LoadManifest(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if len(m) != 2 {
+			t.Fatalf("%s: unexpected manifest: %+v", name, m)
+		}
+
+		db, app := m[0], m[1]
+		if db.Name != "db" || db.Image != "postgres:15" || !reflect.DeepEqual(db.Env, []string{"POSTGRES_PASSWORD=secret"}) ||
+			db.PortForwards[5432] != 5432 || db.BootWait != 2*time.Second || db.WaitFor == nil {
+			t.Fatalf("%s: unexpected container: %+v", name, db)
+		}
+
+		postRun := PostCommand{
+			Command:       []string{"psql", "-U", "postgres"},
+			Stdin:         []byte("CREATE TABLE t (id int);"),
+			RetryFor:      30 * time.Second,
+			RetryInterval: time.Second,
+			Timeout:       5 * time.Second,
+		}
+		if !reflect.DeepEqual(db.PostRun, []PostCommand{postRun}) {
+			t.Fatalf("%s: unexpected post-run commands: %+v", name, db.PostRun)
+		}
+
+		if app.Build == nil || app.Build.Context != "." || !reflect.DeepEqual(app.DependsOn, []string{"db"}) || app.WaitFor != nil {
+			t.Fatalf("%s: unexpected container: %+v", name, app)
+		}
+	}
+
+	for content, expected := range map[string]string{
+		`[{"Name": "db", "Imgae": "postgres"}]`:                     "unknown field",
+		`[{"Name": "db", "Wait": {"Log": "ready", "Kafka": 9092}}]`: "exactly one",
+		`[{"Name": "db", "BootWait": "soon"}]`:                      "invalid duration",
+		`[{"Name": "db", "PostRun": [{"RetryFor": "soon"}]}]`:       "invalid duration",
+	} {
+		path := filepath.Join(dir, "bad.json")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := LoadManifest(path); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected an error containing %q, got %v", content, expected, err)
+		}
+	}
+
+	path := filepath.Join(dir, "manifest.ini")
+	if err := os.WriteFile(path, []byte("[db]"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadManifest(path); err == nil {
+		t.Fatal("no error for an unknown format")
+	}
+}
+
+func TestLoadManifestTemplate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.yaml")
+	content := `
+containers:
+  - name: db
+    image: postgres:{{ .postgres.tag }}
+    portForwards:
+      {{ index . "port" | default 5432 }}: 5432
+    replicas: {{ index . "replicas" | default 1 }}
+    env: [{{ printf "PASSWORD=%s" .password | quote }}]
+`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	values := map[string]interface{}{
+		"postgres": map[string]interface{}{"tag": "15"},
+		"replicas": "3",
+		"password": "secret",
+	}
+
+	m, err := LoadManifestTemplate(path, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := m[0]
+	if db.Image != "postgres:15" || db.PortForwards[5432] != 5432 || db.Replicas != 3 || !reflect.DeepEqual(db.Env, []string{"PASSWORD=secret"}) {
+		t.Fatalf("unexpected container: %+v", db)
+	}
+
+	delete(values, "password")
+	if _, err := LoadManifestTemplate(path, values); err == nil || !strings.Contains(err.Error(), "password") {
+		t.Fatalf("expected an error about the missing value, got %v", err)
+	}
+}
@@ -0,0 +1,205 @@
+package duct
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+// LogLevel is the least severity of the logging output of a Composer; see
+// WithLogLevel.
+type LogLevel int
+
+const (
+	// LogDebug logs everything, including the docker API calls made.
+	LogDebug LogLevel = iota
+	// LogInfo logs the progress of the launch and teardown. It is the default.
+	LogInfo
+	// LogWarn logs warnings and errors.
+	LogWarn
+	// LogError logs only errors.
+	LogError
+)
+
+// WithLogLevel sets the least severity of the Composer's logging output.
+func WithLogLevel(level LogLevel) Options {
+	return Options{optionLogLevel: level}
+}
+
+// WithQuiet logs only errors; it is WithLogLevel(LogError).
+func WithQuiet() Options {
+	return WithLogLevel(LogError)
+}
+
+// logLevel is the least severity which is logged.
+func (c *Composer) logLevel() LogLevel {
+	if level, ok := c.options[optionLogLevel].(LogLevel); ok {
+		return level
+	}
+
+	return LogInfo
+}
+
+// logf logs the message if it is at least as severe as the log level.
+func (c *Composer) logf(level LogLevel, format string, args ...interface{}) {
+	c.logContainer(level, "", format, args...)
+}
+
+// logContainer logs the message about the container like logf. With
+// WithJSONLogs, the container is the Container of its LogEvent.
+func (c *Composer) logContainer(level LogLevel, container, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if c.logEvent(level, LogEvent{Container: container, Message: msg}) {
+		return
+	}
+
+	if level >= c.logLevel() {
+		logPrintf("%s", msg)
+	}
+}
+
+// traceClient returns a copy of the client which logs its API calls. The
+// copy shares everything else with the client, which may be pooled.
+func (c *Composer) traceClient(client *dc.Client) *dc.Client {
+	transport := client.HTTPClient.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	traced := *client
+	traced.HTTPClient = &http.Client{
+		Transport: &tracingTransport{c: c, base: transport},
+		Timeout:   client.HTTPClient.Timeout,
+	}
+
+	return &traced
+}
+
+// tracingTransport logs the requests made through it at LogDebug.
+type tracingTransport struct {
+	c    *Composer
+	base http.RoundTripper
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	started := time.Now()
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		t.c.logf(LogDebug, "docker API: %s %s: %v (%v)", req.Method, req.URL.Path, err, time.Since(started))
+		return nil, err
+	}
+
+	t.c.logf(LogDebug, "docker API: %s %s: %s (%v)", req.Method, req.URL.Path, resp.Status, time.Since(started))
+	return resp, nil
+}
+
+// WithJSONLogs writes the logging output of the Composer as JSON objects, one
+// LogEvent per line, for CI systems to render as structured steps. The events
+// go to the log output, e.g. the writer of WithLogWriter, which is otherwise
+// left as it is.
+func WithJSONLogs() Options {
+	return Options{optionJSONLogs: true}
+}
+
+// LogEvent is a line of the logging output with WithJSONLogs. The phases of
+// the launch and teardown of each container are logged when they begin, and
+// again with their duration when they end.
+type LogEvent struct {
+	Time time.Time `json:"time"`
+	// Phase is the phase of the launch or teardown, e.g. "pull", "create",
+	// "start", "ready", "post-command", "platform" or "remove".
+	Phase string `json:"phase,omitempty"`
+	// Container is the name of the container the event is about, if any.
+	Container string `json:"container,omitempty"`
+	Message   string `json:"message"`
+	// Duration is how long the phase took, in seconds, when it ends.
+	Duration float64 `json:"duration,omitempty"`
+	// Error is why the phase failed, when it ends.
+	Error string `json:"error,omitempty"`
+}
+
+// logMu serializes the lines duct writes to the log output. LogEvents bypass
+// the locking of the log package, so the plain lines are written under it too,
+// with logPrintf.
+var logMu sync.Mutex
+
+// logPrintf logs like log.Printf, without interleaving with LogEvents.
+func logPrintf(format string, args ...interface{}) {
+	logMu.Lock()
+	defer logMu.Unlock()
+
+	log.Printf(format, args...)
+}
+
+// phase logs the beginning of a phase of the launch or teardown of the
+// container, or of the composition if it is nil. Without WithJSONLogs, an
+// empty message is not logged. The returned function ends the phase with its
+// error, if any, which is only logged with WithJSONLogs.
+func (c *Composer) phase(ctx context.Context, name string, cont *Container, format string, args ...interface{}) func(error) {
+	started := time.Now()
+
+	ev := LogEvent{Phase: name, Message: fmt.Sprintf(format, args...)}
+	if cont != nil {
+		ev.Container = cont.Name
+	}
+
+	if !c.logEvent(LogInfo, ev) && ev.Message != "" {
+		c.logf(LogInfo, "%s", ev.Message)
+	}
+
+	_, end := c.trace(ctx, "duct."+name, cont)
+
+	return func(err error) {
+		end(err)
+
+		elapsed := time.Since(started)
+		if err == nil && cont != nil {
+			c.recordTiming(cont, name, elapsed)
+		}
+
+		ev.Message = name + " done"
+		ev.Duration = elapsed.Seconds()
+		if err != nil {
+			ev.Message = name + " failed"
+			ev.Error = err.Error()
+		}
+		c.logEvent(LogInfo, ev)
+	}
+}
+
+// logEvent logs the event at the level if WithJSONLogs is in effect, and
+// returns whether it is.
+func (c *Composer) logEvent(level LogLevel, ev LogEvent) bool {
+	if c.options[optionJSONLogs] == nil {
+		return false
+	}
+
+	if level < c.logLevel() {
+		return true
+	}
+
+	ev.Time = time.Now()
+	if ev.Message == "" {
+		ev.Message = ev.Phase
+	}
+
+	b, err := json.Marshal(ev)
+	if err == nil {
+		logMu.Lock()
+		_, err = log.Writer().Write(append(b, '\n'))
+		logMu.Unlock()
+	}
+
+	if err != nil {
+		logPrintf("Error writing log event: %v", err)
+	}
+
+	return true
+}
@@ -0,0 +1,163 @@
+package duct
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+func TestJSONLogs(t *testing.T) {
+	buf := &bytes.Buffer{}
+
+	writer := log.Writer()
+	defer log.SetOutput(writer)
+	log.SetOutput(buf)
+
+	c := New(Manifest{}, WithJSONLogs())
+	cont := &Container{Name: "db"}
+
+	done := c.phase(context.Background(), "pull", cont, "Pulling docker image: [%s]", "postgres")
+	c.logf(LogInfo, "Creating volume: [%s]", "data")
+	c.logContainer(LogWarn, "db", "WARNING: Failed to inspect [%s]: %v", "db", "gone")
+	c.logContainer(LogDebug, "db", "Container will be emulated: [%s]", "db")
+	done(nil)
+
+	events := []LogEvent{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var ev LogEvent
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			t.Fatalf("invalid log line %q: %v", line, err)
+		}
+		events = append(events, ev)
+	}
+
+	if len(events) != 4 {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+
+	if ev := events[0]; ev.Phase != "pull" || ev.Container != "db" || ev.Message != "Pulling docker image: [postgres]" {
+		t.Fatalf("unexpected start event: %+v", ev)
+	}
+
+	if ev := events[1]; ev.Phase != "" || ev.Container != "" || ev.Message != "Creating volume: [data]" {
+		t.Fatalf("a volume was logged as a container: %+v", ev)
+	}
+
+	if ev := events[2]; ev.Container != "db" || ev.Message != "WARNING: Failed to inspect [db]: gone" {
+		t.Fatalf("unexpected container event: %+v", ev)
+	}
+
+	if ev := events[3]; ev.Phase != "pull" || ev.Duration <= 0 {
+		t.Fatalf("unexpected end event: %+v", ev)
+	}
+
+	if log.Writer() != buf {
+		t.Fatal("the log output was replaced")
+	}
+
+	// other output, and Composers without WithJSONLogs, are left as they are
+	buf.Reset()
+	log.Printf("Creating volume: [%s]", "data")
+	New(Manifest{}).logContainer(LogInfo, "db", "Removing container: [%s]", "db")
+
+	if out := buf.String(); strings.Contains(out, "{") || strings.Count(out, "\n") != 2 {
+		t.Fatalf("output without WithJSONLogs was made JSON: %q", out)
+	}
+}
+
+func TestJSONLogsInterleaving(t *testing.T) {
+	w := &overlapWriter{}
+
+	writer := log.Writer()
+	defer log.SetOutput(writer)
+	log.SetOutput(w)
+
+	json := New(Manifest{}, WithJSONLogs())
+	plain := New(Manifest{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			json.logf(LogInfo, "Creating volume: [%s]", "data")
+		}()
+		go func() {
+			defer wg.Done()
+			plain.logf(LogInfo, "Creating volume: [%s]", "data")
+		}()
+	}
+	wg.Wait()
+
+	if atomic.LoadInt32(&w.overlapped) != 0 {
+		t.Fatal("log events were written concurrently with other log output")
+	}
+}
+
+// overlapWriter records whether it was written to concurrently.
+type overlapWriter struct {
+	writing    int32
+	overlapped int32
+}
+
+func (w *overlapWriter) Write(p []byte) (int, error) {
+	if atomic.AddInt32(&w.writing, 1) != 1 {
+		atomic.StoreInt32(&w.overlapped, 1)
+	}
+	time.Sleep(time.Millisecond)
+	atomic.AddInt32(&w.writing, -1)
+
+	return len(p), nil
+}
+
+func TestLogLevel(t *testing.T) {
+	buf := &bytes.Buffer{}
+
+	writer := log.Writer()
+	defer log.SetOutput(writer)
+	log.SetOutput(buf)
+
+	c := New(Manifest{}, WithQuiet())
+	c.logf(LogInfo, "Creating volume: [%s]", "data")
+	c.logf(LogWarn, "WARNING: Failed to inspect [%s]", "db")
+	c.phase(context.Background(), "pull", &Container{Name: "db"}, "Pulling docker image: [%s]", "postgres")(nil)
+	c.logf(LogError, "Error removing volume: [%s]", "data")
+
+	if out := buf.String(); strings.Count(out, "\n") != 1 || !strings.Contains(out, "Error removing volume") {
+		t.Fatalf("unexpected quiet output: %q", out)
+	}
+
+	buf.Reset()
+
+	c = New(Manifest{}, WithLogLevel(LogDebug))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client, err := dc.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SkipServerVersionCheck = true
+
+	if err := c.traceClient(client).Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(buf.String(), "docker API: GET /_ping: 200 OK") {
+		t.Fatalf("API call was not traced: %q", buf.String())
+	}
+
+	if _, ok := client.HTTPClient.Transport.(*tracingTransport); ok {
+		t.Fatal("original client was modified")
+	}
+}
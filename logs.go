@@ -0,0 +1,341 @@
+package duct
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+// LogLine is a single line of output from a container.
+type LogLine struct {
+	// Container is the name of the container in the manifest.
+	Container string
+	// Stream is either "stdout" or "stderr".
+	Stream string
+	// Text is the line without its trailing newline.
+	Text string
+	// Time is the time docker recorded the line at.
+	Time time.Time
+}
+
+// logFollower attaches to the output of a single container once and retains
+// everything it has seen. Waiters, assertions and writers all read from the
+// same follower at their own pace instead of attaching separately.
+type logFollower struct {
+	mu      sync.Mutex
+	lines   []LogLine
+	changed chan struct{}
+	done    bool
+	err     error
+
+	cancel   context.CancelFunc
+	finished chan struct{}
+}
+
+// follow returns the log follower for the container, starting it if
+// necessary.
+func (c *Composer) follow(cont *Container) *logFollower {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if f, ok := c.followers[cont.Name]; ok {
+		return f
+	}
+
+	if c.followers == nil {
+		c.followers = map[string]*logFollower{}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	f := &logFollower{
+		changed:  make(chan struct{}),
+		cancel:   cancel,
+		finished: make(chan struct{}),
+	}
+	c.followers[cont.Name] = f
+
+	var stream io.Writer
+	if w, ok := c.options[optionLogStream]; ok && w != nil {
+		stream = &lockedWriter{mu: &c.streamMu, w: w.(io.Writer)}
+	}
+
+	prefix := c.logPrefix(cont)
+	timestamps := c.options[optionLogTimestamps] != nil
+	id := cont.id
+	since := cont.started.Unix()
+
+	go func() {
+		defer close(f.finished)
+
+		err := c.client.Logs(dc.LogsOptions{
+			Context:      ctx,
+			Container:    id,
+			OutputStream: &lineWriter{f: f, container: cont.Name, stream: "stdout", out: stream, prefix: prefix, timestamps: timestamps, scrub: c.scrub},
+			ErrorStream:  &lineWriter{f: f, container: cont.Name, stream: "stderr", out: stream, prefix: prefix, timestamps: timestamps, scrub: c.scrub},
+			Since:        since,
+			Follow:       true,
+			Stdout:       true,
+			Stderr:       true,
+			Timestamps:   true,
+		})
+
+		if ctx.Err() != nil {
+			err = nil
+		}
+
+		f.finish(err)
+	}()
+
+	return f
+}
+
+// unfollow detaches the log follower of the container, if there is one.
+func (c *Composer) unfollow(cont *Container) {
+	c.mu.Lock()
+	f, ok := c.followers[cont.Name]
+	delete(c.followers, cont.Name)
+	c.mu.Unlock()
+
+	if ok {
+		f.cancel()
+		<-f.finished
+	}
+}
+
+// stopFollowers detaches all log followers and waits for them to finish.
+func (c *Composer) stopFollowers() {
+	c.mu.Lock()
+	followers := c.followers
+	c.followers = nil
+	c.mu.Unlock()
+
+	for _, f := range followers {
+		f.cancel()
+		<-f.finished
+	}
+}
+
+func (f *logFollower) append(line LogLine) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.lines = append(f.lines, line)
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+func (f *logFollower) finish(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.done = true
+	f.err = err
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+// next returns the lines starting at index from, blocking until there is
+// at least one. io.EOF is returned once the container's output has ended.
+func (f *logFollower) next(ctx context.Context, from int) ([]LogLine, error) {
+	for {
+		f.mu.Lock()
+		lines, done, err, changed := f.lines, f.done, f.err, f.changed
+		f.mu.Unlock()
+
+		if from < len(lines) {
+			return lines[from:], nil
+		}
+
+		if done {
+			if err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// match waits for re to match occurrences lines.
+func (f *logFollower) match(ctx context.Context, re *regexp.Regexp, occurrences int) error {
+	var seen, count int
+
+	for {
+		lines, err := f.next(ctx, seen)
+		if err != nil {
+			return fmt.Errorf("found %d of %d lines matching %q: %w", count, occurrences, re, err)
+		}
+
+		for _, line := range lines {
+			if re.MatchString(line.Text) {
+				count++
+				if count >= occurrences {
+					return nil
+				}
+			}
+		}
+
+		seen += len(lines)
+	}
+}
+
+// lineWriter splits one stream of container output into lines and feeds them
+// to the follower and any writer that is streaming the logs.
+type lineWriter struct {
+	f          *logFollower
+	container  string
+	stream     string
+	out        io.Writer
+	prefix     string
+	timestamps bool
+	scrub      func(string) string
+	buf        []byte
+}
+
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	lw.buf = append(lw.buf, p...)
+
+	for {
+		i := bytes.IndexByte(lw.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		line := LogLine{Container: lw.container, Stream: lw.stream, Text: strings.TrimSuffix(string(lw.buf[:i]), "\r")}
+		lw.buf = lw.buf[i+1:]
+
+		// docker prefixes each line with the timestamp when asked to
+		if ts, text, ok := strings.Cut(line.Text, " "); ok {
+			if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+				line.Time = t
+				line.Text = text
+			}
+		}
+
+		if lw.scrub != nil {
+			line.Text = lw.scrub(line.Text)
+		}
+
+		lw.f.append(line)
+
+		if lw.out != nil {
+			text := line.Text
+			if lw.timestamps {
+				text = line.Time.Format(time.RFC3339Nano) + " " + text
+			}
+
+			if _, err := fmt.Fprintln(lw.out, lw.prefix+text); err != nil {
+				logPrintf("WARNING: Failed to stream logs for [%s]: %v", lw.container, err)
+				lw.out = nil
+			}
+		}
+	}
+
+	return len(p), nil
+}
+
+// logColors are the ANSI colors of the prefixes of streamed logs, in the
+// order they are given to the containers of the manifest.
+var logColors = []string{"36", "33", "32", "35", "34", "96", "93", "92", "95", "94"}
+
+// WithLogPrefix prefixes each line of the output streamed by WithLogStream
+// with the [name] of its container, padded to line up, like docker compose
+// does. If colors is true, each container's prefix gets its own color.
+func WithLogPrefix(colors bool) Options {
+	return Options{optionLogPrefix: colors}
+}
+
+// WithLogTimestamps prefixes each line of the output streamed by
+// WithLogStream with the time docker recorded it at.
+func WithLogTimestamps() Options {
+	return Options{optionLogTimestamps: true}
+}
+
+// logPrefix returns the prefix of the container's streamed output lines.
+func (c *Composer) logPrefix(cont *Container) string {
+	colors, ok := c.options[optionLogPrefix].(bool)
+	if !ok {
+		return ""
+	}
+
+	width, index := 0, 0
+	for i, other := range c.manifest {
+		if len(other.Name) > width {
+			width = len(other.Name)
+		}
+		if other == cont {
+			index = i
+		}
+	}
+
+	prefix := fmt.Sprintf("%-*s ", width+2, "["+cont.Name+"]")
+	if colors {
+		prefix = "\x1b[" + logColors[index%len(logColors)] + "m" + prefix + "\x1b[0m"
+	}
+
+	return prefix
+}
+
+// lockedWriter serializes writes from several followers to one writer.
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (lw *lockedWriter) Write(p []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return lw.w.Write(p)
+}
+
+// WaitForLog waits until the container has emitted occurrences lines matching
+// the regular expression pattern. Lines emitted before the wait begins are
+// counted as well.
+func WaitForLog(pattern string, occurrences int, timeout time.Duration) WaitStrategy {
+	return func(ctx context.Context, c *Composer, cont *Container) error {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return err
+		}
+
+		if occurrences < 1 {
+			occurrences = 1
+		}
+
+		if timeout != 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		return c.follow(cont).match(ctx, re, occurrences)
+	}
+}
+
+// ExpectLog asserts that the named container emits a line matching the
+// regular expression pattern within timeout. Output from the whole life of the
+// container is considered, so lines emitted before the call also count.
+func (c *Composer) ExpectLog(ctx context.Context, name, pattern string, timeout time.Duration) error {
+	cont, err := c.find(name)
+	if err != nil {
+		return err
+	}
+
+	if err := WaitForLog(pattern, 1, timeout)(ctx, c, cont); err != nil {
+		return fmt.Errorf("[%s] expected log line: %w", name, err)
+	}
+
+	return nil
+}
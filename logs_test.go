@@ -0,0 +1,72 @@
+package duct
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestLogFollower(t *testing.T) {
+	f := &logFollower{changed: make(chan struct{})}
+	out := &bytes.Buffer{}
+	lw := &lineWriter{f: f, container: "test", stream: "stdout", out: out}
+
+	errc := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		errc <- f.match(ctx, regexp.MustCompile("^ready"), 2)
+	}()
+
+	lw.Write([]byte("2020-10-31T23:38:35.000000000Z ready once\n2020-10-31T23:38:36.0"))
+	lw.Write([]byte("00000000Z not yet\nready twice\n"))
+
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+
+	if len(f.lines) != 3 {
+		t.Fatalf("expected 3 lines, got %d", len(f.lines))
+	}
+
+	if f.lines[1].Text != "not yet" || f.lines[1].Time.Second() != 36 {
+		t.Fatalf("timestamp was not parsed: %+v", f.lines[1])
+	}
+
+	if out.String() != "ready once\nnot yet\nready twice\n" {
+		t.Fatalf("unexpected streamed output: %q", out.String())
+	}
+
+	f.finish(nil)
+
+	if err := f.match(context.Background(), regexp.MustCompile("never"), 1); err == nil {
+		t.Fatal("match succeeded after output ended")
+	}
+}
+
+func TestLogPrefix(t *testing.T) {
+	m := Manifest{{Name: "db"}, {Name: "web-server"}}
+
+	if prefix := New(m).logPrefix(m[0]); prefix != "" {
+		t.Fatalf("unexpected prefix without the option: %q", prefix)
+	}
+
+	if prefix := New(m, WithLogPrefix(false)).logPrefix(m[0]); prefix != "[db]         " {
+		t.Fatalf("unexpected prefix: %q", prefix)
+	}
+
+	if prefix := New(m, WithLogPrefix(true)).logPrefix(m[1]); prefix != "\x1b[33m[web-server] \x1b[0m" {
+		t.Fatalf("unexpected colored prefix: %q", prefix)
+	}
+
+	f := &logFollower{changed: make(chan struct{})}
+	out := &bytes.Buffer{}
+	lw := &lineWriter{f: f, container: "db", stream: "stdout", out: out, prefix: "[db] ", timestamps: true}
+	lw.Write([]byte("2020-10-31T23:38:35.5Z ready\n"))
+
+	if out.String() != "[db] 2020-10-31T23:38:35.5Z ready\n" {
+		t.Fatalf("unexpected streamed output: %q", out.String())
+	}
+}
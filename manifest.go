@@ -0,0 +1,351 @@
+package duct
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// Derive returns a copy of the container to use as a variant of a template.
+// The copy is named name, and then passed to mutate, if it is non-nil, to
+// override anything else, e.g. Env or Command. The template is not modified.
+func (cont *Container) Derive(name string, mutate func(*Container)) *Container {
+	n := cont.clone()
+	n.Name = name
+
+	if mutate != nil {
+		mutate(n)
+	}
+
+	return n
+}
+
+// Merge returns a manifest of the containers in m followed by those in other.
+// It is an error if both contain a container with the same name, or if
+// containers from each forward the same host port.
+func (m Manifest) Merge(other Manifest) (Manifest, error) {
+	names := map[string]struct{}{}
+	ports := map[string]string{}
+
+	for _, cont := range m {
+		names[cont.Name] = struct{}{}
+		for _, host := range cont.hostPorts() {
+			ports[host] = cont.Name
+		}
+	}
+
+	conflicts := []string{}
+	for _, cont := range other {
+		if _, ok := names[cont.Name]; ok {
+			conflicts = append(conflicts, fmt.Sprintf("container [%s] is in both manifests", cont.Name))
+		}
+
+		for _, host := range cont.hostPorts() {
+			if name, ok := ports[host]; ok {
+				conflicts = append(conflicts, fmt.Sprintf("host port %s is forwarded by [%s] and [%s]", host, name, cont.Name))
+			}
+		}
+	}
+
+	if len(conflicts) != 0 {
+		return nil, fmt.Errorf("cannot merge manifests: %s", strings.Join(conflicts, "; "))
+	}
+
+	return append(append(Manifest{}, m...), other...), nil
+}
+
+// selectProfiles returns the containers without profiles, and those in any of
+// the profiles.
+func (m Manifest) selectProfiles(profiles []string) Manifest {
+	selected := map[string]struct{}{}
+	for _, profile := range profiles {
+		selected[profile] = struct{}{}
+	}
+
+	res := Manifest{}
+	for _, cont := range m {
+		if len(cont.Profiles) == 0 {
+			res = append(res, cont)
+			continue
+		}
+
+		for _, profile := range cont.Profiles {
+			if _, ok := selected[profile]; ok {
+				res = append(res, cont)
+				break
+			}
+		}
+	}
+
+	return res
+}
+
+// enabled is true if the container's Only, Except and Condition let it be
+// launched.
+func (cont *Container) enabled() bool {
+	if len(cont.Only) != 0 && !envMatches(cont.Only) {
+		return false
+	}
+
+	if envMatches(cont.Except) {
+		return false
+	}
+
+	return cont.Condition == nil || cont.Condition()
+}
+
+// envMatches is true if any of the conditions on the environment holds.
+func envMatches(conditions []string) bool {
+	for _, condition := range conditions {
+		name, value, hasValue := strings.Cut(condition, "=")
+		actual := os.Getenv(name)
+
+		if (hasValue && actual == value) || (!hasValue && actual != "") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Validate returns an error describing every problem with the manifest that
+// can be found without docker: duplicate or empty names, empty images, host
+// ports forwarded twice, DependsOn references to containers that are not
+// earlier in the manifest, invalid IPv4 and IPv6 addresses or those outside
+// the subnets given with WithNewNetworkIPAM and the like, static addresses of
+// containers with replicas, invalid address pools, bind mount sources and post-command stdin files that do not exist,
+// invalid FakeTime specifications, and violations of the policies given with
+// WithPolicies. Pass the options the manifest will be launched with.
+func (m Manifest) Validate(options ...Options) error {
+	opts := Options{}
+	for _, o := range options {
+		for k, v := range o {
+			opts[k] = v
+		}
+	}
+
+	problems := []string{}
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	subnets := []*net.IPNet{}
+	for _, pool := range ipamPools(opts) {
+		_, subnet, err := net.ParseCIDR(pool.Subnet)
+		if err != nil {
+			problem("invalid subnet %q", pool.Subnet)
+			continue
+		}
+		subnets = append(subnets, subnet)
+
+		if pool.IPRange != "" {
+			if _, ipRange, err := net.ParseCIDR(pool.IPRange); err != nil {
+				problem("invalid IP range %q", pool.IPRange)
+			} else if !subnet.Contains(ipRange.IP) {
+				problem("IP range %s is not in the subnet %s", ipRange, subnet)
+			}
+		}
+
+		addrs := map[string]string{}
+		for name, addr := range pool.AuxAddresses {
+			addrs["auxiliary address "+name] = addr
+		}
+		if pool.Gateway != "" {
+			addrs["gateway"] = pool.Gateway
+		}
+
+		for _, what := range sortedKeys(addrs) {
+			if ip := net.ParseIP(addrs[what]); ip == nil {
+				problem("invalid %s %q", what, addrs[what])
+			} else if !subnet.Contains(ip) {
+				problem("%s %s is not in the subnet %s", what, ip, subnet)
+			}
+		}
+	}
+
+	// inSubnets returns the subnets of the IP version of the address, and
+	// whether one of them contains it.
+	inSubnets := func(ip net.IP) ([]string, bool) {
+		names := []string{}
+		for _, subnet := range subnets {
+			if (subnet.IP.To4() == nil) != (ip.To4() == nil) {
+				continue
+			}
+			if subnet.Contains(ip) {
+				return nil, true
+			}
+			names = append(names, subnet.String())
+		}
+
+		return names, false
+	}
+
+	mirrors, _ := opts[optionRegistryMirror].(map[string]string)
+
+	names := map[string]struct{}{}
+	shared := map[string]struct{}{}
+	for _, cont := range m {
+		if cont.Name == "" {
+			problem("container with image %q has no name", cont.Image)
+		} else if _, ok := names[cont.Name]; ok {
+			problem("container [%s] is in the manifest more than once", cont.Name)
+		}
+
+		if cont.Image == "" && !cont.External {
+			problem("[%s] has no image", cont.Name)
+		}
+
+		for _, dep := range cont.DependsOn {
+			if _, ok := names[dep]; !ok {
+				problem("[%s] depends on [%s], which is not earlier in the manifest", cont.Name, dep)
+			}
+		}
+
+		for _, from := range cont.namespacesFrom() {
+			if _, ok := names[from]; !ok {
+				problem("[%s] shares namespaces with [%s], which is not earlier in the manifest", cont.Name, from)
+			}
+		}
+
+		names[cont.Name] = struct{}{}
+		if cont.replicaOf != "" {
+			names[cont.replicaOf] = struct{}{}
+		}
+
+		if cont.IPv4 != "" {
+			if ip := net.ParseIP(cont.IPv4); ip == nil || ip.To4() == nil {
+				problem("[%s] has an invalid IPv4 address %q", cont.Name, cont.IPv4)
+			} else if names, ok := inSubnets(ip); !ok && len(names) != 0 {
+				problem("[%s] IPv4 address %s is not in the subnet %s", cont.Name, ip, strings.Join(names, ", "))
+			} else if !ok && opts[optionCreateNetwork] != nil {
+				problem("[%s] has an IPv4 address, which requires a network with a subnet", cont.Name)
+			}
+		}
+
+		if cont.IPv6 != "" {
+			if ip := net.ParseIP(cont.IPv6); ip == nil || ip.To4() != nil {
+				problem("[%s] has an invalid IPv6 address %q", cont.Name, cont.IPv6)
+			} else if names, ok := inSubnets(ip); !ok && len(names) != 0 {
+				problem("[%s] IPv6 address %s is not in the subnet %s", cont.Name, ip, strings.Join(names, ", "))
+			}
+		}
+
+		for _, device := range []struct {
+			what   string
+			limits map[string]int64
+		}{
+			{"read rate", cont.DeviceReadBps},
+			{"write rate", cont.DeviceWriteBps},
+			{"read operations", cont.DeviceReadIOps},
+			{"write operations", cont.DeviceWriteIOps},
+		} {
+			for _, path := range sortedKeys(device.limits) {
+				if device.limits[path] <= 0 {
+					problem("[%s] has a %s limit of %d for %s, which is not positive", cont.Name, device.what, device.limits[path], path)
+				}
+			}
+		}
+
+		// images with variables are checked once they are interpolated
+		if !strings.Contains(cont.Image, "$") {
+			policed := *cont
+			if cont.Build == nil && !cont.LocalImage {
+				policed.Image = mirrorImage(mirrors, cont.Image)
+			}
+
+			for _, violation := range policyViolations(opts, &policed) {
+				problem("%s", violation)
+			}
+		}
+
+		for _, command := range cont.PostRun {
+			if len(command.Command) == 0 && command.Shell == "" {
+				problem("[%s] has a post-command without a command", cont.Name)
+				continue
+			} else if len(command.Command) != 0 && command.Shell != "" {
+				problem("[%s] post-command [%s] has both Command and Shell", cont.Name, command.argv())
+			}
+
+			if command.Stdin != nil && command.StdinFile != "" {
+				problem("[%s] post-command [%s] has both Stdin and StdinFile", cont.Name, command.argv())
+			} else if command.StdinFile != "" {
+				abs, err := hostPath(command.StdinFile)
+				if err == nil {
+					_, err = os.Stat(abs)
+				}
+				if err != nil {
+					problem("[%s] post-command [%s] stdin file %s does not exist", cont.Name, command.argv(), abs)
+				}
+			}
+		}
+
+		if cont.FakeTime != "" && !fakeTimeSpec.MatchString(cont.FakeTime) {
+			problem("[%s] has an invalid fake time %q", cont.Name, cont.FakeTime)
+		}
+
+		if cont.OomScoreAdj < -1000 || cont.OomScoreAdj > 1000 {
+			problem("[%s] has an OOM score adjustment of %d, which is not between -1000 and 1000", cont.Name, cont.OomScoreAdj)
+		}
+
+		if s := cont.MemorySwappiness; s != nil && (*s < 0 || *s > 100) {
+			problem("[%s] has a memory swappiness of %d, which is not between 0 and 100", cont.Name, *s)
+		}
+
+		if cont.MacAddress != "" {
+			if _, err := net.ParseMAC(cont.MacAddress); err != nil {
+				problem("[%s] has an invalid MAC address %q", cont.Name, cont.MacAddress)
+			}
+		}
+
+		// after expand, each replica has a copy of the addresses, so they are
+		// reported once for the container it replicates
+		if name := cont.replicated(); name != "" {
+			for _, addr := range []struct {
+				what  string
+				value string
+			}{
+				{"a MAC address", cont.MacAddress},
+				{"an IPv4 address", cont.IPv4},
+				{"an IPv6 address", cont.IPv6},
+			} {
+				key := name + " " + addr.what
+				if _, ok := shared[key]; addr.value != "" && !ok {
+					shared[key] = struct{}{}
+					problem("[%s] has %s, which its replicas cannot share", name, addr.what)
+				}
+			}
+		}
+
+		for host := range cont.BindMounts {
+			// sources with variables are checked once they are interpolated
+			if strings.Contains(host, "$") {
+				continue
+			}
+
+			abs, err := hostPath(host)
+			if err == nil {
+				_, err = os.Stat(abs)
+			}
+			if err != nil {
+				problem("[%s] bind mount source %s does not exist", cont.Name, abs)
+			}
+		}
+	}
+
+	ports := map[string]string{}
+	for _, cont := range m.expand() {
+		for _, host := range cont.hostPorts() {
+			if name, ok := ports[host]; ok {
+				problem("host port %s is forwarded by [%s] and [%s]", host, name, cont.Name)
+			}
+			ports[host] = cont.Name
+		}
+	}
+
+	if len(problems) != 0 {
+		return fmt.Errorf("invalid manifest: %s", strings.Join(problems, "; "))
+	}
+
+	return nil
+}
@@ -0,0 +1,206 @@
+package duct
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDerive(t *testing.T) {
+	base := &Container{
+		Name:    "postgres",
+		Image:   "postgres:latest",
+		Env:     []string{"POSTGRES_PASSWORD=secret"},
+		Command: []string{"postgres"},
+	}
+
+	variant := base.Derive("postgres-fsync-off", func(c *Container) {
+		c.Env = append(c.Env, "POSTGRES_DB=test")
+		c.Command = append(c.Command, "-c", "fsync=off")
+	})
+
+	if variant.Name != "postgres-fsync-off" || variant.Image != base.Image {
+		t.Fatalf("unexpected variant: %+v", variant)
+	}
+
+	if len(variant.Env) != 2 || len(variant.Command) != 3 {
+		t.Fatalf("variant was not mutated: %+v", variant)
+	}
+
+	if base.Name != "postgres" || len(base.Env) != 1 || len(base.Command) != 1 {
+		t.Fatalf("template was modified: %+v", base)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	a := Manifest{{Name: "db", PortForwards: map[int]int{5432: 5432}}}
+	b := Manifest{{Name: "web", PortForwards: map[int]int{8080: 80}}}
+
+	m, err := a.Merge(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m) != 2 || m[0].Name != "db" || m[1].Name != "web" {
+		t.Fatalf("unexpected merge result: %v", m)
+	}
+
+	if _, err := a.Merge(Manifest{{Name: "db"}}); err == nil {
+		t.Fatal("merged manifests with the same container")
+	}
+
+	if _, err := a.Merge(Manifest{{Name: "db2", PortForwards: map[int]int{5432: 5433}}}); err == nil {
+		t.Fatal("merged manifests forwarding the same host port")
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	m := Manifest{
+		{Name: "app"},
+		{Name: "kafka", Profiles: []string{"kafka"}},
+		{Name: "prometheus", Profiles: []string{"metrics"}},
+		{Name: "grafana", Profiles: []string{"metrics", "dashboards"}},
+	}
+
+	names := func(c *Composer) []string {
+		res := []string{}
+		for _, cont := range c.manifest {
+			res = append(res, cont.Name)
+		}
+		return res
+	}
+
+	if n := names(New(m)); len(n) != 1 || n[0] != "app" {
+		t.Fatalf("unexpected containers without profiles: %v", n)
+	}
+
+	if n := names(New(m, WithProfiles("kafka", "metrics"))); len(n) != 4 {
+		t.Fatalf("unexpected containers with profiles: %v", n)
+	}
+
+	if n := names(New(m, WithProfiles("dashboards"))); len(n) != 2 || n[1] != "grafana" {
+		t.Fatalf("unexpected containers with profile: %v", n)
+	}
+}
+
+func TestConditions(t *testing.T) {
+	t.Setenv("DUCT_TEST_CI", "true")
+	t.Setenv("DUCT_TEST_LAPTOP", "")
+
+	m := Manifest{
+		{Name: "app"},
+		{Name: "oracle", Only: []string{"DUCT_TEST_CI"}},
+		{Name: "mock", Except: []string{"DUCT_TEST_CI=true"}},
+		{Name: "local", Only: []string{"DUCT_TEST_LAPTOP", "DUCT_TEST_CI=false"}},
+		{Name: "never", Condition: func() bool { return false }},
+		{Name: "always", Only: []string{"DUCT_TEST_CI=true"}, Condition: func() bool { return true }},
+	}
+
+	names := []string{}
+	for _, cont := range New(m).manifest {
+		names = append(names, cont.Name)
+	}
+
+	if !reflect.DeepEqual(names, []string{"app", "oracle", "always"}) {
+		t.Fatalf("unexpected containers: %v", names)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := Manifest{
+		{Name: "db", Image: "postgres", PortForwards: map[int]int{5432: 5432}, IPv4: "10.0.0.2"},
+		{Name: "web", Image: "nginx", DependsOn: []string{"db"}, Replicas: 2, PortForwards: map[int]int{8000: 80}},
+		{Name: "client", Image: "debian", DependsOn: []string{"web"}, BindMounts: map[string]string{"manifest.go": "/manifest.go"}},
+		{Name: "seed", Image: "postgres", PostRun: []PostCommand{{Command: []string{"psql"}, StdinFile: "manifest.go"}}},
+	}
+
+	if err := valid.Validate(WithNewNetworkAndSubnet("duct-test-network", "10.0.0.0/24")); err != nil {
+		t.Fatal(err)
+	}
+
+	table := map[string]Manifest{
+		"is in the manifest more than once":  {{Name: "db", Image: "postgres"}, {Name: "db", Image: "postgres"}},
+		"[db] has no image":                  {{Name: "db"}},
+		"which is not earlier":               {{Name: "web", Image: "nginx", DependsOn: []string{"db"}}, {Name: "db", Image: "postgres"}},
+		"is not in the subnet":               {{Name: "db", Image: "postgres", IPv4: "10.0.1.2"}},
+		"invalid IPv4 address":               {{Name: "db", Image: "postgres", IPv4: "10.0.0"}},
+		"invalid IPv6 address":               {{Name: "db", Image: "postgres", IPv6: "10.0.0.2"}},
+		"does not exist":                     {{Name: "db", Image: "postgres", BindMounts: map[string]string{"missing": "/missing"}}},
+		"shares namespaces with [db]":        {{Name: "debug", Image: "debian", PidMode: "container:db"}, {Name: "db", Image: "postgres"}},
+		"write rate limit of 0 for /dev/sda": {{Name: "db", Image: "postgres", DeviceWriteBps: map[string]int64{"/dev/sda": 0}}},
+		"OOM score adjustment of 2000":       {{Name: "db", Image: "postgres", OomScoreAdj: 2000}},
+		"invalid MAC address":                {{Name: "db", Image: "postgres", MacAddress: "02:42:ac"}},
+		"replicas cannot share":              {{Name: "web", Image: "nginx", Replicas: 2, MacAddress: "02:42:ac:11:00:02"}},
+		"[web] has an IPv4 address":          {{Name: "web", Image: "nginx", Replicas: 2, IPv4: "10.0.0.2"}},
+		"host port 8001/tcp":                 {{Name: "web", Image: "nginx", Replicas: 2, PortForwards: map[int]int{8000: 80}}, {Name: "other", Image: "nginx", PortForwards: map[int]int{8001: 80}}},
+		"post-command without a command":     {{Name: "db", Image: "postgres", PostRun: []PostCommand{{StdoutFile: "dump.sql"}}}},
+		"has both Stdin and StdinFile":       {{Name: "db", Image: "postgres", PostRun: []PostCommand{{Command: []string{"psql"}, Stdin: []byte("select 1;"), StdinFile: "manifest.go"}}}},
+		"stdin file":                         {{Name: "db", Image: "postgres", PostRun: []PostCommand{{Command: []string{"psql"}, StdinFile: "missing.sql"}}}},
+		"has both Command and Shell":         {{Name: "db", Image: "postgres", PostRun: []PostCommand{{Command: []string{"psql"}, Shell: "psql"}}}},
+	}
+
+	for expected, m := range table {
+		err := m.Validate(WithNewNetworkAndSubnet("duct-test-network", "10.0.0.0/24"))
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Fatalf("expected an error containing %q, got %v", expected, err)
+		}
+	}
+
+	replicated := Manifest{{Name: "web", Image: "nginx", Replicas: 2, MacAddress: "02:42:ac:11:00:02", IPv6: "fd00::2"}}.expand()
+	if err := replicated.Validate(); err == nil || strings.Count(err.Error(), "replicas cannot share") != 2 {
+		t.Fatalf("expected each shared address of the replicas once, got %v", err)
+	}
+
+	if err := (Manifest{{Name: "db", Image: "postgres", IPv4: "10.0.0.2"}}).Validate(WithNewNetwork("duct-test-network")); err == nil {
+		t.Fatal("static address without a subnet was valid")
+	}
+
+	limited := Manifest{{
+		Name:            "db",
+		Image:           "postgres",
+		DeviceReadBps:   map[string]int64{"/dev/sda": 0},
+		DeviceWriteBps:  map[string]int64{"/dev/sda": 0},
+		DeviceReadIOps:  map[string]int64{"/dev/sda": 0},
+		DeviceWriteIOps: map[string]int64{"/dev/sda": 0},
+	}}
+
+	first := limited.Validate().Error()
+	for i := 0; i < 20; i++ {
+		if err := limited.Validate(); err.Error() != first {
+			t.Fatalf("the problems were not reported in the same order:\n%s\n%s", first, err)
+		}
+	}
+
+	if read, write := strings.Index(first, "read rate"), strings.Index(first, "write operations"); read < 0 || write < read {
+		t.Fatalf("the limits were not reported in the order of the fields: %s", first)
+	}
+}
+
+func TestValidateIPAM(t *testing.T) {
+	pools := WithNewNetworkIPAM("duct-test-network",
+		IPAMPool{Subnet: "10.0.0.0/24", IPRange: "10.0.0.128/25", Gateway: "10.0.0.1", AuxAddresses: map[string]string{"vpn": "10.0.0.2"}},
+		IPAMPool{Subnet: "fd00:1::/64"},
+	)
+
+	valid := Manifest{{Name: "db", Image: "postgres", IPv4: "10.0.0.3", IPv6: "fd00:1::3"}}
+	if err := valid.Validate(pools); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (Manifest{{Name: "db", Image: "postgres", IPv6: "fd00:2::3"}}).Validate(pools); err == nil || !strings.Contains(err.Error(), "is not in the subnet fd00:1::/64") {
+		t.Fatalf("unexpected error for an IPv6 address outside of the subnet: %v", err)
+	}
+
+	table := map[string]IPAMPool{
+		"IP range 10.0.1.0/25 is not in the subnet": {Subnet: "10.0.0.0/24", IPRange: "10.0.1.0/25"},
+		"invalid gateway":                          {Subnet: "10.0.0.0/24", Gateway: "10.0.0"},
+		"auxiliary address vpn 10.0.1.2 is not in": {Subnet: "10.0.0.0/24", AuxAddresses: map[string]string{"vpn": "10.0.1.2"}},
+	}
+
+	for expected, pool := range table {
+		err := (Manifest{{Name: "db", Image: "postgres"}}).Validate(WithNewNetworkIPAM("duct-test-network", pool))
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Fatalf("expected an error containing %q, got %v", expected, err)
+		}
+	}
+}
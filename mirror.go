@@ -0,0 +1,71 @@
+package duct
+
+import (
+	"strings"
+)
+
+// WithRegistryMirror rewrites the images of the containers before they are
+// pulled, so that they are pulled from a mirror or pull-through cache. The
+// keys of prefixes are registries or repository prefixes, optionally ending
+// in "/*", and the values are what they are replaced with, e.g.
+// {"docker.io/*": "mirror.corp/*"}. Images are matched in their fully
+// qualified form, so "postgres" is matched as "docker.io/library/postgres",
+// and the longest matching prefix wins. Built and local images are not
+// rewritten.
+func WithRegistryMirror(prefixes map[string]string) Options {
+	return Options{optionRegistryMirror: prefixes}
+}
+
+// mirror returns the image rewritten by WithRegistryMirror, or the image if
+// no prefix matches.
+func (c *Composer) mirror(image string) string {
+	prefixes, _ := c.options[optionRegistryMirror].(map[string]string)
+	return mirrorImage(prefixes, image)
+}
+
+func mirrorImage(prefixes map[string]string, image string) string {
+	if len(prefixes) == 0 {
+		return image
+	}
+
+	qualified := qualifyImage(image)
+
+	var from, to string
+	for prefix, replacement := range prefixes {
+		p := trimWildcard(prefix)
+		if p == "" || len(p) <= len(from) || !strings.HasPrefix(qualified, p) {
+			continue
+		}
+
+		// prefixes match whole components of the image
+		if rest := qualified[len(p):]; rest == "" || strings.ContainsRune("/:@", rune(rest[0])) {
+			from, to = p, trimWildcard(replacement)
+		}
+	}
+
+	if from == "" {
+		return image
+	}
+
+	return to + strings.TrimPrefix(qualified, from)
+}
+
+func trimWildcard(prefix string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(prefix, "*"), "/")
+}
+
+// qualifyImage returns the image with the registry and namespace docker
+// assumes when they are left out.
+func qualifyImage(image string) string {
+	i := strings.IndexByte(image, '/')
+	if i >= 0 {
+		domain := image[:i]
+		if strings.ContainsAny(domain, ".:") || domain == "localhost" {
+			return image
+		}
+
+		return "docker.io/" + image
+	}
+
+	return "docker.io/library/" + image
+}
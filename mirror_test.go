@@ -0,0 +1,33 @@
+package duct
+
+import (
+	"testing"
+)
+
+func TestMirrorImage(t *testing.T) {
+	prefixes := map[string]string{
+		"docker.io/*":            "mirror.corp/*",
+		"docker.io/library/nats": "mirror.corp/pinned/nats",
+		"ghcr.io":                "ghcr-cache.corp",
+	}
+
+	for image, expected := range map[string]string{
+		"postgres":                  "mirror.corp/library/postgres",
+		"postgres:15":               "mirror.corp/library/postgres:15",
+		"bitnami/redis:7":           "mirror.corp/bitnami/redis:7",
+		"docker.io/library/alpine":  "mirror.corp/library/alpine",
+		"nats:2":                    "mirror.corp/pinned/nats:2",
+		"natsio/nats-box":           "mirror.corp/natsio/nats-box",
+		"ghcr.io/org/app@sha256:ab": "ghcr-cache.corp/org/app@sha256:ab",
+		"quay.io/coreos/etcd":       "quay.io/coreos/etcd",
+		"localhost:5000/app":        "localhost:5000/app",
+	} {
+		if res := mirrorImage(prefixes, image); res != expected {
+			t.Errorf("%s: expected %s, got %s", image, expected, res)
+		}
+	}
+
+	if res := mirrorImage(nil, "postgres"); res != "postgres" {
+		t.Fatalf("image was rewritten without mirrors: %s", res)
+	}
+}
@@ -0,0 +1,164 @@
+package modules
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/erikh/duct"
+)
+
+// Browser names the browser of a Selenium container.
+type Browser string
+
+// Browsers that Selenium containers run.
+const (
+	Chrome  Browser = "chrome"
+	Firefox Browser = "firefox"
+)
+
+const (
+	seleniumPort = 4444
+	// seleniumVNCPort serves noVNC, to watch the browser, with the password
+	// "secret".
+	seleniumVNCPort = 7900
+
+	// browserShmSize is what the Selenium images document as enough for
+	// the browsers, which crash with docker's default.
+	browserShmSize = 2 << 30
+)
+
+// SeleniumOptions configures a Selenium container.
+type SeleniumOptions struct {
+	// Browser is the browser to run; by default, Chrome.
+	Browser Browser
+	// Image is the image to run; by default, the Selenium standalone image of
+	// the Browser.
+	Image string
+	// Sessions is the number of concurrent sessions; by default, 1.
+	Sessions int
+	// VNC forwards the noVNC port, to watch the browser; see
+	// SeleniumVNCURL.
+	VNC bool
+}
+
+// Selenium returns a container named name which runs a standalone Selenium
+// grid with one browser, with the shared memory and tmpfs the browser needs.
+// It is ready once the grid accepts sessions. Use WebDriverURL to create
+// sessions from the test; the browser reaches the other containers by name,
+// e.g. "http://web:8080".
+func Selenium(name string, opts SeleniumOptions) *duct.Container {
+	browser := opts.Browser
+	if browser == "" {
+		browser = Chrome
+	}
+
+	sessions := opts.Sessions
+	if sessions < 1 {
+		sessions = 1
+	}
+
+	cont := &duct.Container{
+		Name:  name,
+		Image: orDefault(opts.Image, "selenium/standalone-"+string(browser)+":4"),
+		Env: []string{
+			"SE_NODE_MAX_SESSIONS=" + strconv.Itoa(sessions),
+			"SE_NODE_OVERRIDE_MAX_SESSIONS=true",
+		},
+		ShmSize: browserShmSize,
+		Tmpfs:   map[string]string{"/tmp": "rw,exec,size=512m"},
+		Ports:   []duct.PortForward{{ContainerPort: seleniumPort}},
+		ReadyFunc: func(ctx context.Context, info *duct.ContainerInfo) error {
+			addr, err := info.Endpoint(seleniumPort)
+			if err != nil {
+				return err
+			}
+
+			return duct.Retry(ctx, 250*time.Millisecond, 0, func() error {
+				return seleniumReady(ctx, "http://"+addr)
+			})
+		},
+	}
+
+	if opts.VNC {
+		cont.Ports = append(cont.Ports, duct.PortForward{ContainerPort: seleniumVNCPort})
+	}
+
+	return cont
+}
+
+// seleniumReady returns an error unless the grid at base accepts sessions.
+func seleniumReady(ctx context.Context, base string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"/status", nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var status struct {
+		Value struct {
+			Ready   bool   `json:"ready"`
+			Message string `json:"message"`
+		} `json:"value"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return fmt.Errorf("%s/status answered %s: %w", base, resp.Status, err)
+	}
+
+	if !status.Value.Ready {
+		return fmt.Errorf("selenium is not ready: %s", status.Value.Message)
+	}
+
+	return nil
+}
+
+// WebDriverURL returns the WebDriver endpoint of the named Selenium container
+// from the test, e.g. "http://127.0.0.1:49153", to pass to a WebDriver
+// client.
+func WebDriverURL(ctx context.Context, c *duct.Composer, name string) (string, error) {
+	l, err := inspect(ctx, c, name, seleniumPort)
+	if err != nil {
+		return "", err
+	}
+
+	return "http://" + l.addr, nil
+}
+
+// SeleniumVNCURL returns the noVNC page of the named Selenium container,
+// launched with VNC, to watch the browser while debugging a test. The
+// password is "secret".
+func SeleniumVNCURL(ctx context.Context, c *duct.Composer, name string) (string, error) {
+	l, err := inspect(ctx, c, name, seleniumVNCPort)
+	if err != nil {
+		return "", err
+	}
+
+	return "http://" + l.addr + "/?autoconnect=1&resize=scale", nil
+}
+
+// Capabilities returns the minimal W3C capabilities requesting the browser,
+// headless if headless is set, for the body of a new session request:
+// {"capabilities": {"alwaysMatch": ...}}.
+func Capabilities(browser Browser, headless bool) map[string]interface{} {
+	caps := map[string]interface{}{"browserName": string(browser)}
+
+	if headless {
+		switch browser {
+		case Firefox:
+			caps["moz:firefoxOptions"] = map[string]interface{}{"args": []string{"-headless"}}
+		default:
+			caps["goog:chromeOptions"] = map[string]interface{}{"args": []string{"--headless=new"}}
+		}
+	}
+
+	return map[string]interface{}{"capabilities": map[string]interface{}{"alwaysMatch": caps}}
+}
@@ -0,0 +1,83 @@
+package modules
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/erikh/duct"
+	"github.com/erikh/duct/ductfake"
+)
+
+func TestSeleniumReady(t *testing.T) {
+	ready := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/status" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if ready {
+			fmt.Fprint(w, `{"value": {"ready": true, "message": "Selenium Grid ready."}}`)
+		} else {
+			fmt.Fprint(w, `{"value": {"ready": false, "message": "Selenium Grid not ready."}}`)
+		}
+	}))
+	defer server.Close()
+
+	err := seleniumReady(context.Background(), server.URL)
+	if err == nil || !strings.Contains(err.Error(), "Selenium Grid not ready.") {
+		t.Fatalf("unexpected error for a grid that is not ready: %v", err)
+	}
+
+	ready = true
+	if err := seleniumReady(context.Background(), server.URL); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSelenium(t *testing.T) {
+	cont := Selenium("browser", SeleniumOptions{Browser: Firefox, Sessions: 2, VNC: true})
+	if cont.Image != "selenium/standalone-firefox:4" || cont.Env[0] != "SE_NODE_MAX_SESSIONS=2" {
+		t.Fatalf("unexpected container: %s %v", cont.Image, cont.Env)
+	}
+
+	if cont.ShmSize != browserShmSize || cont.Tmpfs["/tmp"] == "" {
+		t.Fatalf("shared memory and tmpfs are not set: %d %v", cont.ShmSize, cont.Tmpfs)
+	}
+
+	r := ductfake.Start(t)
+
+	// the fake daemon does not allocate host ports, nor run the grid
+	cont.Ports[0].HostPort = 40000
+	cont.Ports[1].HostPort = 40001
+	cont.ReadyFunc = nil
+
+	c := r.Launch(t, duct.Manifest{cont})
+
+	url, err := WebDriverURL(context.Background(), c, "browser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "http://127.0.0.1:40000" {
+		t.Fatalf("unexpected WebDriver URL: %s", url)
+	}
+
+	url, err = SeleniumVNCURL(context.Background(), c, "browser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(url, "http://127.0.0.1:40001/") {
+		t.Fatalf("unexpected VNC URL: %s", url)
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	caps := Capabilities(Chrome, true)["capabilities"].(map[string]interface{})["alwaysMatch"].(map[string]interface{})
+	if caps["browserName"] != "chrome" || caps["goog:chromeOptions"] == nil {
+		t.Fatalf("unexpected capabilities: %v", caps)
+	}
+}
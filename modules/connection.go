@@ -0,0 +1,70 @@
+package modules
+
+import (
+	"context"
+	"strings"
+
+	"github.com/erikh/duct"
+)
+
+// launched describes a launched module container: where its port is
+// forwarded to, and the environment and command it was created with, which
+// carry its credentials.
+type launched struct {
+	addr string
+	env  []string
+	cmd  []string
+}
+
+func inspect(ctx context.Context, c *duct.Composer, name string, port int) (*launched, error) {
+	info, err := c.Info(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	addr, err := info.Endpoint(port)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &launched{addr: addr}
+	if info.Inspect.Config != nil {
+		l.env = info.Inspect.Config.Env
+		l.cmd = info.Inspect.Config.Cmd
+	}
+
+	return l, nil
+}
+
+// getenv returns the value of the variable in the container's environment,
+// or def if it is not set.
+func (l *launched) getenv(name, def string) string {
+	for _, kv := range l.env {
+		if k, v, ok := strings.Cut(kv, "="); ok && k == name {
+			return v
+		}
+	}
+
+	return def
+}
+
+// arg returns the value following the flag in the container's command, or
+// "" if it is not there.
+func (l *launched) arg(flag string) string {
+	for i, arg := range l.cmd {
+		if arg == flag && i+1 < len(l.cmd) {
+			return l.cmd[i+1]
+		}
+	}
+
+	return ""
+}
+
+// orDefault returns s, or def if s is empty.
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+
+	return s
+}
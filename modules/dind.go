@@ -0,0 +1,78 @@
+// Package modules provides containers for duct manifests which are preset to
+// run common services, with helpers to use them from the test.
+package modules
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/erikh/duct"
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+// DinDImage is the image DinD runs.
+const DinDImage = "docker:dind"
+
+// dindPort is the port the daemon listens on without TLS.
+const dindPort = 2375
+
+// DinD returns a container named name which runs a docker daemon, for
+// testing tools which drive docker themselves without giving them the
+// daemon of the host. The container is privileged, as docker in docker
+// requires; it is ready once the daemon answers. Use DinDClient to talk to
+// it from the test, and ContainerIP on port 2375 from other containers.
+//
+// The daemon listens without TLS, and its images are in an anonymous volume;
+// use duct.WithRemoveVolumes to remove them at Teardown.
+func DinD(name string) *duct.Container {
+	return &duct.Container{
+		Name:       name,
+		Image:      DinDImage,
+		Privileged: true,
+		// an empty certificate directory disables TLS
+		Env:   []string{"DOCKER_TLS_CERTDIR="},
+		Ports: []duct.PortForward{{ContainerPort: dindPort}},
+		ReadyFunc: func(ctx context.Context, info *duct.ContainerInfo) error {
+			addr, err := info.Endpoint(dindPort)
+			if err != nil {
+				return err
+			}
+
+			return duct.Retry(ctx, 100*time.Millisecond, 0, func() error {
+				_, err := dialDaemon(ctx, addr)
+				return err
+			})
+		},
+	}
+}
+
+// DinDClient returns a client of the daemon of the named DinD container.
+func DinDClient(ctx context.Context, c *duct.Composer, name string) (*dc.Client, error) {
+	addr, err := c.Endpoint(name, dindPort)
+	if err != nil {
+		return nil, err
+	}
+
+	return dialDaemon(ctx, addr)
+}
+
+// dialDaemon returns a client of the daemon at the host:port address, once
+// it answers.
+func dialDaemon(ctx context.Context, addr string) (*dc.Client, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, err
+	}
+
+	client, err := dc.NewClient("tcp://" + addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := client.PingWithContext(ctx); err != nil {
+		return nil, fmt.Errorf("docker daemon at %s is not answering: %w", addr, err)
+	}
+
+	return client, nil
+}
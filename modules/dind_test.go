@@ -0,0 +1,36 @@
+package modules
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/erikh/duct/ductfake"
+)
+
+func TestDinD(t *testing.T) {
+	cont := DinD("dind")
+	if cont.Name != "dind" || !cont.Privileged || cont.ReadyFunc == nil {
+		t.Fatalf("unexpected preset: %+v", cont)
+	}
+
+	r, err := ductfake.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(r.Client().Endpoint())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := dialDaemon(context.Background(), u.Host); err != nil {
+		t.Fatal(err)
+	}
+
+	r.Stop()
+
+	if _, err := dialDaemon(context.Background(), u.Host); err == nil {
+		t.Fatal("stopped daemon was answering")
+	}
+}
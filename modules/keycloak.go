@@ -0,0 +1,245 @@
+package modules
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/erikh/duct"
+)
+
+// KeycloakImage is the image Keycloak runs by default.
+const KeycloakImage = "quay.io/keycloak/keycloak:24.0"
+
+const keycloakPort = 8080
+
+// KeycloakOptions configures Keycloak: a realm with clients and users is
+// imported at startup.
+type KeycloakOptions struct {
+	Image string
+	// Realm is the name of the realm; by default, "test".
+	Realm   string
+	Clients []KeycloakClient
+	Users   []KeycloakUser
+	// AdminUser and AdminPassword are those of the master realm's
+	// administrator; by default, "admin" for both.
+	AdminUser     string
+	AdminPassword string
+}
+
+// KeycloakClient is a client of the realm, which may use the password and
+// authorization code grants, and the client credentials grant if it has a
+// Secret. Without a Secret, it is a public client.
+type KeycloakClient struct {
+	ID           string
+	Secret       string
+	RedirectURIs []string
+}
+
+// KeycloakUser is a user of the realm, with a verified email and the realm
+// roles. Email defaults to Username at example.com.
+type KeycloakUser struct {
+	Username string
+	Password string
+	Email    string
+	Roles    []string
+}
+
+// Keycloak returns a container named name which runs Keycloak in development
+// mode, with the realm of the options. It is ready once the realm is served.
+// Use KeycloakIssuer and KeycloakToken from the test.
+//
+// Tokens carry the issuer they were requested from, so those requested from
+// the test do not match those requested from other containers by name.
+func Keycloak(name string, opts KeycloakOptions) *duct.Container {
+	realm := orDefault(opts.Realm, "test")
+
+	return &duct.Container{
+		Name:    name,
+		Image:   orDefault(opts.Image, KeycloakImage),
+		Command: []string{"start-dev", "--import-realm"},
+		Env: []string{
+			"KEYCLOAK_ADMIN=" + orDefault(opts.AdminUser, "admin"),
+			"KEYCLOAK_ADMIN_PASSWORD=" + orDefault(opts.AdminPassword, "admin"),
+		},
+		Files: map[string]duct.FileContent{
+			"/opt/keycloak/data/import/" + realm + ".json": {Content: keycloakRealm(realm, opts)},
+		},
+		Ports: []duct.PortForward{{ContainerPort: keycloakPort}},
+		ReadyFunc: func(ctx context.Context, info *duct.ContainerInfo) error {
+			addr, err := info.Endpoint(keycloakPort)
+			if err != nil {
+				return err
+			}
+
+			return duct.Retry(ctx, 250*time.Millisecond, 0, func() error {
+				return httpOK(ctx, "http://"+addr+"/realms/"+realm+"/.well-known/openid-configuration")
+			})
+		},
+	}
+}
+
+// keycloakRealm returns the realm to import, in JSON.
+func keycloakRealm(realm string, opts KeycloakOptions) []byte {
+	type credential struct {
+		Type      string `json:"type"`
+		Value     string `json:"value"`
+		Temporary bool   `json:"temporary"`
+	}
+
+	clients := []map[string]interface{}{}
+	for _, client := range opts.Clients {
+		clients = append(clients, map[string]interface{}{
+			"clientId":                  client.ID,
+			"secret":                    client.Secret,
+			"publicClient":              client.Secret == "",
+			"serviceAccountsEnabled":    client.Secret != "",
+			"directAccessGrantsEnabled": true,
+			"standardFlowEnabled":       true,
+			"redirectUris":              append([]string{}, client.RedirectURIs...),
+		})
+	}
+
+	roles := map[string]bool{}
+	users := []map[string]interface{}{}
+	for _, user := range opts.Users {
+		for _, role := range user.Roles {
+			roles[role] = true
+		}
+
+		users = append(users, map[string]interface{}{
+			"username":      user.Username,
+			"email":         orDefault(user.Email, user.Username+"@example.com"),
+			"emailVerified": true,
+			"enabled":       true,
+			// required by the default user profile
+			"firstName":   user.Username,
+			"lastName":    "Test",
+			"credentials": []credential{{Type: "password", Value: user.Password}},
+			"realmRoles":  append([]string{}, user.Roles...),
+		})
+	}
+
+	realmRoles := []map[string]string{}
+	for _, role := range sortedRoles(roles) {
+		realmRoles = append(realmRoles, map[string]string{"name": role})
+	}
+
+	content, _ := json.Marshal(map[string]interface{}{
+		"realm":   realm,
+		"enabled": true,
+		"clients": clients,
+		"users":   users,
+		"roles":   map[string]interface{}{"realm": realmRoles},
+	})
+
+	return content
+}
+
+func sortedRoles(roles map[string]bool) []string {
+	res := []string{}
+	for role := range roles {
+		res = append(res, role)
+	}
+	sort.Strings(res)
+
+	return res
+}
+
+// KeycloakIssuer returns the issuer URL of the realm of the named Keycloak
+// container from the test, e.g. "http://127.0.0.1:49153/realms/test", for
+// OIDC discovery.
+func KeycloakIssuer(c *duct.Composer, name, realm string) (string, error) {
+	base, err := c.BaseURL(name, keycloakPort)
+	if err != nil {
+		return "", err
+	}
+
+	return base + "/realms/" + url.PathEscape(orDefault(realm, "test")), nil
+}
+
+// TokenRequest is a request for tokens with the password grant, or, without
+// a Username, with the client credentials grant.
+type TokenRequest struct {
+	// Realm is the realm; by default, "test".
+	Realm        string
+	ClientID     string
+	ClientSecret string
+	Username     string
+	Password     string
+	// Scopes are requested in addition to "openid".
+	Scopes []string
+}
+
+// Token is the response of a token request.
+type Token struct {
+	AccessToken  string `json:"access_token"`
+	IDToken      string `json:"id_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// KeycloakToken requests tokens from the named Keycloak container.
+func KeycloakToken(ctx context.Context, c *duct.Composer, name string, req TokenRequest) (*Token, error) {
+	issuer, err := KeycloakIssuer(c, name, req.Realm)
+	if err != nil {
+		return nil, err
+	}
+
+	return requestToken(ctx, issuer+"/protocol/openid-connect/token", req)
+}
+
+// requestToken requests tokens from the OAuth 2 token endpoint.
+func requestToken(ctx context.Context, endpoint string, req TokenRequest) (*Token, error) {
+	form := url.Values{
+		"client_id": {req.ClientID},
+		"scope":     {strings.Join(append([]string{"openid"}, req.Scopes...), " ")},
+	}
+
+	if req.ClientSecret != "" {
+		form.Set("client_secret", req.ClientSecret)
+	}
+
+	if req.Username != "" {
+		form.Set("grant_type", "password")
+		form.Set("username", req.Username)
+		form.Set("password", req.Password)
+	} else {
+		form.Set("grant_type", "client_credentials")
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var oauthErr struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}
+		json.NewDecoder(resp.Body).Decode(&oauthErr)
+
+		return nil, fmt.Errorf("token request failed with %s: %s %s", resp.Status, oauthErr.Error, oauthErr.Description)
+	}
+
+	token := &Token{}
+	if err := json.NewDecoder(resp.Body).Decode(token); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
@@ -0,0 +1,93 @@
+package modules
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestKeycloakRealm(t *testing.T) {
+	cont := Keycloak("auth", KeycloakOptions{
+		Clients: []KeycloakClient{{ID: "api", Secret: "s3cret"}, {ID: "spa", RedirectURIs: []string{"http://localhost/*"}}},
+		Users:   []KeycloakUser{{Username: "alice", Password: "pw", Roles: []string{"admin", "user"}}, {Username: "bob", Password: "pw", Roles: []string{"user"}}},
+	})
+
+	content, ok := cont.Files["/opt/keycloak/data/import/test.json"]
+	if !ok {
+		t.Fatalf("realm is not imported: %v", cont.Files)
+	}
+
+	var realm struct {
+		Realm   string
+		Clients []struct {
+			ClientID     string
+			PublicClient bool
+		}
+		Users []struct {
+			Username    string
+			Email       string
+			Credentials []struct{ Value string }
+		}
+		Roles struct{ Realm []struct{ Name string } }
+	}
+
+	if err := json.Unmarshal(content.Content, &realm); err != nil {
+		t.Fatal(err)
+	}
+
+	if realm.Realm != "test" || len(realm.Clients) != 2 || realm.Clients[0].PublicClient || !realm.Clients[1].PublicClient {
+		t.Fatalf("unexpected realm: %+v", realm)
+	}
+
+	if realm.Users[0].Email != "alice@example.com" || realm.Users[0].Credentials[0].Value != "pw" {
+		t.Fatalf("unexpected users: %+v", realm.Users)
+	}
+
+	if len(realm.Roles.Realm) != 2 || realm.Roles.Realm[0].Name != "admin" || realm.Roles.Realm[1].Name != "user" {
+		t.Fatalf("unexpected roles: %+v", realm.Roles)
+	}
+}
+
+func TestRequestToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+
+		switch {
+		case r.PostForm.Get("grant_type") == "password" && r.PostForm.Get("username") == "alice" && r.PostForm.Get("password") == "pw":
+			fmt.Fprint(w, `{"access_token": "user-token", "token_type": "Bearer", "expires_in": 300}`)
+		case r.PostForm.Get("grant_type") == "client_credentials" && r.PostForm.Get("client_secret") == "s3cret":
+			fmt.Fprint(w, `{"access_token": "client-token", "token_type": "Bearer", "expires_in": 300}`)
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error": "invalid_grant", "error_description": "Invalid user credentials"}`)
+		}
+	}))
+	defer server.Close()
+
+	token, err := requestToken(context.Background(), server.URL, TokenRequest{ClientID: "spa", Username: "alice", Password: "pw"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "user-token" || token.ExpiresIn != 300 {
+		t.Fatalf("unexpected token: %+v", token)
+	}
+
+	token, err = requestToken(context.Background(), server.URL, TokenRequest{ClientID: "api", ClientSecret: "s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "client-token" {
+		t.Fatalf("unexpected token: %+v", token)
+	}
+
+	_, err = requestToken(context.Background(), server.URL, TokenRequest{ClientID: "spa", Username: "alice", Password: "wrong"})
+	if err == nil || !strings.Contains(err.Error(), "invalid_grant Invalid user credentials") {
+		t.Fatalf("unexpected error for wrong credentials: %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package modules
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/erikh/duct"
+)
+
+// LocalStackImage is the image LocalStack runs by default.
+const LocalStackImage = "localstack/localstack:3"
+
+const localStackPort = 4566
+
+// LocalStackOptions configures LocalStack.
+type LocalStackOptions struct {
+	Image string
+	// Services are the AWS services to emulate, e.g. "s3" and "sqs"; by
+	// default, all that LocalStack supports, started on first use.
+	Services []string
+	// Region is the region of the configuration returned by
+	// LocalStackConfig; by default, "us-east-1".
+	Region string
+}
+
+// LocalStack returns a container named name which runs LocalStack, an
+// emulator of AWS services. It is ready once its health endpoint reports the
+// Services as available. Use LocalStackConfig to reach it from the test.
+func LocalStack(name string, opts LocalStackOptions) *duct.Container {
+	env := []string{"AWS_DEFAULT_REGION=" + orDefault(opts.Region, "us-east-1")}
+	if len(opts.Services) != 0 {
+		env = append(env, "SERVICES="+strings.Join(opts.Services, ","))
+	}
+
+	return &duct.Container{
+		Name:  name,
+		Image: orDefault(opts.Image, LocalStackImage),
+		Env:   env,
+		Ports: []duct.PortForward{{ContainerPort: localStackPort}},
+		ReadyFunc: func(ctx context.Context, info *duct.ContainerInfo) error {
+			addr, err := info.Endpoint(localStackPort)
+			if err != nil {
+				return err
+			}
+
+			return duct.Retry(ctx, 100*time.Millisecond, 0, func() error {
+				return localStackHealthy(ctx, "http://"+addr, opts.Services)
+			})
+		},
+	}
+}
+
+// localStackHealthy returns an error unless the health endpoint of the
+// LocalStack at the base URL reports the services as available or running.
+func localStackHealthy(ctx context.Context, base string, services []string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"/_localstack/health", nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("localstack health endpoint answered %s", resp.Status)
+	}
+
+	var health struct {
+		Services map[string]string
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		return err
+	}
+
+	notReady := []string{}
+	for _, service := range services {
+		switch health.Services[service] {
+		case "available", "running":
+		default:
+			notReady = append(notReady, fmt.Sprintf("%s (%q)", service, health.Services[service]))
+		}
+	}
+
+	if len(notReady) != 0 {
+		sort.Strings(notReady)
+		return fmt.Errorf("localstack services are not ready: %s", strings.Join(notReady, ", "))
+	}
+
+	return nil
+}
+
+// LocalStackConfig returns how to reach the named LocalStack container from
+// the test. LocalStack accepts any credentials; these are "test".
+func LocalStackConfig(ctx context.Context, c *duct.Composer, name string) (AWSConfig, error) {
+	l, err := inspect(ctx, c, name, localStackPort)
+	if err != nil {
+		return AWSConfig{}, err
+	}
+
+	return AWSConfig{
+		Endpoint:        "http://" + l.addr,
+		Region:          l.getenv("AWS_DEFAULT_REGION", "us-east-1"),
+		AccessKeyID:     "test",
+		SecretAccessKey: "test",
+	}, nil
+}
@@ -0,0 +1,54 @@
+package modules
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/erikh/duct"
+	"github.com/erikh/duct/ductfake"
+)
+
+func TestLocalStackHealthy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"services": {"s3": "running", "sqs": "available", "sns": "initializing"}, "edition": "community"}`)
+	}))
+	defer server.Close()
+
+	if err := localStackHealthy(context.Background(), server.URL, []string{"s3", "sqs"}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := localStackHealthy(context.Background(), server.URL, []string{"s3", "sns", "dynamodb"})
+	if err == nil || !strings.Contains(err.Error(), `dynamodb (""), sns ("initializing")`) {
+		t.Fatalf("unexpected error for services that are not ready: %v", err)
+	}
+}
+
+func TestLocalStackConfig(t *testing.T) {
+	r := ductfake.Start(t)
+
+	cont := LocalStack("aws", LocalStackOptions{Services: []string{"s3", "sqs"}, Region: "eu-west-1"})
+	if cont.Env[1] != "SERVICES=s3,sqs" {
+		t.Fatalf("unexpected environment: %v", cont.Env)
+	}
+
+	// the fake daemon does not allocate host ports, nor run the health
+	// endpoint
+	cont.Ports[0].HostPort = 40000
+	cont.ReadyFunc = nil
+
+	c := r.Launch(t, duct.Manifest{cont})
+
+	config, err := LocalStackConfig(context.Background(), c, "aws")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config != (AWSConfig{Endpoint: "http://127.0.0.1:40000", Region: "eu-west-1", AccessKeyID: "test", SecretAccessKey: "test"}) {
+		t.Fatalf("unexpected config: %+v", config)
+	}
+}
@@ -0,0 +1,179 @@
+package modules
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/erikh/duct"
+)
+
+// MailpitImage is the image Mailpit runs.
+const MailpitImage = "axllent/mailpit:latest"
+
+const (
+	mailpitSMTPPort = 1025
+	mailpitHTTPPort = 8025
+)
+
+// Mailpit returns a container named name which runs Mailpit, a mailbox that
+// accepts all mail sent to it over SMTP on port 1025, without
+// authentication. It is ready once it greets SMTP clients. Use MailpitClient
+// to read the mail from the test.
+func Mailpit(name string) *duct.Container {
+	return &duct.Container{
+		Name:    name,
+		Image:   MailpitImage,
+		Ports:   []duct.PortForward{{ContainerPort: mailpitSMTPPort}, {ContainerPort: mailpitHTTPPort}},
+		WaitFor: duct.WaitForTCP(mailpitSMTPPort, nil, []byte("220 "), 0),
+	}
+}
+
+// Mailbox reads the mail received by a Mailpit container.
+type Mailbox struct {
+	// SMTPAddr is the host:port address to send mail to from the test.
+	SMTPAddr string
+
+	base   string
+	client *http.Client
+}
+
+// Message is a mail received by a Mailbox.
+type Message struct {
+	ID      string
+	From    string
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+	Created time.Time
+}
+
+// MailpitClient returns the mailbox of the named Mailpit container.
+func MailpitClient(c *duct.Composer, name string) (*Mailbox, error) {
+	smtp, err := c.Endpoint(name, mailpitSMTPPort)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := c.BaseURL(name, mailpitHTTPPort)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Mailbox{SMTPAddr: smtp, base: base, client: &http.Client{Timeout: 10 * time.Second}}, nil
+}
+
+// mailpitAddress is an address in the API of Mailpit.
+type mailpitAddress struct {
+	Name    string
+	Address string
+}
+
+// Messages returns the received messages, newest first.
+func (m *Mailbox) Messages(ctx context.Context) ([]Message, error) {
+	var list struct {
+		Messages []struct{ ID string }
+	}
+
+	if err := m.api(ctx, http.MethodGet, "/api/v1/messages", &list); err != nil {
+		return nil, err
+	}
+
+	messages := []Message{}
+	for _, summary := range list.Messages {
+		msg, err := m.Message(ctx, summary.ID)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, *msg)
+	}
+
+	return messages, nil
+}
+
+// Message returns the received message with the id.
+func (m *Mailbox) Message(ctx context.Context, id string) (*Message, error) {
+	var msg struct {
+		ID      string
+		From    mailpitAddress
+		To      []mailpitAddress
+		Subject string
+		Text    string
+		HTML    string
+		Date    time.Time
+	}
+
+	if err := m.api(ctx, http.MethodGet, "/api/v1/message/"+url.PathEscape(id), &msg); err != nil {
+		return nil, err
+	}
+
+	res := &Message{
+		ID:      msg.ID,
+		From:    msg.From.Address,
+		Subject: msg.Subject,
+		Text:    msg.Text,
+		HTML:    msg.HTML,
+		Created: msg.Date,
+	}
+
+	for _, to := range msg.To {
+		res.To = append(res.To, to.Address)
+	}
+
+	return res, nil
+}
+
+// WaitForMessages waits until at least count messages were received, and
+// returns them.
+func (m *Mailbox) WaitForMessages(ctx context.Context, count int, timeout time.Duration) ([]Message, error) {
+	var messages []Message
+
+	err := duct.Retry(ctx, 100*time.Millisecond, timeout, func() error {
+		var err error
+		if messages, err = m.Messages(ctx); err != nil {
+			return err
+		}
+
+		if len(messages) < count {
+			return fmt.Errorf("received %d of %d messages", len(messages), count)
+		}
+
+		return nil
+	})
+
+	return messages, err
+}
+
+// DeleteAll deletes all received messages.
+func (m *Mailbox) DeleteAll(ctx context.Context) error {
+	return m.api(ctx, http.MethodDelete, "/api/v1/messages", nil)
+}
+
+// api calls the API of Mailpit, decoding the response into res if it is
+// not nil.
+func (m *Mailbox) api(ctx context.Context, method, path string, res interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, m.base+path, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("mailpit: %s %s: %s", method, path, resp.Status)
+	}
+
+	if res == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(res)
+}
@@ -0,0 +1,82 @@
+package modules
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMailbox(t *testing.T) {
+	var mu sync.Mutex
+	ids := []string{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/messages", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.Method == http.MethodDelete {
+			ids = nil
+			return
+		}
+
+		list := []map[string]string{}
+		for _, id := range ids {
+			list = append(list, map[string]string{"ID": id})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"total": len(list), "messages": list})
+	})
+	mux.HandleFunc("/api/v1/message/", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ID":      r.URL.Path[len("/api/v1/message/"):],
+			"From":    map[string]string{"Name": "App", "Address": "app@example.com"},
+			"To":      []map[string]string{{"Name": "", "Address": "user@example.com"}},
+			"Subject": "Welcome",
+			"Text":    "Hello",
+			"Date":    "2024-01-02T03:04:05Z",
+		})
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	m := &Mailbox{base: server.URL, client: server.Client()}
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		mu.Lock()
+		ids = append(ids, "a1")
+		mu.Unlock()
+	}()
+
+	messages, err := m.WaitForMessages(context.Background(), 1, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Message{{
+		ID:      "a1",
+		From:    "app@example.com",
+		To:      []string{"user@example.com"},
+		Subject: "Welcome",
+		Text:    "Hello",
+		Created: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}}
+
+	if !reflect.DeepEqual(messages, expected) {
+		t.Fatalf("unexpected messages: %+v", messages)
+	}
+
+	if err := m.DeleteAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if messages, err := m.Messages(context.Background()); err != nil || len(messages) != 0 {
+		t.Fatalf("messages were not deleted: %+v, %v", messages, err)
+	}
+}
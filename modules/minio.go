@@ -0,0 +1,123 @@
+package modules
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/erikh/duct"
+)
+
+// MinIOImage is the image MinIO runs by default.
+const MinIOImage = "minio/minio:latest"
+
+const minioPort = 9000
+
+// MinIOOptions configures MinIO. The credentials default to "minioadmin"
+// for both.
+type MinIOOptions struct {
+	Image     string
+	AccessKey string
+	SecretKey string
+	// Buckets are created once the server is ready.
+	Buckets []string
+}
+
+// AWSConfig is how to reach an AWS-compatible endpoint, like MinIO's, from
+// the test.
+type AWSConfig struct {
+	// Endpoint is the URL of the service, e.g. "http://127.0.0.1:49153".
+	Endpoint        string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// Env returns the configuration as the environment variables the AWS SDKs
+// and CLI read.
+func (c AWSConfig) Env() []string {
+	return []string{
+		"AWS_ENDPOINT_URL=" + c.Endpoint,
+		"AWS_REGION=" + c.Region,
+		"AWS_DEFAULT_REGION=" + c.Region,
+		"AWS_ACCESS_KEY_ID=" + c.AccessKeyID,
+		"AWS_SECRET_ACCESS_KEY=" + c.SecretAccessKey,
+	}
+}
+
+// MinIO returns a container named name which runs MinIO, an S3-compatible
+// object store, with the buckets. It is ready once its health endpoint
+// says so. Use MinIOConfig to reach it from the test; clients must use
+// path-style addressing.
+func MinIO(name string, opts MinIOOptions) *duct.Container {
+	accessKey := orDefault(opts.AccessKey, "minioadmin")
+	secretKey := orDefault(opts.SecretKey, "minioadmin")
+
+	cont := &duct.Container{
+		Name:    name,
+		Image:   orDefault(opts.Image, MinIOImage),
+		Command: []string{"server", "/data"},
+		Env: []string{
+			"MINIO_ROOT_USER=" + accessKey,
+			"MINIO_ROOT_PASSWORD=" + secretKey,
+		},
+		Ports: []duct.PortForward{{ContainerPort: minioPort}},
+		ReadyFunc: func(ctx context.Context, info *duct.ContainerInfo) error {
+			addr, err := info.Endpoint(minioPort)
+			if err != nil {
+				return err
+			}
+
+			return duct.Retry(ctx, 100*time.Millisecond, 0, func() error {
+				return httpOK(ctx, "http://"+addr+"/minio/health/ready")
+			})
+		},
+	}
+
+	if len(opts.Buckets) != 0 {
+		// the image ships the client
+		cont.PostCommands = [][]string{{"mc", "alias", "set", "local", fmt.Sprintf("http://localhost:%d", minioPort), accessKey, secretKey}}
+		for _, bucket := range opts.Buckets {
+			cont.PostCommands = append(cont.PostCommands, []string{"mc", "mb", "--ignore-existing", "local/" + bucket})
+		}
+	}
+
+	return cont
+}
+
+// MinIOConfig returns how to reach the named MinIO container from the test.
+// Its region is "us-east-1".
+func MinIOConfig(ctx context.Context, c *duct.Composer, name string) (AWSConfig, error) {
+	l, err := inspect(ctx, c, name, minioPort)
+	if err != nil {
+		return AWSConfig{}, err
+	}
+
+	return AWSConfig{
+		Endpoint:        "http://" + l.addr,
+		Region:          "us-east-1",
+		AccessKeyID:     l.getenv("MINIO_ROOT_USER", ""),
+		SecretAccessKey: l.getenv("MINIO_ROOT_PASSWORD", ""),
+	}, nil
+}
+
+// httpOK returns an error unless a GET of the url answers 200 OK.
+func httpOK(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %s", url, resp.Status)
+	}
+
+	return nil
+}
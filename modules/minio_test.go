@@ -0,0 +1,63 @@
+package modules
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/erikh/duct"
+	"github.com/erikh/duct/ductfake"
+)
+
+func TestMinIO(t *testing.T) {
+	cont := MinIO("s3", MinIOOptions{AccessKey: "key", SecretKey: "secret", Buckets: []string{"uploads"}})
+
+	expected := [][]string{
+		{"mc", "alias", "set", "local", "http://localhost:9000", "key", "secret"},
+		{"mc", "mb", "--ignore-existing", "local/uploads"},
+	}
+	if !reflect.DeepEqual(cont.PostCommands, expected) {
+		t.Fatalf("unexpected post-commands: %v", cont.PostCommands)
+	}
+
+	r := ductfake.Start(t)
+
+	// the fake daemon does not allocate host ports, nor run the health
+	// endpoint
+	cont.Ports[0].HostPort = 40000
+	cont.ReadyFunc = nil
+
+	c := r.Launch(t, duct.Manifest{cont})
+
+	config, err := MinIOConfig(context.Background(), c, "s3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config != (AWSConfig{Endpoint: "http://127.0.0.1:40000", Region: "us-east-1", AccessKeyID: "key", SecretAccessKey: "secret"}) {
+		t.Fatalf("unexpected config: %+v", config)
+	}
+
+	if env := config.Env(); env[0] != "AWS_ENDPOINT_URL=http://127.0.0.1:40000" || len(env) != 5 {
+		t.Fatalf("unexpected environment: %v", env)
+	}
+}
+
+func TestHTTPOK(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ready" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	if err := httpOK(context.Background(), server.URL+"/ready"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := httpOK(context.Background(), server.URL+"/starting"); err == nil {
+		t.Fatal("no error for an unavailable server")
+	}
+}
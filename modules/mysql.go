@@ -0,0 +1,67 @@
+package modules
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/erikh/duct"
+)
+
+// MySQLImage is the image MySQL runs by default.
+const MySQLImage = "mysql:8"
+
+const mysqlPort = 3306
+
+// MySQLOptions configures MySQL. By default, the test connects as root with
+// the password "mysql" to a database named "test"; if User is set, it
+// connects as that user, which is made with Password.
+type MySQLOptions struct {
+	Image    string
+	User     string
+	Password string
+	Database string
+}
+
+// MySQL returns a container named name which runs MySQL. It is ready once
+// the server accepts connections on its port after its initialization. Use
+// MySQLConnectionString to connect to it from the test.
+func MySQL(name string, opts MySQLOptions) *duct.Container {
+	password := orDefault(opts.Password, "mysql")
+
+	env := []string{
+		"MYSQL_DATABASE=" + orDefault(opts.Database, "test"),
+	}
+
+	if opts.User == "" || opts.User == "root" {
+		env = append(env, "MYSQL_ROOT_PASSWORD="+password)
+	} else {
+		env = append(env, "MYSQL_RANDOM_ROOT_PASSWORD=yes", "MYSQL_USER="+opts.User, "MYSQL_PASSWORD="+password)
+	}
+
+	return &duct.Container{
+		Name:  name,
+		Image: orDefault(opts.Image, MySQLImage),
+		Env:   env,
+		Ports: []duct.PortForward{{ContainerPort: mysqlPort}},
+		// the server started for the initialization does not listen on the
+		// port
+		WaitFor: duct.WaitForLog(`ready for connections.*port: 3306`, 1, 0),
+	}
+}
+
+// MySQLConnectionString returns the DSN to connect to the named MySQL
+// container from the test with, in the format of
+// github.com/go-sql-driver/mysql, e.g. "root:mysql@tcp(127.0.0.1:49153)/test".
+func MySQLConnectionString(ctx context.Context, c *duct.Composer, name string) (string, error) {
+	l, err := inspect(ctx, c, name, mysqlPort)
+	if err != nil {
+		return "", err
+	}
+
+	user, password := "root", l.getenv("MYSQL_ROOT_PASSWORD", "")
+	if u := l.getenv("MYSQL_USER", ""); u != "" {
+		user, password = u, l.getenv("MYSQL_PASSWORD", "")
+	}
+
+	return fmt.Sprintf("%s:%s@tcp(%s)/%s", user, password, l.addr, l.getenv("MYSQL_DATABASE", "")), nil
+}
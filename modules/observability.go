@@ -0,0 +1,463 @@
+package modules
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/erikh/duct"
+	"gopkg.in/yaml.v3"
+)
+
+// Images the observability modules run by default.
+const (
+	OTelCollectorImage = "otel/opentelemetry-collector-contrib:0.96.0"
+	PrometheusImage    = "prom/prometheus:v2.51.0"
+	GrafanaImage       = "grafana/grafana:10.4.0"
+)
+
+const (
+	otlpGRPCPort          = 4317
+	otlpHTTPPort          = 4318
+	collectorMetricsPort  = 8889
+	collectorHealthPort   = 13133
+	collectorSpansDir     = "/otel"
+	collectorSpansFile    = "spans.json"
+	prometheusPort        = 9090
+	grafanaPort           = 3000
+	defaultScrapeInterval = time.Second
+)
+
+// OTelCollectorOptions configures an OpenTelemetry collector.
+type OTelCollectorOptions struct {
+	Image string
+}
+
+// OTelCollector returns a container named name which runs an OpenTelemetry
+// collector. It receives OTLP over gRPC and HTTP; see OTLPEnv. The spans it
+// receives are read with CollectorSpans, and the metrics are exposed for
+// Prometheus to scrape; see CollectorScrapeTarget.
+//
+// The spans are written to a TempMount, so reading them needs the daemon to
+// run on this host.
+func OTelCollector(name string, opts OTelCollectorOptions) *duct.Container {
+	return &duct.Container{
+		Name:    name,
+		Image:   orDefault(opts.Image, OTelCollectorImage),
+		Command: []string{"--config=/etc/otelcol/duct.yaml"},
+		Files: map[string]duct.FileContent{
+			"/etc/otelcol/duct.yaml": {Content: collectorConfig()},
+		},
+		TempMounts: []string{collectorSpansDir},
+		Ports: []duct.PortForward{
+			{ContainerPort: otlpGRPCPort},
+			{ContainerPort: otlpHTTPPort},
+			{ContainerPort: collectorHealthPort},
+		},
+		ReadyFunc: func(ctx context.Context, info *duct.ContainerInfo) error {
+			addr, err := info.Endpoint(collectorHealthPort)
+			if err != nil {
+				return err
+			}
+
+			return duct.Retry(ctx, 100*time.Millisecond, 0, func() error {
+				return httpOK(ctx, "http://"+addr+"/")
+			})
+		},
+	}
+}
+
+// collectorConfig returns the configuration of the collector, in YAML.
+func collectorConfig() []byte {
+	type m = map[string]interface{}
+
+	content, _ := yaml.Marshal(m{
+		"receivers": m{
+			"otlp": m{
+				"protocols": m{
+					"grpc": m{"endpoint": fmt.Sprintf("0.0.0.0:%d", otlpGRPCPort)},
+					"http": m{"endpoint": fmt.Sprintf("0.0.0.0:%d", otlpHTTPPort)},
+				},
+			},
+		},
+		"exporters": m{
+			"prometheus": m{"endpoint": fmt.Sprintf("0.0.0.0:%d", collectorMetricsPort)},
+			"file":       m{"path": collectorSpansDir + "/" + collectorSpansFile},
+		},
+		"extensions": m{
+			"health_check": m{"endpoint": fmt.Sprintf("0.0.0.0:%d", collectorHealthPort)},
+		},
+		"service": m{
+			"extensions": []string{"health_check"},
+			"pipelines": m{
+				"traces":  m{"receivers": []string{"otlp"}, "exporters": []string{"file"}},
+				"metrics": m{"receivers": []string{"otlp"}, "exporters": []string{"prometheus"}},
+			},
+		},
+	})
+
+	return content
+}
+
+// OTLPEnv returns the environment which points the OpenTelemetry SDK of
+// another container at the named collector, over HTTP, with the service
+// name.
+func OTLPEnv(collector, service string) []string {
+	return []string{
+		fmt.Sprintf("OTEL_EXPORTER_OTLP_ENDPOINT=http://%s:%d", collector, otlpHTTPPort),
+		"OTEL_EXPORTER_OTLP_PROTOCOL=http/protobuf",
+		"OTEL_SERVICE_NAME=" + service,
+	}
+}
+
+// Span is a span received by a collector.
+type Span struct {
+	Service    string
+	Name       string
+	TraceID    string
+	SpanID     string
+	ParentID   string
+	Attributes map[string]string
+}
+
+// CollectorSpans returns the spans the named collector has received so far,
+// in the order it received them.
+func CollectorSpans(c *duct.Composer, name string) ([]Span, error) {
+	dir, err := c.MountPath(name, collectorSpansDir)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(filepath.Join(dir, collectorSpansFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return readSpans(f)
+}
+
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		String *string          `json:"stringValue"`
+		Int    *json.RawMessage `json:"intValue"`
+		Bool   *bool            `json:"boolValue"`
+		Double *float64         `json:"doubleValue"`
+	} `json:"value"`
+}
+
+// readSpans reads the spans of the OTLP JSON lines the file exporter writes.
+func readSpans(r io.Reader) ([]Span, error) {
+	var traces struct {
+		ResourceSpans []struct {
+			Resource struct {
+				Attributes []otlpAttribute `json:"attributes"`
+			} `json:"resource"`
+			ScopeSpans []struct {
+				Spans []struct {
+					TraceID    string          `json:"traceId"`
+					SpanID     string          `json:"spanId"`
+					ParentID   string          `json:"parentSpanId"`
+					Name       string          `json:"name"`
+					Attributes []otlpAttribute `json:"attributes"`
+				} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+
+	spans := []Span{}
+
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 16<<20)
+	for s.Scan() {
+		if len(s.Bytes()) == 0 {
+			continue
+		}
+
+		traces.ResourceSpans = nil
+		if err := json.Unmarshal(s.Bytes(), &traces); err != nil {
+			return nil, fmt.Errorf("could not read spans: %w", err)
+		}
+
+		for _, resource := range traces.ResourceSpans {
+			service := attributes(resource.Resource.Attributes)["service.name"]
+
+			for _, scope := range resource.ScopeSpans {
+				for _, span := range scope.Spans {
+					spans = append(spans, Span{
+						Service:    service,
+						Name:       span.Name,
+						TraceID:    span.TraceID,
+						SpanID:     span.SpanID,
+						ParentID:   span.ParentID,
+						Attributes: attributes(span.Attributes),
+					})
+				}
+			}
+		}
+	}
+
+	return spans, s.Err()
+}
+
+// attributes returns the OTLP attributes of scalar values as strings.
+func attributes(attrs []otlpAttribute) map[string]string {
+	res := map[string]string{}
+
+	for _, attr := range attrs {
+		switch v := attr.Value; {
+		case v.String != nil:
+			res[attr.Key] = *v.String
+		case v.Int != nil:
+			// int64 values are strings in OTLP JSON
+			var i interface{}
+			json.Unmarshal(*v.Int, &i)
+			res[attr.Key] = fmt.Sprint(i)
+		case v.Bool != nil:
+			res[attr.Key] = strconv.FormatBool(*v.Bool)
+		case v.Double != nil:
+			res[attr.Key] = strconv.FormatFloat(*v.Double, 'g', -1, 64)
+		}
+	}
+
+	return res
+}
+
+// ScrapeTarget is a port of another container of the manifest for
+// Prometheus to scrape.
+type ScrapeTarget struct {
+	Container string
+	Port      int
+	// Path is the path of the metrics; by default, "/metrics".
+	Path string
+	// Job is the job label of the metrics; by default, the Container.
+	Job string
+}
+
+// CollectorScrapeTarget returns the target which scrapes the metrics the
+// named collector has received.
+func CollectorScrapeTarget(collector string) ScrapeTarget {
+	return ScrapeTarget{Container: collector, Port: collectorMetricsPort}
+}
+
+// PrometheusOptions configures Prometheus.
+type PrometheusOptions struct {
+	Image   string
+	Targets []ScrapeTarget
+	// Interval is how often the targets are scraped; by default, every
+	// second.
+	Interval time.Duration
+}
+
+// Prometheus returns a container named name which runs Prometheus, scraping
+// the targets by their container names. Use PrometheusQuery to query it from
+// the test.
+func Prometheus(name string, opts PrometheusOptions) *duct.Container {
+	return &duct.Container{
+		Name:  name,
+		Image: orDefault(opts.Image, PrometheusImage),
+		Files: map[string]duct.FileContent{
+			"/etc/prometheus/prometheus.yml": {Content: prometheusConfig(opts)},
+		},
+		Ports: []duct.PortForward{{ContainerPort: prometheusPort}},
+		ReadyFunc: func(ctx context.Context, info *duct.ContainerInfo) error {
+			addr, err := info.Endpoint(prometheusPort)
+			if err != nil {
+				return err
+			}
+
+			return duct.Retry(ctx, 100*time.Millisecond, 0, func() error {
+				return httpOK(ctx, "http://"+addr+"/-/ready")
+			})
+		},
+	}
+}
+
+// prometheusConfig returns the configuration of Prometheus, in YAML, with a
+// scrape job for each job of the targets.
+func prometheusConfig(opts PrometheusOptions) []byte {
+	type m = map[string]interface{}
+
+	interval := opts.Interval
+	if interval == 0 {
+		interval = defaultScrapeInterval
+	}
+
+	type job struct {
+		path    string
+		targets []string
+	}
+
+	jobs := map[string]*job{}
+	names := []string{}
+	for _, target := range opts.Targets {
+		name := orDefault(target.Job, target.Container)
+		path := orDefault(target.Path, "/metrics")
+
+		// jobs have one metrics path
+		if j, ok := jobs[name]; ok && j.path != path {
+			name = fmt.Sprintf("%s-%d", name, target.Port)
+		}
+
+		j, ok := jobs[name]
+		if !ok {
+			j = &job{path: path}
+			jobs[name] = j
+			names = append(names, name)
+		}
+
+		j.targets = append(j.targets, fmt.Sprintf("%s:%d", target.Container, target.Port))
+	}
+	sort.Strings(names)
+
+	scrapes := []m{}
+	for _, name := range names {
+		scrapes = append(scrapes, m{
+			"job_name":       name,
+			"metrics_path":   jobs[name].path,
+			"static_configs": []m{{"targets": jobs[name].targets}},
+		})
+	}
+
+	content, _ := yaml.Marshal(m{
+		"global":         m{"scrape_interval": interval.String(), "evaluation_interval": interval.String()},
+		"scrape_configs": scrapes,
+	})
+
+	return content
+}
+
+// Sample is a sample of the result of a Prometheus query.
+type Sample struct {
+	Labels map[string]string
+	Value  float64
+}
+
+// PrometheusQuery evaluates the instant query on the named Prometheus
+// container, e.g. `http_requests_total{job="web"}`, and returns its samples.
+// An empty result is not an error; poll with duct.Retry to wait for a metric
+// to be scraped.
+func PrometheusQuery(ctx context.Context, c *duct.Composer, name, query string) ([]Sample, error) {
+	base, err := c.BaseURL(name, prometheusPort)
+	if err != nil {
+		return nil, err
+	}
+
+	return prometheusQuery(ctx, base, query)
+}
+
+func prometheusQuery(ctx context.Context, base, query string) ([]Sample, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"/api/v1/query?query="+url.QueryEscape(query), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+		Data   struct {
+			ResultType string `json:"resultType"`
+			Result     []struct {
+				Metric map[string]string `json:"metric"`
+				Value  [2]interface{}    `json:"value"`
+			} `json:"result"`
+		} `json:"data"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("query %q answered %s: %w", query, resp.Status, err)
+	}
+
+	if result.Status != "success" {
+		return nil, fmt.Errorf("query %q failed: %s", query, result.Error)
+	}
+
+	if result.Data.ResultType != "vector" {
+		return nil, fmt.Errorf("query %q returned a %s, not a vector", query, result.Data.ResultType)
+	}
+
+	samples := []Sample{}
+	for _, r := range result.Data.Result {
+		s, _ := r.Value[1].(string)
+		value, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("query %q returned an invalid value %q", query, s)
+		}
+
+		samples = append(samples, Sample{Labels: r.Metric, Value: value})
+	}
+
+	return samples, nil
+}
+
+// GrafanaOptions configures Grafana.
+type GrafanaOptions struct {
+	Image string
+	// Prometheus is the name of the Prometheus container to provision as the
+	// default data source, if any.
+	Prometheus string
+}
+
+// Grafana returns a container named name which runs Grafana, without a login,
+// for looking at the metrics of a composition while debugging a test.
+func Grafana(name string, opts GrafanaOptions) *duct.Container {
+	cont := &duct.Container{
+		Name:  name,
+		Image: orDefault(opts.Image, GrafanaImage),
+		Env: []string{
+			"GF_AUTH_ANONYMOUS_ENABLED=true",
+			"GF_AUTH_ANONYMOUS_ORG_ROLE=Admin",
+			"GF_AUTH_DISABLE_LOGIN_FORM=true",
+		},
+		Ports: []duct.PortForward{{ContainerPort: grafanaPort}},
+		ReadyFunc: func(ctx context.Context, info *duct.ContainerInfo) error {
+			addr, err := info.Endpoint(grafanaPort)
+			if err != nil {
+				return err
+			}
+
+			return duct.Retry(ctx, 100*time.Millisecond, 0, func() error {
+				return httpOK(ctx, "http://"+addr+"/api/health")
+			})
+		},
+	}
+
+	if opts.Prometheus != "" {
+		type m = map[string]interface{}
+
+		content, _ := yaml.Marshal(m{
+			"apiVersion": 1,
+			"datasources": []m{{
+				"name":      "Prometheus",
+				"type":      "prometheus",
+				"access":    "proxy",
+				"url":       fmt.Sprintf("http://%s:%d", opts.Prometheus, prometheusPort),
+				"isDefault": true,
+			}},
+		})
+
+		cont.Files = map[string]duct.FileContent{
+			"/etc/grafana/provisioning/datasources/duct.yaml": {Content: content},
+		}
+	}
+
+	return cont
+}
@@ -0,0 +1,147 @@
+package modules
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/erikh/duct"
+	"github.com/erikh/duct/ductfake"
+	"gopkg.in/yaml.v3"
+)
+
+const testSpans = `{"resourceSpans":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"web"}}]},"scopeSpans":[{"scope":{"name":"http"},"spans":[{"traceId":"aa","spanId":"01","name":"GET /","attributes":[{"key":"http.status_code","value":{"intValue":"200"}},{"key":"http.method","value":{"stringValue":"GET"}}]},{"traceId":"aa","spanId":"02","parentSpanId":"01","name":"query"}]}]}]}
+
+{"resourceSpans":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"worker"}}]},"scopeSpans":[{"spans":[{"traceId":"bb","spanId":"03","name":"job","attributes":[{"key":"retry","value":{"boolValue":true}}]}]}]}]}
+`
+
+func TestReadSpans(t *testing.T) {
+	spans, err := readSpans(strings.NewReader(testSpans))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Span{
+		{Service: "web", Name: "GET /", TraceID: "aa", SpanID: "01", Attributes: map[string]string{"http.status_code": "200", "http.method": "GET"}},
+		{Service: "web", Name: "query", TraceID: "aa", SpanID: "02", ParentID: "01", Attributes: map[string]string{}},
+		{Service: "worker", Name: "job", TraceID: "bb", SpanID: "03", Attributes: map[string]string{"retry": "true"}},
+	}
+
+	if !reflect.DeepEqual(spans, expected) {
+		t.Fatalf("unexpected spans: %+v", spans)
+	}
+}
+
+func TestCollectorSpans(t *testing.T) {
+	r := ductfake.Start(t)
+
+	cont := OTelCollector("otel", OTelCollectorOptions{})
+	// the fake daemon does not allocate host ports, nor run the collector
+	for i := range cont.Ports {
+		cont.Ports[i].HostPort = 40000 + i
+	}
+	cont.ReadyFunc = nil
+
+	c := r.Launch(t, duct.Manifest{cont})
+
+	spans, err := CollectorSpans(c, "otel")
+	if err != nil || len(spans) != 0 {
+		t.Fatalf("spans before any were received: %v %v", spans, err)
+	}
+
+	dir, err := c.MountPath("otel", collectorSpansDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, collectorSpansFile), []byte(testSpans), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	spans, err = CollectorSpans(c, "otel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spans) != 3 {
+		t.Fatalf("unexpected spans: %+v", spans)
+	}
+}
+
+func TestPrometheusConfig(t *testing.T) {
+	content := prometheusConfig(PrometheusOptions{
+		Interval: 5 * time.Second,
+		Targets: []ScrapeTarget{
+			{Container: "web-1", Port: 8080, Job: "web"},
+			{Container: "web-2", Port: 8080, Job: "web"},
+			{Container: "web-1", Port: 9000, Job: "web", Path: "/internal/metrics"},
+			CollectorScrapeTarget("otel"),
+		},
+	})
+
+	var config struct {
+		Global struct {
+			ScrapeInterval string `yaml:"scrape_interval"`
+		}
+		ScrapeConfigs []struct {
+			JobName       string                       `yaml:"job_name"`
+			MetricsPath   string                       `yaml:"metrics_path"`
+			StaticConfigs []struct{ Targets []string } `yaml:"static_configs"`
+		} `yaml:"scrape_configs"`
+	}
+
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Global.ScrapeInterval != "5s" {
+		t.Fatalf("unexpected interval: %s", config.Global.ScrapeInterval)
+	}
+
+	jobs := []string{}
+	for _, scrape := range config.ScrapeConfigs {
+		jobs = append(jobs, fmt.Sprintf("%s %s %v", scrape.JobName, scrape.MetricsPath, scrape.StaticConfigs[0].Targets))
+	}
+
+	expected := []string{
+		"otel /metrics [otel:8889]",
+		"web /metrics [web-1:8080 web-2:8080]",
+		"web-9000 /internal/metrics [web-1:9000]",
+	}
+
+	if !reflect.DeepEqual(jobs, expected) {
+		t.Fatalf("unexpected jobs: %v", jobs)
+	}
+}
+
+func TestPrometheusQuery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("query") {
+		case `up{job="web"}`:
+			fmt.Fprint(w, `{"status": "success", "data": {"resultType": "vector", "result": [{"metric": {"__name__": "up", "instance": "web-1:8080"}, "value": [1700000000.1, "1"]}]}}`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"status": "error", "errorType": "bad_data", "error": "parse error"}`)
+		}
+	}))
+	defer server.Close()
+
+	samples, err := prometheusQuery(context.Background(), server.URL, `up{job="web"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(samples) != 1 || samples[0].Value != 1 || samples[0].Labels["instance"] != "web-1:8080" {
+		t.Fatalf("unexpected samples: %+v", samples)
+	}
+
+	if _, err := prometheusQuery(context.Background(), server.URL, "up{"); err == nil || !strings.Contains(err.Error(), "parse error") {
+		t.Fatalf("unexpected error for an invalid query: %v", err)
+	}
+}
@@ -0,0 +1,21 @@
+package modules
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPostgresStartup(t *testing.T) {
+	expected := []byte("\x00\x00\x00\x1f\x00\x03\x00\x00user\x00app\x00database\x00app\x00\x00")
+
+	if msg := postgresStartup("app", "app"); !bytes.Equal(msg, expected) {
+		t.Fatalf("unexpected startup message: %q", msg)
+	}
+
+	// the routine field of an error must not pass for an authentication
+	// request
+	starting := []byte("E\x00\x00\x00\x60SFATAL\x00C57P03\x00Mthe database system is starting up\x00Rpostmaster.c\x00\x00")
+	if bytes.Contains(starting, postgresAuthRequest) {
+		t.Fatal("an error passes for an authentication request")
+	}
+}
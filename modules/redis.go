@@ -0,0 +1,54 @@
+package modules
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/erikh/duct"
+)
+
+// RedisImage is the image Redis runs by default.
+const RedisImage = "redis:7"
+
+const redisPort = 6379
+
+// RedisOptions configures Redis. Without a Password, the server does not
+// require authentication.
+type RedisOptions struct {
+	Image    string
+	Password string
+}
+
+// Redis returns a container named name which runs Redis. It is ready once the
+// server accepts connections. Use RedisConnectionString to connect to it
+// from the test.
+func Redis(name string, opts RedisOptions) *duct.Container {
+	cont := &duct.Container{
+		Name:    name,
+		Image:   orDefault(opts.Image, RedisImage),
+		Ports:   []duct.PortForward{{ContainerPort: redisPort}},
+		WaitFor: duct.WaitForLog("Ready to accept connections", 1, 0),
+	}
+
+	if opts.Password != "" {
+		cont.Command = []string{"redis-server", "--requirepass", opts.Password}
+	}
+
+	return cont
+}
+
+// RedisConnectionString returns the URL to connect to the named Redis
+// container from the test with, e.g. "redis://:secret@127.0.0.1:49153/0".
+func RedisConnectionString(ctx context.Context, c *duct.Composer, name string) (string, error) {
+	l, err := inspect(ctx, c, name, redisPort)
+	if err != nil {
+		return "", err
+	}
+
+	u := &url.URL{Scheme: "redis", Host: l.addr, Path: "/0"}
+	if password := l.arg("--requirepass"); password != "" {
+		u.User = url.UserPassword("", password)
+	}
+
+	return u.String(), nil
+}
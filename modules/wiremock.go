@@ -0,0 +1,289 @@
+package modules
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/erikh/duct"
+)
+
+// WireMockImage is the image WireMock runs by default.
+const WireMockImage = "wiremock/wiremock:3.5.2"
+
+const wireMockPort = 8080
+
+// WireMockOptions configures WireMock.
+type WireMockOptions struct {
+	Image string
+	// Stubs are programmed before the container is started, so the service
+	// under test finds them however early it calls.
+	Stubs []Stub
+}
+
+// WireMock returns a container named name which runs WireMock, an HTTP server
+// answering with stubs, to fake the HTTP dependencies of the service under
+// test, which reaches it by name, e.g. "http://payments:8080". Unmatched
+// requests are answered 404. Use WireMockClient to program it and verify the
+// requests it received from the test.
+func WireMock(name string, opts WireMockOptions) *duct.Container {
+	cont := &duct.Container{
+		Name:  name,
+		Image: orDefault(opts.Image, WireMockImage),
+		Ports: []duct.PortForward{{ContainerPort: wireMockPort}},
+		ReadyFunc: func(ctx context.Context, info *duct.ContainerInfo) error {
+			addr, err := info.Endpoint(wireMockPort)
+			if err != nil {
+				return err
+			}
+
+			return duct.Retry(ctx, 100*time.Millisecond, 0, func() error {
+				return httpOK(ctx, "http://"+addr+"/__admin/mappings")
+			})
+		},
+	}
+
+	if len(opts.Stubs) != 0 {
+		mappings := []interface{}{}
+		for _, stub := range opts.Stubs {
+			mappings = append(mappings, stub.mapping())
+		}
+
+		content, _ := json.Marshal(map[string]interface{}{"mappings": mappings})
+		cont.Files = map[string]duct.FileContent{
+			"/home/wiremock/mappings/duct.json": {Content: content},
+		}
+	}
+
+	return cont
+}
+
+// Stub is a request to match, and the response to answer it with.
+type Stub struct {
+	// Method is the method to match; by default, any.
+	Method string
+	// URL matches the path and query exactly, URLPath the path only, and
+	// URLPattern the path and query with a regular expression. One is
+	// required.
+	URL        string
+	URLPath    string
+	URLPattern string
+	// QueryParams and RequestHeaders must equal the values.
+	QueryParams    map[string]string
+	RequestHeaders map[string]string
+	// BodyContains matches requests whose body contains the string.
+	BodyContains string
+
+	// Status is the status of the response; by default, 200.
+	Status  int
+	Headers map[string]string
+	// Body is the body of the response, or JSONBody marshaled to JSON.
+	Body     string
+	JSONBody interface{}
+	// Delay delays the response.
+	Delay time.Duration
+	// Priority orders stubs matching the same request; 1 is the highest.
+	Priority int
+}
+
+// mapping returns the stub as a WireMock stub mapping.
+func (s Stub) mapping() map[string]interface{} {
+	type m = map[string]interface{}
+
+	equalTo := func(values map[string]string) m {
+		res := m{}
+		for k, v := range values {
+			res[k] = m{"equalTo": v}
+		}
+		return res
+	}
+
+	request := m{"method": orDefault(s.Method, "ANY")}
+	switch {
+	case s.URL != "":
+		request["url"] = s.URL
+	case s.URLPath != "":
+		request["urlPath"] = s.URLPath
+	case s.URLPattern != "":
+		request["urlPattern"] = s.URLPattern
+	}
+
+	if len(s.QueryParams) != 0 {
+		request["queryParameters"] = equalTo(s.QueryParams)
+	}
+
+	if len(s.RequestHeaders) != 0 {
+		request["headers"] = equalTo(s.RequestHeaders)
+	}
+
+	if s.BodyContains != "" {
+		request["bodyPatterns"] = []m{{"contains": s.BodyContains}}
+	}
+
+	status := s.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	response := m{"status": status}
+	if len(s.Headers) != 0 {
+		response["headers"] = s.Headers
+	}
+
+	if s.JSONBody != nil {
+		response["jsonBody"] = s.JSONBody
+	} else if s.Body != "" {
+		response["body"] = s.Body
+	}
+
+	if s.Delay != 0 {
+		response["fixedDelayMilliseconds"] = s.Delay.Milliseconds()
+	}
+
+	mapping := m{"request": request, "response": response}
+	if s.Priority != 0 {
+		mapping["priority"] = s.Priority
+	}
+
+	return mapping
+}
+
+// StubServer programs a WireMock container and reads the requests it
+// received.
+type StubServer struct {
+	// URL is the base URL of the stubs from the test.
+	URL string
+
+	client *http.Client
+}
+
+// ReceivedRequest is a request received by a StubServer.
+type ReceivedRequest struct {
+	Method  string
+	URL     string
+	Headers map[string]string
+	Body    string
+	// Matched is false if no stub matched the request.
+	Matched bool
+}
+
+// WireMockClient returns the stub server of the named WireMock container.
+func WireMockClient(c *duct.Composer, name string) (*StubServer, error) {
+	base, err := c.BaseURL(name, wireMockPort)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StubServer{URL: base, client: &http.Client{Timeout: 10 * time.Second}}, nil
+}
+
+// Stub programs the stub, in addition to those already programmed.
+func (s *StubServer) Stub(ctx context.Context, stub Stub) error {
+	return s.api(ctx, http.MethodPost, "/__admin/mappings", stub.mapping(), nil)
+}
+
+// Reset removes the stubs programmed with Stub, restoring those of the
+// options, and forgets the received requests.
+func (s *StubServer) Reset(ctx context.Context) error {
+	return s.api(ctx, http.MethodPost, "/__admin/reset", nil, nil)
+}
+
+// Requests returns the received requests, newest first.
+func (s *StubServer) Requests(ctx context.Context) ([]ReceivedRequest, error) {
+	var journal struct {
+		Requests []struct {
+			Request struct {
+				Method  string
+				URL     string
+				Headers map[string]string
+				Body    string
+			}
+			WasMatched bool
+		}
+	}
+
+	if err := s.api(ctx, http.MethodGet, "/__admin/requests", nil, &journal); err != nil {
+		return nil, err
+	}
+
+	requests := []ReceivedRequest{}
+	for _, r := range journal.Requests {
+		requests = append(requests, ReceivedRequest{
+			Method:  r.Request.Method,
+			URL:     r.Request.URL,
+			Headers: r.Request.Headers,
+			Body:    r.Request.Body,
+			Matched: r.WasMatched,
+		})
+	}
+
+	return requests, nil
+}
+
+// Count returns the number of received requests the stub's request would
+// match; its response is ignored.
+func (s *StubServer) Count(ctx context.Context, stub Stub) (int, error) {
+	var count struct{ Count int }
+
+	if err := s.api(ctx, http.MethodPost, "/__admin/requests/count", stub.mapping()["request"], &count); err != nil {
+		return 0, err
+	}
+
+	return count.Count, nil
+}
+
+// Verify returns an error unless the stub's request matched exactly count
+// received requests.
+func (s *StubServer) Verify(ctx context.Context, stub Stub, count int) error {
+	actual, err := s.Count(ctx, stub)
+	if err != nil {
+		return err
+	}
+
+	if actual != count {
+		request, _ := json.Marshal(stub.mapping()["request"])
+		return fmt.Errorf("expected %d requests matching %s, received %d", count, request, actual)
+	}
+
+	return nil
+}
+
+// api calls the admin API of WireMock with the JSON of body, if it is not
+// nil, decoding the response into res if it is not nil.
+func (s *StubServer) api(ctx context.Context, method, path string, body, res interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(content)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.URL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("wiremock: %s %s: %s: %s", method, path, resp.Status, bytes.TrimSpace(msg))
+	}
+
+	if res == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(res)
+}
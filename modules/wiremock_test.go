@@ -0,0 +1,108 @@
+package modules
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStubMapping(t *testing.T) {
+	stub := Stub{
+		Method:         "POST",
+		URLPath:        "/charges",
+		RequestHeaders: map[string]string{"Authorization": "Bearer test"},
+		BodyContains:   "amount",
+		Status:         http.StatusCreated,
+		JSONBody:       map[string]string{"id": "ch_1"},
+		Delay:          1500 * time.Millisecond,
+	}
+
+	content, err := json.Marshal(stub.mapping())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var actual, expected interface{}
+	json.Unmarshal(content, &actual)
+	json.Unmarshal([]byte(`{
+		"request": {
+			"method": "POST",
+			"urlPath": "/charges",
+			"headers": {"Authorization": {"equalTo": "Bearer test"}},
+			"bodyPatterns": [{"contains": "amount"}]
+		},
+		"response": {"status": 201, "jsonBody": {"id": "ch_1"}, "fixedDelayMilliseconds": 1500}
+	}`), &expected)
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("unexpected mapping: %s", content)
+	}
+
+	if m := (Stub{URL: "/"}).mapping(); m["request"].(map[string]interface{})["method"] != "ANY" || m["response"].(map[string]interface{})["status"] != 200 {
+		t.Fatalf("unexpected defaults: %v", m)
+	}
+}
+
+func TestWireMock(t *testing.T) {
+	cont := WireMock("payments", WireMockOptions{Stubs: []Stub{{URL: "/health", Body: "ok"}}})
+	if _, ok := cont.Files["/home/wiremock/mappings/duct.json"]; !ok {
+		t.Fatalf("stubs of the options are not written: %v", cont.Files)
+	}
+
+	var mappings []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		switch r.Method + " " + r.URL.Path {
+		case "POST /__admin/mappings":
+			mappings = append(mappings, body["request"].(map[string]interface{})["url"].(string))
+			w.WriteHeader(http.StatusCreated)
+		case "POST /__admin/requests/count":
+			fmt.Fprint(w, `{"count": 2}`)
+		case "GET /__admin/requests":
+			fmt.Fprint(w, `{"requests": [{"request": {"method": "GET", "url": "/rates?currency=EUR", "headers": {"Accept": "application/json"}}, "wasMatched": true}]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	s := &StubServer{URL: server.URL, client: http.DefaultClient}
+
+	if err := s.Stub(ctx, Stub{Method: "GET", URL: "/rates?currency=EUR", Body: "1.1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(mappings, []string{"/rates?currency=EUR"}) {
+		t.Fatalf("unexpected mappings: %v", mappings)
+	}
+
+	requests, err := s.Requests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requests) != 1 || requests[0].URL != "/rates?currency=EUR" || !requests[0].Matched || requests[0].Headers["Accept"] != "application/json" {
+		t.Fatalf("unexpected requests: %+v", requests)
+	}
+
+	if err := s.Verify(ctx, Stub{Method: "GET", URLPath: "/rates"}, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Verify(ctx, Stub{Method: "GET", URLPath: "/rates"}, 1); err == nil || !strings.Contains(err.Error(), "received 2") {
+		t.Fatalf("unexpected error for the wrong count: %v", err)
+	}
+
+	if err := s.Reset(ctx); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("unexpected error for a failing call: %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package duct
+
+import (
+	"fmt"
+	"os"
+
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+// makeTempMounts creates the host directories for the container's TempMounts
+// and returns the mounts for them.
+func (cont *Container) makeTempMounts() ([]dc.HostMount, error) {
+	mounts := []dc.HostMount{}
+
+	for _, target := range cont.TempMounts {
+		dir, ok := cont.tempDirs[target]
+		if !ok {
+			var err error
+			dir, err = os.MkdirTemp("", "duct-mount-")
+			if err != nil {
+				return nil, err
+			}
+
+			// the container may not run as our user
+			if err := os.Chmod(dir, 0777); err != nil {
+				os.RemoveAll(dir)
+				return nil, err
+			}
+
+			if cont.tempDirs == nil {
+				cont.tempDirs = map[string]string{}
+			}
+			cont.tempDirs[target] = dir
+		}
+
+		mounts = append(mounts, dc.HostMount{
+			Source: dir,
+			Type:   "bind",
+			Target: target,
+		})
+	}
+
+	return mounts, nil
+}
+
+// removeTempMounts removes the host directories of the container's
+// TempMounts, and its hosts file.
+func (c *Composer) removeTempMounts(cont *Container) error {
+	var failed bool
+
+	for target, dir := range cont.tempDirs {
+		if err := os.RemoveAll(dir); err != nil {
+			c.logContainer(LogError, cont.Name, "Error removing temporary mount [%s] of container [%s]: %v", target, cont.Name, err)
+			failed = true
+			continue
+		}
+		delete(cont.tempDirs, target)
+	}
+
+	if cont.hostsFile != "" {
+		if err := os.Remove(cont.hostsFile); err != nil && !os.IsNotExist(err) {
+			c.logContainer(LogError, cont.Name, "Error removing hosts file of container [%s]: %v", cont.Name, err)
+			failed = true
+		} else {
+			cont.hostsFile = ""
+		}
+	}
+
+	if failed {
+		return fmt.Errorf("[%s] could not remove temporary mounts", cont.Name)
+	}
+
+	return nil
+}
+
+// MountPath returns the host directory mounted at containerPath of the named
+// container for one of its TempMounts.
+func (c *Composer) MountPath(name, containerPath string) (string, error) {
+	cont, err := c.find(name)
+	if err != nil {
+		return "", err
+	}
+
+	dir, ok := cont.tempDirs[containerPath]
+	if !ok {
+		return "", fmt.Errorf("[%s] %s is not a temporary mount", name, containerPath)
+	}
+
+	return dir, nil
+}
@@ -0,0 +1,88 @@
+package duct
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+// NetAdminImage is the image of the helper containers of NetAdmin, which
+// has tools like tc and iptables.
+const NetAdminImage = "nicolaka/netshoot:latest"
+
+// NetAdmin runs the command in the network namespace of the named container,
+// from a helper container of NetAdminImage with the capability to administer
+// its network, e.g. tc or iptables; the image of the container needs no
+// tools. The helper image is pulled like the containers' images are, through
+// WithRegistryMirror and WithRegistryAuth. If the command fails, the error
+// has its output.
+func (c *Composer) NetAdmin(ctx context.Context, name string, command ...string) error {
+	cont, err := c.find(name)
+	if err != nil {
+		return err
+	}
+
+	return c.netAdmin(ctx, cont, command...)
+}
+
+// netAdmin runs the command of NetAdmin for the container.
+func (c *Composer) netAdmin(ctx context.Context, cont *Container, command ...string) error {
+	if len(command) == 0 {
+		return fmt.Errorf("[%s] empty command", cont.Name)
+	}
+
+	image := c.mirror(NetAdminImage)
+
+	if _, err := c.client.InspectImage(image); err != nil {
+		c.logf(LogInfo, "Pulling docker image: [%s]", image)
+		if err := c.pullImage(ctx, image); err != nil {
+			return err
+		}
+	}
+
+	ctr, err := c.client.CreateContainer(dc.CreateContainerOptions{
+		Config: &dc.Config{
+			Image:      image,
+			Entrypoint: command[:1],
+			Cmd:        command[1:],
+		},
+		HostConfig: &dc.HostConfig{
+			NetworkMode: "container:" + cont.id,
+			CapAdd:      []string{"NET_ADMIN"},
+		},
+		Context: ctx,
+	})
+	if err != nil {
+		return err
+	}
+	defer c.client.RemoveContainer(dc.RemoveContainerOptions{ID: ctr.ID, Force: true, Context: context.Background()})
+
+	if err := c.client.StartContainerWithContext(ctr.ID, nil, ctx); err != nil {
+		return err
+	}
+
+	code, err := c.client.WaitContainerWithContext(ctr.ID, ctx)
+	if err != nil {
+		return err
+	}
+
+	if code != 0 {
+		output := &bytes.Buffer{}
+		logsCtx, watch := c.watchStream(ctx)
+		watch.Done(c.client.Logs(dc.LogsOptions{
+			Container:    ctr.ID,
+			Stdout:       true,
+			Stderr:       true,
+			OutputStream: watch.Writer(output),
+			ErrorStream:  watch.Writer(output),
+			Context:      logsCtx,
+		}))
+
+		return fmt.Errorf("[%s] %s exited with code %d: %s", cont.Name, strings.Join(command, " "), code, strings.TrimSpace(output.String()))
+	}
+
+	return nil
+}
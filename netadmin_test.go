@@ -0,0 +1,89 @@
+package duct
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+func TestNetAdmin(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		pulled  []string
+		auth    string
+		command []string
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/images/") && strings.HasSuffix(r.URL.Path, "/json"):
+			http.Error(w, "no such image", http.StatusNotFound)
+		case r.URL.Path == "/images/create":
+			pulled = append(pulled, r.URL.Query().Get("fromImage"))
+			auth = r.Header.Get("X-Registry-Auth")
+			w.Write([]byte(`{"status":"done"}`))
+		case r.URL.Path == "/containers/create":
+			var opts struct {
+				Entrypoint []string
+				Cmd        []string
+			}
+			if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			command = append(opts.Entrypoint, opts.Cmd...)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"Id":"helper"}`))
+		case strings.HasSuffix(r.URL.Path, "/wait"):
+			w.Write([]byte(`{"StatusCode":0}`))
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	client, err := dc.NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := New(Manifest{{Name: "app", Image: "app", id: "app-id"}},
+		WithRegistryMirror(map[string]string{"docker.io/*": "mirror.corp/*"}),
+		WithRegistryAuth(map[string]dc.AuthConfiguration{"mirror.corp": {Username: "ci"}}),
+	)
+	c.client = client
+
+	if err := c.NetAdmin(context.Background(), "app", "tc", "qdisc", "show"); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(pulled) != 1 || !strings.HasPrefix(pulled[0], "mirror.corp/nicolaka/netshoot") {
+		t.Fatalf("the helper image was not pulled from the mirror: %v", pulled)
+	}
+
+	if auth == "" {
+		t.Fatal("the helper image was pulled without the credentials of the mirror")
+	}
+
+	if strings.Join(command, " ") != "tc qdisc show" {
+		t.Fatalf("unexpected command: %v", command)
+	}
+
+	if err := c.NetAdmin(context.Background(), "missing", "tc"); err == nil {
+		t.Fatal("no error for a container not in the manifest")
+	}
+}
@@ -0,0 +1,129 @@
+package duct
+
+import (
+	"context"
+	"net"
+
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+// NetworkOptions configure the network created with WithNewNetwork and the
+// like.
+type NetworkOptions struct {
+	// Driver is the network driver, e.g. "macvlan" or "overlay". The default
+	// is "bridge".
+	Driver string
+	// DriverOptions are passed to the driver, e.g.
+	// "com.docker.network.driver.mtu".
+	DriverOptions map[string]string
+	// Internal cuts the network off from outside of the daemon's host.
+	Internal bool
+	// Attachable lets containers which are not part of a swarm service
+	// attach to an overlay network.
+	Attachable bool
+	// Labels are added to the network.
+	Labels map[string]string
+}
+
+// IPAMPool is an address pool of the network the composition creates.
+type IPAMPool struct {
+	// Subnet is the pool's subnet in CIDR notation, e.g. "10.0.0.0/24" or
+	// "fd00:1::/64". Networks with an IPv6 pool have IPv6 enabled.
+	Subnet string
+	// IPRange is the part of the subnet, in CIDR notation, that addresses
+	// are allocated from to containers without a static address.
+	IPRange string
+	// Gateway is the address of the gateway in the subnet.
+	Gateway string
+	// AuxAddresses reserve addresses of the subnet, by name, so that they
+	// are not allocated to containers.
+	AuxAddresses map[string]string
+}
+
+// WithNewNetworkIPAM creates a network with the address pools for use with
+// the manifest, e.g. to keep the composition clear of the routes of a VPN.
+func WithNewNetworkIPAM(name string, pools ...IPAMPool) Options {
+	return Options{optionCreateNetwork: name, optionCreateNetworkIPAM: pools}
+}
+
+// ipamPools returns the address pools of the network to create.
+func ipamPools(opts Options) []IPAMPool {
+	pools, _ := opts[optionCreateNetworkIPAM].([]IPAMPool)
+	return pools
+}
+
+// ipv6 is true if the pool's subnet is an IPv6 one.
+func (pool IPAMPool) ipv6() bool {
+	_, subnet, err := net.ParseCIDR(pool.Subnet)
+	return err == nil && subnet.IP.To4() == nil
+}
+
+// WithNetworkOptions configures the network the composition creates.
+func WithNetworkOptions(opts NetworkOptions) Options {
+	return Options{optionNetworkOptions: opts}
+}
+
+// networkOptions returns the options of the network to create.
+func (c *Composer) networkOptions() NetworkOptions {
+	opts, _ := c.options[optionNetworkOptions].(NetworkOptions)
+	if opts.Driver == "" {
+		opts.Driver = "bridge"
+	}
+
+	return opts
+}
+
+// createNetwork creates the network given with WithNewNetwork and the like.
+func (c *Composer) createNetwork(ctx context.Context, client *dc.Client) error {
+	var ipam *dc.IPAMOptions
+	var enableIPv6 bool
+
+	if pools := ipamPools(c.options); len(pools) != 0 {
+		ipam = &dc.IPAMOptions{}
+		for _, pool := range pools {
+			ipam.Config = append(ipam.Config, dc.IPAMConfig{
+				Subnet:     pool.Subnet,
+				IPRange:    pool.IPRange,
+				Gateway:    pool.Gateway,
+				AuxAddress: pool.AuxAddresses,
+			})
+			enableIPv6 = enableIPv6 || pool.ipv6()
+		}
+	}
+
+	opts := c.networkOptions()
+
+	labels := map[string]string{}
+	for key, value := range opts.Labels {
+		labels[key] = value
+	}
+	labels[networkLabel] = "true"
+
+	driverOptions := map[string]interface{}{}
+	for key, value := range opts.DriverOptions {
+		driverOptions[key] = value
+	}
+
+	networkMu.Lock()
+	defer networkMu.Unlock()
+
+	net, err := client.CreateNetwork(dc.CreateNetworkOptions{
+		Name:           c.options[optionCreateNetwork].(string),
+		Driver:         opts.Driver,
+		Options:        driverOptions,
+		Internal:       opts.Internal,
+		Attachable:     opts.Attachable,
+		EnableIPv6:     enableIPv6,
+		Context:        ctx,
+		IPAM:           ipam,
+		Labels:         labels,
+		CheckDuplicate: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	c.netID = net.ID
+
+	return nil
+}
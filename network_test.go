@@ -0,0 +1,29 @@
+package duct_test
+
+import (
+	"testing"
+
+	"github.com/erikh/duct"
+	"github.com/erikh/duct/ductfake"
+)
+
+func TestNetworkOptions(t *testing.T) {
+	r := ductfake.Start(t)
+
+	r.Launch(t, duct.Manifest{
+		{Name: "db", Image: "postgres:latest"},
+	}, duct.WithNetworkOptions(duct.NetworkOptions{
+		Driver:        "macvlan",
+		DriverOptions: map[string]string{"com.docker.network.driver.mtu": "1400"},
+		Internal:      true,
+	}))
+
+	network, err := r.Client().NetworkInfo(ductfake.Network)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if network.Driver != "macvlan" {
+		t.Fatalf("unexpected network driver: %q", network.Driver)
+	}
+}
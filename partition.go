@@ -0,0 +1,87 @@
+package duct
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// Partition blocks the traffic between the two named containers, or between
+// each of their replicas, e.g. to split a cluster in two. It is done with
+// iptables rules in the network namespace of one of each pair, from a helper
+// container; the images do not need any tools. Other traffic of the
+// containers is not affected. Undo it with Heal.
+func (c *Composer) Partition(ctx context.Context, a, b string) error {
+	return c.partition(ctx, a, b, true)
+}
+
+// Heal unblocks the traffic between the two named containers blocked by
+// Partition.
+func (c *Composer) Heal(ctx context.Context, a, b string) error {
+	return c.partition(ctx, a, b, false)
+}
+
+func (c *Composer) partition(ctx context.Context, a, b string, block bool) error {
+	c.partitionMu.Lock()
+	defer c.partitionMu.Unlock()
+
+	for _, aName := range c.Replicas(a) {
+		for _, bName := range c.Replicas(b) {
+			if err := c.partitionPair(ctx, aName, bName, block); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// partitionPair blocks or unblocks the traffic between two containers.
+func (c *Composer) partitionPair(ctx context.Context, a, b string, block bool) error {
+	if a == b {
+		return fmt.Errorf("container [%s] cannot be partitioned from itself", a)
+	}
+
+	pair := []string{a, b}
+	sort.Strings(pair)
+
+	from, err := c.find(pair[0])
+	if err != nil {
+		return err
+	}
+
+	to, err := c.find(pair[1])
+	if err != nil {
+		return err
+	}
+
+	key := [2]string{from.id, to.id}
+	if c.partitions[key] == block {
+		return nil
+	}
+
+	ip, err := c.containerIP(ctx, to)
+	if err != nil {
+		return err
+	}
+
+	op := "-I"
+	if block {
+		c.logContainer(LogInfo, from.Name, "Partitioning containers: [%s] and [%s]", from.Name, to.Name)
+	} else {
+		c.logContainer(LogInfo, from.Name, "Healing partition of containers: [%s] and [%s]", from.Name, to.Name)
+		op = "-D"
+	}
+
+	script := fmt.Sprintf("iptables %[1]s INPUT -s %[2]s -j DROP && iptables %[1]s OUTPUT -d %[2]s -j DROP", op, ip)
+	if err := c.netAdmin(ctx, from, "sh", "-c", script); err != nil {
+		return err
+	}
+
+	if c.partitions == nil {
+		c.partitions = map[[2]string]bool{}
+	}
+	c.partitions[key] = block
+
+	return nil
+}
@@ -0,0 +1,298 @@
+package duct
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// internal variable for testing and capturing the output of Plan
+var planTarget io.Writer = os.Stdout
+
+// Plan prints what Launch would do with the manifest: the network, volumes
+// and containers it would create, the images it would pull, and the commands
+// it would run, without contacting the docker daemon. It returns the errors
+// Launch would fail with before then, e.g. for an invalid manifest or missing
+// variables.
+func (c *Composer) Plan(ctx context.Context) error {
+	if err := c.manifest.Validate(c.options); err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	line := func(indent int, format string, args ...interface{}) {
+		b.WriteString(strings.Repeat("  ", indent))
+		b.WriteString(c.scrub(fmt.Sprintf(format, args...)))
+		b.WriteByte('\n')
+	}
+
+	network := ""
+	switch {
+	case c.options[optionCreateNetwork] != nil:
+		network = c.options[optionCreateNetwork].(string)
+		pools := ipamPools(c.options)
+		if len(pools) == 1 && pools[0].IPRange == "" && pools[0].Gateway == "" && len(pools[0].AuxAddresses) == 0 {
+			line(0, "Create network: [%s] with subnet %s", network, pools[0].Subnet)
+			pools = nil
+		} else {
+			line(0, "Create network: [%s]", network)
+		}
+
+		for _, pool := range pools {
+			line(1, "subnet: %s", pool.Subnet)
+			if pool.IPRange != "" {
+				line(2, "ip range: %s", pool.IPRange)
+			}
+			if pool.Gateway != "" {
+				line(2, "gateway: %s", pool.Gateway)
+			}
+			for _, name := range sortedKeys(pool.AuxAddresses) {
+				line(2, "auxiliary address: %s=%s", name, pool.AuxAddresses[name])
+			}
+		}
+
+		opts := c.networkOptions()
+		line(1, "driver: %s", opts.Driver)
+		for _, key := range sortedKeys(opts.DriverOptions) {
+			line(1, "driver option: %s=%s", key, opts.DriverOptions[key])
+		}
+		if opts.Internal {
+			line(1, "internal")
+		}
+		if opts.Attachable {
+			line(1, "attachable")
+		}
+	case c.options[optionExistingNetwork] != nil:
+		network = c.options[optionExistingNetwork].(string)
+		line(0, "Use existing network: [%s]", network)
+	default:
+		return errors.New("compositions must have a network specified")
+	}
+
+	volumes, _ := c.options[optionVolumes].([]string)
+	for _, name := range volumes {
+		line(0, "Create volume: [%s]", name)
+	}
+
+	if c.options[optionTunnel] != nil {
+		line(0, "Pull image: [%s]", c.mirror(tunnelImage))
+		line(0, "Create tunnel relay")
+	}
+
+	for _, cont := range c.manifest {
+		if cont.External {
+			if cont.ExternalLabel != "" {
+				line(0, "Adopt external container: [%s] with label %s", cont.Name, cont.ExternalLabel)
+			} else {
+				line(0, "Adopt external container: [%s]", cont.Name)
+			}
+			continue
+		}
+
+		spec, err := c.resolve(cont)
+		if err != nil {
+			return err
+		}
+
+		if cont.Build != nil {
+			line(0, "Build image: [%s] from %s", spec.Image, cont.Build.dir())
+		} else if cont.LocalImage {
+			line(0, "Use local image: [%s]", spec.Image)
+		} else if spec.Platform != "" {
+			line(0, "Pull image: [%s] for %s", spec.Image, spec.Platform)
+		} else {
+			line(0, "Pull image: [%s]", spec.Image)
+		}
+
+		line(0, "Create container: [%s]", cont.Name)
+		line(1, "image: %s", spec.Image)
+
+		if len(spec.Entrypoint) != 0 {
+			line(1, "entrypoint: %s", strings.Join(spec.Entrypoint, " "))
+		}
+
+		if len(spec.Command) != 0 {
+			line(1, "command: %s", strings.Join(spec.Command, " "))
+		}
+
+		for _, kv := range spec.Env {
+			line(1, "env: %s", kv)
+		}
+
+		line(1, "network: [%s] as %s", network, strings.Join(cont.aliases(), ", "))
+
+		if cont.IPv4 != "" {
+			line(1, "ipv4 address: %s", cont.IPv4)
+		}
+
+		if cont.IPv6 != "" {
+			line(1, "ipv6 address: %s", cont.IPv6)
+		}
+
+		if cont.MacAddress != "" {
+			line(1, "mac address: %s", cont.MacAddress)
+		}
+
+		_, bindings := c.portBindings(spec)
+		for _, port := range sortedKeys(bindings) {
+			for _, binding := range bindings[port] {
+				hostPort := binding.HostPort
+				if hostPort == "" {
+					hostPort = "(any)"
+				}
+				line(1, "port: %s:%s -> %s", binding.HostIP, hostPort, port)
+			}
+		}
+
+		if spec.PublishAllPorts {
+			line(1, "port: all exposed ports")
+		}
+
+		if spec.Privileged {
+			line(1, "privileged")
+		}
+
+		if spec.Runtime != "" {
+			line(1, "runtime: %s", spec.Runtime)
+		}
+
+		if parent := c.cgroupParent(spec); parent != "" {
+			line(1, "cgroup parent: %s", parent)
+		}
+
+		if spec.CgroupnsMode != "" {
+			line(1, "cgroup namespace: %s", spec.CgroupnsMode)
+		}
+
+		if spec.Memory != 0 {
+			line(1, "memory: %d bytes", spec.Memory)
+		}
+
+		if spec.OomScoreAdj != 0 {
+			line(1, "oom score adjustment: %d", spec.OomScoreAdj)
+		}
+
+		for _, key := range sortedKeys(spec.StorageOpt) {
+			line(1, "storage option: %s=%s", key, spec.StorageOpt[key])
+		}
+
+		if spec.TraceDir != "" {
+			line(1, "command trace: %s", spec.TraceDir)
+		}
+
+		if spec.FakeTime != "" {
+			line(1, "fake time: %s", spec.FakeTime)
+		}
+
+		if spec.ShmSize != 0 {
+			line(1, "shm size: %d bytes", spec.ShmSize)
+		}
+
+		if config := c.logConfig(spec); config.Type != "" {
+			line(1, "log driver: %s", config.Type)
+			for _, key := range sortedKeys(config.Config) {
+				line(2, "%s=%s", key, config.Config[key])
+			}
+		}
+
+		for _, host := range sortedKeys(spec.BindMounts) {
+			source, err := hostPath(host)
+			if err != nil {
+				return err
+			}
+			line(1, "bind mount: %s -> %s", source, spec.BindMounts[host])
+		}
+
+		for _, name := range sortedKeys(spec.Volumes) {
+			line(1, "volume: %s -> %s", name, spec.Volumes[name])
+		}
+
+		for _, name := range spec.VolumesFrom {
+			line(1, "volumes from: [%s]", name)
+		}
+
+		for _, target := range spec.TempMounts {
+			line(1, "temporary mount: %s", target)
+		}
+
+		for _, target := range sortedKeys(spec.Tmpfs) {
+			line(1, "tmpfs: %s %s", target, spec.Tmpfs[target])
+		}
+
+		for _, ip := range sortedKeys(spec.ExtraHosts) {
+			line(1, "host: %s %s", ip, strings.Join(spec.ExtraHosts[ip], " "))
+		}
+
+		if c.hostGateway(spec) {
+			line(1, "host: %s", hostGatewayName)
+		}
+
+		for _, target := range sortedKeys(spec.Files) {
+			line(1, "file: %s", target)
+		}
+	}
+
+	for _, cont := range c.manifest {
+		if cont.External {
+			line(0, "Check external container: [%s]", cont.Name)
+		} else {
+			line(0, "Start container: [%s]", cont.Name)
+		}
+
+		if cont.BootWait != 0 {
+			line(1, "boot wait: %v", cont.BootWait)
+		}
+
+		if cont.WaitForExit {
+			line(1, "wait for exit")
+		} else if cont.AliveFunc != nil || cont.WaitFor != nil {
+			line(1, "wait until ready")
+		}
+
+		for _, command := range cont.postCommands() {
+			line(1, "post-command: %s", command.argv())
+			if command.StdinFile != "" {
+				line(2, "stdin: %s", command.StdinFile)
+			} else if command.Stdin != nil {
+				line(2, "stdin: %d bytes", len(command.Stdin))
+			}
+			if command.StdoutFile != "" {
+				line(2, "stdout: %s", command.StdoutFile)
+			}
+			if command.User != "" {
+				line(2, "user: %s", command.User)
+			}
+			if command.Privileged {
+				line(2, "privileged")
+			}
+			if command.Attempts > 1 {
+				line(2, "attempts: %d", command.Attempts)
+			}
+			if command.RetryFor > 0 {
+				line(2, "retry for: %v", command.RetryFor)
+			}
+			if command.Timeout > 0 {
+				line(2, "timeout: %v", command.Timeout)
+			}
+		}
+	}
+
+	_, err := io.WriteString(planTarget, b.String())
+	return err
+}
+
+// sortedKeys returns the keys of the map in order.
+func sortedKeys[K interface{ ~int | ~string }, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	return keys
+}
@@ -0,0 +1,66 @@
+package duct
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPlan(t *testing.T) {
+	buf := &bytes.Buffer{}
+	planTarget = buf
+	defer func() { planTarget = os.Stdout }()
+
+	c := New(Manifest{
+		{
+			Name:         "db",
+			Image:        "postgres:${PG_VERSION}",
+			Env:          []string{"POSTGRES_DB=test"},
+			PortForwards: map[int]int{5432: 5432},
+			Secrets:      []Secret{{Name: "password", Content: []byte("hunter2"), Env: "POSTGRES_PASSWORD"}},
+			Runtime:      "runsc",
+			StorageOpt:   map[string]string{"size": "2G"},
+		},
+		{
+			Name:         "migrate",
+			Image:        "migrate",
+			LocalImage:   true,
+			WaitForExit:  true,
+			PostCommands: [][]string{{"echo", "done"}},
+		},
+	}, WithNewNetwork("duct-test-network"), WithVariables(map[string]string{"PG_VERSION": "15"}), WithCgroupParent("ci-1234.slice"))
+
+	if err := c.Plan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	plan := buf.String()
+	for _, expected := range []string{
+		"Create network: [duct-test-network]\n",
+		"Pull image: [postgres:15]\n",
+		"Create container: [db]\n  image: postgres:15\n  env: POSTGRES_DB=test\n",
+		"  port: 0.0.0.0:5432 -> 5432/tcp\n",
+		"  file: /run/secrets/password\n",
+		"  runtime: runsc\n  cgroup parent: ci-1234.slice\n  storage option: size=2G\n",
+		"Use local image: [migrate]\n",
+		"Start container: [migrate]\n  wait for exit\n  post-command: echo done\n",
+	} {
+		if !strings.Contains(plan, expected) {
+			t.Fatalf("plan does not contain %q:\n%s", expected, plan)
+		}
+	}
+
+	if strings.Contains(plan, "hunter2") {
+		t.Fatalf("plan contains a secret:\n%s", plan)
+	}
+
+	if err := New(Manifest{{Name: "db", Image: "postgres"}}).Plan(context.Background()); err == nil {
+		t.Fatal("planned a composition without a network")
+	}
+
+	if err := New(Manifest{{Name: "db", Image: "postgres:${PG_VERSION?}"}}, WithNewNetwork("duct-test-network")).Plan(context.Background()); err == nil {
+		t.Fatal("planned a composition with a missing variable")
+	}
+}
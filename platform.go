@@ -0,0 +1,187 @@
+package duct
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+// PlatformMismatch is a container whose image was built for another platform
+// than the docker daemon's, so it runs under emulation (e.g. an amd64 image on
+// an arm64 host through qemu), if at all. Emulated containers are much slower
+// to start and run, which makes readiness timeouts and benchmarks misleading.
+type PlatformMismatch struct {
+	Container string
+	Image     string
+	// ImagePlatform is the os/arch of the image, e.g. "linux/amd64".
+	ImagePlatform string
+	// DaemonPlatform is the os/arch of the docker daemon, e.g. "linux/arm64".
+	DaemonPlatform string
+	// Requested is true when the container asked for the platform with
+	// Platform, and so expects the emulation.
+	Requested bool
+}
+
+func (pm PlatformMismatch) Error() string {
+	return fmt.Sprintf("container %s: image %s is %s, but the docker daemon is %s", pm.Container, pm.Image, pm.ImagePlatform, pm.DaemonPlatform)
+}
+
+// WithStrictPlatform fails the launch of any container whose image does not
+// match the platform of the docker daemon, instead of warning about it.
+// Containers which set Platform are exempt.
+func WithStrictPlatform() Options {
+	return Options{optionStrictPlatform: true}
+}
+
+// Emulated returns the containers of the last Launch whose images do not match
+// the platform of the docker daemon, once each, in the order they were last
+// created.
+func (c *Composer) Emulated() []PlatformMismatch {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]PlatformMismatch{}, c.emulated...)
+}
+
+// resetPlatforms forgets the platform of the daemon and the mismatches of the
+// last launch.
+func (c *Composer) resetPlatforms() {
+	c.mu.Lock()
+	c.daemonPlatform = ""
+	c.emulated = nil
+	c.mu.Unlock()
+}
+
+// hostPlatform returns the os/arch of the docker daemon.
+func (c *Composer) hostPlatform(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	platform := c.daemonPlatform
+	c.mu.Unlock()
+
+	if platform != "" {
+		return platform, nil
+	}
+
+	env, err := c.client.VersionWithContext(ctx)
+	if err != nil {
+		return "", fmt.Errorf("getting docker version: %w", err)
+	}
+
+	platform = normalizePlatform(env.Get("Os"), env.Get("Arch"))
+
+	c.mu.Lock()
+	c.daemonPlatform = platform
+	c.mu.Unlock()
+
+	return platform, nil
+}
+
+// checkPlatform compares the platform of the container's image with the
+// daemon's. A mismatch is recorded and warned about, or with
+// WithStrictPlatform, fails the launch.
+func (c *Composer) checkPlatform(ctx context.Context, cont *Container, spec *Container) error {
+	host, err := c.hostPlatform(ctx)
+	if err != nil {
+		return err
+	}
+
+	image, err := c.client.InspectImage(spec.Image)
+	if err != nil {
+		return fmt.Errorf("inspecting image %s: %w", spec.Image, err)
+	}
+
+	mismatch, ok := platformMismatch(cont.Name, spec.Image, image, host)
+	mismatch.Requested = spec.Platform != ""
+
+	// the container may be created again, e.g. by Recreate, with another
+	// image
+	c.mu.Lock()
+	emulated := c.emulated[:0]
+	for _, pm := range c.emulated {
+		if pm.Container != cont.Name {
+			emulated = append(emulated, pm)
+		}
+	}
+	if ok {
+		emulated = append(emulated, mismatch)
+	}
+	c.emulated = emulated
+	c.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	if mismatch.Requested {
+		c.logContainer(LogDebug, cont.Name, "Container will be emulated: [%s] image %s is %s on a %s daemon", cont.Name, spec.Image, mismatch.ImagePlatform, host)
+		return nil
+	}
+
+	if c.options[optionStrictPlatform] != nil {
+		return fmt.Errorf("refusing to emulate a foreign platform: %w", mismatch)
+	}
+
+	c.warnPlatform(mismatch)
+
+	return nil
+}
+
+// warnPlatform warns that the container will be emulated; with WithJSONLogs,
+// as a LogEvent of the "platform" phase.
+func (c *Composer) warnPlatform(mismatch PlatformMismatch) {
+	msg := fmt.Sprintf("WARNING: Container will be emulated: [%s] image %s is %s, but the docker daemon is %s", mismatch.Container, mismatch.Image, mismatch.ImagePlatform, mismatch.DaemonPlatform)
+
+	if !c.logEvent(LogWarn, LogEvent{Phase: "platform", Container: mismatch.Container, Message: msg}) {
+		c.logf(LogWarn, "%s", msg)
+	}
+}
+
+// platformMismatch returns the mismatch between the image and the daemon's
+// platform, if there is one. Images which do not report their platform are
+// assumed to match.
+func platformMismatch(name, ref string, image *dc.Image, host string) (PlatformMismatch, bool) {
+	if image == nil || image.Architecture == "" || host == "" {
+		return PlatformMismatch{}, false
+	}
+
+	platform := normalizePlatform(image.OS, image.Architecture)
+	if platform == host {
+		return PlatformMismatch{}, false
+	}
+
+	return PlatformMismatch{
+		Container:      name,
+		Image:          ref,
+		ImagePlatform:  platform,
+		DaemonPlatform: host,
+	}, true
+}
+
+// archAliases maps the names architectures go by to docker's.
+var archAliases = map[string]string{
+	"x86_64":  "amd64",
+	"x86-64":  "amd64",
+	"aarch64": "arm64",
+	"armhf":   "arm",
+	"armel":   "arm",
+	"i386":    "386",
+	"i686":    "386",
+}
+
+// normalizePlatform returns the os/arch of a platform, with the architecture
+// under docker's name for it.
+func normalizePlatform(os, arch string) string {
+	os = strings.ToLower(os)
+	if os == "" {
+		os = "linux"
+	}
+
+	arch = strings.ToLower(arch)
+	if alias, ok := archAliases[arch]; ok {
+		arch = alias
+	}
+
+	return os + "/" + arch
+}
@@ -0,0 +1,76 @@
+package duct_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/erikh/duct"
+	"github.com/erikh/duct/ductfake"
+)
+
+func TestEmulatedPlatform(t *testing.T) {
+	r := ductfake.Start(t)
+
+	r.SetImagePlatform("postgres:latest", "linux/arm64")
+	r.SetImagePlatform("debian:latest", "linux/x86_64")
+
+	// Recreate changes the containers of the manifest
+	newManifest := func() duct.Manifest {
+		return duct.Manifest{
+			{Name: "db", Image: "postgres:latest"},
+			{Name: "app", Image: "debian:latest"},
+		}
+	}
+
+	c := r.Launch(t, newManifest())
+
+	emulated := c.Emulated()
+	if len(emulated) != 1 {
+		t.Fatalf("unexpected emulated containers: %+v", emulated)
+	}
+
+	want := duct.PlatformMismatch{Container: "db", Image: "postgres:latest", ImagePlatform: "linux/arm64", DaemonPlatform: "linux/amd64"}
+	if emulated[0] != want {
+		t.Fatalf("unexpected mismatch: %+v", emulated[0])
+	}
+
+	if err := c.Recreate(context.Background(), "db", func(cont *duct.Container) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	if emulated := c.Emulated(); len(emulated) != 1 || emulated[0] != want {
+		t.Fatalf("a recreated container was recorded twice: %+v", emulated)
+	}
+
+	if err := c.Recreate(context.Background(), "db", func(cont *duct.Container) { cont.Image = "nginx:latest" }); err != nil {
+		t.Fatal(err)
+	}
+
+	if emulated := c.Emulated(); len(emulated) != 0 {
+		t.Fatalf("a container recreated from a native image is still emulated: %+v", emulated)
+	}
+
+	if err := c.Teardown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest := newManifest()
+	c = r.Compose(t, manifest, duct.WithStrictPlatform())
+
+	var mismatch duct.PlatformMismatch
+	if err := c.Launch(context.Background()); !errors.As(err, &mismatch) || mismatch.Container != "db" {
+		t.Fatalf("unexpected error launching a foreign image strictly: %v", err)
+	}
+
+	if err := c.Teardown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest[0].Platform = "linux/arm64"
+	c = r.Launch(t, manifest, duct.WithStrictPlatform())
+
+	if emulated := c.Emulated(); len(emulated) != 1 || !emulated[0].Requested {
+		t.Fatalf("a requested platform was not recorded: %+v", emulated)
+	}
+}
@@ -0,0 +1,82 @@
+package duct
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"testing"
+
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+func TestPlatformMismatch(t *testing.T) {
+	table := []struct {
+		image    dc.Image
+		host     string
+		mismatch string
+	}{
+		{image: dc.Image{OS: "linux", Architecture: "amd64"}, host: "linux/amd64"},
+		{image: dc.Image{OS: "linux", Architecture: "x86_64"}, host: "linux/amd64"},
+		{image: dc.Image{Architecture: "aarch64"}, host: "linux/arm64"},
+		{image: dc.Image{}, host: "linux/arm64"},
+		{image: dc.Image{OS: "linux", Architecture: "amd64"}, host: ""},
+		{image: dc.Image{OS: "linux", Architecture: "amd64"}, host: "linux/arm64", mismatch: "linux/amd64"},
+		{image: dc.Image{OS: "Linux", Architecture: "ARM64"}, host: "linux/amd64", mismatch: "linux/arm64"},
+		{image: dc.Image{OS: "windows", Architecture: "amd64"}, host: "linux/amd64", mismatch: "windows/amd64"},
+	}
+
+	for _, test := range table {
+		test := test
+		mismatch, ok := platformMismatch("app", "example", &test.image, test.host)
+		if ok != (test.mismatch != "") {
+			t.Fatalf("%+v on %q: mismatch was %v", test.image, test.host, ok)
+		}
+
+		if ok && (mismatch.ImagePlatform != test.mismatch || mismatch.DaemonPlatform != test.host) {
+			t.Fatalf("%+v on %q: unexpected mismatch: %+v", test.image, test.host, mismatch)
+		}
+	}
+}
+
+func TestNormalizePlatform(t *testing.T) {
+	table := map[[2]string]string{
+		{"linux", "amd64"}:  "linux/amd64",
+		{"linux", "x86_64"}: "linux/amd64",
+		{"", "aarch64"}:     "linux/arm64",
+		{"linux", "i686"}:   "linux/386",
+		{"linux", "s390x"}:  "linux/s390x",
+	}
+
+	for in, want := range table {
+		if got := normalizePlatform(in[0], in[1]); got != want {
+			t.Fatalf("%v: got %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestWarnPlatform(t *testing.T) {
+	buf := &bytes.Buffer{}
+
+	writer := log.Writer()
+	defer log.SetOutput(writer)
+	log.SetOutput(buf)
+
+	mismatch := PlatformMismatch{Container: "db", Image: "postgres", ImagePlatform: "linux/amd64", DaemonPlatform: "linux/arm64"}
+	New(Manifest{}, WithJSONLogs()).warnPlatform(mismatch)
+
+	var ev LogEvent
+	if err := json.Unmarshal(buf.Bytes(), &ev); err != nil {
+		t.Fatalf("invalid log line %q: %v", buf, err)
+	}
+
+	if ev.Phase != "platform" || ev.Container != "db" {
+		t.Fatalf("unexpected event: %+v", ev)
+	}
+
+	buf.Reset()
+	New(Manifest{}, WithJSONLogs(), WithQuiet()).warnPlatform(mismatch)
+
+	if buf.Len() != 0 {
+		t.Fatalf("warning was logged below the log level: %q", buf)
+	}
+}
@@ -0,0 +1,88 @@
+package duct
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Policy is a rule the containers of a manifest must follow, e.g. about the
+// images they use. It is given each container that is not built or External,
+// with its Image rewritten by WithRegistryMirror, and returns an error
+// describing how the container breaks the rule. See WithPolicies.
+type Policy func(cont *Container) error
+
+// WithPolicies makes Manifest.Validate, and so Launch, fail for containers
+// that break any of the policies. Images with variables are checked once
+// they are interpolated, when the container is created.
+func WithPolicies(policies ...Policy) Options {
+	return Options{optionPolicies: policies}
+}
+
+// NoFloatingTags is a Policy that forbids images without a tag, or with the
+// "latest" tag, so that images only change when the manifest does. Images
+// pinned by digest are allowed.
+func NoFloatingTags() Policy {
+	return func(cont *Container) error {
+		if strings.Contains(cont.Image, "@") {
+			return nil
+		}
+
+		tag := imageTag(cont.Image)
+		if tag == "" || tag == "latest" {
+			return fmt.Errorf("image %s has a floating tag; pin a version or digest", cont.Image)
+		}
+
+		return nil
+	}
+}
+
+// AllowRegistries is a Policy that only allows images from the registries,
+// e.g. "ghcr.io" or "registry.corp:5000". Images without a registry are
+// from "docker.io".
+func AllowRegistries(registries ...string) Policy {
+	return func(cont *Container) error {
+		registry := imageRegistry(cont.Image)
+		for _, allowed := range registries {
+			if registry == allowed {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("image %s is from registry %s, which is not one of %s", cont.Image, registry, strings.Join(registries, ", "))
+	}
+}
+
+// policyViolations describes how the container breaks the policies.
+func policyViolations(opts Options, cont *Container) []string {
+	policies, _ := opts[optionPolicies].([]Policy)
+	if cont.Build != nil || cont.External {
+		return nil
+	}
+
+	violations := []string{}
+	for _, policy := range policies {
+		if err := policy(cont); err != nil {
+			violations = append(violations, fmt.Sprintf("[%s] %v", cont.Name, err))
+		}
+	}
+
+	return violations
+}
+
+// imageRegistry returns the registry of the image.
+func imageRegistry(image string) string {
+	qualified := qualifyImage(image)
+	return qualified[:strings.IndexByte(qualified, '/')]
+}
+
+// imageTag returns the tag of the image, or "" if it has none.
+func imageTag(image string) string {
+	image, _, _ = strings.Cut(image, "@")
+
+	i := strings.LastIndexByte(image, ':')
+	if i < 0 || strings.Contains(image[i:], "/") {
+		return ""
+	}
+
+	return image[i+1:]
+}
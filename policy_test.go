@@ -0,0 +1,64 @@
+package duct
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPolicies(t *testing.T) {
+	floating := NoFloatingTags()
+	for image, ok := range map[string]bool{
+		"postgres":                   false,
+		"postgres:latest":            false,
+		"localhost:5000/app":         false,
+		"postgres:15":                true,
+		"localhost:5000/app:1.2":     true,
+		"postgres@sha256:0123456789": true,
+	} {
+		if err := floating(&Container{Image: image}); (err == nil) != ok {
+			t.Errorf("%s: unexpected result of NoFloatingTags: %v", image, err)
+		}
+	}
+
+	registries := AllowRegistries("docker.io", "registry.corp:5000")
+	for image, ok := range map[string]bool{
+		"postgres:15":                true,
+		"bitnami/redis:7":            true,
+		"registry.corp:5000/app:1.0": true,
+		"ghcr.io/org/app:1.0":        false,
+	} {
+		if err := registries(&Container{Image: image}); (err == nil) != ok {
+			t.Errorf("%s: unexpected result of AllowRegistries: %v", image, err)
+		}
+	}
+}
+
+func TestValidatePolicies(t *testing.T) {
+	m := Manifest{
+		{Name: "db", Image: "postgres"},
+		{Name: "app", Image: "app", Build: &Build{Context: "."}},
+		{Name: "cache", Image: "redis:${REDIS_VERSION}"},
+		{Name: "queue", Image: "nats:2"},
+	}
+
+	err := m.Validate(WithPolicies(NoFloatingTags(), AllowRegistries("mirror.corp")), WithRegistryMirror(map[string]string{"docker.io/library/nats": "mirror.corp/nats"}))
+	if err == nil {
+		t.Fatal("manifest breaking the policies was valid")
+	}
+
+	msg := err.Error()
+	for _, expected := range []string{
+		"[db] image postgres has a floating tag",
+		"[db] image postgres is from registry docker.io",
+	} {
+		if !strings.Contains(msg, expected) {
+			t.Errorf("error %q does not contain %q", msg, expected)
+		}
+	}
+
+	for _, name := range []string{"[app]", "[cache]", "[queue]"} {
+		if strings.Contains(msg, name) {
+			t.Errorf("error %q is about %s", msg, name)
+		}
+	}
+}
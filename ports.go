@@ -0,0 +1,151 @@
+package duct
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+// PortForward forwards a port on the host to a port of the container.
+type PortForward struct {
+	// HostIP is the host address to bind to. The default is the one given
+	// with WithHostIP, or 0.0.0.0.
+	HostIP string
+	// HostPort is the port on the host; if it is 0, docker picks a free one.
+	HostPort int
+	// ContainerPort is the port in the container.
+	ContainerPort int
+	// Protocol is "tcp", the default, or "udp".
+	Protocol string
+	// Count forwards a range of this many consecutive ports, starting at
+	// HostPort and ContainerPort, e.g. for passive FTP. If HostPort is 0,
+	// each port in the range gets a free host port of its own.
+	Count int
+}
+
+// WithHostIP sets the host address port forwards bind to by default, instead
+// of 0.0.0.0. Use "127.0.0.1" to keep forwarded ports off the network.
+func WithHostIP(ip string) Options {
+	return Options{optionHostIP: ip}
+}
+
+// count is the number of ports forwarded.
+func (forward PortForward) count() int {
+	if forward.Count < 1 {
+		return 1
+	}
+
+	return forward.Count
+}
+
+// forwards returns all of the container's port forwards.
+func (cont *Container) forwards() []PortForward {
+	forwards := []PortForward{}
+
+	for from, to := range cont.PortForwards {
+		forwards = append(forwards, PortForward{HostPort: from, ContainerPort: to})
+	}
+
+	return append(forwards, cont.Ports...)
+}
+
+// hostPorts returns the fixed host ports the container forwards, as
+// "port/protocol".
+func (cont *Container) hostPorts() []string {
+	ports := []string{}
+
+	for _, forward := range cont.forwards() {
+		if forward.HostPort == 0 {
+			continue
+		}
+
+		protocol := forward.Protocol
+		if protocol == "" {
+			protocol = "tcp"
+		}
+
+		for i := 0; i < forward.count(); i++ {
+			ports = append(ports, fmt.Sprintf("%d/%s", forward.HostPort+i, protocol))
+		}
+	}
+
+	return ports
+}
+
+// portBindings returns the exposed ports and port bindings for the
+// container.
+func (c *Composer) portBindings(cont *Container) (map[dc.Port]struct{}, map[dc.Port][]dc.PortBinding) {
+	exposed := map[dc.Port]struct{}{}
+	bindings := map[dc.Port][]dc.PortBinding{}
+
+	defaultIP, _ := c.options[optionHostIP].(string)
+	if defaultIP == "" {
+		defaultIP = "0.0.0.0"
+	}
+
+	for _, forward := range cont.forwards() {
+		protocol := forward.Protocol
+		if protocol == "" {
+			protocol = "tcp"
+		}
+
+		hostIP := forward.HostIP
+		if hostIP == "" {
+			hostIP = defaultIP
+		}
+
+		for i := 0; i < forward.count(); i++ {
+			hostPort := ""
+			if forward.HostPort != 0 {
+				hostPort = fmt.Sprint(forward.HostPort + i)
+			}
+
+			port := dc.Port(fmt.Sprintf("%d/%s", forward.ContainerPort+i, protocol))
+			exposed[port] = struct{}{}
+			bindings[port] = append(bindings[port], dc.PortBinding{
+				HostIP:   hostIP,
+				HostPort: hostPort,
+			})
+		}
+	}
+
+	return exposed, bindings
+}
+
+// hostBinding returns the host binding of the container's port.
+func (c *Composer) hostBinding(ctx context.Context, cont *Container, port int, protocol string) (dc.PortBinding, error) {
+	ctr, err := c.client.InspectContainerWithOptions(dc.InspectContainerOptions{ID: cont.id, Context: ctx})
+	if err != nil {
+		return dc.PortBinding{}, err
+	}
+
+	bindings := ctr.NetworkSettings.Ports[dc.Port(fmt.Sprintf("%d/%s", port, protocol))]
+	if len(bindings) == 0 {
+		return dc.PortBinding{}, fmt.Errorf("[%s] port %d/%s is not forwarded to the host", cont.Name, port, protocol)
+	}
+
+	return bindings[0], nil
+}
+
+// HostPort returns the host port forwarded to the port of the named
+// container, e.g. one picked by docker for PublishAllPorts or a PortForward
+// without a HostPort. The protocol is "tcp" if empty.
+func (c *Composer) HostPort(ctx context.Context, name string, port int, protocol string) (int, error) {
+	cont, err := c.find(name)
+	if err != nil {
+		return 0, err
+	}
+
+	if protocol == "" {
+		protocol = "tcp"
+	}
+
+	binding, err := c.hostBinding(ctx, cont, port, protocol)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(binding.HostPort)
+}
@@ -0,0 +1,77 @@
+package duct
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+func TestPortBindings(t *testing.T) {
+	cont := &Container{
+		Name:         "web",
+		PortForwards: map[int]int{8080: 80},
+		Ports: []PortForward{
+			{HostIP: "192.0.2.1", HostPort: 8443, ContainerPort: 443},
+			{HostPort: 5353, ContainerPort: 53, Protocol: "udp"},
+			{ContainerPort: 9000},
+		},
+	}
+
+	exposed, bindings := New(Manifest{}).portBindings(cont)
+
+	expected := map[dc.Port][]dc.PortBinding{
+		"80/tcp":   {{HostIP: "0.0.0.0", HostPort: "8080"}},
+		"443/tcp":  {{HostIP: "192.0.2.1", HostPort: "8443"}},
+		"53/udp":   {{HostIP: "0.0.0.0", HostPort: "5353"}},
+		"9000/tcp": {{HostIP: "0.0.0.0", HostPort: ""}},
+	}
+
+	if !reflect.DeepEqual(bindings, expected) {
+		t.Fatalf("unexpected bindings: %v", bindings)
+	}
+
+	if len(exposed) != len(expected) {
+		t.Fatalf("unexpected exposed ports: %v", exposed)
+	}
+
+	_, bindings = New(Manifest{}, WithHostIP("127.0.0.1")).portBindings(cont)
+
+	if binding := bindings["80/tcp"][0]; binding.HostIP != "127.0.0.1" {
+		t.Fatalf("default host ip was not used: %v", binding)
+	}
+
+	if binding := bindings["443/tcp"][0]; binding.HostIP != "192.0.2.1" {
+		t.Fatalf("host ip of the port forward was not used: %v", binding)
+	}
+}
+
+func TestPortRanges(t *testing.T) {
+	cont := &Container{
+		Name:  "ftp",
+		Ports: []PortForward{{HostPort: 30000, ContainerPort: 21000, Count: 3}},
+	}
+
+	_, bindings := New(Manifest{}).portBindings(cont)
+
+	if len(bindings) != 3 {
+		t.Fatalf("unexpected bindings: %v", bindings)
+	}
+
+	for i := 0; i < 3; i++ {
+		port := dc.Port(fmt.Sprintf("%d/tcp", 21000+i))
+		if binding := bindings[port]; len(binding) != 1 || binding[0].HostPort != fmt.Sprint(30000+i) {
+			t.Fatalf("unexpected binding for %s: %v", port, binding)
+		}
+	}
+
+	c := New(Manifest{{Name: "ftp", Ports: cont.Ports, Replicas: 2}})
+	if port := c.manifest[1].Ports[0].HostPort; port != 30003 {
+		t.Fatalf("second replica's range did not follow the first: %d", port)
+	}
+
+	if _, err := (Manifest{cont}).Merge(Manifest{{Name: "other", PortForwards: map[int]int{30002: 80}}}); err == nil {
+		t.Fatal("merged manifests with overlapping port ranges")
+	}
+}
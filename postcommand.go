@@ -0,0 +1,295 @@
+package duct
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+// PostCommand is a command run in the container after it is ready, with more
+// control than PostCommands.
+type PostCommand struct {
+	// Command is the argv of the command, or Shell a command line run with
+	// /bin/sh -c. The environment of Shell has the variables
+	// DUCT_<NAME>_IP, the address of each launched container on the
+	// network, DUCT_<NAME>_PORT, its first container port, and
+	// DUCT_<NAME>_PORTS, all of them, where NAME is the container's name in
+	// upper case with other characters than letters and digits replaced by
+	// underscores, e.g. "nc -z $DUCT_CACHE_IP $DUCT_CACHE_PORT".
+	Command []string
+	Shell   string
+	// Stdin is written to the command's standard input, or the contents of
+	// the host file StdinFile, e.g. a schema for `psql`. Relative paths are
+	// relative to the working directory of the test.
+	Stdin     []byte
+	StdinFile string
+	// StdoutFile is a host file to write the command's standard output to,
+	// instead of the output of the test, e.g. for a dump.
+	StdoutFile string
+
+	// Attempts is how many times the command is run until it succeeds; by
+	// default, once. RetryFor retries it until it succeeds or the duration
+	// elapses instead, e.g. for a setup step that fails until another
+	// service is up. With both, it stops at whichever comes first. Between
+	// attempts, it waits RetryInterval, by default a quarter second, and
+	// twice as long after each one after that, up to two seconds or
+	// RetryInterval if that is longer.
+	Attempts      int
+	RetryFor      time.Duration
+	RetryInterval time.Duration
+	// Timeout bounds each attempt. A command which times out is abandoned,
+	// but docker does not kill it.
+	Timeout time.Duration
+
+	// User is the user, and optionally the group, to run the command as,
+	// e.g. "postgres", instead of the container's user. WorkingDir is the
+	// directory to run it in, and Env is added to the container's
+	// environment. Privileged runs it with extended privileges.
+	User       string
+	WorkingDir string
+	Env        []string
+	Privileged bool
+}
+
+// defaultRetryInterval is the first wait between attempts of a
+// post-command.
+const defaultRetryInterval = 250 * time.Millisecond
+
+// retries is true if the command is run more than once when it fails.
+func (pc PostCommand) retries() bool {
+	return pc.Attempts > 1 || pc.RetryFor > 0
+}
+
+// args returns the argv the command is run with.
+func (pc PostCommand) args() []string {
+	if pc.Shell != "" {
+		return []string{"/bin/sh", "-c", pc.Shell}
+	}
+
+	return pc.Command
+}
+
+// argv returns the command, for logging.
+func (pc PostCommand) argv() string {
+	if pc.Shell != "" {
+		return pc.Shell
+	}
+
+	return strings.Join(pc.Command, " ")
+}
+
+// shellEnv returns the variables of the launched containers for Shell
+// post-commands.
+func (c *Composer) shellEnv(ctx context.Context) ([]string, error) {
+	env := []string{}
+
+	for _, cont := range c.manifest {
+		if cont.id == "" {
+			continue
+		}
+
+		prefix := "DUCT_" + envName(cont.Name) + "_"
+
+		ip, err := c.containerIP(ctx, cont)
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, prefix+"IP="+ip)
+
+		ports := []string{}
+		for _, forward := range cont.forwards() {
+			for i := 0; i < forward.count(); i++ {
+				ports = append(ports, strconv.Itoa(forward.ContainerPort+i))
+			}
+		}
+
+		if len(ports) != 0 {
+			env = append(env, prefix+"PORT="+ports[0], prefix+"PORTS="+strings.Join(ports, " "))
+		}
+	}
+
+	return env, nil
+}
+
+// envName returns the name in upper case, with other characters than
+// letters and digits replaced by underscores.
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+// postCommands returns the PostCommands of the container, followed by its
+// PostRun.
+func (cont *Container) postCommands() []PostCommand {
+	res := []PostCommand{}
+	for _, command := range cont.PostCommands {
+		res = append(res, PostCommand{Command: command})
+	}
+
+	return append(res, cont.PostRun...)
+}
+
+// clone returns a copy of the command that shares nothing mutable with the
+// original.
+func (pc PostCommand) clone() PostCommand {
+	pc.Command = append([]string(nil), pc.Command...)
+	pc.Env = append([]string(nil), pc.Env...)
+	if pc.Stdin != nil {
+		pc.Stdin = append([]byte{}, pc.Stdin...)
+	}
+
+	return pc
+}
+
+// runPostCommand runs the command in the container, retrying it as it
+// declares, and returns the error of the last attempt if none succeeded.
+func (c *Composer) runPostCommand(ctx context.Context, cont *Container, pc PostCommand) error {
+	if !pc.retries() {
+		return c.postCommand(ctx, cont, pc)
+	}
+
+	var deadline <-chan time.Time
+	if pc.RetryFor > 0 {
+		timer := time.NewTimer(pc.RetryFor)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	interval := pc.RetryInterval
+	if interval <= 0 {
+		interval = defaultRetryInterval
+	}
+
+	ceiling := maxRetryInterval
+	if interval > ceiling {
+		ceiling = interval
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := c.postCommand(ctx, cont, pc)
+		if err == nil || ctx.Err() != nil || (pc.Attempts > 0 && attempt >= pc.Attempts) {
+			return err
+		}
+
+		c.logContainer(LogInfo, cont.Name, "Post-command [%s] failed in container: [%s] (attempt %d), retrying: %v", pc.argv(), cont.Name, attempt, err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-deadline:
+			return fmt.Errorf("gave up retrying after %v: %w", pc.RetryFor, err)
+		case <-time.After(interval):
+		}
+
+		if interval *= 2; interval > ceiling {
+			interval = ceiling
+		}
+	}
+}
+
+// postCommand runs the command in the container once, and returns an
+// ExitError if it fails.
+func (c *Composer) postCommand(ctx context.Context, cont *Container, pc PostCommand) error {
+	if pc.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, pc.Timeout)
+		defer cancel()
+	}
+
+	var stdin io.Reader
+	if pc.StdinFile != "" {
+		path, err := hostPath(pc.StdinFile)
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("[%s] post-command stdin: %w", cont.Name, err)
+		}
+		defer f.Close()
+
+		stdin = f
+	} else if pc.Stdin != nil {
+		stdin = bytes.NewReader(pc.Stdin)
+	}
+
+	tail := &tailWriter{max: exitLogLines}
+	stdout := io.MultiWriter(&scrubWriter{c: c, w: os.Stdout}, tail)
+
+	if pc.StdoutFile != "" {
+		path, err := hostPath(pc.StdoutFile)
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("[%s] post-command stdout: %w", cont.Name, err)
+		}
+		defer f.Close()
+
+		stdout = f
+	}
+
+	env := pc.Env
+	if pc.Shell != "" {
+		shellEnv, err := c.shellEnv(ctx)
+		if err != nil {
+			return err
+		}
+		env = mergeEnv(shellEnv, pc.Env)
+	}
+
+	exec, err := c.client.CreateExec(dc.CreateExecOptions{
+		Context:      ctx,
+		Container:    cont.id,
+		Cmd:          cont.traced(pc.args()),
+		Env:          env,
+		User:         pc.User,
+		WorkingDir:   pc.WorkingDir,
+		Privileged:   pc.Privileged,
+		AttachStdin:  stdin != nil,
+		AttachStderr: true,
+		AttachStdout: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = c.client.StartExec(exec.ID, dc.StartExecOptions{
+		InputStream:  stdin,
+		OutputStream: stdout,
+		ErrorStream:  io.MultiWriter(&scrubWriter{c: c, w: os.Stderr}, tail),
+		Context:      ctx,
+	})
+	if err != nil {
+		return err
+	}
+
+	ins, err := c.client.InspectExec(exec.ID)
+	if err != nil {
+		return err
+	}
+
+	if ins.ExitCode != 0 {
+		return c.exitError(ctx, cont, pc.args(), ins.ExitCode, tail.Lines())
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package duct_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/erikh/duct"
+	"github.com/erikh/duct/ductfake"
+)
+
+func TestPostRun(t *testing.T) {
+	r := ductfake.Start(t)
+
+	// the fake daemon does not speak the attached stdin protocol, so only
+	// the output is exercised here
+	dump := filepath.Join(t.TempDir(), "dump.sql")
+
+	r.Launch(t, duct.Manifest{
+		{
+			Name:  "db",
+			Image: "postgres:16",
+			PostRun: []duct.PostCommand{
+				{Command: []string{"pg_dump", "-U", "postgres"}, StdoutFile: dump},
+			},
+		},
+		{
+			Name:      "migrate",
+			Image:     "debian:latest",
+			DependsOn: []string{"db"},
+			PostRun: []duct.PostCommand{
+				{Shell: "nc -z $DUCT_DB_IP 5432"},
+				{Command: []string{"./migrate"}, User: "app", WorkingDir: "/srv", Env: []string{"DSN=postgres://db"}},
+			},
+		},
+	})
+
+	execs := r.Execs()
+	if len(execs) != 3 {
+		t.Fatalf("unexpected execs: %+v", execs)
+	}
+
+	if !reflect.DeepEqual(execs[1].Cmd, []string{"/bin/sh", "-c", "nc -z $DUCT_DB_IP 5432"}) || !strings.HasPrefix(strings.Join(execs[1].Env, " "), "DUCT_DB_IP=") {
+		t.Fatalf("unexpected shell command: %+v", execs[1])
+	}
+
+	if execs[2].User != "app" || execs[2].WorkingDir != "/srv" || !reflect.DeepEqual(execs[2].Env, []string{"DSN=postgres://db"}) {
+		t.Fatalf("post-command options were not passed on: %+v", execs[2])
+	}
+
+	if _, err := os.Stat(dump); err != nil {
+		t.Fatalf("stdout file was not written: %v", err)
+	}
+}
+
+func TestPostRunRetry(t *testing.T) {
+	r := ductfake.Start(t)
+
+	launch := func(command duct.PostCommand) error {
+		c := r.Compose(t, duct.Manifest{
+			{Name: "migrate", Image: "debian:latest", PostRun: []duct.PostCommand{command}},
+		})
+		defer c.Teardown(context.Background())
+
+		return c.Launch(context.Background())
+	}
+
+	r.FailExecs(1, 2)
+	if err := launch(duct.PostCommand{Shell: "nc -z db 5432", Attempts: 3, RetryInterval: 10 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+
+	r.FailExecs(1, 2)
+	var exitErr *duct.ExitError
+	if err := launch(duct.PostCommand{Shell: "nc -z db 5432", Attempts: 2, RetryInterval: 10 * time.Millisecond}); !errors.As(err, &exitErr) || exitErr.ExitCode != 1 {
+		t.Fatalf("unexpected error after the last attempt: %v", err)
+	}
+
+	r.FailExecs(1, 1000)
+	if err := launch(duct.PostCommand{Shell: "nc -z db 5432", RetryFor: 100 * time.Millisecond, RetryInterval: 10 * time.Millisecond}); err == nil || !strings.Contains(err.Error(), "gave up retrying after 100ms") {
+		t.Fatalf("unexpected error after retrying: %v", err)
+	}
+	r.FailExecs(0, 0)
+
+	if err := launch(duct.PostCommand{Shell: "nc -z db 5432", Attempts: 2}); err != nil {
+		t.Fatal(err)
+	}
+}
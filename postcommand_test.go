@@ -0,0 +1,24 @@
+package duct
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPostCommandArgs(t *testing.T) {
+	pc := PostCommand{Shell: "nc -z $DUCT_CACHE_IP $DUCT_CACHE_PORT"}
+	if !reflect.DeepEqual(pc.args(), []string{"/bin/sh", "-c", "nc -z $DUCT_CACHE_IP $DUCT_CACHE_PORT"}) || pc.argv() != pc.Shell {
+		t.Fatalf("unexpected shell command: %v", pc.args())
+	}
+
+	cont := &Container{PostCommands: [][]string{{"true"}}, PostRun: []PostCommand{pc}}
+	if commands := cont.postCommands(); len(commands) != 2 || commands[0].argv() != "true" || commands[1].Shell == "" {
+		t.Fatalf("unexpected post-commands: %+v", commands)
+	}
+
+	for name, expected := range map[string]string{"db": "DB", "web-1": "WEB_1", "my.cache": "MY_CACHE"} {
+		if actual := envName(name); actual != expected {
+			t.Fatalf("unexpected variable name for %s: %s", name, actual)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package duct
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// pullLogInterval is how often the progress of a pull is logged.
+const pullLogInterval = 2 * time.Second
+
+// PullProgress is a report of the daemon on pulling the image of a
+// container.
+type PullProgress struct {
+	// Container is the name of the container in the manifest.
+	Container string
+	// Image is the image being pulled.
+	Image string
+	// Layer is the id of the layer the report is about; it is empty for
+	// reports about the whole image.
+	Layer string
+	// Status is e.g. "Downloading", "Extracting" or "Pull complete".
+	Status string
+	// Current and Total are the bytes of the layer downloaded or extracted
+	// so far, and in all, if they are known.
+	Current int64
+	Total   int64
+}
+
+// WithPullProgress calls fn with every progress report of the daemon while it
+// pulls the images of the containers. fn may be called concurrently for
+// different containers. Without it, the progress is logged every couple of
+// seconds.
+func WithPullProgress(fn func(PullProgress)) Options {
+	return Options{optionPullProgress: fn}
+}
+
+// pullProgress decodes the JSON stream of a pull, and reports the progress
+// in it.
+type pullProgress struct {
+	c     *Composer
+	cont  *Container
+	image string
+	fn    func(PullProgress)
+
+	mu      sync.Mutex
+	buf     []byte
+	layers  map[string]PullProgress
+	order   []string
+	started time.Time
+	logged  time.Time
+}
+
+// newPullProgress returns a writer for the JSON stream of pulling the
+// image of the container.
+func (c *Composer) newPullProgress(cont *Container, image string) *pullProgress {
+	fn, _ := c.options[optionPullProgress].(func(PullProgress))
+
+	return &pullProgress{
+		c:       c,
+		cont:    cont,
+		image:   image,
+		fn:      fn,
+		layers:  map[string]PullProgress{},
+		started: time.Now(),
+		logged:  time.Now(),
+	}
+}
+
+func (p *pullProgress) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.buf = append(p.buf, b...)
+
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		line := bytes.TrimSpace(p.buf[:i])
+		p.buf = p.buf[i+1:]
+
+		if len(line) != 0 {
+			p.report(line)
+		}
+	}
+
+	return len(b), nil
+}
+
+// report handles a message of the stream. Errors in it are also returned by
+// the pull, so they are left to that.
+func (p *pullProgress) report(line []byte) {
+	var msg struct {
+		Status         string `json:"status"`
+		ID             string `json:"id"`
+		ProgressDetail struct {
+			Current int64 `json:"current"`
+			Total   int64 `json:"total"`
+		} `json:"progressDetail"`
+	}
+
+	if err := json.Unmarshal(line, &msg); err != nil || msg.Status == "" {
+		return
+	}
+
+	progress := PullProgress{
+		Container: p.cont.Name,
+		Image:     p.image,
+		Layer:     msg.ID,
+		Status:    msg.Status,
+		Current:   msg.ProgressDetail.Current,
+		Total:     msg.ProgressDetail.Total,
+	}
+
+	// the id of messages about the whole image is its tag
+	if msg.ProgressDetail.Total != 0 || layerStatus(msg.Status) {
+		if _, ok := p.layers[msg.ID]; !ok {
+			p.order = append(p.order, msg.ID)
+		}
+		p.layers[msg.ID] = progress
+	} else {
+		progress.Layer = ""
+	}
+
+	if p.fn != nil {
+		p.fn(progress)
+		return
+	}
+
+	if time.Since(p.logged) >= pullLogInterval {
+		p.logged = time.Now()
+		p.c.logf(LogInfo, "Pulling docker image: [%s] %s (%v)", p.image, p.summary(), time.Since(p.started).Round(time.Second))
+	}
+}
+
+// layerStatus is true for the statuses of messages about a layer.
+func layerStatus(status string) bool {
+	switch status {
+	case "Pulling fs layer", "Waiting", "Downloading", "Verifying Checksum", "Download complete", "Extracting", "Pull complete", "Already exists":
+		return true
+	}
+
+	return false
+}
+
+// summary describes the progress of all layers.
+func (p *pullProgress) summary() string {
+	var done int
+	var current, total int64
+
+	for _, id := range p.order {
+		layer := p.layers[id]
+		switch layer.Status {
+		case "Pull complete", "Already exists":
+			done++
+		case "Downloading":
+			current += layer.Current
+			total += layer.Total
+		}
+	}
+
+	summary := fmt.Sprintf("%d of %d layers done", done, len(p.order))
+	if total != 0 {
+		summary += fmt.Sprintf(", downloading %.1f of %.1f MB", float64(current)/1e6, float64(total)/1e6)
+	}
+
+	return summary
+}
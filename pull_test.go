@@ -0,0 +1,40 @@
+package duct
+
+import (
+	"testing"
+)
+
+func TestPullProgress(t *testing.T) {
+	reports := []PullProgress{}
+	c := New(Manifest{}, WithPullProgress(func(p PullProgress) { reports = append(reports, p) }))
+
+	p := c.newPullProgress(&Container{Name: "db"}, "postgres:latest")
+	stream := `{"status":"Pulling from library/postgres","id":"latest"}` + "\r\n" +
+		`{"status":"Pulling fs layer","progressDetail":{},"id":"a1"}` + "\r\n" +
+		`{"status":"Downloading","progressDetail":{"current":50,"total":100},"id":"a1"}` + "\r\n" +
+		`{"status":"Pull complete","progressDetail":{},"id":"a1"}` + "\r\n" +
+		`{"status":"Downloading","progressDetail":{"current":1000000,"total":4000000},"id":"b2"}` + "\r\n"
+
+	// split the stream mid-message, as the daemon may
+	for _, chunk := range []string{stream[:30], stream[30:]} {
+		if _, err := p.Write([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(reports) != 5 {
+		t.Fatalf("unexpected reports: %+v", reports)
+	}
+
+	if reports[0].Layer != "" || reports[0].Container != "db" || reports[0].Image != "postgres:latest" {
+		t.Fatalf("unexpected image report: %+v", reports[0])
+	}
+
+	if r := reports[2]; r.Layer != "a1" || r.Status != "Downloading" || r.Current != 50 || r.Total != 100 {
+		t.Fatalf("unexpected layer report: %+v", r)
+	}
+
+	if summary := p.summary(); summary != "1 of 2 layers done, downloading 1.0 of 4.0 MB" {
+		t.Fatalf("unexpected summary: %q", summary)
+	}
+}
@@ -0,0 +1,49 @@
+package duct
+
+import (
+	"context"
+	"fmt"
+)
+
+// WaitReady runs the readiness checks of the named containers again, or of
+// all of them if no names are given, e.g. after they were restarted or
+// disrupted mid-test. The names of replicated containers include all of
+// their replicas. Containers with WaitForExit set are skipped.
+func (c *Composer) WaitReady(ctx context.Context, names ...string) error {
+	conts := []*Container{}
+
+	if len(names) == 0 {
+		conts = append(conts, c.manifest...)
+	}
+
+	for _, name := range names {
+		replicas := c.Replicas(name)
+		if len(replicas) == 0 {
+			return fmt.Errorf("container [%s] is not in the manifest", name)
+		}
+
+		for _, replica := range replicas {
+			cont, err := c.find(replica)
+			if err != nil {
+				return err
+			}
+			conts = append(conts, cont)
+		}
+	}
+
+	for _, cont := range conts {
+		if cont.WaitForExit {
+			continue
+		}
+
+		if cont.id == "" {
+			return fmt.Errorf("container [%s] has not been launched", cont.Name)
+		}
+
+		if err := c.waitReady(ctx, cont); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package duct_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/erikh/duct"
+	"github.com/erikh/duct/ductfake"
+)
+
+func TestReadyFunc(t *testing.T) {
+	r := ductfake.Start(t)
+
+	var info *duct.ContainerInfo
+
+	r.Launch(t, duct.Manifest{
+		{
+			Name:         "nginx",
+			Image:        "nginx:latest",
+			PortForwards: map[int]int{8000: 80},
+			ReadyFunc: func(ctx context.Context, i *duct.ContainerInfo) error {
+				info = i
+				return nil
+			},
+		},
+	})
+
+	if info == nil || info.Name != "nginx" || info.ID == "" || info.Inspect == nil {
+		t.Fatalf("unexpected container info: %+v", info)
+	}
+
+	if info.HostPorts["80/tcp"] != 8000 {
+		t.Fatalf("unexpected host ports: %v", info.HostPorts)
+	}
+
+	if addr, err := info.Endpoint(80); err != nil || !strings.HasSuffix(addr, ":8000") {
+		t.Fatalf("unexpected endpoint %q: %v", addr, err)
+	}
+}
+
+func TestWaitReady(t *testing.T) {
+	r := ductfake.Start(t)
+
+	checks := map[string]int{}
+	ready := func(ctx context.Context, info *duct.ContainerInfo) error {
+		checks[info.Name]++
+		return nil
+	}
+
+	c := r.Launch(t, duct.Manifest{
+		{Name: "db", Image: "postgres:latest", ReadyFunc: ready},
+		{Name: "web", Image: "nginx:latest", Replicas: 2, ReadyFunc: ready},
+	})
+
+	if err := c.WaitReady(context.Background(), "web"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(checks, map[string]int{"db": 1, "web-1": 2, "web-2": 2}) {
+		t.Fatalf("unexpected readiness checks: %v", checks)
+	}
+
+	if err := c.WaitReady(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if checks["db"] != 2 {
+		t.Fatalf("unexpected readiness checks: %v", checks)
+	}
+
+	if err := c.WaitReady(context.Background(), "missing"); err == nil {
+		t.Fatal("no error for a missing container")
+	}
+}
@@ -0,0 +1,190 @@
+package duct
+
+import (
+	"context"
+	"fmt"
+)
+
+// expand returns the manifest with every container that has Replicas set
+// replaced by its replicas.
+func (m Manifest) expand() Manifest {
+	res := Manifest{}
+
+	for _, cont := range m {
+		if cont.Replicas <= 1 {
+			res = append(res, cont)
+			continue
+		}
+
+		for i := 0; i < cont.Replicas; i++ {
+			replica := cont.clone()
+			replica.Name = fmt.Sprintf("%s-%d", cont.Name, i+1)
+			replica.Replicas = 0
+			replica.replicaOf = cont.Name
+
+			replica.PortForwards = map[int]int{}
+			for host, port := range cont.PortForwards {
+				replica.PortForwards[host+i] = port
+			}
+
+			for j, forward := range replica.Ports {
+				if forward.HostPort != 0 {
+					replica.Ports[j].HostPort += i * forward.count()
+				}
+			}
+
+			res = append(res, replica)
+		}
+	}
+
+	return res
+}
+
+// replicated returns the name of the container which the container is a
+// replica of, or its own if it has replicas, or "" if it has neither.
+func (cont *Container) replicated() string {
+	if cont.replicaOf != "" {
+		return cont.replicaOf
+	}
+
+	if cont.Replicas > 1 {
+		return cont.Name
+	}
+
+	return ""
+}
+
+// clone returns a copy of the container description that shares nothing
+// mutable with the original, and none of its launch state.
+func (cont *Container) clone() *Container {
+	n := *cont
+
+	n.Env = append([]string(nil), cont.Env...)
+	n.Command = append([]string(nil), cont.Command...)
+	n.Entrypoint = append([]string(nil), cont.Entrypoint...)
+	n.DependsOn = append([]string(nil), cont.DependsOn...)
+	n.Aliases = append([]string(nil), cont.Aliases...)
+
+	n.PostCommands = nil
+	for _, command := range cont.PostCommands {
+		n.PostCommands = append(n.PostCommands, append([]string(nil), command...))
+	}
+
+	n.PostRun = nil
+	for _, command := range cont.PostRun {
+		n.PostRun = append(n.PostRun, command.clone())
+	}
+
+	n.BindMounts = copyMap(cont.BindMounts)
+	n.Files = copyMap(cont.Files)
+	n.Volumes = copyMap(cont.Volumes)
+	n.CollectArtifacts = copyMap(cont.CollectArtifacts)
+	n.PortForwards = copyMap(cont.PortForwards)
+	n.StorageOpt = copyMap(cont.StorageOpt)
+	n.Tmpfs = copyMap(cont.Tmpfs)
+	n.DeviceReadBps = copyMap(cont.DeviceReadBps)
+	n.DeviceWriteBps = copyMap(cont.DeviceWriteBps)
+	n.DeviceReadIOps = copyMap(cont.DeviceReadIOps)
+	n.DeviceWriteIOps = copyMap(cont.DeviceWriteIOps)
+	n.Ports = append([]PortForward(nil), cont.Ports...)
+
+	if cont.Build != nil {
+		build := *cont.Build
+		n.Build = &build
+	}
+
+	if cont.Auth != nil {
+		auth := *cont.Auth
+		n.Auth = &auth
+	}
+
+	if cont.MemorySwappiness != nil {
+		swappiness := *cont.MemorySwappiness
+		n.MemorySwappiness = &swappiness
+	}
+
+	if cont.LogConfig != nil {
+		config := *cont.LogConfig
+		config.Options = copyMap(cont.LogConfig.Options)
+		n.LogConfig = &config
+	}
+
+	if cont.ExtraHosts != nil {
+		n.ExtraHosts = map[string][]string{}
+		for ip, names := range cont.ExtraHosts {
+			n.ExtraHosts[ip] = append([]string(nil), names...)
+		}
+	}
+
+	n.id = ""
+	n.exitCode = nil
+	n.restarts = 0
+	n.tempDirs = nil
+	n.hostsFile = ""
+	n.fakeTime = ""
+
+	return &n
+}
+
+func copyMap[K comparable, V any](m map[K]V) map[K]V {
+	if m == nil {
+		return nil
+	}
+
+	res := make(map[K]V, len(m))
+	for k, v := range m {
+		res[k] = v
+	}
+
+	return res
+}
+
+// aliases are the names the container is reachable by on the network.
+func (cont *Container) aliases() []string {
+	aliases := []string{cont.Name}
+	if cont.replicaOf != "" {
+		aliases = append(aliases, cont.replicaOf)
+	}
+
+	return append(aliases, cont.Aliases...)
+}
+
+// Replicas returns the names of the launched replicas of the named container,
+// or just the name if it is not replicated.
+func (c *Composer) Replicas(name string) []string {
+	names := []string{}
+
+	for _, cont := range c.manifest {
+		if cont.Name == name || cont.replicaOf == name {
+			names = append(names, cont.Name)
+		}
+	}
+
+	return names
+}
+
+// HostAddrs returns the host addresses forwarded to the tcp port of each
+// replica of the named container, in order.
+func (c *Composer) HostAddrs(ctx context.Context, name string, port int) ([]string, error) {
+	names := c.Replicas(name)
+	if len(names) == 0 {
+		return nil, fmt.Errorf("container [%s] is not in the manifest", name)
+	}
+
+	addrs := []string{}
+	for _, replica := range names {
+		cont, err := c.find(replica)
+		if err != nil {
+			return nil, err
+		}
+
+		addr, err := c.hostAddr(ctx, cont, port)
+		if err != nil {
+			return nil, err
+		}
+
+		addrs = append(addrs, addr)
+	}
+
+	return addrs, nil
+}
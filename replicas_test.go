@@ -0,0 +1,40 @@
+package duct
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReplicas(t *testing.T) {
+	c := New(Manifest{
+		{
+			Name:         "etcd",
+			Image:        "quay.io/coreos/etcd",
+			Replicas:     3,
+			PortForwards: map[int]int{2379: 2379},
+			Aliases:      []string{"etcd-cluster"},
+		},
+		{
+			Name:  "client",
+			Image: "debian:latest",
+		},
+	})
+
+	if names := c.Replicas("etcd"); !reflect.DeepEqual(names, []string{"etcd-1", "etcd-2", "etcd-3"}) {
+		t.Fatalf("unexpected replicas: %v", names)
+	}
+
+	if names := c.Replicas("client"); !reflect.DeepEqual(names, []string{"client"}) {
+		t.Fatalf("unexpected replicas: %v", names)
+	}
+
+	for i, cont := range c.manifest[:3] {
+		if _, ok := cont.PortForwards[2379+i]; !ok {
+			t.Fatalf("replica %s did not get an offset host port: %v", cont.Name, cont.PortForwards)
+		}
+
+		if !reflect.DeepEqual(cont.aliases(), []string{cont.Name, "etcd", "etcd-cluster"}) {
+			t.Fatalf("unexpected aliases for %s: %v", cont.Name, cont.aliases())
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package duct
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// WithParallelism launches up to n containers at a time. Each container waits
+// only for the containers in its DependsOn, and those it takes VolumesFrom or
+// namespaces from, to be ready, instead of for every container before it in
+// the manifest.
+func WithParallelism(n int) Options {
+	return Options{optionParallelism: n}
+}
+
+// parallelism is the number of containers to launch at a time.
+func (c *Composer) parallelism() int {
+	if n, ok := c.options[optionParallelism].(int); ok && n > 0 {
+		return n
+	}
+
+	return 1
+}
+
+// dependencies returns the containers which must be ready before the i'th
+// container in the manifest is started.
+func (c *Composer) dependencies(i int) []*Container {
+	if c.options[optionParallelism] == nil {
+		if i == 0 {
+			return nil
+		}
+
+		return []*Container{c.manifest[i-1]}
+	}
+
+	cont := c.manifest[i]
+
+	names := append([]string(nil), cont.DependsOn...)
+	names = append(names, cont.volumesFrom()...)
+	names = append(names, cont.namespacesFrom()...)
+
+	return c.earlier(i, names)
+}
+
+// creationDependencies returns the containers which must be created before
+// the i'th container in the manifest is.
+func (c *Composer) creationDependencies(i int) []*Container {
+	if c.options[optionParallelism] == nil {
+		if i == 0 {
+			return nil
+		}
+
+		return []*Container{c.manifest[i-1]}
+	}
+
+	cont := c.manifest[i]
+
+	return c.earlier(i, append(cont.volumesFrom(), cont.namespacesFrom()...))
+}
+
+// earlier returns the containers before the i'th in the manifest with the
+// names, including replicas of them.
+func (c *Composer) earlier(i int, names []string) []*Container {
+	res := []*Container{}
+	for _, name := range names {
+		for _, cont := range c.manifest[:i] {
+			if cont.Name == name || cont.replicaOf == name {
+				res = append(res, cont)
+			}
+		}
+	}
+
+	return res
+}
+
+// volumesFrom returns the names of the containers the container takes
+// VolumesFrom.
+func (cont *Container) volumesFrom() []string {
+	names := []string{}
+	for _, from := range cont.VolumesFrom {
+		names = append(names, strings.SplitN(from, ":", 2)[0])
+	}
+
+	return names
+}
+
+// namespacesFrom returns the names of the containers the container shares
+// namespaces with.
+func (cont *Container) namespacesFrom() []string {
+	names := []string{}
+	for _, mode := range []string{cont.PidMode, cont.IpcMode, cont.UTSMode} {
+		if name := strings.TrimPrefix(mode, "container:"); name != mode {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// launchContainers creates and starts the containers in the manifest. The two
+// are pipelined: containers are pulled and created as soon as they can be,
+// while earlier ones boot and become ready, and each is started once it is
+// created and its dependencies are ready, which closes its channel in ready;
+// missing channels are made. It returns the first error, after the launches
+// in progress have stopped.
+func (c *Composer) launchContainers(ctx context.Context, ready map[*Container]chan struct{}) error {
+	launchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if ready == nil {
+		ready = map[*Container]chan struct{}{}
+	}
+
+	created := map[*Container]chan struct{}{}
+	for _, cont := range c.manifest {
+		created[cont] = make(chan struct{})
+		if ready[cont] == nil {
+			ready[cont] = make(chan struct{})
+		}
+	}
+
+	creating := make(chan struct{}, c.parallelism())
+	starting := make(chan struct{}, c.parallelism())
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+
+	// stage waits for the dependencies and a slot, runs fn, and closes done if
+	// it succeeded.
+	stage := func(deps []<-chan struct{}, slots chan struct{}, done chan struct{}, fn func() error) {
+		defer wg.Done()
+
+		for _, dep := range deps {
+			select {
+			case <-dep:
+			case <-launchCtx.Done():
+				return
+			}
+		}
+
+		select {
+		case slots <- struct{}{}:
+		case <-launchCtx.Done():
+			return
+		}
+
+		err := fn()
+		<-slots
+
+		if err != nil {
+			errOnce.Do(func() {
+				firstErr = err
+				cancel()
+			})
+			return
+		}
+
+		close(done)
+	}
+
+	for i, cont := range c.manifest {
+		cont := cont
+
+		createDeps := []<-chan struct{}{}
+		for _, dep := range c.creationDependencies(i) {
+			createDeps = append(createDeps, created[dep])
+		}
+
+		startDeps := []<-chan struct{}{created[cont]}
+		for _, dep := range c.dependencies(i) {
+			startDeps = append(startDeps, ready[dep])
+		}
+
+		wg.Add(2)
+		go stage(createDeps, creating, created[cont], func() error { return c.createContainer(launchCtx, cont) })
+		go stage(startDeps, starting, ready[cont], func() error { return c.startContainer(launchCtx, cont) })
+	}
+
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+
+	return ctx.Err()
+}
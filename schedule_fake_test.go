@@ -0,0 +1,69 @@
+package duct_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/erikh/duct"
+	"github.com/erikh/duct/ductfake"
+)
+
+func TestParallelism(t *testing.T) {
+	r := ductfake.Start(t)
+
+	m := duct.Manifest{}
+	for _, name := range []string{"one", "two", "three"} {
+		m = append(m, &duct.Container{Name: name, Image: "nginx:latest", BootWait: 500 * time.Millisecond})
+	}
+	m = append(m, &duct.Container{Name: "last", Image: "nginx:latest", DependsOn: []string{"one", "two", "three"}})
+
+	before := time.Now()
+	r.Launch(t, m, duct.WithParallelism(3))
+
+	if elapsed := time.Since(before); elapsed >= 1500*time.Millisecond {
+		t.Fatalf("containers were not launched in parallel: %v", elapsed)
+	}
+
+	last, err := r.Container("last")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"one", "two", "three"} {
+		ctr, err := r.Container(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if last.State.StartedAt.Before(ctr.State.StartedAt.Add(500 * time.Millisecond)) {
+			t.Fatalf("[last] started before [%s] was ready", name)
+		}
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	r := ductfake.Start(t)
+
+	r.Launch(t, duct.Manifest{
+		{Name: "first", Image: "nginx:latest", BootWait: 500 * time.Millisecond},
+		{Name: "second", Image: "nginx:latest"},
+	})
+
+	first, err := r.Container("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := r.Container("second")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !second.Created.Before(first.State.StartedAt.Add(500 * time.Millisecond)) {
+		t.Fatal("[second] was not created while [first] was booting")
+	}
+
+	if second.State.StartedAt.Before(first.State.StartedAt.Add(500 * time.Millisecond)) {
+		t.Fatal("[second] was started before [first] was ready")
+	}
+}
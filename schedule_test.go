@@ -0,0 +1,54 @@
+package duct
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDependencies(t *testing.T) {
+	m := Manifest{
+		{Name: "db"},
+		{Name: "cache"},
+		{Name: "web", Replicas: 2, DependsOn: []string{"db"}},
+		{Name: "proxy", DependsOn: []string{"web"}, VolumesFrom: []string{"cache:ro"}},
+		{Name: "debug", PidMode: "container:proxy"},
+	}
+
+	deps := func(c *Composer) map[string][]string {
+		res := map[string][]string{}
+		for i, cont := range c.manifest {
+			names := []string{}
+			for _, dep := range c.dependencies(i) {
+				names = append(names, dep.Name)
+			}
+			res[cont.Name] = names
+		}
+		return res
+	}
+
+	sequential := map[string][]string{
+		"db":    {},
+		"cache": {"db"},
+		"web-1": {"cache"},
+		"web-2": {"web-1"},
+		"proxy": {"web-2"},
+		"debug": {"proxy"},
+	}
+
+	if d := deps(New(m)); !reflect.DeepEqual(d, sequential) {
+		t.Fatalf("unexpected sequential dependencies: %v", d)
+	}
+
+	parallel := map[string][]string{
+		"db":    {},
+		"cache": {},
+		"web-1": {"db"},
+		"web-2": {"db"},
+		"proxy": {"web-1", "web-2", "cache"},
+		"debug": {"proxy"},
+	}
+
+	if d := deps(New(m, WithParallelism(4))); !reflect.DeepEqual(d, parallel) {
+		t.Fatalf("unexpected parallel dependencies: %v", d)
+	}
+}
@@ -0,0 +1,147 @@
+package duct
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// Secret is sensitive content, such as a TLS key or API token, provided to a
+// container as a file with restrictive permissions instead of through a bind
+// mount or Env. Its content is scrubbed from container output duct logs or
+// returns.
+type Secret struct {
+	// Name identifies the secret; it is the file name in the default Target.
+	Name string
+	// Content is the secret. If it is empty, it is read from HostPath.
+	Content  []byte
+	HostPath string
+	// Target is the path of the file in the container; the default is
+	// /run/secrets/<Name>.
+	Target string
+	// Mode is the permissions of the file; the default is 0400.
+	Mode os.FileMode
+	// UID and GID own the file; the default is root. Set these to the user the
+	// container runs as if it is not root.
+	UID int
+	GID int
+	// Env, if set, is the name of an environment variable set to the path of
+	// the file, e.g. "API_TOKEN_FILE".
+	Env string
+}
+
+// secretMask replaces secrets in output.
+const secretMask = "********"
+
+// secretFiles returns the files for the container's secrets, and the
+// environment variables pointing at them.
+func (cont *Container) secretFiles() (map[string]FileContent, []string, error) {
+	files := map[string]FileContent{}
+	env := []string{}
+
+	for _, secret := range cont.Secrets {
+		content, err := secret.content()
+		if err != nil {
+			return nil, nil, fmt.Errorf("[%s] %w", cont.Name, err)
+		}
+
+		target := secret.Target
+		if target == "" {
+			target = path.Join("/run/secrets", secret.Name)
+		}
+
+		mode := secret.Mode
+		if mode == 0 {
+			mode = 0400
+		}
+
+		files[target] = FileContent{Content: content, Mode: mode, UID: secret.UID, GID: secret.GID}
+
+		if secret.Env != "" {
+			env = append(env, secret.Env+"="+target)
+		}
+	}
+
+	return files, env, nil
+}
+
+func (s Secret) content() ([]byte, error) {
+	if len(s.Content) != 0 || s.HostPath == "" {
+		return s.Content, nil
+	}
+
+	content, err := os.ReadFile(s.HostPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading secret %s: %w", s.Name, err)
+	}
+
+	return content, nil
+}
+
+// addSecrets registers the contents of secrets for scrubbing. Output is
+// scrubbed a line or a write at a time, so each line of a secret is registered
+// as well as the whole. Containers are resolved again by Recreate and Watch,
+// so a secret is only registered once.
+func (c *Composer) addSecrets(files map[string]FileContent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, file := range files {
+		content := strings.TrimSpace(string(file.Content))
+
+		for _, secret := range append([]string{content}, strings.Split(content, "\n")...) {
+			if secret = strings.TrimSpace(secret); secret != "" && !c.hasSecret(secret) {
+				c.secrets = append(c.secrets, secret)
+			}
+		}
+	}
+}
+
+// hasSecret is true if the secret is registered. c.mu must be held.
+func (c *Composer) hasSecret(secret string) bool {
+	for _, s := range c.secrets {
+		if s == secret {
+			return true
+		}
+	}
+
+	return false
+}
+
+// scrub replaces the contents of any secret in s.
+func (c *Composer) scrub(s string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, secret := range c.secrets {
+		s = strings.ReplaceAll(s, secret, secretMask)
+	}
+
+	return s
+}
+
+// scrubLines replaces the contents of any secret in the lines.
+func (c *Composer) scrubLines(lines []string) []string {
+	for i := range lines {
+		lines[i] = c.scrub(lines[i])
+	}
+
+	return lines
+}
+
+// scrubWriter replaces secrets in each write to w. Secrets split across
+// writes are not caught.
+type scrubWriter struct {
+	c *Composer
+	w io.Writer
+}
+
+func (sw *scrubWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(sw.w, sw.c.scrub(string(p))); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
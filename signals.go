@@ -0,0 +1,120 @@
+package duct
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// WithOnSignal calls fn before the composition is torn down because of a
+// signal given to HandleSignals, or because the context given to
+// HandleContext is done, in which case the signal is nil. Use it to e.g.
+// collect logs before the containers are gone.
+func WithOnSignal(fn func(os.Signal)) Options {
+	return Options{optionOnSignal: fn}
+}
+
+// HandleSignals tears down the composition when the process receives one of
+// the signals, SIGINT and SIGTERM by default, to ensure that containers get
+// cleaned up. If the forward argument is true, it will forward the signal back
+// to its own process after deregistering itself as the signal handler,
+// allowing your test suite to exit gracefully. Set it to false to stay out of
+// your way.
+//
+// The returned function stops handling the signals; Teardown does so too.
+func (c *Composer) HandleSignals(forward bool, signals ...os.Signal) (stop func()) {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+
+	ctx, cancel := c.signalContext()
+	sigChan := make(chan os.Signal, 2)
+	signal.Notify(sigChan, signals...)
+
+	go func() {
+		defer signal.Stop(sigChan)
+
+		select {
+		case sig := <-sigChan:
+			c.logf(LogInfo, "Signalled; will terminate containers now")
+			c.interrupted(sig)
+			signal.Stop(sigChan) // stop letting us get notified
+			if forward {
+				forwardSignal(sig)
+			}
+		case <-ctx.Done():
+		}
+	}()
+
+	return cancel
+}
+
+// forwardSignal sends the signal to our own process. Windows can only send
+// os.Kill to a process, so the process exits instead there.
+func forwardSignal(sig os.Signal) {
+	p, err := os.FindProcess(os.Getpid())
+	if err == nil {
+		err = p.Signal(sig)
+	}
+
+	if err != nil {
+		logPrintf("Could not forward signal %v; exiting: %v", sig, err)
+		os.Exit(1)
+	}
+}
+
+// HandleContext tears down the composition when ctx is done, e.g. one made
+// with signal.NotifyContext for the signals the rest of the program handles.
+//
+// The returned function stops watching the context; Teardown does so too.
+func (c *Composer) HandleContext(ctx context.Context) (stop func()) {
+	stopCtx, cancel := c.signalContext()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			if stopCtx.Err() != nil {
+				return // stopped before ctx was done
+			}
+			c.logf(LogInfo, "Context done; will terminate containers now")
+			c.interrupted(nil)
+		case <-stopCtx.Done():
+		}
+	}()
+
+	return cancel
+}
+
+// signalContext returns a context which is canceled when the returned
+// function is called, or by Teardown.
+func (c *Composer) signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	c.mu.Lock()
+	c.sigCancel = append(c.sigCancel, cancel)
+	c.mu.Unlock()
+
+	return ctx, cancel
+}
+
+// interrupted runs the WithOnSignal callback and tears down.
+func (c *Composer) interrupted(sig os.Signal) {
+	if fn, ok := c.options[optionOnSignal].(func(os.Signal)); ok {
+		fn(sig)
+	}
+
+	c.Teardown(context.Background())
+}
+
+// stopSignals stops all signal handling.
+func (c *Composer) stopSignals() {
+	c.mu.Lock()
+	cancels := c.sigCancel
+	c.sigCancel = nil
+	c.mu.Unlock()
+
+	for _, cancel := range cancels {
+		cancel()
+	}
+}
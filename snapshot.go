@@ -0,0 +1,54 @@
+package duct
+
+import (
+	"context"
+	"errors"
+
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+// Commit snapshots the filesystem of the named container into an image
+// tagged imageTag, e.g. a database after its migrations and fixtures, so that
+// later compositions can launch it with LocalImage set instead of repeating
+// the setup. The container is paused while it is committed.
+//
+// Volumes are not part of the image, and many database images declare one
+// for their data directory; point the data elsewhere with their environment
+// (e.g. PGDATA for postgres) for it to be committed.
+func (c *Composer) Commit(ctx context.Context, name, imageTag string) error {
+	cont, err := c.find(name)
+	if err != nil {
+		return err
+	}
+
+	repository, tag := dc.ParseRepositoryTag(imageTag)
+
+	c.logf(LogInfo, "Committing container: [%s] to image [%s]", name, imageTag)
+	_, err = c.client.CommitContainer(dc.CommitContainerOptions{
+		Container:  cont.id,
+		Repository: repository,
+		Tag:        tag,
+		Message:    "committed by duct",
+		Context:    ctx,
+	})
+
+	return err
+}
+
+// HasImage returns whether the daemon has the image, e.g. one made with
+// Commit by an earlier composition. It may be called before Launch.
+func (c *Composer) HasImage(ctx context.Context, image string) (bool, error) {
+	client, err := c.newClient()
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := client.InspectImage(image); err != nil {
+		if errors.Is(err, dc.ErrNoSuchImage) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
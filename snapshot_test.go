@@ -0,0 +1,29 @@
+package duct_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/erikh/duct"
+	"github.com/erikh/duct/ductfake"
+)
+
+func TestCommit(t *testing.T) {
+	r := ductfake.Start(t)
+
+	c := r.Launch(t, duct.Manifest{
+		{Name: "db", Image: "postgres:latest"},
+	})
+
+	if err := c.Commit(context.Background(), "db", "seeded-db:v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Client().InspectImage("seeded-db:v1"); err != nil {
+		t.Fatalf("image was not committed: %v", err)
+	}
+
+	if err := c.Commit(context.Background(), "missing", "missing:v1"); err == nil {
+		t.Fatal("no error for a missing container")
+	}
+}
@@ -0,0 +1,227 @@
+package duct
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+// StatsSummary is the resource usage of a container over the samples taken
+// by the sampler enabled with WithStatsSampler.
+type StatsSummary struct {
+	// Samples is the number of samples taken.
+	Samples int
+	// MaxMemory and AvgMemory are the peak and mean memory usage, in bytes.
+	MaxMemory uint64
+	AvgMemory uint64
+	// MaxCPUPercent and AvgCPUPercent are the peak and mean cpu usage, where
+	// 100 is one fully used cpu.
+	MaxCPUPercent float64
+	AvgCPUPercent float64
+	// NetworkRx and NetworkTx are the bytes received and transmitted on all
+	// interfaces as of the last sample.
+	NetworkRx uint64
+	NetworkTx uint64
+
+	totalMemory uint64
+	totalCPU    float64
+}
+
+type statsSampler struct {
+	mu        sync.Mutex
+	summaries map[string]*StatsSummary
+	cancel    context.CancelFunc
+	finished  chan struct{}
+	stopped   bool
+}
+
+// WithStatsSampler samples the resource usage of every container at the
+// interval once the manifest is launched. The summary is logged at Teardown
+// and is available from StatsSummary.
+func WithStatsSampler(interval time.Duration) Options {
+	return Options{optionStatsSampler: interval}
+}
+
+// Stats returns a single sample of the named container's resource usage.
+func (c *Composer) Stats(ctx context.Context, name string) (*dc.Stats, error) {
+	cont, err := c.find(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.stats(ctx, cont)
+}
+
+func (c *Composer) stats(ctx context.Context, cont *Container) (*dc.Stats, error) {
+	statsChan := make(chan *dc.Stats, 1)
+	errChan := make(chan error, 1)
+
+	go func() {
+		errChan <- c.client.Stats(dc.StatsOptions{
+			ID:      cont.id,
+			Stats:   statsChan,
+			Stream:  false,
+			Context: ctx,
+		})
+	}()
+
+	var stats *dc.Stats
+	for s := range statsChan {
+		stats = s
+	}
+
+	if err := <-errChan; err != nil {
+		return nil, err
+	}
+
+	if stats == nil {
+		return nil, errors.New("docker did not return any stats")
+	}
+
+	return stats, nil
+}
+
+// StatsSummary returns the resource usage of each container recorded by the
+// sampler, keyed by container name. It is empty unless WithStatsSampler was
+// given.
+func (c *Composer) StatsSummary() map[string]StatsSummary {
+	res := map[string]StatsSummary{}
+
+	s := c.sampler
+	if s == nil {
+		return res
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name, summary := range s.summaries {
+		res[name] = *summary
+	}
+
+	return res
+}
+
+// startSampler starts sampling all containers at the interval.
+func (c *Composer) startSampler(interval time.Duration) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &statsSampler{
+		summaries: map[string]*StatsSummary{},
+		cancel:    cancel,
+		finished:  make(chan struct{}),
+	}
+	c.sampler = s
+
+	go func() {
+		defer close(s.finished)
+
+		for {
+			var wg sync.WaitGroup
+
+			for _, cont := range c.manifest {
+				if cont.id == "" || cont.WaitForExit {
+					continue
+				}
+
+				wg.Add(1)
+				go func(cont *Container) {
+					defer wg.Done()
+
+					stats, err := c.stats(ctx, cont)
+					if err != nil {
+						if ctx.Err() == nil {
+							c.logContainer(LogWarn, cont.Name, "WARNING: Failed to sample stats for [%s]: %v", cont.Name, err)
+						}
+						return
+					}
+
+					s.record(cont.Name, stats)
+				}(cont)
+			}
+
+			wg.Wait()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+		}
+	}()
+}
+
+// stopSampler stops the sampler and logs the summary.
+func (c *Composer) stopSampler() {
+	s := c.sampler
+	if s == nil || s.stopped {
+		return
+	}
+
+	s.cancel()
+	<-s.finished
+	s.stopped = true
+
+	for _, cont := range c.manifest {
+		if summary, ok := c.StatsSummary()[cont.Name]; ok {
+			c.logf(LogInfo,
+				"Resource usage of [%s]: memory max %d avg %d bytes, cpu max %.1f%% avg %.1f%%, network rx %d tx %d bytes (%d samples)",
+				cont.Name, summary.MaxMemory, summary.AvgMemory, summary.MaxCPUPercent, summary.AvgCPUPercent,
+				summary.NetworkRx, summary.NetworkTx, summary.Samples,
+			)
+		}
+	}
+}
+
+func (s *statsSampler) record(name string, stats *dc.Stats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	summary, ok := s.summaries[name]
+	if !ok {
+		summary = &StatsSummary{}
+		s.summaries[name] = summary
+	}
+
+	cpu := cpuPercent(stats)
+
+	summary.Samples++
+	summary.totalMemory += stats.MemoryStats.Usage
+	summary.totalCPU += cpu
+	summary.AvgMemory = summary.totalMemory / uint64(summary.Samples)
+	summary.AvgCPUPercent = summary.totalCPU / float64(summary.Samples)
+
+	if stats.MemoryStats.Usage > summary.MaxMemory {
+		summary.MaxMemory = stats.MemoryStats.Usage
+	}
+
+	if cpu > summary.MaxCPUPercent {
+		summary.MaxCPUPercent = cpu
+	}
+
+	summary.NetworkRx, summary.NetworkTx = 0, 0
+	for _, net := range stats.Networks {
+		summary.NetworkRx += net.RxBytes
+		summary.NetworkTx += net.TxBytes
+	}
+}
+
+// cpuPercent computes the cpu usage between the two readings in the sample
+// the same way `docker stats` does.
+func cpuPercent(stats *dc.Stats) float64 {
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	sysDelta := float64(stats.CPUStats.SystemCPUUsage) - float64(stats.PreCPUStats.SystemCPUUsage)
+
+	if cpuDelta <= 0 || sysDelta <= 0 {
+		return 0
+	}
+
+	cpus := float64(stats.CPUStats.OnlineCPUs)
+	if cpus == 0 {
+		cpus = float64(len(stats.CPUStats.CPUUsage.PercpuUsage))
+	}
+
+	return cpuDelta / sysDelta * cpus * 100
+}
@@ -0,0 +1,38 @@
+package duct
+
+import (
+	"testing"
+
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+func TestStatsSummary(t *testing.T) {
+	s := &statsSampler{summaries: map[string]*StatsSummary{}}
+
+	for i, usage := range []uint64{100, 300} {
+		stats := &dc.Stats{}
+		stats.MemoryStats.Usage = usage
+		stats.PreCPUStats.CPUUsage.TotalUsage = 1000
+		stats.CPUStats.CPUUsage.TotalUsage = 1000 + uint64(i+1)*100
+		stats.PreCPUStats.SystemCPUUsage = 10000
+		stats.CPUStats.SystemCPUUsage = 11000
+		stats.CPUStats.OnlineCPUs = 2
+		stats.Networks = map[string]dc.NetworkStats{"eth0": {RxBytes: 10, TxBytes: 20}}
+		s.record("test", stats)
+	}
+
+	c := &Composer{sampler: s}
+	summary := c.StatsSummary()["test"]
+
+	if summary.Samples != 2 || summary.MaxMemory != 300 || summary.AvgMemory != 200 {
+		t.Fatalf("unexpected memory summary: %+v", summary)
+	}
+
+	if summary.MaxCPUPercent != 40 || summary.AvgCPUPercent != 30 {
+		t.Fatalf("unexpected cpu summary: %+v", summary)
+	}
+
+	if summary.NetworkRx != 10 || summary.NetworkTx != 20 {
+		t.Fatalf("unexpected network summary: %+v", summary)
+	}
+}
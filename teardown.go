@@ -0,0 +1,141 @@
+package duct
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+// defaultTeardownTimeout is how long Teardown waits for resources to be
+// removed, unless set with WithTeardownTimeout.
+const defaultTeardownTimeout = time.Minute
+
+// networkLabel marks the networks created by duct, for PruneNetworks.
+const networkLabel = "com.github.erikh.duct"
+
+// maxRetryInterval is the longest time between attempts to remove a network.
+const maxRetryInterval = 2 * time.Second
+
+// WithTeardownTimeout sets how long Teardown waits for the containers and the
+// network to be removed. The default is a minute.
+func WithTeardownTimeout(timeout time.Duration) Options {
+	return Options{optionTeardownTimeout: timeout}
+}
+
+// waitRemoved polls inspect, which should look up a removed resource, until
+// it fails because the resource does not exist, or the context is done.
+func waitRemoved(ctx context.Context, inspect func(context.Context) error) error {
+	return waitUntil(ctx, 0, func(ctx context.Context) error {
+		err := inspect(ctx)
+
+		var noContainer *dc.NoSuchContainer
+		var noNetwork *dc.NoSuchNetwork
+		if errors.As(err, &noContainer) || errors.As(err, &noNetwork) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		return errors.New("still exists")
+	})
+}
+
+// removeNetwork removes the network created by Launch, retrying with backoff
+// while containers which were just removed are still attached to it. It
+// returns false if the network could not be removed.
+func (c *Composer) removeNetwork(ctx context.Context, client *dc.Client) bool {
+	if c.options[optionCreateNetwork] == nil || c.netID == "" {
+		return true
+	}
+
+	c.logf(LogInfo, "Removing network: [%s]", c.options[optionCreateNetwork])
+
+	interval := waitInterval
+	err := client.RemoveNetwork(c.netID)
+	for err != nil && strings.Contains(err.Error(), "active endpoints") {
+		select {
+		case <-ctx.Done():
+			c.logf(LogError, "Error removing network: [%s] gave up waiting: %v (last error: %v)", c.options[optionCreateNetwork], ctx.Err(), err)
+			return false
+		case <-time.After(interval):
+		}
+
+		if interval *= 2; interval > maxRetryInterval {
+			interval = maxRetryInterval
+		}
+
+		err = client.RemoveNetwork(c.netID)
+	}
+
+	var notFound *dc.NoSuchNetwork
+	if errors.As(err, &notFound) {
+		err = nil
+	}
+
+	if err == nil {
+		err = waitRemoved(ctx, func(context.Context) error {
+			_, err := client.NetworkInfo(c.netID)
+			return err
+		})
+	}
+
+	if err != nil {
+		c.logf(LogError, "Error removing network: [%s] %v", c.options[optionCreateNetwork], err)
+		return false
+	}
+
+	c.netID = ""
+
+	return true
+}
+
+// PruneNetworks removes the networks duct created which no container is
+// attached to, e.g. those left behind by test runs which were killed before
+// they could tear down. The options select the daemon and the logging like
+// they do for a Composer.
+func PruneNetworks(ctx context.Context, options ...Options) error {
+	c := New(Manifest{}, options...)
+
+	client, err := c.baseClient()
+	if err != nil {
+		return err
+	}
+
+	if err := pingClient(ctx, client); err != nil {
+		return err
+	}
+
+	networks, err := client.FilteredListNetworks(dc.NetworkFilterOpts{"label": {networkLabel: true}})
+	if err != nil {
+		return err
+	}
+
+	failed := []string{}
+	for _, network := range networks {
+		info, err := client.NetworkInfo(network.ID)
+		if err != nil || len(info.Containers) != 0 {
+			continue
+		}
+
+		c.logf(LogInfo, "Removing stale network: [%s]", network.Name)
+		var notFound *dc.NoSuchNetwork
+		if err := client.RemoveNetwork(network.ID); err != nil && !errors.As(err, &notFound) {
+			c.logf(LogError, "Error removing network: [%s] %v", network.Name, err)
+			failed = append(failed, network.Name)
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+
+	if len(failed) != 0 {
+		return fmt.Errorf("could not remove networks: %s", strings.Join(failed, ", "))
+	}
+
+	return nil
+}
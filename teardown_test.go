@@ -0,0 +1,161 @@
+package duct
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dc "github.com/fsouza/go-dockerclient"
+	dtesting "github.com/fsouza/go-dockerclient/testing"
+)
+
+func TestRemoveNetworkRetry(t *testing.T) {
+	server, err := dtesting.NewServer("127.0.0.1:0", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	client, err := dc.NewClient(server.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	network, err := client.CreateNetwork(dc.CreateNetworkOptions{Name: "duct-test-network"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var attempts int32
+	server.CustomHandler("/networks/"+network.ID, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			if atomic.AddInt32(&attempts, 1) < 3 {
+				http.Error(w, "error while removing network: network duct-test-network has active endpoints", http.StatusForbidden)
+				return
+			}
+		}
+		server.DefaultHandler().ServeHTTP(w, r)
+	}))
+
+	c := New(Manifest{}, WithNewNetwork("duct-test-network"))
+	c.netID = network.ID
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if c.removeNetwork(ctx, client) {
+		t.Fatal("network was removed before the timeout")
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	atomic.StoreInt32(&attempts, 0)
+	if !c.removeNetwork(ctx, client) {
+		t.Fatal("network was not removed")
+	}
+
+	if n := atomic.LoadInt32(&attempts); n != 3 {
+		t.Fatalf("unexpected number of attempts: %d", n)
+	}
+
+	if c.netID != "" {
+		t.Fatal("network is still recorded")
+	}
+}
+
+func TestTeardownWithoutDaemon(t *testing.T) {
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+
+	dir := t.TempDir()
+	c := New(Manifest{{Name: "web", Image: "nginx", TempMounts: []string{"/data"}}},
+		WithDockerContext("duct-does-not-exist"),
+		WithHooks(Hooks{PostTeardown: [][]string{{"touch", "torn-down"}}, Dir: dir, Output: io.Discard}),
+	)
+
+	mounts, err := c.manifest[0].makeTempMounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.hooksDue = true
+
+	if err := c.Teardown(context.Background()); err == nil {
+		t.Fatal("teardown without a daemon succeeded")
+	}
+
+	if _, err := os.Stat(mounts[0].Source); !os.IsNotExist(err) {
+		t.Fatalf("temporary mount was left behind: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "torn-down")); err != nil {
+		t.Fatalf("post-teardown hook did not run: %v", err)
+	}
+}
+
+func TestPruneNetworks(t *testing.T) {
+	server, err := dtesting.NewServer("127.0.0.1:0", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	t.Setenv("DOCKER_HOST", server.URL())
+
+	client, err := dc.NewClient(server.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.PullImage(dc.PullImageOptions{Repository: "nginx"}, dc.AuthConfiguration{}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctr, err := client.CreateContainer(dc.CreateContainerOptions{Config: &dc.Config{Image: "nginx"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"stale", "used"} {
+		network, err := client.CreateNetwork(dc.CreateNetworkOptions{Name: name, Labels: map[string]string{networkLabel: "true"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if name == "used" {
+			if err := client.ConnectNetwork(network.ID, dc.NetworkConnectionOptions{Container: ctr.ID}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	var filters string
+	server.CustomHandler("/networks", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if f := r.URL.Query().Get("filters"); f != "" {
+			filters = f
+		}
+		server.DefaultHandler().ServeHTTP(w, r)
+	}))
+
+	if err := PruneNetworks(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(filters, networkLabel) {
+		t.Fatalf("networks were not filtered by label: %q", filters)
+	}
+
+	networks, err := client.ListNetworks()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(networks) != 1 || networks[0].Name != "used" {
+		t.Fatalf("unexpected networks after pruning: %v", networks)
+	}
+}
@@ -0,0 +1,101 @@
+package duct
+
+import (
+	"sort"
+	"time"
+)
+
+// Timing is how long the phases of launching a container took.
+type Timing struct {
+	// Container is the name of the container in the manifest.
+	Container string
+
+	// Pull includes building the image of containers with a Build.
+	Pull   time.Duration
+	Create time.Duration
+	Start  time.Duration
+	// Ready includes the BootWait and the readiness checks, or waiting for
+	// the container to exit if WaitForExit is set.
+	Ready time.Duration
+	// PostCommands is the time taken by all of them.
+	PostCommands time.Duration
+}
+
+// Total is the sum of the phases.
+func (t Timing) Total() time.Duration {
+	return t.Pull + t.Create + t.Start + t.Ready + t.PostCommands
+}
+
+// WithTimingSummary logs how long launching each container took at the end
+// of Launch, slowest first; see Timings.
+func WithTimingSummary() Options {
+	return Options{optionTimingSummary: true}
+}
+
+// Timings returns how long the phases of launching each container took in
+// the last Launch, in the order of the manifest. Phases which were skipped or
+// did not finish are zero.
+func (c *Composer) Timings() []Timing {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	timings := []Timing{}
+	for _, cont := range c.manifest {
+		timing := Timing{Container: cont.Name}
+		if t, ok := c.timings[cont.Name]; ok {
+			timing = *t
+		}
+		timings = append(timings, timing)
+	}
+
+	return timings
+}
+
+// recordTiming records that the phase of launching the container took d.
+func (c *Composer) recordTiming(cont *Container, phase string, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.timings == nil {
+		c.timings = map[string]*Timing{}
+	}
+
+	t, ok := c.timings[cont.Name]
+	if !ok {
+		t = &Timing{Container: cont.Name}
+		c.timings[cont.Name] = t
+	}
+
+	switch phase {
+	case "pull", "build":
+		t.Pull = d
+	case "create":
+		t.Create = d
+	case "start":
+		t.Start = d
+	case "ready":
+		t.Ready = d
+	case "post-command":
+		t.PostCommands += d
+	}
+}
+
+// resetTimings forgets the timings of the last launch.
+func (c *Composer) resetTimings() {
+	c.mu.Lock()
+	c.timings = nil
+	c.mu.Unlock()
+}
+
+// logTimings logs the timing summary, slowest container first.
+func (c *Composer) logTimings() {
+	timings := c.Timings()
+	sort.SliceStable(timings, func(i, j int) bool { return timings[i].Total() > timings[j].Total() })
+
+	c.logf(LogInfo, "Launch timings, slowest first:")
+	for _, t := range timings {
+		c.logf(LogInfo, "  [%s] %v (pull %v, create %v, start %v, ready %v, post-commands %v)",
+			t.Container, t.Total().Round(time.Millisecond), t.Pull.Round(time.Millisecond), t.Create.Round(time.Millisecond),
+			t.Start.Round(time.Millisecond), t.Ready.Round(time.Millisecond), t.PostCommands.Round(time.Millisecond))
+	}
+}
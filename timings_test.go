@@ -0,0 +1,31 @@
+package duct_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/erikh/duct"
+	"github.com/erikh/duct/ductfake"
+)
+
+func TestTimings(t *testing.T) {
+	r := ductfake.Start(t)
+
+	c := r.Launch(t, duct.Manifest{
+		{Name: "db", Image: "postgres:latest", BootWait: 200 * time.Millisecond},
+		{Name: "web", Image: "nginx:latest", PostCommands: [][]string{{"nginx", "-t"}}},
+	}, duct.WithTimingSummary())
+
+	timings := c.Timings()
+	if len(timings) != 2 || timings[0].Container != "db" || timings[1].Container != "web" {
+		t.Fatalf("unexpected timings: %+v", timings)
+	}
+
+	if timings[0].Ready < 200*time.Millisecond || timings[0].Total() < timings[0].Ready {
+		t.Fatalf("boot wait was not timed: %+v", timings[0])
+	}
+
+	if timings[1].Create == 0 || timings[1].PostCommands == 0 {
+		t.Fatalf("phases were not timed: %+v", timings[1])
+	}
+}
@@ -0,0 +1,46 @@
+package duct
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation name of duct's spans.
+const tracerName = "github.com/erikh/duct"
+
+// WithTracerProvider records OpenTelemetry spans of Launch, Teardown, and the
+// phases of each container (see LogEvent) with the provider. Spans are
+// children of the span in the context given to Launch and Teardown, if any.
+func WithTracerProvider(provider trace.TracerProvider) Options {
+	return Options{optionTracerProvider: provider}
+}
+
+func (c *Composer) tracer() trace.Tracer {
+	if provider, ok := c.options[optionTracerProvider].(trace.TracerProvider); ok {
+		return provider.Tracer(tracerName)
+	}
+
+	return trace.NewNoopTracerProvider().Tracer(tracerName)
+}
+
+// trace starts a span about the container, or the composition if it is nil.
+// The returned function ends it with its error, if any.
+func (c *Composer) trace(ctx context.Context, name string, cont *Container) (context.Context, func(error)) {
+	opts := []trace.SpanStartOption{}
+	if cont != nil {
+		opts = append(opts, trace.WithAttributes(attribute.String("duct.container", cont.Name)))
+	}
+
+	ctx, span := c.tracer().Start(ctx, name, opts...)
+
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
@@ -0,0 +1,51 @@
+package duct_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/erikh/duct"
+	"github.com/erikh/duct/ductfake"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	r := ductfake.Start(t)
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	c := r.Launch(t, duct.Manifest{
+		{
+			Name:         "nginx",
+			Image:        "nginx:latest",
+			PostCommands: [][]string{{"nginx", "-t"}},
+		},
+	}, duct.WithTracerProvider(provider))
+
+	if err := c.Teardown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+
+	for _, name := range []string{"duct.pull", "duct.create", "duct.start", "duct.ready", "duct.post-command", "duct.remove"} {
+		span, ok := spans[name]
+		if !ok {
+			t.Fatalf("no %s span: %v", name, spans)
+		}
+
+		parent := "duct.Launch"
+		if name == "duct.remove" {
+			parent = "duct.Teardown"
+		}
+
+		if span.Parent().SpanID() != spans[parent].SpanContext().SpanID() {
+			t.Fatalf("%s is not a child of %s", name, parent)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package duct
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+// tunnelImage is the image of the relay container used by WithTunnel.
+const tunnelImage = "alpine/socat:latest"
+
+// WithTunnel makes container ports reachable through a relay container on
+// the network, for when the docker daemon is on another machine and
+// forwarded ports are not reachable from this one. Endpoint, HostAddrs and
+// the wait strategies then return local addresses whose connections are
+// relayed over the docker API to the container, whether the port is
+// forwarded or not.
+func WithTunnel() Options {
+	return Options{optionTunnel: true}
+}
+
+// startTunnel launches the relay container.
+func (c *Composer) startTunnel(ctx context.Context) error {
+	image := c.mirror(tunnelImage)
+
+	c.logf(LogInfo, "Pulling docker image: [%s]", image)
+	if err := c.pullImage(ctx, image); err != nil {
+		return err
+	}
+
+	c.logf(LogInfo, "Creating tunnel relay")
+	ctr, err := c.client.CreateContainer(dc.CreateContainerOptions{
+		Context: ctx,
+		Config: &dc.Config{
+			Image:      image,
+			Entrypoint: []string{"tail", "-f", "/dev/null"},
+		},
+		HostConfig: &dc.HostConfig{
+			NetworkMode: c.netID,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	c.tunnelID = ctr.ID
+
+	return c.client.StartContainerWithContext(ctr.ID, nil, ctx)
+}
+
+// removeTunnel closes the tunnels and removes the relay container. It returns
+// false if that failed.
+func (c *Composer) removeTunnel(ctx context.Context, client *dc.Client) bool {
+	c.closeTunnels()
+
+	if c.tunnelID == "" {
+		return true
+	}
+
+	c.logf(LogInfo, "Removing tunnel relay")
+	var notFound *dc.NoSuchContainer
+	if err := client.RemoveContainer(dc.RemoveContainerOptions{
+		ID:      c.tunnelID,
+		Force:   true,
+		Context: ctx,
+	}); err != nil && !errors.As(err, &notFound) {
+		c.logf(LogError, "Error removing tunnel relay: %v", err)
+		return false
+	}
+
+	c.tunnelID = ""
+
+	return true
+}
+
+// closeTunnels forgets the local addresses of the tunnels, whose listeners
+// are closed by stopBackground.
+func (c *Composer) closeTunnels() {
+	c.mu.Lock()
+	c.tunnels = nil
+	c.mu.Unlock()
+}
+
+// tunnel returns the local address of the tunnel to the container's tcp port,
+// opening it if necessary.
+func (c *Composer) tunnel(cont *Container, port int) (string, error) {
+	key := fmt.Sprintf("%s:%d", cont.Name, port)
+
+	c.mu.Lock()
+	if addr, ok := c.tunnels[key]; ok {
+		c.mu.Unlock()
+		return addr, nil
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		c.mu.Unlock()
+		return "", err
+	}
+
+	if c.tunnels == nil {
+		c.tunnels = map[string]string{}
+	}
+	c.tunnels[key] = l.Addr().String()
+	c.mu.Unlock()
+
+	c.logContainer(LogInfo, cont.Name, "Tunneling %s to [%s] port %d", l.Addr(), cont.Name, port)
+
+	c.background(context.Background(), func(ctx context.Context) {
+		go func() {
+			<-ctx.Done()
+			l.Close()
+		}()
+
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go c.relay(ctx, cont, port, conn)
+		}
+	})
+
+	return l.Addr().String(), nil
+}
+
+// relay copies the connection to and from the container's port with socat in
+// the relay container. The container's address is looked up for every
+// connection, as it may change when the container is restarted.
+func (c *Composer) relay(ctx context.Context, cont *Container, port int, conn net.Conn) {
+	defer conn.Close()
+
+	ip, err := c.containerIP(ctx, cont)
+	if err != nil {
+		c.logContainer(LogError, cont.Name, "Tunnel to [%s] failed: %v", cont.Name, err)
+		return
+	}
+
+	exec, err := c.client.CreateExec(dc.CreateExecOptions{
+		Context:      ctx,
+		Container:    c.tunnelID,
+		Cmd:          []string{"socat", "STDIO", fmt.Sprintf("TCP:%s", net.JoinHostPort(ip, fmt.Sprint(port)))},
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		c.logContainer(LogError, cont.Name, "Tunnel to [%s] failed: %v", cont.Name, err)
+		return
+	}
+
+	if err := c.client.StartExec(exec.ID, dc.StartExecOptions{
+		Context:      ctx,
+		InputStream:  conn,
+		OutputStream: conn,
+		ErrorStream:  io.Discard,
+	}); err != nil {
+		c.logContainer(LogError, cont.Name, "Tunnel to [%s] failed: %v", cont.Name, err)
+	}
+}
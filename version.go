@@ -0,0 +1,156 @@
+package duct
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+// minAPIVersion is the oldest docker API version duct works with.
+const minAPIVersion = "1.25"
+
+// feature is something a container uses which needs a newer docker API than
+// duct does.
+type feature struct {
+	name    string
+	version string
+}
+
+// negotiateAPIVersion returns the API version to use with the daemon: the one
+// requested with DOCKER_API_VERSION, or else the daemon's. It fails if the
+// daemon does not support that or the version duct needs.
+func negotiateAPIVersion(ctx context.Context, client *dc.Client) (dc.APIVersion, error) {
+	env, err := client.VersionWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting docker version: %w", err)
+	}
+
+	server, err := dc.NewAPIVersion(env.Get("ApiVersion"))
+	if err != nil {
+		return nil, fmt.Errorf("docker daemon reported an invalid API version: %w", err)
+	}
+
+	version := server
+	if requested := os.Getenv("DOCKER_API_VERSION"); requested != "" {
+		version, err = dc.NewAPIVersion(requested)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DOCKER_API_VERSION: %w", err)
+		}
+
+		if version.GreaterThan(server) {
+			return nil, fmt.Errorf("DOCKER_API_VERSION is %s, but the docker daemon only supports up to %s", version, server)
+		}
+	}
+
+	if err := requireAPIVersion(version, feature{name: "duct", version: minAPIVersion}); err != nil {
+		return nil, err
+	}
+
+	return version, nil
+}
+
+// versionedClientKey identifies a client made by versionedClient.
+type versionedClientKey struct {
+	client  *dc.Client
+	version string
+}
+
+// versionedClient returns a client like the given one which makes its
+// requests with the API version, so the daemon answers them like a daemon of
+// that version. The client shares its connections with the given one, and is
+// pooled; it learns the daemon's API version before it is returned.
+func versionedClient(client *dc.Client, version dc.APIVersion) (*dc.Client, error) {
+	key := versionedClientKey{client: client, version: version.String()}
+
+	clientPool.Lock()
+	versioned, ok := clientPool.versioned[key]
+	if !ok {
+		var err error
+		versioned, err = newVersionedClient(client, version)
+		if err != nil {
+			clientPool.Unlock()
+			return nil, err
+		}
+
+		clientPool.versioned[key] = versioned
+	}
+	clientPool.Unlock()
+
+	learnAPIVersion(versioned)
+
+	return versioned, nil
+}
+
+// newVersionedClient returns a new client like the given one which makes its
+// requests with the API version; see versionedClient.
+func newVersionedClient(client *dc.Client, version dc.APIVersion) (*dc.Client, error) {
+	endpoint := client.Endpoint()
+	if client.TLSConfig != nil {
+		if u, err := url.Parse(endpoint); err == nil && u.Scheme == "tcp" {
+			u.Scheme = "https"
+			endpoint = u.String()
+		}
+	}
+
+	versioned, err := dc.NewVersionedClient(endpoint, version.String())
+	if err != nil {
+		return nil, err
+	}
+
+	versioned.HTTPClient = client.HTTPClient
+	versioned.Dialer = client.Dialer
+	versioned.TLSConfig = client.TLSConfig
+	versioned.SkipServerVersionCheck = true
+
+	return versioned, nil
+}
+
+// requireAPIVersion returns an error if the feature needs a newer API version.
+func requireAPIVersion(version dc.APIVersion, f feature) error {
+	required, err := dc.NewAPIVersion(f.version)
+	if err != nil {
+		return err
+	}
+
+	if version.LessThan(required) {
+		return fmt.Errorf("%s requires docker API version %s, but %s is in use", f.name, required, version)
+	}
+
+	return nil
+}
+
+// features returns the features the container needs a newer API version for.
+func (c *Composer) features(cont *Container) []feature {
+	features := []feature{}
+
+	if c.hostGateway(cont) && len(cont.ExtraHosts) == 0 {
+		features = append(features, feature{name: "host-gateway", version: "1.41"})
+	}
+
+	if cont.Platform != "" {
+		features = append(features, feature{name: "platform", version: "1.32"})
+	}
+
+	if cont.CgroupnsMode != "" {
+		features = append(features, feature{name: "cgroupns", version: "1.41"})
+	}
+
+	return features
+}
+
+// checkFeatures returns an error for the first feature of the manifest the API
+// version is too old for, so it is found before anything is launched.
+func (c *Composer) checkFeatures() error {
+	for _, cont := range c.manifest {
+		for _, f := range c.features(cont) {
+			if err := requireAPIVersion(c.apiVersion, f); err != nil {
+				return fmt.Errorf("[%s] %w", cont.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
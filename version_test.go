@@ -0,0 +1,118 @@
+package duct
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+func TestNegotiateAPIVersion(t *testing.T) {
+	client, err := dc.NewClient("unix://" + filepath.Join(fakeDaemon(t, "1.41"), "docker.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("DOCKER_API_VERSION", "")
+
+	version, err := negotiateAPIVersion(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if version.String() != "1.41" {
+		t.Fatalf("daemon version was not used: %s", version)
+	}
+
+	t.Setenv("DOCKER_API_VERSION", "1.30")
+
+	version, err = negotiateAPIVersion(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if version.String() != "1.30" {
+		t.Fatalf("requested version was not used: %s", version)
+	}
+
+	t.Setenv("DOCKER_API_VERSION", "1.43")
+
+	if _, err := negotiateAPIVersion(context.Background(), client); err == nil {
+		t.Fatal("negotiated a version newer than the daemon's")
+	}
+}
+
+func TestCheckFeatures(t *testing.T) {
+	c := New(Manifest{
+		{Name: "plain", Image: "debian:latest"},
+		{Name: "arm", Image: "debian:latest", Platform: "linux/arm64"},
+	})
+
+	c.apiVersion, _ = dc.NewAPIVersion("1.30")
+
+	err := c.checkFeatures()
+	if err == nil || !strings.Contains(err.Error(), "[arm] platform requires docker API version 1.32") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	c.apiVersion, _ = dc.NewAPIVersion("1.32")
+
+	if err := c.checkFeatures(); err != nil {
+		t.Fatal(err)
+	}
+
+	c = New(Manifest{{Name: "plain", Image: "debian:latest"}}, WithHostGateway())
+	c.apiVersion, _ = dc.NewAPIVersion("1.40")
+
+	if err := c.checkFeatures(); err == nil {
+		t.Fatal("host-gateway was allowed on an old daemon")
+	}
+
+	c = New(Manifest{{Name: "isolated", Image: "debian:latest", CgroupnsMode: "private"}})
+	c.apiVersion, _ = dc.NewAPIVersion("1.40")
+
+	if err := c.checkFeatures(); err == nil || !strings.Contains(err.Error(), "[isolated] cgroupns requires docker API version 1.41") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestVersionedClient(t *testing.T) {
+	paths := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/version") {
+			w.Write([]byte(`{"ApiVersion":"1.41"}`))
+			return
+		}
+		paths <- r.URL.Path
+		w.Write([]byte("[]"))
+	}))
+	defer srv.Close()
+
+	base, err := dc.NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	version, _ := dc.NewAPIVersion("1.30")
+	client, err := versionedClient(base, version)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pooled, err := versionedClient(base, version); err != nil || pooled != client {
+		t.Fatalf("client was not pooled: %v", err)
+	}
+
+	if _, err := client.ListContainers(dc.ListContainersOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if path := <-paths; path != "/v1.30/containers/json" {
+		t.Fatalf("the negotiated version was not requested: %s", path)
+	}
+}
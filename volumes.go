@@ -0,0 +1,64 @@
+package duct
+
+import (
+	"context"
+	"errors"
+
+	dc "github.com/fsouza/go-dockerclient"
+)
+
+// WithVolumes declares named volumes to share between containers in the
+// manifest; see Container.Volumes. They are created by Launch and removed by
+// Teardown.
+func WithVolumes(names ...string) Options {
+	return Options{optionVolumes: names}
+}
+
+// createVolumes creates the volumes declared with WithVolumes.
+func (c *Composer) createVolumes(ctx context.Context) error {
+	names, _ := c.options[optionVolumes].([]string)
+
+	for _, name := range names {
+		c.logf(LogInfo, "Creating volume: [%s]", name)
+		if _, err := c.client.CreateVolume(dc.CreateVolumeOptions{Name: name, Context: ctx}); err != nil {
+			return err
+		}
+		c.volumes = append(c.volumes, name)
+	}
+
+	return nil
+}
+
+// removeVolumes removes the volumes created by Launch. It returns false if
+// any could not be removed; those are tried again the next time.
+func (c *Composer) removeVolumes(ctx context.Context, client *dc.Client) bool {
+	remaining := []string{}
+
+	for _, name := range c.volumes {
+		c.logf(LogInfo, "Removing volume: [%s]", name)
+		err := client.RemoveVolumeWithOptions(dc.RemoveVolumeOptions{Name: name, Context: ctx})
+		if err != nil && !errors.Is(err, dc.ErrNoSuchVolume) {
+			c.logf(LogError, "Error removing volume: [%s] %v", name, err)
+			remaining = append(remaining, name)
+		}
+	}
+
+	c.volumes = remaining
+
+	return len(remaining) == 0
+}
+
+// volumeMounts returns the mounts for the container's Volumes.
+func (cont *Container) volumeMounts() []dc.HostMount {
+	mounts := []dc.HostMount{}
+
+	for name, target := range cont.Volumes {
+		mounts = append(mounts, dc.HostMount{
+			Source: name,
+			Type:   "volume",
+			Target: target,
+		})
+	}
+
+	return mounts
+}
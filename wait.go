@@ -0,0 +1,304 @@
+package duct
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// WaitStrategy is a readiness check for a container. It is run after the
+// container is started and its BootWait is consumed, but before any
+// PostCommands. See the WaitFor* functions for the provided implementations.
+type WaitStrategy func(ctx context.Context, c *Composer, cont *Container) error
+
+// waitInterval is the time between attempts of a wait strategy.
+const waitInterval = 100 * time.Millisecond
+
+// waitUntil runs check until it succeeds, the timeout elapses or the context
+// is canceled. A zero timeout waits until the context is canceled.
+func waitUntil(ctx context.Context, timeout time.Duration, check func(context.Context) error) error {
+	if timeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	for {
+		err := check(ctx)
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("gave up waiting: %w (last error: %v)", ctx.Err(), err)
+		case <-time.After(waitInterval):
+		}
+	}
+}
+
+// Retry calls fn until it succeeds, the timeout elapses or the context is
+// canceled, for writing an AliveFunc. It waits interval after the first
+// failure, and twice as long after each one after that, up to two seconds or
+// interval if that is longer. A zero timeout retries until the context is
+// canceled.
+func Retry(ctx context.Context, interval, timeout time.Duration, fn func() error) error {
+	if timeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	ceiling := maxRetryInterval
+	if interval > ceiling {
+		ceiling = interval
+	}
+
+	for {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("gave up retrying: %w (last error: %v)", ctx.Err(), err)
+		case <-time.After(interval):
+		}
+
+		if interval *= 2; interval > ceiling {
+			interval = ceiling
+		}
+	}
+}
+
+// waitForAddr is the basis of the network protocol strategies: it resolves
+// the forwarded port and runs check against a fresh connection until it
+// succeeds.
+func waitForAddr(port int, timeout time.Duration, check func(net.Conn) error) WaitStrategy {
+	return func(ctx context.Context, c *Composer, cont *Container) error {
+		return waitUntil(ctx, timeout, func(ctx context.Context) error {
+			addr, err := c.hostAddr(ctx, cont, port)
+			if err != nil {
+				return err
+			}
+
+			var d net.Dialer
+			conn, err := d.DialContext(ctx, "tcp", addr)
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+
+			if deadline, ok := ctx.Deadline(); ok {
+				conn.SetDeadline(deadline)
+			}
+
+			return check(conn)
+		})
+	}
+}
+
+// WaitForKafka waits until a Kafka broker answers a metadata request on the
+// forwarded container port, which is not the case for some time after the
+// port is accepting connections.
+func WaitForKafka(port int, timeout time.Duration) WaitStrategy {
+	return waitForAddr(port, timeout, checkKafka)
+}
+
+// WaitForAMQP waits until an AMQP 0-9-1 server (e.g. RabbitMQ) begins the
+// connection handshake on the forwarded container port.
+func WaitForAMQP(port int, timeout time.Duration) WaitStrategy {
+	return waitForAddr(port, timeout, checkAMQP)
+}
+
+const kafkaCorrelationID = 0x6475 // "du"
+
+// checkKafka sends a v0 metadata request and expects a response listing at
+// least one broker.
+func checkKafka(conn net.Conn) error {
+	clientID := "duct"
+
+	req := &bytes.Buffer{}
+	binary.Write(req, binary.BigEndian, int16(3)) // api key: metadata
+	binary.Write(req, binary.BigEndian, int16(0)) // api version
+	binary.Write(req, binary.BigEndian, int32(kafkaCorrelationID))
+	binary.Write(req, binary.BigEndian, int16(len(clientID)))
+	req.WriteString(clientID)
+	binary.Write(req, binary.BigEndian, int32(0)) // no topics
+
+	msg := &bytes.Buffer{}
+	binary.Write(msg, binary.BigEndian, int32(req.Len()))
+	msg.Write(req.Bytes())
+
+	if _, err := conn.Write(msg.Bytes()); err != nil {
+		return err
+	}
+
+	var resp struct {
+		Size          int32
+		CorrelationID int32
+		Brokers       int32
+	}
+
+	if err := binary.Read(conn, binary.BigEndian, &resp); err != nil {
+		return fmt.Errorf("reading kafka metadata response: %w", err)
+	}
+
+	if resp.CorrelationID != kafkaCorrelationID {
+		return fmt.Errorf("kafka metadata response had unexpected correlation id %d", resp.CorrelationID)
+	}
+
+	if resp.Brokers < 1 {
+		return errors.New("kafka metadata response did not list any brokers")
+	}
+
+	return nil
+}
+
+var amqpProtocolHeader = []byte("AMQP\x00\x00\x09\x01")
+
+// checkAMQP sends the AMQP 0-9-1 protocol header and expects the server to
+// answer with a connection.start method frame.
+func checkAMQP(conn net.Conn) error {
+	if _, err := conn.Write(amqpProtocolHeader); err != nil {
+		return err
+	}
+
+	// frame type (1), channel (2), size (4), class id (2), method id (2)
+	buf := make([]byte, 11)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return fmt.Errorf("reading amqp handshake: %w", err)
+	}
+
+	if bytes.HasPrefix(buf, []byte("AMQP")) {
+		return fmt.Errorf("amqp server rejected protocol version: %q", buf[:8])
+	}
+
+	if buf[0] != 1 || binary.BigEndian.Uint16(buf[7:9]) != 10 || binary.BigEndian.Uint16(buf[9:11]) != 10 {
+		return errors.New("amqp server did not send connection.start")
+	}
+
+	return nil
+}
+
+// probeReadTimeout bounds how long an attempt of a probe waits for the reply.
+const probeReadTimeout = 5 * time.Second
+
+// maxProbeReply is how much of a reply a probe reads looking for what it
+// expects.
+const maxProbeReply = 64 << 10
+
+// WaitForTCP waits until the server on the forwarded container port replies
+// to send with bytes containing expect, for protocols where accepting
+// connections does not mean the server is ready: e.g. "PING\r\n" and "+PONG"
+// for Redis. If send is empty, the server is expected to speak first.
+func WaitForTCP(port int, send, expect []byte, timeout time.Duration) WaitStrategy {
+	return waitForAddr(port, timeout, func(conn net.Conn) error {
+		return checkTCP(conn, send, expect)
+	})
+}
+
+func checkTCP(conn net.Conn, send, expect []byte) error {
+	if len(send) != 0 {
+		if _, err := conn.Write(send); err != nil {
+			return err
+		}
+	}
+
+	conn.SetReadDeadline(time.Now().Add(probeReadTimeout))
+
+	reply := []byte{}
+	buf := make([]byte, 4096)
+	for len(reply) < maxProbeReply {
+		n, err := conn.Read(buf)
+		reply = append(reply, buf[:n]...)
+
+		if bytes.Contains(reply, expect) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("expected %q, got %q: %w", expect, reply, err)
+		}
+	}
+
+	return fmt.Errorf("expected %q in the first %d bytes of the reply", expect, maxProbeReply)
+}
+
+// mqttConnect is an MQTT 3.1.1 CONNECT packet with a clean session, a keep
+// alive of 60 seconds and the client id "duct".
+var mqttConnect = []byte{
+	0x10, 16, // packet type, remaining length
+	0, 4, 'M', 'Q', 'T', 'T', 4, 2, 0, 60, // protocol name and level, flags, keep alive
+	0, 4, 'd', 'u', 'c', 't', // client id
+}
+
+// WaitForMQTT waits until an MQTT broker answers a connection on the
+// forwarded container port with a CONNACK, whether it accepts the
+// connection or not.
+func WaitForMQTT(port int, timeout time.Duration) WaitStrategy {
+	return WaitForTCP(port, mqttConnect, []byte{0x20, 2}, timeout)
+}
+
+// websocketGUID is appended to the key of a WebSocket handshake to compute
+// the accept header of the reply.
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WaitForWebSocket waits until the server on the forwarded container port
+// completes a WebSocket handshake on the path, e.g. "/ws".
+func WaitForWebSocket(port int, path string, timeout time.Duration) WaitStrategy {
+	return waitForAddr(port, timeout, func(conn net.Conn) error {
+		return checkWebSocket(conn, path)
+	})
+}
+
+func checkWebSocket(conn net.Conn, path string) error {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	req, err := http.NewRequest(http.MethodGet, "http://"+conn.RemoteAddr().String()+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", key)
+
+	if err := req.Write(conn); err != nil {
+		return err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(probeReadTimeout))
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return fmt.Errorf("reading websocket handshake: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return fmt.Errorf("websocket handshake failed with status %s", resp.Status)
+	}
+
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	if resp.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(sum[:]) {
+		return errors.New("websocket handshake had an invalid accept header")
+	}
+
+	return nil
+}
@@ -0,0 +1,183 @@
+package duct
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveOnce accepts one connection on a local listener and hands it to fn.
+func serveOnce(t *testing.T, fn func(net.Conn)) net.Conn {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fn(conn)
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func TestCheckKafka(t *testing.T) {
+	respond := func(brokers int32) func(net.Conn) {
+		return func(conn net.Conn) {
+			var size int32
+			if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+				return
+			}
+
+			req := make([]byte, size)
+			if _, err := io.ReadFull(conn, req); err != nil {
+				return
+			}
+
+			resp := &bytes.Buffer{}
+			binary.Write(resp, binary.BigEndian, int32(8))
+			resp.Write(req[4:8]) // correlation id
+			binary.Write(resp, binary.BigEndian, brokers)
+			conn.Write(resp.Bytes())
+		}
+	}
+
+	if err := checkKafka(serveOnce(t, respond(1))); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkKafka(serveOnce(t, respond(0))); err == nil {
+		t.Fatal("kafka check passed without any brokers")
+	}
+
+	if err := checkKafka(serveOnce(t, func(net.Conn) {})); err == nil {
+		t.Fatal("kafka check passed on a closed connection")
+	}
+}
+
+func TestCheckAMQP(t *testing.T) {
+	respond := func(reply []byte) func(net.Conn) {
+		return func(conn net.Conn) {
+			buf := make([]byte, len(amqpProtocolHeader))
+			if _, err := io.ReadFull(conn, buf); err != nil {
+				return
+			}
+			conn.Write(reply)
+		}
+	}
+
+	start := []byte{1, 0, 0, 0, 0, 0, 4, 0, 10, 0, 10}
+	if err := checkAMQP(serveOnce(t, respond(start))); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkAMQP(serveOnce(t, respond([]byte("AMQP\x00\x00\x09\x01\x00\x00\x00")))); err == nil {
+		t.Fatal("amqp check passed on a rejected protocol header")
+	}
+}
+
+func TestRetry(t *testing.T) {
+	attempts := 0
+	err := Retry(context.Background(), time.Millisecond, time.Second, func() error {
+		if attempts++; attempts < 3 {
+			return errors.New("not yet")
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Fatalf("unexpected result after %d attempts: %v", attempts, err)
+	}
+
+	before := time.Now()
+	err = Retry(context.Background(), 10*time.Millisecond, 100*time.Millisecond, func() error {
+		return errors.New("never")
+	})
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "never") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if elapsed := time.Since(before); elapsed > time.Second {
+		t.Fatalf("timeout was not respected: %v", elapsed)
+	}
+}
+
+func TestCheckTCP(t *testing.T) {
+	pong := func(conn net.Conn) {
+		buf := make([]byte, 6)
+		if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "PING\r\n" {
+			return
+		}
+		// reply in pieces, as servers may
+		conn.Write([]byte("+PO"))
+		conn.Write([]byte("NG\r\n"))
+	}
+
+	if err := checkTCP(serveOnce(t, pong), []byte("PING\r\n"), []byte("+PONG")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkTCP(serveOnce(t, func(net.Conn) {}), []byte("PING\r\n"), []byte("+PONG")); err == nil {
+		t.Fatal("tcp check passed on a closed connection")
+	}
+
+	banner := func(conn net.Conn) { conn.Write([]byte("220 mail ESMTP\r\n")) }
+	if err := checkTCP(serveOnce(t, banner), nil, []byte("220 ")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckWebSocket(t *testing.T) {
+	upgrade := func(status string, accept func(key string) string) func(net.Conn) {
+		return func(conn net.Conn) {
+			req, err := http.ReadRequest(bufio.NewReader(conn))
+			if err != nil || req.URL.Path != "/ws" {
+				return
+			}
+
+			key := req.Header.Get("Sec-WebSocket-Key")
+			fmt.Fprintf(conn, "HTTP/1.1 %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", status, accept(key))
+		}
+	}
+
+	valid := func(key string) string {
+		sum := sha1.Sum([]byte(key + websocketGUID))
+		return base64.StdEncoding.EncodeToString(sum[:])
+	}
+
+	if err := checkWebSocket(serveOnce(t, upgrade("101 Switching Protocols", valid)), "/ws"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkWebSocket(serveOnce(t, upgrade("404 Not Found", valid)), "/ws"); err == nil {
+		t.Fatal("websocket check passed without an upgrade")
+	}
+
+	invalid := func(string) string { return "invalid" }
+	if err := checkWebSocket(serveOnce(t, upgrade("101 Switching Protocols", invalid)), "/ws"); err == nil {
+		t.Fatal("websocket check passed with an invalid accept header")
+	}
+}
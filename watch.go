@@ -0,0 +1,124 @@
+package duct
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"time"
+)
+
+// Watch rebuilds the images of the containers with a Build when the files of
+// their build context or dockerfile change, and then recreates just those
+// containers with Recreate, for a local development loop. Files are checked
+// for changes every interval. A failed build or recreate is logged, and tried
+// again after the next change. Watch returns nil once ctx is done.
+func (c *Composer) Watch(ctx context.Context, interval time.Duration) error {
+	if c.client == nil {
+		return errors.New("the composition has not been launched")
+	}
+
+	type watched struct {
+		build Build
+		names []string
+		state string
+	}
+
+	images := map[string]*watched{}
+	order := []string{}
+
+	for _, cont := range c.manifest {
+		if cont.Build == nil {
+			continue
+		}
+
+		spec, err := c.resolve(cont)
+		if err != nil {
+			return err
+		}
+
+		w, ok := images[spec.Image]
+		if !ok {
+			state, err := cont.Build.state()
+			if err != nil {
+				return err
+			}
+
+			w = &watched{build: *cont.Build, state: state}
+			images[spec.Image] = w
+			order = append(order, spec.Image)
+		}
+		w.names = append(w.names, cont.Name)
+	}
+
+	if len(images) == 0 {
+		return errors.New("no container in the manifest has a Build to watch")
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		for _, image := range order {
+			w := images[image]
+
+			state, err := w.build.state()
+			if err != nil {
+				c.logf(LogError, "Error watching build of image [%s]: %v", image, err)
+				continue
+			}
+
+			if state == w.state {
+				continue
+			}
+			w.state = state
+
+			c.logf(LogInfo, "Build context of image [%s] changed; rebuilding", image)
+			if err := c.buildImage(ctx, image, w.build, true); err != nil {
+				c.logf(LogError, "Error rebuilding image: %v", err)
+				continue
+			}
+
+			for _, name := range w.names {
+				if err := c.Recreate(ctx, name, func(*Container) {}); err != nil {
+					c.logf(LogError, "Error recreating container: [%s] %v", name, err)
+				}
+			}
+		}
+	}
+}
+
+// state returns a digest of the names, sizes, modes and modification times
+// of the files in the context of the build, the dockerfile among them, which
+// changes when any of them does.
+func (b Build) state() (string, error) {
+	h := sha256.New()
+
+	err := filepath.Walk(b.dir(), func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+
+		fmt.Fprintf(h, "%s\x00%d\x00%v\x00%d\n", path, info.Size(), info.Mode(), info.ModTime().UnixNano())
+
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
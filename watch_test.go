@@ -0,0 +1,65 @@
+package duct_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/erikh/duct"
+	"github.com/erikh/duct/ductfake"
+)
+
+func TestWatch(t *testing.T) {
+	r := ductfake.Start(t)
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := r.Launch(t, duct.Manifest{
+		{Name: "db", Image: "postgres:latest"},
+		{Name: "app", Image: "app:dev", Build: &duct.Build{Context: dir, Dockerfile: "Dockerfile"}},
+	})
+
+	if _, err := r.Client().InspectImage("app:dev"); err != nil {
+		t.Fatalf("image was not built: %v", err)
+	}
+
+	app, err := r.Container("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := r.Container("db")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() { errs <- c.Watch(ctx, 10*time.Millisecond) }()
+
+	time.Sleep(50 * time.Millisecond)
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for {
+		if ctr, err := r.Container("app"); err == nil && ctr.ID != app.ID && ctr.State.Running {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+
+	if ctr, err := r.Container("db"); err != nil || ctr.ID != db.ID {
+		t.Fatalf("unchanged container was recreated: %v", err)
+	}
+}